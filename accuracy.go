@@ -0,0 +1,153 @@
+package hlld
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+const (
+	// accuracyBatchSize is the number of keys sent per command
+	// when measuring accuracy
+	accuracyBatchSize = 1000
+)
+
+// AccuracyReport contains the results of an accuracy measurement
+type AccuracyReport struct {
+	// SetName is the name of the set used
+	SetName string
+
+	// Keys is the number of unique keys added to the set
+	Keys int
+
+	// Precision is the precision reported by the server
+	Precision uint64
+
+	// Size is the cardinality estimated by the server
+	Size uint64
+
+	// ObservedError is the relative error of the estimate
+	ObservedError float64
+
+	// TheoreticalError is the expected standard error for the precision
+	TheoreticalError float64
+}
+
+// TheoreticalError returns the expected standard error of a
+// HyperLogLog with the given number of precision bits
+func TheoreticalError(precision uint64) float64 {
+	return 1.04 / math.Sqrt(float64(uint64(1)<<precision))
+}
+
+// MeasureAccuracy is used to create a new set, add the given number of
+// unique random keys to it, and compare the estimated cardinality reported
+// by the server against the expected error for the precision. If the
+// precision is zero, the default create options of the client or the
+// server are used. The set is left in place if the measurement succeeds,
+// and otherwise dropped on a best-effort basis.
+func MeasureAccuracy(client *Client, name string, keys int, precision int) (report *AccuracyReport, err error) {
+	if keys <= 0 {
+		return nil, fmt.Errorf("number of keys must be positive")
+	}
+
+	// Create the set
+	create, err := NewCreateCommand(name)
+	if err != nil {
+		return nil, err
+	}
+	create.Precision = precision
+	client.config.DefaultCreateOptions.Apply(create)
+	if err := executeWait(client, create); err != nil {
+		return nil, err
+	}
+	if ok, err := create.Result(); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("failed to create set '%s'", name)
+	}
+
+	// Drop the set if the measurement fails
+	defer func() {
+		if err != nil {
+			if drop, dropErr := NewDropCommand(name); dropErr == nil {
+				executeWait(client, drop)
+			}
+		}
+	}()
+
+	// Use a random prefix so that the keys are unique across runs
+	prefixBuf := make([]byte, 8)
+	if _, err := rand.Read(prefixBuf); err != nil {
+		return nil, err
+	}
+	prefix := hex.EncodeToString(prefixBuf)
+
+	// Pipeline the keys in batches
+	var cmds []*SetKeysCommand
+	var futures []*Future
+	batch := make([]string, 0, accuracyBatchSize)
+	for i := 0; i < keys; i++ {
+		batch = append(batch, fmt.Sprintf("%s-%d", prefix, i))
+		if len(batch) < accuracyBatchSize && i != keys-1 {
+			continue
+		}
+		cmd, err := NewSetKeysCommand(name, batch)
+		if err != nil {
+			return nil, err
+		}
+		f, err := client.Execute(cmd)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+		futures = append(futures, f)
+		batch = make([]string, 0, accuracyBatchSize)
+	}
+
+	// Wait for all the batches
+	for idx, f := range futures {
+		if err := f.Error(); err != nil {
+			return nil, err
+		}
+		if ok, err := cmds[idx].Result(); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, fmt.Errorf("set '%s' does not exist", name)
+		}
+	}
+
+	// Read back the size
+	info, err := NewInfoCommand(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := executeWait(client, info); err != nil {
+		return nil, err
+	}
+	setInfo, ok, err := info.Result()
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("set '%s' does not exist", name)
+	}
+
+	report = &AccuracyReport{
+		SetName:          name,
+		Keys:             keys,
+		Precision:        setInfo.Precision,
+		Size:             setInfo.Size,
+		ObservedError:    math.Abs(float64(setInfo.Size)-float64(keys)) / float64(keys),
+		TheoreticalError: TheoreticalError(setInfo.Precision),
+	}
+	return report, nil
+}
+
+// executeWait is used to execute a command and wait for it to complete
+func executeWait(client *Client, cmd Command) error {
+	f, err := client.Execute(cmd)
+	if err != nil {
+		return err
+	}
+	return f.Error()
+}
@@ -0,0 +1,103 @@
+package hlld
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTheoreticalError(t *testing.T) {
+	if err := TheoreticalError(14); math.Abs(err-0.008125) > 1e-6 {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestMeasureAccuracy(t *testing.T) {
+	var lock sync.Mutex
+	keys := make(map[string]struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		parts := strings.Fields(line)
+		switch parts[0] {
+		case "create":
+			if line != "create foo precision=12\n" {
+				t.Errorf("bad: %q", line)
+			}
+			return "Done\n"
+		case "b":
+			lock.Lock()
+			for _, key := range parts[2:] {
+				keys[key] = struct{}{}
+			}
+			lock.Unlock()
+			return "Done\n"
+		case "info":
+			// Report a size that is 1% over
+			return "START\nprecision 12\nsize 2525\nEND\n"
+		}
+		return "Client Error: Command not supported\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	report, err := MeasureAccuracy(client, "foo", 2500, 12)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(keys) != 2500 {
+		t.Fatalf("bad: %d", len(keys))
+	}
+	if report.Keys != 2500 || report.Size != 2525 || report.Precision != 12 {
+		t.Fatalf("bad: %#v", report)
+	}
+	if math.Abs(report.ObservedError-0.01) > 1e-9 {
+		t.Fatalf("bad: %#v", report)
+	}
+	if report.TheoreticalError != TheoreticalError(12) {
+		t.Fatalf("bad: %#v", report)
+	}
+}
+
+func TestMeasureAccuracy_DropOnFailure(t *testing.T) {
+	var lock sync.Mutex
+	var dropped []string
+	addr, stop := testServer(t, func(conn int, line string) string {
+		parts := strings.Fields(line)
+		switch parts[0] {
+		case "create":
+			return "Done\n"
+		case "b":
+			return "Set does not exist\n"
+		case "drop":
+			lock.Lock()
+			dropped = append(dropped, parts[1])
+			lock.Unlock()
+			return "Done\n"
+		}
+		return "Client Error: Command not supported\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := MeasureAccuracy(client, "foo", 10, 12); err == nil {
+		t.Fatalf("expected error")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(dropped) != 1 || dropped[0] != "foo" {
+		t.Fatalf("bad: %v", dropped)
+	}
+}
@@ -0,0 +1,36 @@
+package hlld
+
+import (
+	"fmt"
+)
+
+// newAddCommand returns the command to add keys to a set, using a
+// SetKeyCommand for a single key and a SetKeysCommand otherwise
+func newAddCommand(name string, keys []string) (Command, error) {
+	if len(keys) == 1 {
+		return NewSetKeyCommand(name, keys[0])
+	}
+	return NewSetKeysCommand(name, keys)
+}
+
+// Add is used to add keys to a set, choosing the "s" command for a
+// single key and the "b" command for many. It returns false if the
+// set does not exist.
+func (c *Client) Add(name string, keys ...string) (bool, error) {
+	cmd, err := newAddCommand(name, keys)
+	if err != nil {
+		return false, err
+	}
+	f, err := c.Execute(cmd)
+	if err != nil {
+		return false, err
+	}
+	if err := f.Error(); err != nil {
+		return false, err
+	}
+	result, ok := f.Command().(boolResult)
+	if !ok {
+		return false, fmt.Errorf("set command replaced by a hook")
+	}
+	return result.Result()
+}
@@ -0,0 +1,50 @@
+package hlld
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClient_Add(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		lines = append(lines, line)
+		lock.Unlock()
+		if strings.Contains(line, " missing ") {
+			return "Set does not exist\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	if ok, err := client.Add("foo", "a"); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if ok, err := client.Add("foo", "a", "b"); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if ok, err := client.Add("missing", "a"); ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if _, err := client.Add("foo"); err == nil {
+		t.Fatalf("expect error")
+	}
+	if _, err := client.Add("foo", "a b"); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if strings.Join(lines, "") != "s foo a\nb foo a b\ns missing a\n" {
+		t.Fatalf("bad: %q", lines)
+	}
+}
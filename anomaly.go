@@ -0,0 +1,256 @@
+package hlld
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AnomalyType is the kind of anomaly flagged by an AnomalyDetector
+type AnomalyType int
+
+const (
+	// AnomalyGrowth is flagged when a set grows much faster than its
+	// baseline, such as from a bot or a duplicated producer
+	AnomalyGrowth AnomalyType = iota
+
+	// AnomalyFlatline is flagged when a set that normally grows stops
+	// growing, which often means an ingestion outage
+	AnomalyFlatline
+)
+
+func (t AnomalyType) String() string {
+	switch t {
+	case AnomalyGrowth:
+		return "growth"
+	case AnomalyFlatline:
+		return "flatline"
+	default:
+		return "unknown"
+	}
+}
+
+// Anomaly describes an anomalous sample of a set
+type Anomaly struct {
+	// Type is the kind of anomaly
+	Type AnomalyType
+
+	// Time is the time of the sample
+	Time time.Time
+
+	// Rate is the observed growth in unique values per minute
+	Rate float64
+
+	// Expected is the growth rate of the baseline, and StdDev
+	// is its standard deviation
+	Expected float64
+	StdDev   float64
+}
+
+func (a *Anomaly) String() string {
+	return fmt.Sprintf("%v: rate %.1f/min, expected %.1f±%.1f/min", a.Type, a.Rate, a.Expected, a.StdDev)
+}
+
+// DetectorConfig is used to configure an AnomalyDetector
+type DetectorConfig struct {
+	// Alpha is the weight of each new sample in the exponentially
+	// weighted baseline, between 0 and 1. Higher values adapt faster.
+	Alpha float64
+
+	// Threshold is the number of standard deviations above the
+	// baseline a growth rate must be to be flagged
+	Threshold float64
+
+	// Warmup is the number of rates observed before any anomalies are
+	// flagged, so the baseline can be established. With a Season, this
+	// applies to each slot of the season.
+	Warmup int
+
+	// FlatlineSamples is the number of consecutive samples without
+	// growth that are flagged as a flatline, if the baseline expects
+	// growth. Zero disables flatline detection.
+	FlatlineSamples int
+
+	// Season is an optional period over which the growth rate follows
+	// a pattern, such as a day. It is divided into Slots, each of which
+	// has its own baseline, so that a quiet night is not compared to a
+	// busy afternoon.
+	Season time.Duration
+	Slots  int
+
+	// OnAnomaly is invoked for each anomaly, and can be used to raise
+	// an alert. Flatlines are reported once until growth resumes.
+	OnAnomaly func(a Anomaly)
+}
+
+// DefaultDetectorConfig returns the default detector configuration
+func DefaultDetectorConfig() *DetectorConfig {
+	return &DetectorConfig{
+		Alpha:           0.1,
+		Threshold:       4,
+		Warmup:          10,
+		FlatlineSamples: 5,
+	}
+}
+
+// Validate is used to sanity check the configuration
+func (c *DetectorConfig) Validate() error {
+	switch {
+	case c.Alpha <= 0 || c.Alpha > 1:
+		return fmt.Errorf("alpha must be in (0, 1], got %v", c.Alpha)
+	case c.Threshold <= 0:
+		return fmt.Errorf("threshold must be positive, got %v", c.Threshold)
+	case c.Warmup < 0 || c.FlatlineSamples < 0:
+		return fmt.Errorf("warmup and flatline samples must not be negative")
+	case c.Season < 0:
+		return fmt.Errorf("season must not be negative, got %v", c.Season)
+	case c.Season > 0 && (c.Slots <= 0 || c.Season/time.Duration(c.Slots) <= 0):
+		return fmt.Errorf("a season requires a positive number of slots")
+	}
+	return nil
+}
+
+// baseline is an exponentially weighted mean and variance of growth rates
+type baseline struct {
+	mean     float64
+	variance float64
+	count    int
+}
+
+// update is used to add a rate to the baseline
+func (b *baseline) update(alpha, rate float64) {
+	if b.count == 0 {
+		b.mean = rate
+	} else {
+		diff := rate - b.mean
+		incr := alpha * diff
+		b.mean += incr
+		b.variance = (1 - alpha) * (b.variance + diff*incr)
+	}
+	b.count++
+}
+
+// stddev returns the standard deviation, with a floor relative to the
+// mean so that steady growth does not flag every small variation
+func (b *baseline) stddev() float64 {
+	return math.Max(math.Sqrt(b.variance), 0.05*math.Abs(b.mean))
+}
+
+// AnomalyDetector flags anomalous growth of a set, comparing the growth
+// rate between samples against an exponentially weighted baseline. It
+// can be fed samples directly, or attached to a CardinalityTracker.
+type AnomalyDetector struct {
+	config DetectorConfig
+
+	baselines []baseline
+	last      *Sample
+	flat      int
+	flagged   bool
+	lock      sync.Mutex
+}
+
+// NewAnomalyDetector creates a detector with the given configuration,
+// or the default configuration if nil
+func NewAnomalyDetector(config *DetectorConfig) (*AnomalyDetector, error) {
+	if config == nil {
+		config = DefaultDetectorConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	slots := 1
+	if config.Season > 0 {
+		slots = config.Slots
+	}
+	d := &AnomalyDetector{
+		config:    *config,
+		baselines: make([]baseline, slots),
+	}
+	return d, nil
+}
+
+// slot returns the baseline for rates starting at the given time
+func (d *AnomalyDetector) slot(t time.Time) *baseline {
+	if d.config.Season == 0 {
+		return &d.baselines[0]
+	}
+	width := d.config.Season / time.Duration(d.config.Slots)
+	offset := time.Duration(t.UnixNano()) % d.config.Season
+	return &d.baselines[int(offset/width)%d.config.Slots]
+}
+
+// Observe is used to add a sample, returning an anomaly if one is
+// flagged. OnAnomaly is invoked for the anomaly before returning.
+// Samples must be observed in order.
+func (d *AnomalyDetector) Observe(s Sample) *Anomaly {
+	anomaly := d.observe(s)
+	if anomaly != nil && d.config.OnAnomaly != nil {
+		d.config.OnAnomaly(*anomaly)
+	}
+	return anomaly
+}
+
+// observe is used to add a sample with the lock held
+func (d *AnomalyDetector) observe(s Sample) *Anomaly {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	last := d.last
+	d.last = &s
+	if last == nil {
+		return nil
+	}
+	elapsed := s.Time.Sub(last.Time).Minutes()
+	if elapsed <= 0 {
+		return nil
+	}
+	rate := (float64(s.Size) - float64(last.Size)) / elapsed
+
+	b := d.slot(last.Time)
+	warm := b.count > 0 && b.count >= d.config.Warmup
+	anomaly := &Anomaly{
+		Time:     s.Time,
+		Rate:     rate,
+		Expected: b.mean,
+		StdDev:   b.stddev(),
+	}
+
+	// Check for a flatline, reporting it once
+	if rate <= 0 {
+		d.flat++
+	} else {
+		d.flat = 0
+		d.flagged = false
+	}
+	if d.config.FlatlineSamples > 0 && d.flat >= d.config.FlatlineSamples && warm && b.mean > 0 {
+		if d.flagged {
+			return nil
+		}
+		d.flagged = true
+		anomaly.Type = AnomalyFlatline
+		return anomaly
+	}
+
+	// Check for growth, keeping outliers out of the baseline
+	if warm && rate > b.mean+d.config.Threshold*anomaly.StdDev {
+		anomaly.Type = AnomalyGrowth
+		return anomaly
+	}
+	if d.flat == 0 {
+		b.update(d.config.Alpha, rate)
+	}
+	return nil
+}
+
+// Detect is used to attach an anomaly detector to the tracker, which
+// observes every sample taken from then on
+func (t *CardinalityTracker) Detect(config *DetectorConfig) (*AnomalyDetector, error) {
+	d, err := NewAnomalyDetector(config)
+	if err != nil {
+		return nil, err
+	}
+	t.lock.Lock()
+	t.detectors = append(t.detectors, d)
+	t.lock.Unlock()
+	return d, nil
+}
@@ -0,0 +1,202 @@
+package hlld
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rateFeed feeds a detector samples a minute apart
+type rateFeed struct {
+	d    *AnomalyDetector
+	time time.Time
+	size uint64
+}
+
+// feed is used to observe samples growing by the given
+// rates, returning the anomalies flagged
+func (f *rateFeed) feed(rates ...uint64) []*Anomaly {
+	if f.time.IsZero() {
+		f.time = time.Unix(1400000000, 0).Truncate(24 * time.Hour)
+		f.d.Observe(Sample{Time: f.time, Size: f.size})
+	}
+	var out []*Anomaly
+	for _, rate := range rates {
+		f.time = f.time.Add(time.Minute)
+		f.size += rate
+		if a := f.d.Observe(Sample{Time: f.time, Size: f.size}); a != nil {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func TestDetectorConfig_Validate(t *testing.T) {
+	if err := DefaultDetectorConfig().Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	bad := []func(c *DetectorConfig){
+		func(c *DetectorConfig) { c.Alpha = 0 },
+		func(c *DetectorConfig) { c.Alpha = 1.5 },
+		func(c *DetectorConfig) { c.Threshold = 0 },
+		func(c *DetectorConfig) { c.Warmup = -1 },
+		func(c *DetectorConfig) { c.Season = time.Hour },
+		func(c *DetectorConfig) { c.Season = -time.Hour },
+	}
+	for idx, fn := range bad {
+		conf := DefaultDetectorConfig()
+		fn(conf)
+		if _, err := NewAnomalyDetector(conf); err == nil {
+			t.Fatalf("expect error %d", idx)
+		}
+	}
+}
+
+func TestAnomalyDetector_Growth(t *testing.T) {
+	var flagged []Anomaly
+	conf := DefaultDetectorConfig()
+	conf.OnAnomaly = func(a Anomaly) {
+		flagged = append(flagged, a)
+	}
+	d, err := NewAnomalyDetector(conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f := &rateFeed{d: d}
+
+	// Noisy but steady growth is not flagged
+	if out := f.feed(100, 110, 90, 105, 95, 100, 120, 80, 100, 110, 90, 100); len(out) != 0 {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// A spike is flagged, and kept out of the baseline
+	out := f.feed(1000, 1000, 100)
+	if len(out) != 2 || out[0].Type != AnomalyGrowth || out[0].Rate != 1000 {
+		t.Fatalf("bad: %v", out)
+	}
+	if out[0].Expected < 95 || out[0].Expected > 105 || out[1].Expected != out[0].Expected {
+		t.Fatalf("bad: %v", out)
+	}
+	if len(flagged) != 2 || flagged[1].Time != out[1].Time {
+		t.Fatalf("bad: %v", flagged)
+	}
+}
+
+func TestAnomalyDetector_Flatline(t *testing.T) {
+	d, err := NewAnomalyDetector(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f := &rateFeed{d: d}
+
+	// Flatlines are not flagged during warmup
+	if out := f.feed(0, 0, 0, 0, 0, 0); len(out) != 0 {
+		t.Fatalf("bad: %v", out)
+	}
+	if out := f.feed(100, 100, 100, 100, 100, 100, 100, 100, 100, 100); len(out) != 0 {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// A flatline is flagged once, until growth resumes
+	out := f.feed(0, 0, 0, 0, 0, 0, 0, 0, 100, 0, 0, 0, 0, 0)
+	if len(out) != 2 {
+		t.Fatalf("bad: %v", out)
+	}
+	for _, a := range out {
+		if a.Type != AnomalyFlatline || a.Rate != 0 || a.Expected != 100 {
+			t.Fatalf("bad: %v", a)
+		}
+	}
+	if out[0].String() != "flatline: rate 0.0/min, expected 100.0±5.0/min" {
+		t.Fatalf("bad: %v", out[0])
+	}
+}
+
+func TestAnomalyDetector_Season(t *testing.T) {
+	conf := DefaultDetectorConfig()
+	conf.Season = 2 * time.Hour
+	conf.Slots = 2
+	conf.Warmup = 5
+	d, err := NewAnomalyDetector(conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f := &rateFeed{d: d}
+
+	// Alternating busy and quiet hours are expected
+	busy, quiet := make([]uint64, 60), make([]uint64, 60)
+	for i := range busy {
+		busy[i], quiet[i] = 1000, 10
+	}
+	for hour := 0; hour < 3; hour++ {
+		if out := f.feed(busy...); len(out) != 0 {
+			t.Fatalf("bad: %v", out)
+		}
+		if out := f.feed(quiet...); len(out) != 0 {
+			t.Fatalf("bad: %v", out)
+		}
+	}
+
+	// Busy traffic in the quiet hour is flagged
+	f.feed(busy...)
+	out := f.feed(1000)
+	if len(out) != 1 || out[0].Type != AnomalyGrowth || out[0].Expected != 10 {
+		t.Fatalf("bad: %v", out)
+	}
+}
+
+func TestCardinalityTracker_Detect(t *testing.T) {
+	var size uint64
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return fmt.Sprintf("START\nsize %d\nEND\n", atomic.LoadUint64(&size))
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	tracker, err := NewCardinalityTracker(client, "foo", time.Hour, 3)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer tracker.Stop()
+
+	// Wait for the first sample, so only later samples are observed
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tracker.Samples()) < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := tracker.Detect(&DetectorConfig{}); err == nil {
+		t.Fatalf("expect error")
+	}
+	conf := DefaultDetectorConfig()
+	conf.Warmup = 0
+	conf.FlatlineSamples = 0
+	var flagged int32
+	conf.OnAnomaly = func(a Anomaly) {
+		atomic.AddInt32(&flagged, 1)
+	}
+	d, err := tracker.Detect(conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Samples taken by the tracker are observed
+	tracker.sample()
+	atomic.StoreUint64(&size, 100)
+	tracker.sample()
+	d.lock.Lock()
+	count := d.baselines[0].count
+	d.lock.Unlock()
+	if count != 1 || atomic.LoadInt32(&flagged) != 0 {
+		t.Fatalf("bad: %v %v", count, flagged)
+	}
+}
@@ -0,0 +1,61 @@
+package hlld
+
+import (
+	"sort"
+	"sync"
+)
+
+// BroadcastResult is the result of a broadcast command on a server
+type BroadcastResult struct {
+	// Name is the name of the server, as given to Broadcast
+	Name string
+
+	// Command is the command executed on the server, whose result
+	// can be read if Err is nil
+	Command Command
+
+	// Err is the error executing the command, or its result
+	// if the command was not applied
+	Err error
+}
+
+// Broadcast is used to execute a command on every server, such as a
+// flush or a list for maintenance across a fleet, and returns the result
+// of each server sorted by name. A command is built for each server by
+// newCmd, since a command can only be executed once. The commands are
+// executed concurrently, and a failure on one server does not stop the
+// others.
+func Broadcast(servers map[string]Executor, newCmd func() (Command, error)) []*BroadcastResult {
+	results := make([]*BroadcastResult, 0, len(servers))
+	for name := range servers {
+		results = append(results, &BroadcastResult{Name: name})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	var wg sync.WaitGroup
+	for _, result := range results {
+		cmd, err := newCmd()
+		if err != nil {
+			result.Err = err
+			continue
+		}
+		result.Command = cmd
+		wg.Add(1)
+		go func(result *BroadcastResult, exec Executor) {
+			defer wg.Done()
+			f, err := exec.Execute(result.Command)
+			if err == nil {
+				err = f.Error()
+			}
+			if err == nil {
+				result.Command = f.Command()
+				err = commandError(result.Command)
+			}
+			result.Err = err
+		}(result, servers[result.Name])
+	}
+	wg.Wait()
+	return results
+}
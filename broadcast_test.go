@@ -0,0 +1,59 @@
+package hlld
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	servers := make(map[string]Executor)
+	for _, name := range []string{"b", "a", "c"} {
+		name := name
+		addr, stop := testServer(t, func(conn int, line string) string {
+			if name == "c" {
+				return "Set does not exist\n"
+			}
+			return fmt.Sprintf("START\n%s-set 0.01 12 %d 0\nEND\n", name, len(name))
+		})
+		defer stop()
+		client, err := Dial(addr)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		defer client.Close()
+		servers[name] = client
+	}
+
+	results := Broadcast(servers, func() (Command, error) {
+		return NewListCommand("")
+	})
+	if len(results) != 3 {
+		t.Fatalf("bad: %v", results)
+	}
+	for idx, name := range []string{"a", "b"} {
+		r := results[idx]
+		if r.Name != name || r.Err != nil {
+			t.Fatalf("bad: %#v", r)
+		}
+		entries, err := r.Command.(*ListCommand).Result()
+		if err != nil || len(entries) != 1 || entries[0].Name != name+"-set" {
+			t.Fatalf("bad: %v %v", entries, err)
+		}
+	}
+
+	// A failure on one server is reported without stopping the others
+	if results[2].Name != "c" || results[2].Err == nil {
+		t.Fatalf("bad: %#v", results[2])
+	}
+
+	// Commands that cannot be built are reported for every server
+	results = Broadcast(servers, func() (Command, error) {
+		return NewFlushCommand("bad name")
+	})
+	for _, r := range results {
+		if r.Err == nil || r.Command != nil || !strings.Contains(r.Err.Error(), "invalid set name") {
+			t.Fatalf("bad: %#v", r)
+		}
+	}
+}
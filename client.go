@@ -2,17 +2,18 @@ package hlld
 
 import (
 	"bufio"
+	"container/list"
+	"context"
+	"crypto/tls"
 	"fmt"
+	"log/slog"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var (
-	// ErrClientClosed is used if the client is closed
-	ErrClientClosed = fmt.Errorf("client closed")
-)
-
 // Command is used to represent any command that can be sent to
 // HLLD. It must be able to encode and decode from the wire.
 type Command interface {
@@ -22,16 +23,61 @@ type Command interface {
 
 // Client is used to interact with an hlld server
 type Client struct {
+	// Counters are updated atomically and must be 64-bit aligned
+	commands   uint64
+	errors     uint64
+	reconnects uint64
+
+	// Tunables that may be updated while running are accessed
+	// atomically, and are in nanoseconds for the timeouts
+	timeoutNs        int64
+	enqueueTimeoutNs int64
+	maxPipeline      int64
+
+	// slotCh is signaled when a pending command completes, if the
+	// pipeline is limited below its capacity
+	slotCh chan struct{}
+
+	// draining is set atomically once Shutdown is called, and idleCh
+	// is then signaled when no commands are pending
+	draining int32
+	idleCh   chan struct{}
+
 	config *Config
 
-	conn net.Conn
+	// dialer is used to establish a new connection on reconnect,
+	// and is nil if the client wraps an existing connection
+	dialer func() (net.Conn, error)
+
+	// gen is the generation of the connection, which is incremented
+	// whenever the connection is replaced. connLock is held by the writer
+	// while using the connection, and by the reader to replace it.
+	conn     net.Conn
+	gen      uint64
+	connLock sync.Mutex
+
 	bufR *bufio.Reader
 
-	bufW      *bufio.Writer
-	writeLock sync.Mutex
+	bufW    *bufio.Writer
+	writeCh chan *Future
 
 	decodeCh chan *Future
 
+	// pending tracks the futures waiting for a response, in order
+	pending     *list.List
+	pendingLock sync.Mutex
+
+	eventCh chan Event
+	logger  *slog.Logger
+
+	// recentErrors is a bounded list of the latest command errors
+	recentErrors     []CommandError
+	recentErrorsLock sync.Mutex
+
+	// version caches the result of probing the server
+	version     *ServerVersion
+	versionLock sync.Mutex
+
 	closed     bool
 	closedCh   chan struct{}
 	closedLock sync.Mutex
@@ -44,15 +90,136 @@ type Config struct {
 
 	// Timeout is the read or write timeout
 	Timeout time.Duration
+
+	// EnqueueTimeout is the maximum time to wait to queue a command for
+	// writing. Up to MaxPipeline commands are queued before this applies.
+	EnqueueTimeout time.Duration
+
+	// DialStagger is the delay before a connection is attempted to the
+	// next address when a host resolves to multiple addresses, so that
+	// the addresses are raced rather than tried one at a time. Zero uses
+	// the default, and NoDialStagger attempts every address at once.
+	DialStagger time.Duration
+
+	// DialTimeout is the timeout of each connection attempt. If a host
+	// resolves to multiple addresses, each is attempted in turn, so a
+	// dead address only delays dialing by up to this timeout. The
+	// Timeout is used if unspecified.
+	DialTimeout time.Duration
+
+	// TLSConfig is used to wrap connections with TLS when dialing.
+	// This is useful when hlld is behind a TLS terminating proxy.
+	TLSConfig *tls.Config
+
+	// Handshake is an optional function invoked on a new connection
+	// before any commands are sent. It can be used to perform custom
+	// authentication exchanges with patched or proxied hlld servers.
+	// The connection deadline is set to Timeout during the handshake.
+	Handshake func(conn net.Conn, r *bufio.Reader, w *bufio.Writer) error
+
+	// Hooks are invoked in order on every command before it is encoded,
+	// and may rewrite or replace the command. This can be used to apply
+	// policies without modifying every call site.
+	Hooks []Hook
+
+	// OnReaderError is an optional function invoked when decoding a
+	// response fails, and returns the action to take. By default, the
+	// client is closed.
+	OnReaderError func(err error) Action
+
+	// DefaultCreateOptions are applied to the sets created by CreateSet
+	// and the helpers that create sets, such as CopyAndSwap, for any
+	// options that are not specified. This can be used to standardize
+	// the options of an application in one place.
+	DefaultCreateOptions *CreateOptions
+
+	// OnComplete is an optional function invoked when each command
+	// completes, which can be used to record metrics or traces. It is
+	// invoked on the goroutine decoding responses, so it must be fast.
+	OnComplete func(c Completion)
+
+	// MaxKeysPerCommand limits the number of keys of a set command, and
+	// MaxCommandBytes limits the encoded size of any command, including
+	// the newline. Commands beyond the limits fail with a LimitError
+	// before they are sent, which can be used to match the limits of a
+	// server or proxy. Zero disables the limit.
+	MaxKeysPerCommand int
+	MaxCommandBytes   int
+
+	// ParkedFutures completes futures by parking the waiters with a
+	// sync.WaitGroup rather than closing a channel, which saves an
+	// allocation per command for very high throughput users. Waiting
+	// with a timeout is more expensive, as it allocates a channel.
+	ParkedFutures bool
+
+	// Logger receives the diagnostics of the client, such as reconnects
+	// and protocol errors, with a component attribute of "hlld" so they
+	// can be filtered. Nothing is logged if unspecified, and
+	// NewLogHandler can be used to adapt a log.Logger.
+	Logger *slog.Logger
+}
+
+// NoDialStagger is used as the DialStagger to attempt a connection to
+// every address of a host at once, since zero means the default
+const NoDialStagger time.Duration = -1
+
+// Action is the action to take when decoding a response fails
+type Action int
+
+const (
+	// CloseClient closes the client, failing all pending commands
+	CloseClient Action = iota
+
+	// Reconnect replaces the connection with a new one. Commands that
+	// were already sent fail with ErrConnectionLost, while queued commands
+	// are sent on the new connection. This is only supported by clients
+	// that are dialed, otherwise the client is closed.
+	Reconnect
+
+	// FailFutureOnly fails only the command being decoded and continues
+	// with the next response. This should only be used if the response
+	// stream is known to remain in sync, such as when a response is
+	// malformed but complete, otherwise responses will be mismatched.
+	FailFutureOnly
+)
+
+// ConfigError is returned if a configuration is invalid,
+// and describes every invalid field
+type ConfigError struct {
+	Errors []string
 }
 
-// Validate is used to sanity check the configuration
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config: %s", strings.Join(e.Errors, "; "))
+}
+
+// Validate is used to sanity check the configuration. A ConfigError
+// listing every invalid field is returned.
 func (c *Config) Validate() error {
+	var errs []string
 	if c.MaxPipeline <= 0 {
-		return fmt.Errorf("max pipeline must be positive")
+		errs = append(errs, fmt.Sprintf("max pipeline must be at least 1, got %d", c.MaxPipeline))
 	}
 	if c.Timeout <= 0 {
-		return fmt.Errorf("timeout must be positive")
+		errs = append(errs, fmt.Sprintf("timeout must be positive, got %v", c.Timeout))
+	}
+	if c.EnqueueTimeout <= 0 {
+		errs = append(errs, fmt.Sprintf("enqueue timeout must be positive, got %v", c.EnqueueTimeout))
+	}
+	if c.DialStagger < 0 && c.DialStagger != NoDialStagger {
+		errs = append(errs, fmt.Sprintf("dial stagger must not be negative, got %v", c.DialStagger))
+	}
+	if c.DialTimeout < 0 {
+		errs = append(errs, fmt.Sprintf("dial timeout must not be negative, got %v", c.DialTimeout))
+	}
+	if c.MaxKeysPerCommand < 0 {
+		errs = append(errs, fmt.Sprintf("max keys per command must not be negative, got %d", c.MaxKeysPerCommand))
+	}
+	if c.MaxCommandBytes < 0 {
+		errs = append(errs, fmt.Sprintf("max command bytes must not be negative, got %d", c.MaxCommandBytes))
+	}
+	if len(errs) > 0 {
+		return &ConfigError{Errors: errs}
 	}
 	return nil
 }
@@ -60,42 +227,189 @@ func (c *Config) Validate() error {
 // DefaultConfig is used as the default client configuration
 func DefaultConfig() *Config {
 	return &Config{
-		MaxPipeline: 8192,
-		Timeout:     5 * time.Second,
+		MaxPipeline:    8192,
+		Timeout:        5 * time.Second,
+		EnqueueTimeout: time.Second,
+		DialStagger:    250 * time.Millisecond,
+	}
+}
+
+// MergeDefaults is used to set any unspecified fields to their
+// default values, so a partial configuration can be used
+func (c *Config) MergeDefaults() {
+	defaults := DefaultConfig()
+	if c.MaxPipeline == 0 {
+		c.MaxPipeline = defaults.MaxPipeline
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.EnqueueTimeout == 0 {
+		c.EnqueueTimeout = defaults.EnqueueTimeout
+	}
+	if c.DialStagger == 0 {
+		c.DialStagger = defaults.DialStagger
 	}
 }
 
+// Clone returns a copy of the configuration
+func (c *Config) Clone() *Config {
+	out := *c
+	if c.Hooks != nil {
+		out.Hooks = make([]Hook, len(c.Hooks))
+		copy(out.Hooks, c.Hooks)
+	}
+	return &out
+}
+
+// WithDefaults returns a copy of the configuration with any
+// unspecified fields set to their default values
+func (c *Config) WithDefaults() *Config {
+	out := c.Clone()
+	out.MergeDefaults()
+	return out
+}
+
 // Dial is a short hand to dial a new connection
 func Dial(addr string) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
+	return DialConfig(addr, nil)
+}
+
+// DialConfig is used to dial a new connection with a given configuration.
+// Any unspecified fields of the configuration are set to their defaults.
+func DialConfig(addr string, config *Config) (*Client, error) {
+	// Default config if none given, or any unspecified fields
+	if config == nil {
+		config = DefaultConfig()
+	}
+	config.MergeDefaults()
+	dialer := func() (net.Conn, error) {
+		return dialAddr(addr, config)
+	}
+	conn, err := dialer()
 	if err != nil {
 		return nil, err
 	}
-	return NewClient(conn, nil)
+	return newClient(conn, config, dialer)
 }
 
-// NewClient is used to create a new client by wrapping an existing connection
+// NewClient is used to create a new client by wrapping an existing connection.
+// Any unspecified fields of the configuration are set to their defaults. The
+// connection is closed if the client cannot be created, such as when the
+// handshake fails.
 func NewClient(conn net.Conn, config *Config) (*Client, error) {
-	// Default config if none given
+	return newClient(conn, config, nil)
+}
+
+// newClient is used to create a new client with an optional dialer,
+// closing the connection on failure
+func newClient(conn net.Conn, config *Config, dialer func() (net.Conn, error)) (*Client, error) {
+	// Default config if none given, or any unspecified fields
 	if config == nil {
 		config = DefaultConfig()
 	}
+	config.MergeDefaults()
 	if err := config.Validate(); err != nil {
+		conn.Close()
 		return nil, err
 	}
 
 	c := &Client{
 		config:   config,
+		dialer:   dialer,
 		conn:     conn,
 		bufR:     bufio.NewReader(conn),
 		bufW:     bufio.NewWriter(conn),
+		writeCh:  make(chan *Future, config.MaxPipeline),
 		decodeCh: make(chan *Future, config.MaxPipeline),
+		pending:  list.New(),
+		eventCh:  make(chan Event, eventBuffer),
+		logger:   clientLogger(config.Logger, conn),
 		closedCh: make(chan struct{}),
+
+		timeoutNs:        int64(config.Timeout),
+		enqueueTimeoutNs: int64(config.EnqueueTimeout),
+		maxPipeline:      int64(config.MaxPipeline),
+		slotCh:           make(chan struct{}, 1),
+		idleCh:           make(chan struct{}, 1),
+	}
+
+	// Perform the handshake if any
+	if config.Handshake != nil {
+		if err := c.handshake(conn, c.bufR, c.bufW); err != nil {
+			conn.Close()
+			return nil, err
+		}
 	}
-	go c.reader()
+	c.emit(EventConnected, nil)
+	go c.labeled("reader", c.reader)
+	go c.labeled("writer", c.writer)
 	return c, nil
 }
 
+// handshake is used to invoke the configured handshake function
+// before a connection is used for commands
+func (c *Client) handshake(conn net.Conn, bufR *bufio.Reader, bufW *bufio.Writer) error {
+	conn.SetDeadline(time.Now().Add(c.timeout()))
+	if err := c.config.Handshake(conn, bufR, bufW); err != nil {
+		return fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+	}
+	if err := bufW.Flush(); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	return nil
+}
+
+// reconnect is used to replace the connection with a new one
+func (c *Client) reconnect() error {
+	c.emit(EventReconnecting, nil)
+	conn, err := c.dialer()
+	if err != nil {
+		return err
+	}
+	bufR := bufio.NewReader(conn)
+	bufW := bufio.NewWriter(conn)
+	if c.config.Handshake != nil {
+		if err := c.handshake(conn, bufR, bufW); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	// Swap the connection once the writer is done with it
+	c.connLock.Lock()
+	c.closedLock.Lock()
+	if c.closed {
+		c.closedLock.Unlock()
+		c.connLock.Unlock()
+		conn.Close()
+		return ErrClientClosed
+	}
+	old := c.conn
+	c.conn, c.bufR, c.bufW = conn, bufR, bufW
+	c.gen++
+	c.closedLock.Unlock()
+	c.connLock.Unlock()
+
+	atomic.AddUint64(&c.reconnects, 1)
+	old.Close()
+	c.emit(EventConnected, nil)
+	return nil
+}
+
+// readerErrorAction returns the action to take on a decode error
+func (c *Client) readerErrorAction(err error) Action {
+	if c.config.OnReaderError == nil {
+		return CloseClient
+	}
+	action := c.config.OnReaderError(err)
+	if action == Reconnect && c.dialer == nil {
+		return CloseClient
+	}
+	return action
+}
+
 // Close is used to shut down the client
 func (c *Client) Close() error {
 	c.closedLock.Lock()
@@ -107,6 +421,7 @@ func (c *Client) Close() error {
 	c.closed = true
 	close(c.closedCh)
 	c.conn.Close()
+	c.emit(EventDisconnected, nil)
 	return nil
 }
 
@@ -125,30 +440,151 @@ func (c *Client) reader() {
 	for {
 		select {
 		case next := <-c.decodeCh:
-			// Set the read deadline
-			c.conn.SetReadDeadline(time.Now().Add(c.config.Timeout))
+			// Fail commands that were sent on a replaced connection
+			if next.gen != c.gen {
+				c.complete(next, ErrConnectionLost)
+				continue
+			}
+
+			// Set the read deadline. The deadline of the command is not
+			// used, since it would close the connection shared with
+			// other commands; the command fails alone when it passes.
+			c.conn.SetReadDeadline(time.Now().Add(c.timeout()))
+
+			// Decode the next command, once the response starts. A
+			// connection lost before then is distinguished, since the
+			// command can be safely sent again.
+			var err error
+			if _, perr := c.bufR.Peek(1); perr != nil && !isTimeout(perr) {
+				err = fmt.Errorf("%w: %w", ErrConnectionLost, perr)
+			} else if next.timing != nil {
+				err = c.decodeTimed(next)
+			} else {
+				err = next.Command().Decode(c.bufR)
+			}
+			if err == nil {
+				c.complete(next, nil)
+				continue
+			}
+
+			// Handle the error, shutting down by default. The command
+			// fails once the connection is replaced or closed, so that
+			// it is not sent again on the same connection.
+			c.emit(EventProtocolError, err)
+			switch c.readerErrorAction(err) {
+			case FailFutureOnly:
+				c.complete(next, err)
+				continue
+			case Reconnect:
+				if c.reconnect() == nil {
+					c.complete(next, err)
+					continue
+				}
+			}
+			c.Close()
+			c.complete(next, err)
+			goto DRAIN
 
-			// Decode the next command
-			err := next.Command().Decode(c.bufR)
-			next.respond(err)
+		case <-c.closedCh:
+			goto DRAIN
+		}
+	}
+
+	// After the main loop, drain the decode channel
+DRAIN:
+	c.drain(c.decodeCh)
+}
+
+// writer is used to encode the queued commands and hand
+// them off to the reader in the order they are written
+func (c *Client) writer() {
+	for {
+		select {
+		case next := <-c.writeCh:
+			// Skip commands whose context ended while queued
+			if next.expired() {
+				c.untrack(next)
+				continue
+			}
+			if next.timing != nil {
+				next.timing.dequeued = time.Now()
+			}
+
+			// Set the write deadline
+			c.connLock.Lock()
+			next.gen = c.gen
+			c.conn.SetWriteDeadline(time.Now().Add(c.timeout()))
+
+			// Encode the command, flushing once the queue is empty.
+			// Timed commands are always flushed to measure the write.
+			err := next.Command().Encode(c.bufW)
+			if err == nil && (len(c.writeCh) == 0 || next.timing != nil) {
+				err = c.bufW.Flush()
+			}
+			c.connLock.Unlock()
+			if next.timing != nil {
+				next.timing.written = time.Now()
+			}
+
+			// Respond and do not decode on error, close the socket
+			if err != nil {
+				c.complete(next, err)
+				c.Close()
+				goto DRAIN
+			}
+
+			// Push the future to the decode channel
+			select {
+			case c.decodeCh <- next:
+				continue
+			default:
+				c.emit(EventPipelineStalled, nil)
+			}
 
-			// Shutdown if there was an error
+			// Flush before waiting, the reader may need the buffered commands
+			c.connLock.Lock()
+			err = c.bufW.Flush()
+			c.connLock.Unlock()
 			if err != nil {
+				c.complete(next, err)
 				c.Close()
 				goto DRAIN
 			}
+			select {
+			case c.decodeCh <- next:
+			case <-c.closedCh:
+				c.complete(next, ErrClientClosed)
+				goto DRAIN
+			}
+
+			// Ensure the future is not missed by the reader's drain
+			if c.isClosed() {
+				c.drain(c.decodeCh)
+			}
 
 		case <-c.closedCh:
 			goto DRAIN
 		}
 	}
 
-	// After the main loop, drain the decode channel
+	// After the main loop, drain the write channel
 DRAIN:
+	c.drain(c.writeCh)
+}
+
+// isTimeout checks if an error is a network timeout
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// drain is used to fail all the futures in a channel
+// once the client is closed
+func (c *Client) drain(ch chan *Future) {
 	for {
 		select {
-		case next := <-c.decodeCh:
-			next.respond(ErrClientClosed)
+		case next := <-ch:
+			c.complete(next, ErrClientClosed)
 		default:
 			return
 		}
@@ -157,37 +593,211 @@ DRAIN:
 
 // Execute starts command execution and returns a future
 func (c *Client) Execute(cmd Command) (*Future, error) {
-	c.writeLock.Lock()
-	defer c.writeLock.Unlock()
+	return c.execute(context.Background(), cmd, time.Time{}, nil, futureDefault)
+}
 
-	// Check if the client is closed
-	if c.isClosed() {
-		return nil, ErrClientClosed
+// ExecuteNoReply starts command execution without returning a future,
+// for callers that never read the results. The response is still decoded
+// to keep the pipeline in sync, but the future is recycled, reducing
+// allocations. The command must not be reused or inspected afterwards.
+func (c *Client) ExecuteNoReply(cmd Command) error {
+	_, err := c.execute(context.Background(), cmd, time.Time{}, nil, futureNoReply)
+	return err
+}
+
+// ExecuteContext starts command execution and returns a future. If the
+// context is done before the response is received, the future fails
+// with the error of the context, while the other commands on the
+// connection are unaffected. A command that was not yet written is
+// skipped, otherwise its response is still read and discarded, so the
+// command must not be inspected after it fails. The connection itself
+// always uses the configured Timeout. Any labels added to the context
+// with WithLabels are attached to the command.
+func (c *Client) ExecuteContext(ctx context.Context, cmd Command) (*Future, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	deadline, _ := ctx.Deadline()
+	return c.execute(ctx, cmd, deadline, LabelsFromContext(ctx), futureDefault)
+}
 
-	// Set the write deadline
-	c.conn.SetWriteDeadline(time.Now().Add(c.config.Timeout))
+// execute starts command execution with a context, an optional deadline
+// that may be earlier than that of the context, and optional labels,
+// using the given kind of future
+func (c *Client) execute(ctx context.Context, cmd Command, deadline time.Time, labels map[string]string, kind futureKind) (*Future, error) {
+	// Apply the hooks
+	cmd, err := applyHooks(c.config.Hooks, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, cmd, deadline, labels, kind)
+}
 
-	// Encode the command
-	err := cmd.Encode(c.bufW)
+// send starts execution of a command that has already been passed
+// through the hooks, which is used to retry a command without
+// applying the hooks again
+func (c *Client) send(ctx context.Context, cmd Command, deadline time.Time, labels map[string]string, kind futureKind) (*Future, error) {
+	if err := c.checkLimits(cmd); err != nil {
+		return nil, err
+	}
 
-	// Flush the writter
-	if err == nil {
-		err = c.bufW.Flush()
+	// Check if the client is accepting commands
+	if err := c.accepting(); err != nil {
+		return nil, err
 	}
 
-	// Respond and do not enqueue on error, close the socket
-	if err != nil {
-		c.Close()
+	// Prepare the future
+	if kind == futureDefault && c.config.ParkedFutures {
+		kind = futureParked
+	}
+	f := newFuture(kind, cmd)
+	f.deadline = deadline
+	f.labels = labels
+	c.watch(ctx, f)
+	if err := c.enqueue(f); err != nil {
+		f.unwatch()
 		return nil, err
 	}
+	return f, nil
+}
+
+// watch is used to fail a future with the error of its context once the
+// context is done or the deadline of the future passes, without waiting
+// for the response
+func (c *Client) watch(ctx context.Context, f *Future) {
+	if d, ok := ctx.Deadline(); !f.deadline.IsZero() && (!ok || f.deadline.Before(d)) {
+		ctx, f.cancel = context.WithDeadline(ctx, f.deadline)
+	}
+	if ctx.Done() == nil {
+		return
+	}
+	f.watch = watching
+	f.stopWatch = context.AfterFunc(ctx, func() {
+		c.expire(f, ctx.Err())
+	})
+}
 
-	// Push the future to the decode channel
-	f := NewFuture(cmd)
+// expire is used to fail a future whose context is done. The future is
+// left in the pending list, since its response must still be read.
+func (c *Client) expire(f *Future, err error) {
+	if !atomic.CompareAndSwapInt32(&f.watch, watching, watchDone) {
+		return
+	}
+	if f.cancel != nil {
+		f.cancel()
+	}
+	atomic.AddUint64(&c.commands, 1)
+	atomic.AddUint64(&c.errors, 1)
+	c.recordError(f, err)
+	f.respond(err)
+}
+
+// enqueue is used to track a future and queue it for the writer,
+// waiting up to the EnqueueTimeout or the deadline if the queue is full
+func (c *Client) enqueue(f *Future) error {
+	if err := c.waitSlot(f); err != nil {
+		return err
+	}
+	c.track(f)
 	select {
-	case c.decodeCh <- f:
-	case <-c.closedCh:
-		f.respond(ErrClientClosed)
+	case c.writeCh <- f:
+	default:
+		timer := time.NewTimer(c.enqueueWait(f))
+		defer timer.Stop()
+		select {
+		case c.writeCh <- f:
+		case <-timer.C:
+			c.untrack(f)
+			return ErrEnqueueTimeout
+		case <-c.closedCh:
+			c.untrack(f)
+			return ErrClientClosed
+		}
 	}
-	return f, nil
+
+	// Ensure the future is not missed by the writer's drain
+	if c.isClosed() {
+		c.drain(c.writeCh)
+	}
+	return nil
+}
+
+// track is used to add a future to the pending list
+func (c *Client) track(f *Future) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	f.enqueued = time.Now()
+	f.elem = c.pending.PushBack(f)
+}
+
+// untrack is used to remove a future from the pending list
+func (c *Client) untrack(f *Future) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	if f.elem != nil {
+		c.pending.Remove(f.elem)
+		f.elem = nil
+		if c.pipelineLimited() {
+			select {
+			case c.slotCh <- struct{}{}:
+			default:
+			}
+		}
+		if c.pending.Len() == 0 && atomic.LoadInt32(&c.draining) == 1 {
+			select {
+			case c.idleCh <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// complete is used to remove a future from the pending list
+// and respond with the result, unless its context already failed it
+func (c *Client) complete(f *Future, err error) {
+	c.untrack(f)
+	if !f.unwatch() {
+		return
+	}
+	atomic.AddUint64(&c.commands, 1)
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		c.recordError(f, err)
+	}
+	c.observe(f, err)
+	f.respond(err)
+}
+
+// PendingCommand describes a command waiting for a response
+type PendingCommand struct {
+	// Type is the type of the command, such as "create" or "info"
+	Type string
+
+	// SetName is the name of the set, if the command targets one
+	SetName string
+
+	// Labels are the labels of the context the command was executed
+	// with, if any
+	Labels map[string]string
+
+	// Enqueued is when the command was sent
+	Enqueued time.Time
+}
+
+// Pending returns the commands waiting for a response, in the order
+// they were sent. This is useful for diagnosing a stalled pipeline.
+func (c *Client) Pending() []PendingCommand {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	out := make([]PendingCommand, 0, c.pending.Len())
+	for e := c.pending.Front(); e != nil; e = e.Next() {
+		f := e.Value.(*Future)
+		out = append(out, PendingCommand{
+			Type:     commandType(f.cmd),
+			SetName:  commandSetName(f.cmd),
+			Labels:   f.labels,
+			Enqueued: f.enqueued,
+		})
+	}
+	return out
 }
@@ -1,15 +1,76 @@
 package hlld
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
 	conf := DefaultConfig()
 	err := conf.Validate()
 	if err != nil {
-		t.Fatalf("err: %v")
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	conf := &Config{MaxPipeline: -1, Timeout: -time.Second}
+	err := conf.Validate()
+	cerr, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("err: %v", err)
+	}
+	if len(cerr.Errors) != 3 {
+		t.Fatalf("bad: %v", cerr)
+	}
+	if !strings.Contains(err.Error(), "max pipeline must be at least 1, got -1") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestConfig_WithDefaults(t *testing.T) {
+	hook := PrefixHook("test-")
+	conf := &Config{Timeout: time.Second, Hooks: []Hook{hook}}
+	out := conf.WithDefaults()
+	if err := out.Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Timeout != time.Second || out.MaxPipeline != DefaultConfig().MaxPipeline {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// Original is not modified
+	if conf.MaxPipeline != 0 {
+		t.Fatalf("bad: %#v", conf)
+	}
+	out.Hooks[0] = nil
+	if conf.Hooks[0] == nil {
+		t.Fatalf("hooks not copied")
+	}
+}
+
+func TestConfig_NoDialStagger(t *testing.T) {
+	conf := &Config{DialStagger: NoDialStagger}
+	out := conf.WithDefaults()
+	if out.DialStagger != NoDialStagger {
+		t.Fatalf("bad: %v", out.DialStagger)
+	}
+	if err := out.Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Other negative values are still rejected
+	out.DialStagger = -time.Second
+	if err := out.Validate(); err == nil {
+		t.Fatalf("expect error")
 	}
 }
 
@@ -24,12 +85,16 @@ func TestClient(t *testing.T) {
 		// Listen as server
 		conn, err := list.Accept()
 		if err != nil {
-			t.Fatalf("err: %v", err)
+			t.Errorf("err: %v", err)
+			return
 		}
 		defer conn.Close()
 
 		// Don't bother read, just send the response
 		conn.Write([]byte("Done\nDone\nDone\n"))
+
+		// Hold the connection open until the client closes
+		io.Copy(ioutil.Discard, conn)
 	}()
 
 	// Dial the client
@@ -74,3 +139,533 @@ func TestClient(t *testing.T) {
 		}
 	}
 }
+
+func TestClient_Handshake(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+
+	go func() {
+		// Listen as server
+		conn, err := list.Accept()
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		// Verify the auth line, then respond to the command
+		bufR := bufio.NewReader(conn)
+		line, err := bufR.ReadString('\n')
+		if err != nil || line != "auth secret\n" {
+			t.Errorf("bad: %q %v", line, err)
+			return
+		}
+		conn.Write([]byte("OK\n"))
+
+		line, err = bufR.ReadString('\n')
+		if err != nil || line != "create foo\n" {
+			t.Errorf("bad: %q %v", line, err)
+			return
+		}
+		conn.Write([]byte("Done\n"))
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	conf := DefaultConfig()
+	conf.Handshake = func(conn net.Conn, r *bufio.Reader, w *bufio.Writer) error {
+		if _, err := w.WriteString("auth secret\n"); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		resp, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if resp != "OK\n" {
+			return fmt.Errorf("bad auth response: %s", resp)
+		}
+		return nil
+	}
+
+	client, err := DialConfig(list.Addr().String(), conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	create, err := NewCreateCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	future, err := client.Execute(create)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := future.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ok, err := create.Result(); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+}
+
+func TestClient_HandshakeFailed(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+
+	go func() {
+		conn, err := list.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("Denied\n"))
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	conf := DefaultConfig()
+	conf.Handshake = func(conn net.Conn, r *bufio.Reader, w *bufio.Writer) error {
+		resp, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("bad auth response: %s", resp)
+	}
+
+	_, err = DialConfig(list.Addr().String(), conf)
+	if !errors.Is(err, ErrHandshakeFailed) {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestClient_ExecuteContext(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line == "drop slow\n" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// A command within the deadline succeeds
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	drop, _ := NewDropCommand("fast")
+	f, err := client.ExecuteContext(ctx, drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A slow response exceeds the deadline, rather than the Timeout
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	drop, _ = NewDropCommand("slow")
+	start := time.Now()
+	f, err = client.ExecuteContext(ctx, drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err == nil {
+		t.Fatalf("expect error")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("deadline not honored")
+	}
+
+	// A cancelled context is not executed
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.ExecuteContext(ctx, drop); err != context.Canceled {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestClient_ExecuteContext_Concurrent(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line == "drop slow\n" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// The first caller has a short deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	slow, _ := NewDropCommand("slow")
+	f1, err := client.ExecuteContext(ctx, slow)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The second caller is pipelined behind it without a deadline
+	fast, _ := NewDropCommand("fast")
+	f2, err := client.ExecuteContext(context.Background(), fast)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Only the first caller fails
+	if err := f1.Error(); err != context.DeadlineExceeded {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := f2.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ok, err := fast.Result(); err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if client.isClosed() {
+		t.Fatalf("should not close")
+	}
+
+	// The late response was discarded, keeping the pipeline in sync
+	drop, _ := NewDropCommand("after")
+	f3, err := client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f3.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(client.Pending()) != 0 {
+		t.Fatalf("bad: %v", client.Pending())
+	}
+}
+
+func TestClient_ExecuteNoReply(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line == "info foo\n" {
+			return "START\nsize 10\nEND\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 100; i++ {
+		set, _ := NewSetKeysCommand("foo", []string{"bar"})
+		if err := client.ExecuteNoReply(set); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// The pipeline should remain in sync
+	info, _ := NewInfoCommand("foo")
+	f, err := client.Execute(info)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	setInfo, ok, err := info.Result()
+	if err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if setInfo.Size != 10 {
+		t.Fatalf("bad: %#v", setInfo)
+	}
+
+	// Closed clients return an error
+	client.Close()
+	set, _ := NewSetKeysCommand("foo", []string{"bar"})
+	if err := client.ExecuteNoReply(set); err != ErrClientClosed {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestClient_Pending(t *testing.T) {
+	releaseCh := make(chan struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		<-releaseCh
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	if pending := client.Pending(); len(pending) != 0 {
+		t.Fatalf("bad: %v", pending)
+	}
+
+	start := time.Now()
+	create, _ := NewCreateCommand("foo")
+	createFuture, err := client.Execute(create)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	flush, _ := NewFlushCommand("")
+	flushFuture, err := client.Execute(flush)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pending := client.Pending()
+	if len(pending) != 2 {
+		t.Fatalf("bad: %v", pending)
+	}
+	if pending[0].Type != "create" || pending[0].SetName != "foo" {
+		t.Fatalf("bad: %#v", pending[0])
+	}
+	if pending[1].Type != "flush" || pending[1].SetName != "" {
+		t.Fatalf("bad: %#v", pending[1])
+	}
+	if pending[0].Enqueued.Before(start) {
+		t.Fatalf("bad: %#v", pending[0])
+	}
+
+	// Should be empty once the responses are received
+	close(releaseCh)
+	createFuture.Error()
+	flushFuture.Error()
+	if pending := client.Pending(); len(pending) != 0 {
+		t.Fatalf("bad: %v", pending)
+	}
+}
+
+func TestClient_EnqueueTimeout(t *testing.T) {
+	// Never respond, so the pipeline stalls
+	addr, stop := testServer(t, func(conn int, line string) string {
+		select {}
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.MaxPipeline = 1
+	conf.EnqueueTimeout = 20 * time.Millisecond
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Fill the reader, decode queue, writer and write queue
+	for i := 0; i < 4; i++ {
+		drop, _ := NewDropCommand("foo")
+		if _, err := client.Execute(drop); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Should fail fast instead of blocking
+	start := time.Now()
+	drop, _ := NewDropCommand("foo")
+	if _, err := client.Execute(drop); err != ErrEnqueueTimeout {
+		t.Fatalf("bad: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("should fail fast")
+	}
+	if pending := client.Pending(); len(pending) != 4 {
+		t.Fatalf("bad: %v", pending)
+	}
+}
+
+func TestClient_OnReaderError_FailFutureOnly(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line == "list\n" {
+			return "bad\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.OnReaderError = func(err error) Action {
+		return FailFutureOnly
+	}
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	list, _ := NewListCommand("")
+	f, err := client.Execute(list)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The client should still be usable
+	drop, _ := NewDropCommand("foo")
+	f, err = client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestClient_OnReaderError_Reconnect(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if conn == 0 && line == "list\n" {
+			return "bad\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	var errs []error
+	conf := DefaultConfig()
+	conf.OnReaderError = func(err error) Action {
+		errs = append(errs, err)
+		return Reconnect
+	}
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+	expectEvent(t, client, EventConnected)
+
+	list, _ := NewListCommand("")
+	f, err := client.Execute(list)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err == nil {
+		t.Fatalf("expect error")
+	}
+	expectEvent(t, client, EventProtocolError)
+	expectEvent(t, client, EventReconnecting)
+	expectEvent(t, client, EventConnected)
+	if len(errs) != 1 {
+		t.Fatalf("bad: %v", errs)
+	}
+
+	// The new connection should be used
+	drop, _ := NewDropCommand("foo")
+	f, err = client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if client.gen != 1 {
+		t.Fatalf("bad: %d", client.gen)
+	}
+}
+
+func TestClient_OnReaderError_ReconnectUnsupported(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "bad\n"
+	})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	conf := DefaultConfig()
+	conf.OnReaderError = func(err error) Action {
+		return Reconnect
+	}
+	client, err := NewClient(conn, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Without a dialer the client must be closed
+	list, _ := NewListCommand("")
+	f, err := client.Execute(list)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err == nil {
+		t.Fatalf("expect error")
+	}
+	select {
+	case <-client.closedCh:
+	case <-time.After(time.Second):
+		t.Fatalf("should be closed")
+	}
+}
+
+// testServer starts a server that invokes the handler for each
+// command line received on any connection and writes back the response.
+// Connections are numbered in the order they are accepted.
+func testServer(t testing.TB, handler func(conn int, line string) string) (string, func()) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	go func() {
+		for idx := 0; ; idx++ {
+			conn, err := list.Accept()
+			if err != nil {
+				return
+			}
+			go func(idx int, conn net.Conn) {
+				defer conn.Close()
+				bufR := bufio.NewReader(conn)
+				for {
+					line, err := bufR.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte(handler(idx, line))); err != nil {
+						return
+					}
+				}
+			}(idx, conn)
+		}
+	}()
+	return list.Addr().String(), func() { list.Close() }
+}
+
+func TestNewClient_HandshakeFailureClosesConn(t *testing.T) {
+	conn, other := net.Pipe()
+	defer other.Close()
+	conf := DefaultConfig()
+	conf.Handshake = func(conn net.Conn, r *bufio.Reader, w *bufio.Writer) error {
+		return fmt.Errorf("denied")
+	}
+	if _, err := NewClient(conn, conf); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// The peer sees the connection closed
+	if _, err := other.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+const (
+	// defaultWindow is the default aggregation window
+	defaultWindow = time.Second
+
+	// defaultMaxBatch is the default number of keys per upstream command
+	defaultMaxBatch = 1024
+
+	// defaultMaxBuffer is the default memory of the buffered keys
+	defaultMaxBuffer = 256 << 20
+
+	// keyOverhead is the approximate memory used to buffer a key,
+	// in addition to its bytes, used to bound the buffer
+	keyOverhead = 64
+
+	// bufferFull is the response to writes rejected by the reject policy
+	bufferFull = "Client Error: Buffer full\n"
+
+	// shuttingDown is the response to writes once the aggregator
+	// is shutting down, since they could no longer be forwarded
+	shuttingDown = "Client Error: Shutting down\n"
+)
+
+// shedPolicy determines which keys are dropped when the buffer is full
+type shedPolicy string
+
+const (
+	// shedDropOldest evicts the oldest buffered keys to admit new keys
+	shedDropOldest shedPolicy = "drop-oldest"
+
+	// shedDropNewest drops the new keys that do not fit
+	shedDropNewest shedPolicy = "drop-newest"
+
+	// shedReject rejects writes that do not fit with an error,
+	// so that clients can apply backpressure
+	shedReject shedPolicy = "reject"
+)
+
+// parseShedPolicy is used to validate a shedding policy
+func parseShedPolicy(s string) (shedPolicy, error) {
+	switch p := shedPolicy(s); p {
+	case shedDropOldest, shedDropNewest, shedReject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown shedding policy '%s'", s)
+	}
+}
+
+// bufferLimit bounds the memory used by buffered keys, so that
+// an upstream outage cannot exhaust the memory of the proxy
+type bufferLimit struct {
+	// maxBytes is the approximate memory of the buffered keys,
+	// or zero for no limit
+	maxBytes int
+
+	// policy determines which keys are dropped once full
+	policy shedPolicy
+}
+
+// bufferedKey is a key in the order it was buffered, along with
+// when it was first buffered, which is kept if it is restored
+type bufferedKey struct {
+	name string
+	key  string
+	at   time.Time
+}
+
+// keySize returns the approximate memory used to buffer a key
+func keySize(key string) int {
+	return len(key) + keyOverhead
+}
+
+// aggregator is used to accept writes from many clients, deduplicate
+// the keys in memory, and periodically forward consolidated batches to
+// the upstream server. Writes are acknowledged as soon as they are
+// buffered, so errors from the upstream server are only logged, and
+// keys that fail to forward are retried in the next window. All other
+// commands are forwarded immediately.
+type aggregator struct {
+	client   hlld.Executor
+	window   time.Duration
+	maxBatch int
+	limit    bufferLimit
+	logger   *log.Logger
+
+	// pending maps each set name to the buffered unique keys, with
+	// the keys in the order they were buffered and their memory
+	pending map[string]map[string]struct{}
+	order   []bufferedKey
+	bytes   int
+	lock    sync.Mutex
+
+	// received and forwarded count keys in and out
+	received  uint64
+	forwarded uint64
+
+	// unique counts the keys remaining after deduplication, batches
+	// the upstream commands, and flushes the windows with any keys
+	unique  uint64
+	batches uint64
+	flushes uint64
+
+	// dropped counts the keys shed because the buffer was full,
+	// and rejected the keys of writes rejected by the reject policy
+	dropped  uint64
+	rejected uint64
+
+	// replayed counts the keys restored from a checkpoint or journal,
+	// and replayTime is the time taken to read and buffer them
+	replayed   uint64
+	replayTime time.Duration
+
+	// journal is an optional write-ahead log of the buffered keys
+	journal *journal
+
+	// closing is set once shutdown starts, rejecting new writes
+	closing bool
+
+	// flushCtx is canceled to abandon a flush in progress in the
+	// flush loop when a shutdown runs out of time
+	flushCtx    context.Context
+	flushCancel context.CancelFunc
+
+	// shutdownOnce ensures only the first Shutdown stops the flush loop
+	shutdownOnce sync.Once
+	stopCh       chan struct{}
+	doneCh       chan struct{}
+}
+
+// newAggregator creates an aggregator and starts the flush loop
+func newAggregator(client hlld.Executor, window time.Duration, maxBatch int, limit bufferLimit, logger *log.Logger) *aggregator {
+	a := &aggregator{
+		client:   client,
+		window:   window,
+		maxBatch: maxBatch,
+		limit:    limit,
+		logger:   logger,
+		pending:  make(map[string]map[string]struct{}),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	a.flushCtx, a.flushCancel = context.WithCancel(context.Background())
+	go a.run()
+	return a
+}
+
+// Close stops the flush loop and forwards any buffered keys,
+// returning the keys that could not be forwarded. If there is
+// a journal, they are left in it to be replayed on restart.
+func (a *aggregator) Close() map[string][]string {
+	failed, _ := a.Shutdown(context.Background())
+	return failed
+}
+
+// Shutdown is like Close, but gives up forwarding once the context is
+// done, returning the context error. New writes are rejected, and the
+// keys not yet forwarded are returned along with the keys that failed,
+// including those of batches still awaiting a response. Those may have
+// been added upstream, but adding a key again is harmless, so it is
+// safe to checkpoint them. Only the first call shuts down, and later
+// calls wait for it to finish and return no keys.
+func (a *aggregator) Shutdown(ctx context.Context) (map[string][]string, error) {
+	var failed map[string][]string
+	var err error
+	a.shutdownOnce.Do(func() {
+		failed, err = a.shutdown(ctx)
+	})
+	return failed, err
+}
+
+// shutdown is used to stop the flush loop and forward the buffered keys
+func (a *aggregator) shutdown(ctx context.Context) (map[string][]string, error) {
+	a.lock.Lock()
+	a.closing = true
+	a.lock.Unlock()
+
+	// Abandon a flush in progress if the context is done first, so
+	// its keys are restored to the buffer and returned below
+	close(a.stopCh)
+	select {
+	case <-a.doneCh:
+	case <-ctx.Done():
+		a.flushCancel()
+		<-a.doneCh
+	}
+	a.flushCancel()
+	failed, since := a.flushContext(ctx)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.journal != nil {
+		a.restoreLocked(failed, since)
+		if err := a.journal.rewrite(a.pending); err != nil {
+			a.logger.Printf("[ERR] Failed to compact journal: %v", err)
+		}
+		if err := a.journal.Close(); err != nil {
+			a.logger.Printf("[ERR] Failed to close journal: %v", err)
+		}
+		a.journal = nil
+	}
+	return failed, ctx.Err()
+}
+
+// attachJournal is used to replay the keys of a journal into the
+// buffer, and then record the buffered keys in it. It returns the
+// number of sets with keys replayed.
+func (a *aggregator) attachJournal(path string) (int, error) {
+	start := time.Now()
+	keys, err := loadJournal(path)
+	if err != nil {
+		return 0, err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.replayLocked(keys, start)
+	j, err := openJournal(path, a.pending)
+	if err != nil {
+		return 0, err
+	}
+	a.journal = j
+	return len(keys), nil
+}
+
+// restoreCheckpoint is used to buffer the keys saved to a checkpoint
+// by an earlier aggregator. It returns the number of sets with keys.
+func (a *aggregator) restoreCheckpoint(path string) (int, error) {
+	start := time.Now()
+	keys, err := loadCheckpoint(path)
+	if err != nil {
+		return 0, err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.replayLocked(keys, start)
+	return len(keys), nil
+}
+
+// replayLocked is used to restore the keys read from a checkpoint or
+// journal, counting them and the time since the read started towards
+// the replay throughput. The lock must be held.
+func (a *aggregator) replayLocked(keys map[string][]string, start time.Time) {
+	a.restoreLocked(keys, start)
+	for _, setKeys := range keys {
+		a.replayed += uint64(len(setKeys))
+	}
+	a.replayTime += time.Since(start)
+}
+
+// compact is used to rewrite the journal with the buffered keys,
+// dropping the keys that were forwarded
+func (a *aggregator) compact() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.journal == nil {
+		return
+	}
+	if err := a.journal.rewrite(a.pending); err != nil {
+		a.logger.Printf("[ERR] Failed to compact journal: %v", err)
+	}
+}
+
+// restore is used to buffer keys saved by an earlier aggregator or
+// that failed to forward, which are not counted as received. They are
+// older than any buffered key, so they are the first to be shed, and
+// are treated as buffered since the given time.
+func (a *aggregator) restore(keys map[string][]string, since time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.restoreLocked(keys, since)
+}
+
+// restoreLocked is used to restore keys while the lock is held
+func (a *aggregator) restoreLocked(keys map[string][]string, since time.Time) {
+	order := a.order
+	a.order = nil
+	for name, setKeys := range keys {
+		for _, key := range setKeys {
+			a.insert(name, key, since)
+		}
+	}
+	a.order = append(a.order, order...)
+	a.evict()
+}
+
+// insert is used to add a key to the pending set, unless
+// it is already buffered. The lock must be held.
+func (a *aggregator) insert(name, key string, at time.Time) {
+	set, ok := a.pending[name]
+	if !ok {
+		set = make(map[string]struct{})
+		a.pending[name] = set
+	}
+	if _, ok := set[key]; ok {
+		return
+	}
+	set[key] = struct{}{}
+	a.order = append(a.order, bufferedKey{name, key, at})
+	a.bytes += keySize(key)
+}
+
+// evict is used to drop the oldest keys until the buffer is
+// within its limit. The lock must be held.
+func (a *aggregator) evict() {
+	if a.limit.maxBytes <= 0 {
+		return
+	}
+	for a.bytes > a.limit.maxBytes && len(a.order) > 0 {
+		oldest := a.order[0]
+		a.order = a.order[1:]
+		set := a.pending[oldest.name]
+		delete(set, oldest.key)
+		if len(set) == 0 {
+			delete(a.pending, oldest.name)
+		}
+		a.bytes -= keySize(oldest.key)
+		a.dropped++
+	}
+}
+
+// Handle is used to serve a single command line
+func (a *aggregator) Handle(line string) hlldproxy.Reply {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return hlldproxy.Static(hlldproxy.UnsupportedCommand)
+	}
+
+	switch fields[0] {
+	case "s", "set":
+		if len(fields) != 3 {
+			return hlldproxy.Static("Client Error: Bad arguments\n")
+		}
+		if resp := a.buffer(fields[1], fields[2:]); resp != "" {
+			return hlldproxy.Static(resp)
+		}
+		return hlldproxy.Static("Done\n")
+
+	case "b", "bulk":
+		if len(fields) < 3 {
+			return hlldproxy.Static("Client Error: Bad arguments\n")
+		}
+		if resp := a.buffer(fields[1], fields[2:]); resp != "" {
+			return hlldproxy.Static(resp)
+		}
+		return hlldproxy.Static("Done\n")
+	}
+	return hlldproxy.Forward(a.client, line)
+}
+
+// buffer is used to add keys to the pending set, shedding keys
+// if the buffer is full. It returns the error response if the
+// write is rejected, or an empty string.
+func (a *aggregator) buffer(name string, keys []string) string {
+	now := time.Now()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closing {
+		return shuttingDown
+	}
+
+	if a.limit.maxBytes > 0 && a.limit.policy != shedDropOldest {
+		// Only keys that are not yet buffered use more memory
+		need := 0
+		for _, key := range keys {
+			if _, ok := a.pending[name][key]; !ok {
+				need += keySize(key)
+			}
+		}
+		if a.limit.policy == shedReject && a.bytes+need > a.limit.maxBytes {
+			a.rejected += uint64(len(keys))
+			return bufferFull
+		}
+		for _, key := range keys {
+			if _, ok := a.pending[name][key]; !ok && a.bytes+keySize(key) > a.limit.maxBytes {
+				a.dropped++
+				continue
+			}
+			a.insert(name, key, now)
+		}
+		a.received += uint64(len(keys))
+		a.record(name, keys)
+		return ""
+	}
+
+	for _, key := range keys {
+		a.insert(name, key, now)
+	}
+	a.received += uint64(len(keys))
+	a.evict()
+	a.record(name, keys)
+	return ""
+}
+
+// record is used to append keys to the journal, if any, before the
+// write is acknowledged. Shed keys may be recorded, but are dropped
+// again if the journal is replayed into a full buffer. The lock must
+// be held.
+func (a *aggregator) record(name string, keys []string) {
+	if a.journal == nil {
+		return
+	}
+	if err := a.journal.append(name, keys); err != nil {
+		a.logger.Printf("[ERR] Failed to write journal: %v", err)
+	}
+}
+
+// run is used to flush the buffered keys every window
+func (a *aggregator) run() {
+	defer close(a.doneCh)
+	ticker := time.NewTicker(a.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// Keys that failed are retried in the next window
+			if failed, since := a.flushContext(a.flushCtx); len(failed) > 0 {
+				a.restore(failed, since)
+			}
+			a.compact()
+		case <-a.stopCh:
+			return
+		}
+	}
+}
+
+// flush is used to forward all the buffered keys upstream, returning
+// the keys that failed to forward because of an upstream error, and
+// when the oldest of the keys was buffered
+func (a *aggregator) flush() (map[string][]string, time.Time) {
+	return a.flushContext(context.Background())
+}
+
+// flushContext is like flush, but once the context is done the keys
+// not yet forwarded are returned as failed without waiting further
+func (a *aggregator) flushContext(ctx context.Context) (map[string][]string, time.Time) {
+	// Swap out the pending keys
+	a.lock.Lock()
+	pending := a.pending
+	var since time.Time
+	if len(a.order) > 0 {
+		since = a.order[0].at
+	}
+	a.pending = make(map[string]map[string]struct{})
+	a.order = nil
+	a.bytes = 0
+	a.lock.Unlock()
+	if len(pending) == 0 {
+		return nil, since
+	}
+	failed := make(map[string][]string)
+
+	// Pipeline a command per batch of keys
+	var cmds []*hlld.SetKeysCommand
+	var futures []*hlld.Future
+	var unique, batches uint64
+	for name, set := range pending {
+		unique += uint64(len(set))
+		keys := make([]string, 0, len(set))
+		for key := range set {
+			keys = append(keys, key)
+		}
+		for len(keys) > 0 {
+			n := len(keys)
+			if n > a.maxBatch {
+				n = a.maxBatch
+			}
+			cmd, err := hlld.NewSetKeysCommand(name, keys[:n])
+			keys = keys[n:]
+			batches++
+			if err != nil {
+				a.logger.Printf("[ERR] Dropping keys for set '%s': %v", name, err)
+				continue
+			}
+			if ctx.Err() != nil {
+				failed[name] = append(failed[name], cmd.Keys...)
+				continue
+			}
+			f, err := a.client.Execute(cmd)
+			if err != nil {
+				a.logger.Printf("[ERR] Failed to forward keys for set '%s': %v", name, err)
+				failed[name] = append(failed[name], cmd.Keys...)
+				continue
+			}
+			cmds = append(cmds, cmd)
+			futures = append(futures, f)
+		}
+	}
+
+	// Wait for the results
+	var forwarded uint64
+	for idx, f := range futures {
+		cmd := cmds[idx]
+		if err := wait(ctx, f); err != nil {
+			a.logger.Printf("[ERR] Failed to forward keys for set '%s': %v", cmd.SetName, err)
+			failed[cmd.SetName] = append(failed[cmd.SetName], cmd.Keys...)
+			continue
+		}
+		ok, err := cmd.Result()
+		if err != nil {
+			a.logger.Printf("[ERR] Failed to forward keys for set '%s': %v", cmd.SetName, err)
+			continue
+		} else if !ok {
+			a.logger.Printf("[WARN] Dropping keys for missing set '%s'", cmd.SetName)
+			continue
+		}
+		forwarded += uint64(len(cmd.Keys))
+	}
+
+	a.lock.Lock()
+	a.forwarded += forwarded
+	a.unique += unique
+	a.batches += batches
+	a.flushes++
+	a.lock.Unlock()
+	return failed, since
+}
+
+// wait is used to wait for the result of a future until
+// the context is done
+func wait(ctx context.Context, f *hlld.Future) error {
+	if ctx.Done() == nil {
+		return f.Error()
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f.Error()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stats returns the number of keys received and forwarded
+func (a *aggregator) stats() (received, forwarded uint64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.received, a.forwarded
+}
+
+// report returns the write amplification report
+func (a *aggregator) report() *report {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var age time.Duration
+	if len(a.order) > 0 {
+		age = time.Since(a.order[0].at)
+	}
+	return &report{
+		Received:  a.received,
+		Unique:    a.unique,
+		Forwarded: a.forwarded,
+		Batches:   a.batches,
+		Flushes:   a.flushes,
+		MaxBatch:  a.maxBatch,
+		Dropped:   a.dropped,
+		Rejected:  a.rejected,
+		Buffered:  a.bytes,
+		OldestAge: age,
+
+		Replayed:   a.replayed,
+		ReplayTime: a.replayTime,
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+// testUpstream starts a server that records the keys it receives
+func testUpstream(t *testing.T) (*hlld.LazyClient, func() map[string][]string, func()) {
+	var lock sync.Mutex
+	keys := make(map[string][]string)
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	upstream := hlldproxy.NewServer(list, func(line string) hlldproxy.Reply {
+		fields := strings.Fields(line)
+		if fields[0] != "b" {
+			return hlldproxy.Static("Done\n")
+		}
+		if fields[1] == "missing" {
+			return hlldproxy.Static("Set does not exist\n")
+		}
+		lock.Lock()
+		keys[fields[1]] = append(keys[fields[1]], fields[2:]...)
+		lock.Unlock()
+		return hlldproxy.Static("Done\n")
+	})
+
+	client, err := hlld.NewLazyClient(upstream.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	getKeys := func() map[string][]string {
+		lock.Lock()
+		defer lock.Unlock()
+		out := make(map[string][]string)
+		for k, v := range keys {
+			sorted := append([]string(nil), v...)
+			sort.Strings(sorted)
+			out[k] = sorted
+		}
+		return out
+	}
+	stop := func() {
+		client.Close()
+		upstream.Close()
+	}
+	return client, getKeys, stop
+}
+
+func TestAggregator_Dedup(t *testing.T) {
+	client, keys, stop := testUpstream(t)
+	defer stop()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, time.Hour, 2, bufferLimit{}, logger)
+
+	for _, line := range []string{
+		"b foo a b c\n",
+		"b foo a b\n",
+		"s foo c\n",
+		"b bar a\n",
+		"b missing a\n",
+	} {
+		resp := agg.Handle(line)()
+		if resp != "Done\n" {
+			t.Fatalf("bad: %q", resp)
+		}
+	}
+	if resp := agg.Handle("b foo\n")(); !strings.HasPrefix(resp, "Client Error") {
+		t.Fatalf("bad: %q", resp)
+	}
+
+	// Nothing is forwarded until the flush
+	if out := keys(); len(out) != 0 {
+		t.Fatalf("bad: %v", out)
+	}
+	agg.Close()
+
+	out := keys()
+	if strings.Join(out["foo"], ",") != "a,b,c" {
+		t.Fatalf("bad: %v", out)
+	}
+	if strings.Join(out["bar"], ",") != "a" {
+		t.Fatalf("bad: %v", out)
+	}
+
+	received, forwarded := agg.stats()
+	if received != 8 || forwarded != 4 {
+		t.Fatalf("bad: %d %d", received, forwarded)
+	}
+}
+
+func TestAggregator_Window(t *testing.T) {
+	client, keys, stop := testUpstream(t)
+	defer stop()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, 10*time.Millisecond, defaultMaxBatch, bufferLimit{}, logger)
+	defer agg.Close()
+
+	agg.Handle("b foo a\n")()
+	time.Sleep(50 * time.Millisecond)
+	if out := keys(); len(out["foo"]) != 1 {
+		t.Fatalf("bad: %v", out)
+	}
+}
+
+func TestAggregator_Redial(t *testing.T) {
+	client, keys, stop := testUpstream(t)
+	defer stop()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	agg.Handle("b foo a\n")()
+	agg.flush()
+
+	// Lose the upstream connection, which is redialed by the next flush
+	conn, err := client.Client()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	conn.Close()
+	agg.Handle("b foo b\n")()
+	if failed := agg.Close(); len(failed) != 0 {
+		t.Fatalf("bad: %v", failed)
+	}
+	if out := keys(); strings.Join(out["foo"], ",") != "a,b" {
+		t.Fatalf("bad: %v", out)
+	}
+}
+
+func TestAggregator_Forward(t *testing.T) {
+	client, _, stop := testUpstream(t)
+	defer stop()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	defer agg.Close()
+
+	if resp := agg.Handle("drop foo\n")(); resp != "Done\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+}
+
+func TestAggregator_Restore(t *testing.T) {
+	client, keys, stop := testUpstream(t)
+	defer stop()
+
+	// Keys are returned if the upstream is unavailable
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	agg.Handle("b foo a b\n")()
+	agg.Handle("b missing a\n")()
+	client.Close()
+	failed := agg.Close()
+	sort.Strings(failed["foo"])
+	if len(failed) != 2 || strings.Join(failed["foo"], ",") != "a,b" {
+		t.Fatalf("bad: %v", failed)
+	}
+
+	// Restored keys are forwarded by another aggregator
+	client2, keys2, stop2 := testUpstream(t)
+	defer stop2()
+	agg = newAggregator(client2, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	agg.restore(failed, time.Now())
+	if failed := agg.Close(); len(failed) != 0 {
+		t.Fatalf("bad: %v", failed)
+	}
+	if out := keys(); len(out) != 0 {
+		t.Fatalf("bad: %v", out)
+	}
+	if out := keys2(); strings.Join(out["foo"], ",") != "a,b" {
+		t.Fatalf("bad: %v", out)
+	}
+	if received, forwarded := agg.stats(); received != 0 || forwarded != 2 {
+		t.Fatalf("bad: %d %d", received, forwarded)
+	}
+}
+
+func TestAggregator_Shutdown(t *testing.T) {
+	// The upstream accepts commands but never responds
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+	go func() {
+		for {
+			conn, err := list.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			go ioutil.ReadAll(conn)
+		}
+	}()
+	client, err := hlld.NewLazyClient(list.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	agg.Handle("b foo a b\n")()
+
+	// Keys awaiting a response are returned once the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	failed, err := agg.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err: %v", err)
+	}
+	sort.Strings(failed["foo"])
+	if len(failed) != 1 || strings.Join(failed["foo"], ",") != "a,b" {
+		t.Fatalf("bad: %v", failed)
+	}
+
+	// Writes are rejected once shutting down
+	if resp := agg.Handle("b foo c\n")(); resp != shuttingDown {
+		t.Fatalf("bad: %q", resp)
+	}
+
+	// Later calls return once the first shutdown is done
+	if failed, err := agg.Shutdown(context.Background()); err != nil || len(failed) != 0 {
+		t.Fatalf("bad: %v %v", failed, err)
+	}
+	if failed := agg.Close(); len(failed) != 0 {
+		t.Fatalf("bad: %v", failed)
+	}
+}
+
+func TestAggregator_Shedding(t *testing.T) {
+	client, keys, stop := testUpstream(t)
+	defer stop()
+	logger := log.New(ioutil.Discard, "", 0)
+
+	// Room for 3 single byte keys
+	maxBytes := 3 * keySize("a")
+	cases := []struct {
+		policy   shedPolicy
+		resp     string
+		expect   string
+		dropped  uint64
+		rejected uint64
+	}{
+		{shedDropOldest, "Done\n", "c,d,e", 2, 0},
+		{shedDropNewest, "Done\n", "a,b,c", 2, 0},
+		{shedReject, bufferFull, "a,b,c", 0, 2},
+	}
+	for _, tc := range cases {
+		name := string(tc.policy)
+		agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{maxBytes, tc.policy}, logger)
+		if resp := agg.Handle("b " + name + " a b c\n")(); resp != "Done\n" {
+			t.Fatalf("bad: %s %q", name, resp)
+		}
+
+		// Duplicates use no memory, so they are always accepted
+		if resp := agg.Handle("b " + name + " a c\n")(); resp != "Done\n" {
+			t.Fatalf("bad: %s %q", name, resp)
+		}
+		if resp := agg.Handle("b " + name + " d e\n")(); resp != tc.resp {
+			t.Fatalf("bad: %s %q", name, resp)
+		}
+		if r := agg.report(); r.Dropped != tc.dropped || r.Rejected != tc.rejected || r.Buffered != maxBytes {
+			t.Fatalf("bad: %s %#v", name, r)
+		}
+		agg.Close()
+		if out := keys(); strings.Join(out[name], ",") != tc.expect {
+			t.Fatalf("bad: %s %v", name, out)
+		}
+		if r := agg.report(); r.Buffered != 0 {
+			t.Fatalf("bad: %s %#v", name, r)
+		}
+	}
+}
+
+func TestAggregator_RestoreShedding(t *testing.T) {
+	client, keys, stop := testUpstream(t)
+	defer stop()
+	logger := log.New(ioutil.Discard, "", 0)
+
+	// Restored keys are older than the buffered keys, so they are shed first
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{2 * keySize("a"), shedDropNewest}, logger)
+	agg.Handle("b foo c\n")()
+	agg.restore(map[string][]string{"foo": {"a", "b"}}, time.Now())
+	if r := agg.report(); r.Dropped != 1 {
+		t.Fatalf("bad: %#v", r)
+	}
+	agg.Close()
+	if out := keys(); len(out["foo"]) != 2 || out["foo"][1] != "c" {
+		t.Fatalf("bad: %v", out)
+	}
+}
+
+func TestParseShedPolicy(t *testing.T) {
+	for _, s := range []string{"drop-oldest", "drop-newest", "reject"} {
+		if p, err := parseShedPolicy(s); err != nil || string(p) != s {
+			t.Fatalf("bad: %v %v", p, err)
+		}
+	}
+	if _, err := parseShedPolicy("block"); err == nil {
+		t.Fatalf("expect error")
+	}
+}
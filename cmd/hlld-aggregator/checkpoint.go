@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// saveCheckpoint is used to save the keys that could not be forwarded,
+// so they can be restored after a restart. The file is replaced
+// atomically, and removed if there are no keys to save.
+func saveCheckpoint(path string, keys map[string][]string) error {
+	if len(keys) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(keys); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadCheckpoint is used to load the keys saved by saveCheckpoint,
+// returning no keys if there is no checkpoint. The checkpoint is left
+// in place until the next shutdown, since forwarding the keys again
+// after a crash does not change the sets.
+func loadCheckpoint(path string) (map[string][]string, error) {
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string][]string
+	if err := json.Unmarshal(buf, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
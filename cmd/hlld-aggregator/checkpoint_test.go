@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// A missing checkpoint has no keys
+	keys, err := loadCheckpoint(path)
+	if err != nil || keys != nil {
+		t.Fatalf("bad: %v %v", keys, err)
+	}
+
+	saved := map[string][]string{"foo": {"a", "b"}, "bar": {"c"}}
+	if err := saveCheckpoint(path, saved); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keys, err = loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(keys, saved) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// Saving no keys removes the checkpoint
+	if err := saveCheckpoint(path, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := saveCheckpoint(path, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Corrupt checkpoints are rejected
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := loadCheckpoint(path); err == nil {
+		t.Fatalf("expect error")
+	}
+}
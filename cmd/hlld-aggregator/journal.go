@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// journal is a write-ahead log of the buffered keys, so that keys
+// acknowledged to clients survive a crash of the proxy. Each line is
+// a set name followed by keys, which cannot contain whitespace. The
+// journal is compacted after each window to the keys still buffered.
+//
+// Appends are written to the operating system before a write is
+// acknowledged, but are not synced to disk, which would limit the
+// write rate to that of fsync. They survive the proxy exiting, but a
+// crash of the machine loses the keys appended since the last
+// compaction, which is synced. That is at most a window of keys.
+type journal struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+// loadJournal is used to read the keys of a journal, returning no keys
+// if it does not exist. A partial last line, written when the proxy
+// crashed, is ignored.
+func loadJournal(path string) (map[string][]string, error) {
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string][]string)
+	lines := strings.Split(string(buf), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		keys[fields[0]] = append(keys[fields[0]], fields[1:]...)
+	}
+	return keys, nil
+}
+
+// openJournal is used to replace the journal with the given keys,
+// and open it for appending
+func openJournal(path string, keys map[string]map[string]struct{}) (*journal, error) {
+	j := &journal{path: path}
+	if err := j.rewrite(keys); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// errJournalClosed is returned when appending to a journal whose
+// file could not be reopened after a compaction
+var errJournalClosed = fmt.Errorf("journal is closed")
+
+// append is used to record keys, which are written
+// to the file before the write is acknowledged
+func (j *journal) append(name string, keys []string) error {
+	if j.f == nil {
+		return errJournalClosed
+	}
+	j.w.WriteString(name)
+	for _, key := range keys {
+		j.w.WriteByte(' ')
+		j.w.WriteString(key)
+	}
+	j.w.WriteByte('\n')
+	return j.w.Flush()
+}
+
+// rewrite is used to atomically replace the journal with the given
+// keys, and reopen it for appending. The current file is kept open
+// until it is replaced, so appends continue to it if the rewrite fails.
+func (j *journal) rewrite(keys map[string]map[string]struct{}) error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for name, set := range keys {
+		if len(set) == 0 {
+			continue
+		}
+		w.WriteString(name)
+		for key := range set {
+			w.WriteByte(' ')
+			w.WriteString(key)
+		}
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if j.f != nil {
+		j.f.Close()
+	}
+	if err != nil {
+		j.f, j.w = nil, nil
+		return err
+	}
+	j.f = f
+	j.w = bufio.NewWriter(f)
+	return nil
+}
+
+// Close is used to sync and close the journal
+func (j *journal) Close() error {
+	if j.f == nil {
+		return nil
+	}
+	if err := j.w.Flush(); err != nil {
+		j.f.Close()
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
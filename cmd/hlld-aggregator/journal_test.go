@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	// A missing journal has no keys
+	keys, err := loadJournal(path)
+	if err != nil || keys != nil {
+		t.Fatalf("bad: %v %v", keys, err)
+	}
+
+	j, err := openJournal(path, map[string]map[string]struct{}{
+		"foo": {"a": {}},
+		"bar": {},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := j.append("foo", []string{"b", "c"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := j.append("baz", []string{"d"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A partial line written during a crash is ignored
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f.WriteString("foo e")
+	f.Close()
+
+	keys, err = loadJournal(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 2 || strings.Join(keys["foo"], ",") != "a,b,c" || strings.Join(keys["baz"], ",") != "d" {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// Compaction replaces the keys
+	if err := j.rewrite(map[string]map[string]struct{}{"baz": {"d": {}}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keys, err = loadJournal(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 1 || strings.Join(keys["baz"], ",") != "d" {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestJournal_RewriteFailed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal")
+	j, err := openJournal(path, map[string]map[string]struct{}{"foo": {"a": {}}})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer j.Close()
+
+	// Move the journal aside, and block the rename with a directory
+	moved := filepath.Join(dir, "moved")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0700); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := j.rewrite(map[string]map[string]struct{}{"foo": {"b": {}}}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Appends continue to the original file
+	if err := j.append("foo", []string{"c"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keys, err := loadJournal(moved)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if strings.Join(keys["foo"], ",") != "a,c" {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestAggregator_Journal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	logger := log.New(ioutil.Discard, "", 0)
+
+	// Keys are journaled when acknowledged
+	client, keys, stop := testUpstream(t)
+	defer stop()
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	if _, err := agg.attachJournal(path); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	agg.Handle("b foo a b\n")()
+	agg.Handle("s bar c\n")()
+
+	// Crash without forwarding the keys
+	close(agg.stopCh)
+	<-agg.doneCh
+	if out := keys(); len(out) != 0 {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// The keys are replayed by the next aggregator
+	agg = newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	sets, err := agg.attachJournal(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sets != 2 {
+		t.Fatalf("bad: %d", sets)
+	}
+	if r := agg.report(); r.Replayed != 3 {
+		t.Fatalf("bad: %#v", r)
+	}
+	if failed := agg.Close(); len(failed) != 0 {
+		t.Fatalf("bad: %v", failed)
+	}
+	out := keys()
+	if strings.Join(out["foo"], ",") != "a,b" || strings.Join(out["bar"], ",") != "c" {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// Forwarded keys are compacted out of the journal
+	replay, err := loadJournal(path)
+	if err != nil || len(replay) != 0 {
+		t.Fatalf("bad: %v %v", replay, err)
+	}
+}
+
+func TestAggregator_JournalFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	logger := log.New(ioutil.Discard, "", 0)
+
+	// Keys that cannot be forwarded at shutdown are kept in the journal
+	client, _, stop := testUpstream(t)
+	defer stop()
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	if _, err := agg.attachJournal(path); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	agg.Handle("b foo a b\n")()
+	client.Close()
+	agg.Close()
+
+	replay, err := loadJournal(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sort.Strings(replay["foo"])
+	if len(replay) != 1 || strings.Join(replay["foo"], ",") != "a,b" {
+		t.Fatalf("bad: %v", replay)
+	}
+}
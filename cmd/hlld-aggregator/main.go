@@ -0,0 +1,138 @@
+// hlld-aggregator is a write-behind proxy that accepts set commands from
+// many application instances, deduplicates the keys in memory for a
+// configurable window, and forwards consolidated batches to the upstream
+// hlld server. This greatly reduces the write amplification upstream.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/armon/go-hlld/hlldconfig"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:4555", "address to listen on")
+	upstream := flag.String("upstream", "", "address of the hlld server")
+	configPath := flag.String("config", "", "path to a JSON configuration file")
+	window := flag.Duration("window", defaultWindow, "how long keys are aggregated before forwarding")
+	maxBatch := flag.Int("max-batch", defaultMaxBatch, "maximum number of keys per upstream command")
+	maxBuffer := flag.Int("max-buffer", defaultMaxBuffer, "approximate memory in bytes of the buffered keys, 0 for no limit")
+	shedding := flag.String("shedding", string(shedDropOldest), "policy once the buffer is full, one of drop-oldest, drop-newest or reject")
+	checkpoint := flag.String("checkpoint", "", "path to save keys that cannot be forwarded at shutdown, restored at start")
+	journalPath := flag.String("journal", "", "path to a write-ahead journal of the buffered keys, replayed at start")
+	reportInterval := flag.Duration("report", 0, "interval to log the write amplification report, 0 to only log at shutdown")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long to forward the buffered keys at shutdown before checkpointing them")
+	layers := &hlldproxy.Layers{}
+	layers.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	policy, err := parseShedPolicy(*shedding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -shedding: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Load the configuration, the upstream flag takes precedence
+	conf := &hlldconfig.Config{}
+	if *configPath != "" {
+		var err error
+		conf, err = hlldconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *upstream != "" {
+		conf.Addr = *upstream
+	}
+
+	// Dial lazily, so the upstream is redialed if the connection is lost
+	// and batches are forwarded again once it is back
+	client, err := conf.Lazy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid upstream config: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	list, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to listen: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	agg := newAggregator(client, *window, *maxBatch, bufferLimit{maxBytes: *maxBuffer, policy: policy}, logger)
+
+	// Restore the keys that could not be forwarded before a restart
+	if *checkpoint != "" {
+		sets, err := agg.restoreCheckpoint(*checkpoint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load checkpoint: %v\n", err)
+			os.Exit(1)
+		}
+		if sets > 0 {
+			logger.Printf("[INFO] Restored keys for %d sets from checkpoint", sets)
+		}
+	}
+
+	// Replay the keys acknowledged before a crash
+	if *journalPath != "" {
+		sets, err := agg.attachJournal(*journalPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open journal: %v\n", err)
+			os.Exit(1)
+		}
+		if sets > 0 {
+			logger.Printf("[INFO] Replayed keys for %d sets from journal", sets)
+		}
+	}
+
+	// Enforce the naming policy and tenants, and record the commands,
+	// if configured
+	newHandler, err := layers.Wrap(client, agg.Handle)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid proxy layers: %v\n", err)
+		os.Exit(1)
+	}
+	defer layers.Close()
+	server := hlldproxy.NewConnServer(list, newHandler)
+
+	// Periodically log the report to tune the window and batch size
+	if *reportInterval > 0 {
+		go func() {
+			for range time.Tick(*reportInterval) {
+				logger.Printf("[INFO] Report: %v", agg.report())
+			}
+		}()
+	}
+
+	// Wait for a shutdown signal, then forward the buffered keys
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	<-sigCh
+	server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	failed, err := agg.Shutdown(ctx)
+	cancel()
+	if err != nil {
+		logger.Printf("[WARN] Timed out forwarding buffered keys: %v", err)
+	}
+	if *checkpoint != "" {
+		if err := saveCheckpoint(*checkpoint, failed); err != nil {
+			logger.Printf("[ERR] Failed to save checkpoint: %v", err)
+		} else if len(failed) > 0 {
+			logger.Printf("[INFO] Saved keys for %d sets to checkpoint", len(failed))
+		}
+	}
+
+	logger.Printf("[INFO] Report: %v", agg.report())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// report describes how much the aggregator reduces the writes upstream,
+// which is used to tune the window and batch size for the distribution
+// of the keys. Keys still buffered are not included.
+type report struct {
+	// Received is the number of keys received from clients
+	Received uint64
+
+	// Unique is the number of keys left after deduplicating each window
+	Unique uint64
+
+	// Forwarded is the number of keys accepted upstream
+	Forwarded uint64
+
+	// Batches is the number of commands sent upstream
+	Batches uint64
+
+	// Flushes is the number of windows that had any keys
+	Flushes uint64
+
+	// MaxBatch is the maximum number of keys per command
+	MaxBatch int
+
+	// Dropped is the number of keys shed because the buffer was full,
+	// and Rejected the number of keys of writes rejected as a result
+	Dropped  uint64
+	Rejected uint64
+
+	// Buffered is the approximate memory of the buffered keys, and
+	// OldestAge how long the oldest of them has been buffered, which
+	// grows beyond the window while the upstream is unavailable
+	Buffered  int
+	OldestAge time.Duration
+
+	// Replayed is the number of keys restored from a checkpoint or
+	// journal at start, and ReplayTime the time taken to restore them
+	Replayed   uint64
+	ReplayTime time.Duration
+}
+
+// Suppressed returns the fraction of received keys that were duplicates
+// within their window. A low value suggests a longer window.
+func (r *report) Suppressed() float64 {
+	if r.Received == 0 {
+		return 0
+	}
+	return float64(r.Received-r.Unique) / float64(r.Received)
+}
+
+// FillRatio returns the average fraction of the maximum batch size used
+// by each command. A low value means most sets receive few keys per
+// window, so a longer window makes fuller batches.
+func (r *report) FillRatio() float64 {
+	if r.Batches == 0 || r.MaxBatch == 0 {
+		return 0
+	}
+	return float64(r.Unique) / float64(r.Batches*uint64(r.MaxBatch))
+}
+
+// KeysPerBatch returns the average number of keys per command
+func (r *report) KeysPerBatch() float64 {
+	if r.Batches == 0 {
+		return 0
+	}
+	return float64(r.Unique) / float64(r.Batches)
+}
+
+// ReplayRate returns the number of keys restored per second
+// from a checkpoint or journal
+func (r *report) ReplayRate() float64 {
+	if r.ReplayTime <= 0 {
+		return 0
+	}
+	return float64(r.Replayed) / r.ReplayTime.Seconds()
+}
+
+// String formats the report as a single log line
+func (r *report) String() string {
+	return fmt.Sprintf("received=%d unique=%d forwarded=%d suppressed=%.1f%% batches=%d flushes=%d keys_per_batch=%.1f fill=%.1f%% dropped=%d rejected=%d buffered_bytes=%d oldest_age=%v replayed=%d replay_rate=%.0f/s",
+		r.Received, r.Unique, r.Forwarded, 100*r.Suppressed(), r.Batches, r.Flushes,
+		r.KeysPerBatch(), 100*r.FillRatio(), r.Dropped, r.Rejected, r.Buffered,
+		r.OldestAge.Round(time.Millisecond), r.Replayed, r.ReplayRate())
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAggregator_Report(t *testing.T) {
+	client, _, stop := testUpstream(t)
+	defer stop()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, time.Hour, 2, bufferLimit{}, logger)
+	for _, line := range []string{
+		"b foo a b c\n",
+		"b foo a b c\n",
+		"b bar a\n",
+		"b bar a\n",
+	} {
+		agg.Handle(line)()
+	}
+	agg.flush()
+
+	// Empty windows are not counted
+	agg.flush()
+	agg.Close()
+
+	r := agg.report()
+	if r.Received != 8 || r.Unique != 4 || r.Forwarded != 4 {
+		t.Fatalf("bad: %#v", r)
+	}
+	if r.Batches != 3 || r.Flushes != 1 {
+		t.Fatalf("bad: %#v", r)
+	}
+	if r.Suppressed() != 0.5 {
+		t.Fatalf("bad: %v", r.Suppressed())
+	}
+	if r.FillRatio() != 4.0/6.0 {
+		t.Fatalf("bad: %v", r.FillRatio())
+	}
+	expect := "received=8 unique=4 forwarded=4 suppressed=50.0% batches=3 flushes=1 keys_per_batch=1.3 fill=66.7% dropped=0 rejected=0 buffered_bytes=0 oldest_age=0s replayed=0 replay_rate=0/s"
+	if r.String() != expect {
+		t.Fatalf("bad: %v", r.String())
+	}
+}
+
+func TestReport_Empty(t *testing.T) {
+	r := &report{}
+	if r.Suppressed() != 0 || r.FillRatio() != 0 || r.KeysPerBatch() != 0 || r.ReplayRate() != 0 {
+		t.Fatalf("bad: %#v", r)
+	}
+}
+
+func TestReport_ReplayRate(t *testing.T) {
+	r := &report{Replayed: 500, ReplayTime: 250 * time.Millisecond}
+	if r.ReplayRate() != 2000 {
+		t.Fatalf("bad: %v", r.ReplayRate())
+	}
+}
+
+func TestAggregator_OldestAge(t *testing.T) {
+	client, _, stop := testUpstream(t)
+	defer stop()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	defer agg.Close()
+	if r := agg.report(); r.OldestAge != 0 {
+		t.Fatalf("bad: %v", r.OldestAge)
+	}
+
+	// Restored keys keep the time they were first buffered
+	agg.Handle("b foo a\n")()
+	agg.restore(map[string][]string{"foo": {"b"}}, time.Now().Add(-time.Minute))
+	if r := agg.report(); r.OldestAge < time.Minute {
+		t.Fatalf("bad: %v", r.OldestAge)
+	}
+
+	// Flushing empties the buffer
+	agg.flush()
+	if r := agg.report(); r.OldestAge != 0 {
+		t.Fatalf("bad: %v", r.OldestAge)
+	}
+}
+
+func TestAggregator_RestoreCheckpoint(t *testing.T) {
+	client, keys, stop := testUpstream(t)
+	defer stop()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := saveCheckpoint(path, map[string][]string{"foo": {"a", "b"}, "bar": {"c"}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	logger := log.New(ioutil.Discard, "", 0)
+	agg := newAggregator(client, time.Hour, defaultMaxBatch, bufferLimit{}, logger)
+	sets, err := agg.restoreCheckpoint(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sets != 2 {
+		t.Fatalf("bad: %d", sets)
+	}
+	if r := agg.report(); r.Replayed != 3 || r.ReplayTime <= 0 {
+		t.Fatalf("bad: %#v", r)
+	}
+	agg.Close()
+	if out := keys(); len(out["foo"]) != 2 || len(out["bar"]) != 1 {
+		t.Fatalf("bad: %v", out)
+	}
+}
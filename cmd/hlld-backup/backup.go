@@ -0,0 +1,225 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/armon/go-hlld"
+)
+
+// manifestName is the name of the manifest in the archive
+const manifestName = "manifest.json"
+
+// backup is used to archive the sets of a server
+type backup struct {
+	client *hlld.Client
+
+	// prefix filters the sets that are backed up
+	prefix string
+
+	// dataDir is the optional data directory of the server. If set,
+	// the folder of each set is archived with the manifest.
+	dataDir string
+
+	// folderPrefix is prepended to a set name to get its folder
+	folderPrefix string
+}
+
+// run is used to flush the sets and write the archive, returning
+// the manifest that was archived
+func (b *backup) run(w io.Writer) (*hlld.Manifest, error) {
+	if err := b.flush(); err != nil {
+		return nil, err
+	}
+	m, err := hlld.BuildManifest(b.client, b.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeManifest(tw, m); err != nil {
+		return nil, err
+	}
+	if b.dataDir != "" {
+		names := make([]string, 0, len(m.Sets))
+		for name := range m.Sets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			folder := b.folderPrefix + name
+			if err := addDir(tw, filepath.Join(b.dataDir, folder), folder); err != nil {
+				return nil, fmt.Errorf("failed to archive set '%s': %w", name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// flush is used to flush the sets to disk before they are archived.
+// Every set is flushed at once unless filtered by a prefix.
+func (b *backup) flush() error {
+	var names []string
+	if b.prefix == "" {
+		names = []string{""}
+	} else {
+		err := b.client.ListAll(b.prefix, func(entries []*hlld.ListEntry) bool {
+			for _, e := range entries {
+				names = append(names, e.Name)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		cmd, err := hlld.NewFlushCommand(name)
+		if err != nil {
+			return err
+		}
+		f, err := b.client.Execute(cmd)
+		if err != nil {
+			return err
+		}
+		if err := f.Error(); err != nil {
+			return err
+		}
+
+		// Sets dropped since listing are not an error
+		if _, err := cmd.Result(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeManifest is used to add the manifest to the archive
+func writeManifest(tw *tar.Writer, m *hlld.Manifest) error {
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Name:    manifestName,
+		Mode:    0644,
+		Size:    int64(buf.Len()),
+		ModTime: m.Created,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(buf.Bytes())
+	return err
+}
+
+// addDir is used to add the regular files of a directory to the
+// archive under the given name
+func addDir(tw *tar.Writer, dir, name string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(name, rel))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		fh, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		_, err = io.Copy(tw, fh)
+		return err
+	})
+}
+
+// readManifest is used to read the manifest from an archive
+func readManifest(r io.Reader) (*hlld.Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive has no %s", manifestName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name == manifestName {
+			return hlld.ReadManifest(tr)
+		}
+	}
+}
+
+// verify is used to check that the sets of a manifest exist on the
+// server with the same precision and error threshold, such as after a
+// restore. It returns a description of each problem found.
+func verify(client *hlld.Client, m *hlld.Manifest) ([]string, error) {
+	names := make([]string, 0, len(m.Sets))
+	for name := range m.Sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		cmd, err := hlld.NewInfoCommand(name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := client.Execute(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Error(); err != nil {
+			return nil, err
+		}
+		info, ok, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+
+		expect := m.Sets[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: missing", name))
+		case info.Precision != expect.Precision:
+			problems = append(problems, fmt.Sprintf("%s: precision %d, expected %d",
+				name, info.Precision, expect.Precision))
+		case info.ErrThreshold != expect.ErrThreshold:
+			problems = append(problems, fmt.Sprintf("%s: eps %v, expected %v",
+				name, info.ErrThreshold, expect.ErrThreshold))
+		}
+	}
+	return problems, nil
+}
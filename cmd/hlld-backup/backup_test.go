@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+// testServer starts a server with static responses by line, and
+// records the lines received
+func testServer(t *testing.T, resps map[string]string) (*hlld.Client, func() []string, func()) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var lock sync.Mutex
+	var lines []string
+	server := hlldproxy.NewServer(list, func(line string) hlldproxy.Reply {
+		lock.Lock()
+		lines = append(lines, line)
+		lock.Unlock()
+		resp, ok := resps[line]
+		if !ok {
+			resp = "Client Error: Command not supported\n"
+		}
+		return hlldproxy.Static(resp)
+	})
+
+	client, err := hlld.Dial(server.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	got := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), lines...)
+	}
+	return client, got, func() {
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestBackup(t *testing.T) {
+	client, lines, stop := testServer(t, map[string]string{
+		"flush\n":    "Done\n",
+		"list\n":     "START\nfoo 0.01 12 10 3280\nEND\n",
+		"info foo\n": "START\neps 0.01\nprecision 12\nsize 10\nEND\n",
+	})
+	defer stop()
+
+	dir, err := ioutil.TempDir("", "hlld-backup")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "hlld.foo"), 0755); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "hlld.foo", "registers.mmap"), []byte("registers"), 0644)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var buf bytes.Buffer
+	b := &backup{
+		client:       client,
+		dataDir:      dir,
+		folderPrefix: "hlld.",
+	}
+	m, err := b.run(&buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(m.Sets) != 1 || m.Sets["foo"].Precision != 12 {
+		t.Fatalf("bad: %#v", m)
+	}
+
+	// Flushed before taking the inventory
+	if got := lines(); len(got) == 0 || got[0] != "flush\n" {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Check the contents of the archive
+	gz, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		contents, _ := ioutil.ReadAll(tr)
+		files[hdr.Name] = string(contents)
+	}
+	if len(files) != 2 || files["hlld.foo/registers.mmap"] != "registers" {
+		t.Fatalf("bad: %v", files)
+	}
+
+	out, err := readManifest(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(out.Sets, m.Sets) {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestBackup_MissingFolder(t *testing.T) {
+	client, _, stop := testServer(t, map[string]string{
+		"flush\n":    "Done\n",
+		"list\n":     "START\nfoo 0.01 12 10 3280\nEND\n",
+		"info foo\n": "START\nprecision 12\nEND\n",
+	})
+	defer stop()
+
+	dir, err := ioutil.TempDir("", "hlld-backup")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &backup{client: client, dataDir: dir, folderPrefix: "hlld."}
+	if _, err := b.run(ioutil.Discard); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	client, _, stop := testServer(t, map[string]string{
+		"info foo\n": "START\neps 0.01\nprecision 12\nEND\n",
+		"info bar\n": "START\neps 0.01\nprecision 14\nEND\n",
+		"info baz\n": "Set does not exist\n",
+	})
+	defer stop()
+
+	m := &hlld.Manifest{
+		Sets: map[string]*hlld.SetInfo{
+			"foo": {ErrThreshold: 0.01, Precision: 12},
+			"bar": {ErrThreshold: 0.01, Precision: 12},
+			"baz": {ErrThreshold: 0.01, Precision: 12},
+		},
+	}
+	problems, err := verify(client, m)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := []string{
+		"bar: precision 14, expected 12",
+		"baz: missing",
+	}
+	if !reflect.DeepEqual(problems, expect) {
+		t.Fatalf("bad: %v", problems)
+	}
+}
@@ -0,0 +1,109 @@
+// hlld-backup flushes the sets of a server and archives them with a
+// manifest of their metadata. Given the data directory of the server, the
+// folder of each set is included in the archive. After a restore, the
+// verify command checks that every set of the manifest exists with the
+// same precision and error threshold.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/armon/go-hlld/hlldconfig"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: hlld-backup [flags] backup|verify <archive>\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	addr := flag.String("addr", "", "address of the hlld server")
+	configPath := flag.String("config", "", "path to a JSON configuration file")
+	prefix := flag.String("prefix", "", "only back up sets with this prefix")
+	dataDir := flag.String("data-dir", "", "data directory of the server, to archive the set files")
+	folderPrefix := flag.String("folder-prefix", "hlld.", "prefix of the folder of each set in the data directory")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 || (args[0] != "backup" && args[0] != "verify") {
+		usage()
+		os.Exit(1)
+	}
+	mode, path := args[0], args[1]
+
+	// Load the configuration, the address flag takes precedence
+	conf := &hlldconfig.Config{}
+	if *configPath != "" {
+		var err error
+		conf, err = hlldconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *addr != "" {
+		conf.Addr = *addr
+	}
+
+	client, err := conf.Dial()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	if mode == "backup" {
+		fh, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create archive: %v\n", err)
+			os.Exit(1)
+		}
+		b := &backup{
+			client:       client,
+			prefix:       *prefix,
+			dataDir:      *dataDir,
+			folderPrefix: *folderPrefix,
+		}
+		m, err := b.run(fh)
+		if err == nil {
+			err = fh.Close()
+		}
+		if err != nil {
+			fh.Close()
+			os.Remove(path)
+			fmt.Fprintf(os.Stderr, "Failed to back up: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Backed up %d sets to %s\n", len(m.Sets), path)
+		return
+	}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open archive: %v\n", err)
+		os.Exit(1)
+	}
+	defer fh.Close()
+	m, err := readManifest(fh)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read manifest: %v\n", err)
+		os.Exit(1)
+	}
+	problems, err := verify(client, m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to verify: %v\n", err)
+		os.Exit(1)
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	fmt.Printf("Verified %d sets, %d problems\n", len(m.Sets), len(problems))
+
+	// Exit with a distinct code so the tool can be used in scripts
+	if len(problems) > 0 {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+const (
+	// defaultTTL is the default lifetime of a cached response
+	defaultTTL = 5 * time.Second
+
+	// defaultMaxEntries is the default number of cached responses
+	defaultMaxEntries = 10000
+)
+
+// cacheEntry is a cached response
+type cacheEntry struct {
+	line    string
+	resp    string
+	expires time.Time
+}
+
+// cache is used to serve read commands from a local cache and
+// forward everything else to the upstream server
+type cache struct {
+	client     hlld.Executor
+	ttl        time.Duration
+	maxEntries int
+
+	// entries holds the elements of lru, which is ordered from the most
+	// to the least recently used. gen is incremented by each purge, so
+	// that a response to a read forwarded before the purge is not stored
+	// after it. Expired entries are swept at most once per ttl.
+	entries   map[string]*list.Element
+	lru       *list.List
+	gen       uint64
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// newCache creates a new cache in front of the client, holding
+// up to maxEntries responses
+func newCache(client hlld.Executor, ttl time.Duration, maxEntries int) *cache {
+	return &cache{
+		client:     client,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		lastSweep:  time.Now(),
+	}
+}
+
+// Handle is used to serve a single command line
+func (c *cache) Handle(line string) hlldproxy.Reply {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return hlldproxy.Static(hlldproxy.UnsupportedCommand)
+	}
+
+	switch fields[0] {
+	case "info", "list":
+		return c.read(line)
+
+	case "create", "drop", "close", "clear":
+		// These commands change the set inventory, purge the cache
+		c.purge()
+	}
+	return hlldproxy.Forward(c.client, line)
+}
+
+// read serves a read command from the cache if possible
+func (c *cache) read(line string) hlldproxy.Reply {
+	c.lock.Lock()
+	resp, ok := c.lookup(line)
+	gen := c.gen
+	c.lock.Unlock()
+	if ok {
+		return hlldproxy.Static(resp)
+	}
+
+	// Forward and store the response if the command succeeded,
+	// unless the cache was purged in the meantime
+	reply := hlldproxy.Forward(c.client, line)
+	return func() string {
+		resp := reply()
+		if !strings.HasPrefix(resp, "START\n") {
+			return resp
+		}
+		c.lock.Lock()
+		if c.gen == gen {
+			c.store(line, resp)
+		}
+		c.lock.Unlock()
+		return resp
+	}
+}
+
+// lookup returns the cached response to a line if it has not expired,
+// and must be called with the lock held
+func (c *cache) lookup(line string) (string, bool) {
+	elem, ok := c.entries[line]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expires) {
+		c.remove(elem)
+		return "", false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.resp, true
+}
+
+// store is used to cache the response to a line, evicting the least
+// recently used entries beyond the limit, and must be called with
+// the lock held
+func (c *cache) store(line, resp string) {
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= c.ttl {
+		c.sweep(now)
+	}
+
+	entry := &cacheEntry{
+		line:    line,
+		resp:    resp,
+		expires: now.Add(c.ttl),
+	}
+	if elem, ok := c.entries[line]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[line] = c.lru.PushFront(entry)
+	}
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// sweep is used to remove the expired entries, and must
+// be called with the lock held
+func (c *cache) sweep(now time.Time) {
+	c.lastSweep = now
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if !now.Before(elem.Value.(*cacheEntry).expires) {
+			c.remove(elem)
+		}
+		elem = next
+	}
+}
+
+// remove is used to remove an entry, and must be called with the lock held
+func (c *cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).line)
+}
+
+// purge is used to remove all cached responses
+func (c *cache) purge() {
+	c.lock.Lock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.gen++
+	c.lock.Unlock()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+// testProxy starts an upstream server that counts the commands it
+// receives, and a caching proxy in front of it
+func testProxy(t *testing.T, ttl time.Duration) (*hlld.Client, func() map[string]int, func()) {
+	var lock sync.Mutex
+	counts := make(map[string]int)
+	upList, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	upstream := hlldproxy.NewServer(upList, func(line string) hlldproxy.Reply {
+		lock.Lock()
+		counts[line]++
+		lock.Unlock()
+		switch line {
+		case "info foo\n":
+			return hlldproxy.Static("START\nsize 10\nEND\n")
+		case "info missing\n":
+			return hlldproxy.Static("Set does not exist\n")
+		}
+		return hlldproxy.Static("Done\n")
+	})
+
+	upClient, err := hlld.NewLazyClient(upstream.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	proxy := hlldproxy.NewServer(list, newCache(upClient, ttl, defaultMaxEntries).Handle)
+
+	client, err := hlld.Dial(proxy.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	getCounts := func() map[string]int {
+		lock.Lock()
+		defer lock.Unlock()
+		out := make(map[string]int)
+		for k, v := range counts {
+			out[k] = v
+		}
+		return out
+	}
+	stop := func() {
+		client.Close()
+		proxy.Close()
+		upClient.Close()
+		upstream.Close()
+	}
+	return client, getCounts, stop
+}
+
+// info is used to query the size of a set
+func info(t *testing.T, client *hlld.Client) uint64 {
+	cmd, _ := hlld.NewInfoCommand("foo")
+	f, err := client.Execute(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	setInfo, ok, err := cmd.Result()
+	if err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	return setInfo.Size
+}
+
+func TestCache_Info(t *testing.T) {
+	client, counts, stop := testProxy(t, time.Minute)
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		if size := info(t, client); size != 10 {
+			t.Fatalf("bad: %d", size)
+		}
+	}
+	if n := counts()["info foo\n"]; n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Dropping a set purges the cache
+	drop, _ := hlld.NewDropCommand("foo")
+	f, err := client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	info(t, client)
+	if n := counts()["info foo\n"]; n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestCache_Expire(t *testing.T) {
+	client, counts, stop := testProxy(t, 10*time.Millisecond)
+	defer stop()
+
+	info(t, client)
+	time.Sleep(20 * time.Millisecond)
+	info(t, client)
+	if n := counts()["info foo\n"]; n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestCache_ForwardWrites(t *testing.T) {
+	client, counts, stop := testProxy(t, time.Minute)
+	defer stop()
+
+	for i := 0; i < 2; i++ {
+		cmd, _ := hlld.NewSetKeysCommand("foo", []string{"bar"})
+		f, err := client.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if n := counts()["b foo bar\n"]; n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestCache_Errors(t *testing.T) {
+	client, counts, stop := testProxy(t, time.Minute)
+	defer stop()
+
+	// Failed reads are not cached
+	for i := 0; i < 2; i++ {
+		cmd, _ := hlld.NewInfoCommand("missing")
+		f, err := client.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, ok, err := cmd.Result(); err != nil || ok {
+			t.Fatalf("bad: %v %v", ok, err)
+		}
+	}
+	if n := counts()["info missing\n"]; n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestCache_PurgeInFlight(t *testing.T) {
+	releaseCh := make(chan struct{})
+	upList, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	upstream := hlldproxy.NewServer(upList, func(line string) hlldproxy.Reply {
+		if line == "list\n" {
+			return func() string {
+				<-releaseCh
+				return "START\nfoo 0.01 14 0 0\nEND\n"
+			}
+		}
+		return hlldproxy.Static("Done\n")
+	})
+	defer upstream.Close()
+
+	upClient, err := hlld.NewLazyClient(upstream.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer upClient.Close()
+	c := newCache(upClient, time.Minute, defaultMaxEntries)
+
+	// The list is answered after the drop purges the cache,
+	// so its response is stale and must not be stored
+	reply := c.Handle("list\n")
+	drop := c.Handle("drop foo\n")
+	close(releaseCh)
+	reply()
+	drop()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.entries) != 0 {
+		t.Fatalf("bad: %v", c.entries)
+	}
+}
+
+func TestCache_Evict(t *testing.T) {
+	c := newCache(nil, time.Minute, 2)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.store("info a\n", "START\nEND\n")
+	c.store("info b\n", "START\nEND\n")
+
+	// Using a makes b the least recently used
+	if _, ok := c.lookup("info a\n"); !ok {
+		t.Fatalf("expected entry")
+	}
+	c.store("info c\n", "START\nEND\n")
+	if _, ok := c.lookup("info b\n"); ok {
+		t.Fatalf("expected eviction")
+	}
+	if len(c.entries) != 2 || c.lru.Len() != 2 {
+		t.Fatalf("bad: %v", c.entries)
+	}
+}
+
+func TestCache_Sweep(t *testing.T) {
+	c := newCache(nil, 10*time.Millisecond, defaultMaxEntries)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.store("info a\n", "START\nEND\n")
+	c.store("info b\n", "START\nEND\n")
+
+	// Expired entries are removed without being read again
+	time.Sleep(20 * time.Millisecond)
+	c.store("info c\n", "START\nEND\n")
+	if len(c.entries) != 1 || c.lru.Len() != 1 {
+		t.Fatalf("bad: %v", c.entries)
+	}
+}
@@ -0,0 +1,78 @@
+// hlld-cache is a protocol compatible proxy that caches the responses
+// of info and list commands for a short time, and forwards all other
+// commands to the upstream hlld server. It is used to reduce the read
+// load caused by many dashboard clients.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/armon/go-hlld/hlldconfig"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:4554", "address to listen on")
+	upstream := flag.String("upstream", "", "address of the hlld server")
+	configPath := flag.String("config", "", "path to a JSON configuration file")
+	ttl := flag.Duration("ttl", defaultTTL, "how long responses are cached")
+	maxEntries := flag.Int("max-entries", defaultMaxEntries, "maximum number of cached responses")
+	layers := &hlldproxy.Layers{}
+	layers.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Load the configuration, the upstream flag takes precedence
+	conf := &hlldconfig.Config{}
+	if *configPath != "" {
+		var err error
+		conf, err = hlldconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *upstream != "" {
+		conf.Addr = *upstream
+	}
+
+	// Dial lazily, so the upstream is redialed if the connection is lost
+	client, err := conf.Lazy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid upstream config: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	if *maxEntries <= 0 {
+		fmt.Fprintf(os.Stderr, "Max entries must be positive\n")
+		os.Exit(1)
+	}
+
+	list, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to listen: %v\n", err)
+		os.Exit(1)
+	}
+
+	c := newCache(client, *ttl, *maxEntries)
+
+	// Enforce the naming policy and tenants, and record the commands,
+	// if configured
+	newHandler, err := layers.Wrap(client, c.Handle)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid proxy layers: %v\n", err)
+		os.Exit(1)
+	}
+	defer layers.Close()
+	server := hlldproxy.NewConnServer(list, newHandler)
+	defer server.Close()
+
+	// Wait for a shutdown signal
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	<-sigCh
+}
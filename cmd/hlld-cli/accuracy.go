@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/armon/go-hlld"
+)
+
+// accuracyCommand is used to validate the accuracy of a server
+// configuration by writing a known number of unique keys to a set
+func accuracyCommand(m *meta, args []string) int {
+	out := m.out
+	flags := flag.NewFlagSet("accuracy", flag.ContinueOnError)
+	flags.SetOutput(out)
+	name := flags.String("set", "hlld_cli_accuracy", "name of the set to create")
+	keys := flags.Int("keys", 100000, "number of unique keys to add")
+	precision := flags.Int("precision", 0, "precision of the set, server default if zero")
+	keep := flags.Bool("keep", false, "keep the set instead of dropping it")
+	formatFlag := flags.String("format", "text", "output format, one of text, json or a Go template such as '{{.ObservedError}}'")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	format, err := parseFormat(*formatFlag)
+	if err == nil && format.name == "csv" {
+		err = fmt.Errorf("csv is not supported")
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Invalid format: %v\n", err)
+		return 1
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		fmt.Fprintf(out, "Failed to connect: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	report, err := hlld.MeasureAccuracy(client, *name, *keys, *precision)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to measure accuracy: %v\n", err)
+		return 1
+	}
+
+	// Clean up the set unless asked to keep it
+	if !*keep {
+		drop, err := hlld.NewDropCommand(*name)
+		if err == nil {
+			var f *hlld.Future
+			if f, err = client.Execute(drop); err == nil {
+				err = f.Error()
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Failed to drop set: %v\n", err)
+		}
+	}
+
+	switch format.name {
+	case "json":
+		err = writeJSON(out, report)
+	case "template":
+		err = format.writeTemplate(out, report)
+	default:
+		writeAccuracy(out, report)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Failed to write output: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeAccuracy is used to write a report as text
+func writeAccuracy(out io.Writer, report *hlld.AccuracyReport) {
+	fmt.Fprintf(out, "Set:               %s\n", report.SetName)
+	fmt.Fprintf(out, "Precision:         %d\n", report.Precision)
+	fmt.Fprintf(out, "Keys:              %d\n", report.Keys)
+	fmt.Fprintf(out, "Estimated size:    %d\n", report.Size)
+	fmt.Fprintf(out, "Observed error:    %.4f%%\n", report.ObservedError*100)
+	fmt.Fprintf(out, "Theoretical error: %.4f%%\n", report.TheoreticalError*100)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/armon/go-hlld"
+)
+
+// broadcastCommand is used to send a raw command, such as a flush,
+// to every server of a cluster and show the response of each
+func broadcastCommand(m *meta, args []string) int {
+	out := m.out
+	flags := flag.NewFlagSet("broadcast", flag.ContinueOnError)
+	flags.SetOutput(out)
+	addrs := flags.String("addrs", "", "comma separated addresses of the servers, defaults to the configured address")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	line := strings.Join(flags.Args(), " ")
+	if _, err := hlld.NewRawCommand(line); err != nil {
+		fmt.Fprintf(out, "Invalid command: %v\n", err)
+		return 1
+	}
+
+	names := []string{m.config.Address()}
+	if *addrs != "" {
+		names = strings.Split(*addrs, ",")
+	}
+
+	// Connect to every server, failing if any cannot be reached
+	// so that maintenance is never applied to part of the cluster
+	servers := make(map[string]hlld.Executor, len(names))
+	for _, addr := range names {
+		conf := *m.config
+		conf.Addr = strings.TrimSpace(addr)
+		client, err := conf.Dial()
+		if err != nil {
+			fmt.Fprintf(out, "Failed to connect to %s: %v\n", conf.Addr, err)
+			return 1
+		}
+		defer client.Close()
+		servers[conf.Addr] = client
+	}
+
+	code := 0
+	results := hlld.Broadcast(servers, func() (hlld.Command, error) {
+		return hlld.NewRawCommand(line)
+	})
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(out, "%s: error: %v\n", r.Name, r.Err)
+			code = 1
+			continue
+		}
+		resp, _ := r.Command.(*hlld.RawCommand).Result()
+		if strings.HasPrefix(resp, "Client Error") || strings.HasPrefix(resp, "Internal Error") {
+			code = 1
+		}
+		if strings.HasPrefix(resp, "START\n") {
+			fmt.Fprintf(out, "%s:\n%s", r.Name, resp)
+		} else {
+			fmt.Fprintf(out, "%s: %s", r.Name, resp)
+		}
+	}
+	return code
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestBroadcastCommand(t *testing.T) {
+	addr1, stop1 := testServer(t, map[string]string{
+		"flush\n":    "Done\n",
+		"list foo\n": "START\nfoo1 0.01 12 100 3280\nEND\n",
+	})
+	defer stop1()
+	addr2, stop2 := testServer(t, map[string]string{
+		"flush\n": "Done\n",
+	})
+	defer stop2()
+	addrs := addr1 + "," + addr2
+
+	var out bytes.Buffer
+	code := realMain([]string{"broadcast", "-addrs", addrs, "flush"}, &out)
+	if code != 0 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	first, second := addr1, addr2
+	if second < first {
+		first, second = second, first
+	}
+	expect := fmt.Sprintf("%s: Done\n%s: Done\n", first, second)
+	if out.String() != expect {
+		t.Fatalf("bad: %s", out.String())
+	}
+
+	// A failure on one server is shown with the others
+	out.Reset()
+	code = realMain([]string{"broadcast", "-addrs", addrs, "list", "foo"}, &out)
+	if code != 1 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if !bytes.Contains(out.Bytes(), []byte(addr1+":\nSTART\nfoo1 0.01 12 100 3280\nEND\n")) ||
+		!bytes.Contains(out.Bytes(), []byte(addr2+": Client Error: Command not supported\n")) {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
+
+func TestBroadcastCommand_Invalid(t *testing.T) {
+	var out bytes.Buffer
+	if code := realMain([]string{"broadcast"}, &out); code != 1 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if !bytes.Contains(out.Bytes(), []byte("Invalid command")) {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/armon/go-hlld/conformance"
+)
+
+// conformanceCommand is used to check the server implements
+// the semantics of the protocol expected by the client
+func conformanceCommand(m *meta, args []string) int {
+	out := m.out
+	flags := flag.NewFlagSet("conformance", flag.ContinueOnError)
+	flags.SetOutput(out)
+	prefix := flags.String("prefix", conformance.DefaultPrefix, "prefix of the sets created by the checks")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		fmt.Fprintf(out, "Failed to connect: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	results, err := conformance.Run(client, *prefix)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to run checks: %v\n", err)
+		return 1
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Passed() {
+			fmt.Fprintf(out, "PASS  %-18s %v\n", r.Name, r.Duration)
+		} else {
+			failed++
+			fmt.Fprintf(out, "FAIL  %-18s %v\n", r.Name, r.Err)
+		}
+	}
+	fmt.Fprintf(out, "\n%d of %d checks passed\n", len(results)-failed, len(results))
+	if failed > 0 {
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConformanceCommand(t *testing.T) {
+	addr, stop := testServer(t, map[string]string{
+		"list hlld-conformance\n": "START\nEND\n",
+	})
+	defer stop()
+
+	var out bytes.Buffer
+	code := realMain([]string{"-addr", addr, "conformance"}, &out)
+	if code != 2 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	for _, expect := range []string{
+		"FAIL  create ",
+		"PASS  unsupported ",
+		"1 of 13 checks passed",
+	} {
+		if !strings.Contains(out.String(), expect) {
+			t.Fatalf("missing %q: %s", expect, out.String())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// formatUsage is the usage of the format flag of the subcommands
+const formatUsage = "output format, one of text, json, csv or a Go template such as '{{.Name}} {{.Size}}'"
+
+// outputFormat is a parsed format flag. Formats containing an action,
+// such as {{.Name}}, are parsed as Go templates.
+type outputFormat struct {
+	// name is text, json, csv or template
+	name string
+
+	// tmpl is the template, if the name is template
+	tmpl *template.Template
+}
+
+// templateFuncs are the functions available to templates
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		buf, err := json.Marshal(v)
+		return string(buf), err
+	},
+}
+
+// parseFormat is used to parse a format flag
+func parseFormat(format string) (*outputFormat, error) {
+	switch format {
+	case "text", "json", "csv":
+		return &outputFormat{name: format}, nil
+	}
+	if !strings.Contains(format, "{{") {
+		return nil, fmt.Errorf("unknown format '%s'", format)
+	}
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return &outputFormat{name: "template", tmpl: tmpl}, nil
+}
+
+// writeTemplate is used to execute the template for each
+// item, writing each result on its own line
+func (f *outputFormat) writeTemplate(out io.Writer, items ...interface{}) error {
+	for _, item := range items {
+		if err := f.tmpl.Execute(out, item); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(out, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON is used to write a value as indented JSON
+func writeJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "    ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"text", "json", "csv"} {
+		f, err := parseFormat(name)
+		if err != nil || f.name != name || f.tmpl != nil {
+			t.Fatalf("bad: %v %v", f, err)
+		}
+	}
+
+	f, err := parseFormat("{{.Name}}")
+	if err != nil || f.name != "template" || f.tmpl == nil {
+		t.Fatalf("bad: %v %v", f, err)
+	}
+
+	for _, format := range []string{"", "xml", "{{.Name"} {
+		if _, err := parseFormat(format); err == nil {
+			t.Fatalf("expected error for %q", format)
+		}
+	}
+}
+
+func TestOutputFormat_WriteTemplate(t *testing.T) {
+	f, err := parseFormat("{{.A}} {{json .}}")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var out bytes.Buffer
+	items := []interface{}{
+		struct{ A int }{1},
+		struct{ A int }{2},
+	}
+	if err := f.writeTemplate(&out, items...); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.String() != "1 {\"A\":1}\n2 {\"A\":2}\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+
+	// Execution errors are returned
+	f, _ = parseFormat("{{.Missing}}")
+	if err := f.writeTemplate(&out, items[0]); err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/armon/go-hlld"
+)
+
+// listCommand is used to list the sets matching an optional prefix
+func listCommand(m *meta, args []string) int {
+	out := m.out
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.SetOutput(out)
+	formatFlag := flags.String("format", "text", formatUsage)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	format, err := parseFormat(*formatFlag)
+	if err != nil {
+		fmt.Fprintf(out, "Invalid format: %v\n", err)
+		return 1
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		fmt.Fprintf(out, "Failed to connect: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	var entries []*hlld.ListEntry
+	err = client.ListAll(flags.Arg(0), func(page []*hlld.ListEntry) bool {
+		entries = append(entries, page...)
+		return true
+	})
+	if err != nil {
+		fmt.Fprintf(out, "Failed to list sets: %v\n", err)
+		return 1
+	}
+
+	switch format.name {
+	case "json":
+		err = writeJSON(out, entries)
+	case "csv":
+		err = hlld.WriteListCSV(out, entries)
+	case "template":
+		items := make([]interface{}, len(entries))
+		for idx, e := range entries {
+			items[idx] = e
+		}
+		err = format.writeTemplate(out, items...)
+	default:
+		for _, e := range entries {
+			fmt.Fprintf(out, "%s %v %d %d %d\n", e.Name, e.ErrThreshold,
+				e.Precision, e.Size, e.Storage)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Failed to write output: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// infoCommand is used to query every set matching a prefix
+func infoCommand(m *meta, args []string) int {
+	out := m.out
+	flags := flag.NewFlagSet("info", flag.ContinueOnError)
+	flags.SetOutput(out)
+	formatFlag := flags.String("format", "text", formatUsage)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	format, err := parseFormat(*formatFlag)
+	if err != nil {
+		fmt.Fprintf(out, "Invalid format: %v\n", err)
+		return 1
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		fmt.Fprintf(out, "Failed to connect: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	infos, err := client.InfoByPrefix(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(out, "Failed to query sets: %v\n", err)
+		return 1
+	}
+
+	switch format.name {
+	case "json":
+		err = writeJSON(out, infos)
+	case "csv":
+		err = hlld.WriteInfoCSV(out, infos)
+	case "template":
+		items := make([]interface{}, 0, len(infos))
+		for _, name := range sortedNames(infos) {
+			items = append(items, &infoItem{Name: name, SetInfo: infos[name]})
+		}
+		err = format.writeTemplate(out, items...)
+	default:
+		for _, name := range sortedNames(infos) {
+			i := infos[name]
+			fmt.Fprintf(out, "%s: precision=%d eps=%v size=%d storage=%d in_memory=%v\n",
+				name, i.Precision, i.ErrThreshold, i.Size, i.Storage, i.InMemory)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Failed to write output: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// infoItem is the value of a template for the info of a set,
+// exposing the name of the set with the fields of its info
+type infoItem struct {
+	Name string
+	*hlld.SetInfo
+}
+
+// sortedNames returns the names of the sets in order
+func sortedNames(infos map[string]*hlld.SetInfo) []string {
+	names := make([]string, 0, len(infos))
+	for name := range infos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
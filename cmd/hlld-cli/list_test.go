@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+// testServer starts a server that responds to each line with the
+// given responses, returning the address
+func testServer(t *testing.T, responses map[string]string) (string, func()) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := list.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				bufR := bufio.NewReader(conn)
+				for {
+					line, err := bufR.ReadString('\n')
+					if err != nil {
+						return
+					}
+					resp, ok := responses[line]
+					if !ok {
+						resp = "Client Error: Command not supported\n"
+					}
+					if _, err := conn.Write([]byte(resp)); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return list.Addr().String(), func() { list.Close() }
+}
+
+func TestListCommand(t *testing.T) {
+	addr, stop := testServer(t, map[string]string{
+		"list foo\n": "START\nfoo1 0.01 12 100 3280\nEND\n",
+	})
+	defer stop()
+
+	var out bytes.Buffer
+	code := realMain([]string{"-addr", addr, "list", "-format", "csv", "foo"}, &out)
+	if code != 0 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if out.String() != "name,eps,precision,size,storage\nfoo1,0.01,12,100,3280\n" {
+		t.Fatalf("bad: %s", out.String())
+	}
+
+	out.Reset()
+	code = realMain([]string{"-addr", addr, "list", "-format", "json", "foo"}, &out)
+	if code != 0 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), `"name": "foo1"`) {
+		t.Fatalf("bad: %s", out.String())
+	}
+
+	out.Reset()
+	code = realMain([]string{"-addr", addr, "list", "-format", "{{.Name}}={{.Size}}", "foo"}, &out)
+	if code != 0 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if out.String() != "foo1=100\n" {
+		t.Fatalf("bad: %s", out.String())
+	}
+
+	out.Reset()
+	code = realMain([]string{"-addr", addr, "list", "-format", "xml"}, &out)
+	if code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+}
+
+func TestInfoCommand(t *testing.T) {
+	addr, stop := testServer(t, map[string]string{
+		"list foo\n":  "START\nfoo1 0.01 12 100 3280\nEND\n",
+		"info foo1\n": "START\nin_memory 1\nprecision 12\nsize 100\nEND\n",
+	})
+	defer stop()
+
+	var out bytes.Buffer
+	code := realMain([]string{"-addr", addr, "info", "foo"}, &out)
+	if code != 0 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "foo1: precision=12") {
+		t.Fatalf("bad: %s", out.String())
+	}
+
+	out.Reset()
+	code = realMain([]string{"-addr", addr, "info", "-format", "{{.Name}} {{.Precision}} {{.InMemory}}", "foo"}, &out)
+	if code != 0 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if out.String() != "foo1 12 true\n" {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
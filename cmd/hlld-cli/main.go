@@ -0,0 +1,132 @@
+// hlld-cli is a command line tool for interacting with an hlld server
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldconfig"
+)
+
+// command is a subcommand of the CLI
+type command struct {
+	// synopsis is a one line description of the command
+	synopsis string
+
+	// run invokes the command with the remaining arguments,
+	// returning the exit code
+	run func(m *meta, args []string) int
+}
+
+// meta is the state shared by all the subcommands
+type meta struct {
+	// config is the loaded configuration
+	config *hlldconfig.Config
+
+	// in is where interactive input is read
+	in io.Reader
+
+	// out is where output is written
+	out io.Writer
+}
+
+// dial is used to connect to the configured server
+func (m *meta) dial() (*hlld.Client, error) {
+	return m.config.Dial()
+}
+
+// commands is the set of available subcommands
+var commands = map[string]*command{
+	"accuracy": {
+		synopsis: "Measure the observed vs theoretical error of a set",
+		run:      accuracyCommand,
+	},
+	"broadcast": {
+		synopsis: "Send a command to every server of a cluster",
+		run:      broadcastCommand,
+	},
+	"conformance": {
+		synopsis: "Check the server conforms to the protocol",
+		run:      conformanceCommand,
+	},
+	"info": {
+		synopsis: "Show the details of the sets matching a prefix",
+		run:      infoCommand,
+	},
+	"list": {
+		synopsis: "List the sets matching an optional prefix",
+		run:      listCommand,
+	},
+	"shell": {
+		synopsis: "Start an interactive shell",
+		run:      shellCommand,
+	},
+	"watch": {
+		synopsis: "Show the size and storage of a set over time",
+		run:      watchCommand,
+	},
+}
+
+func main() {
+	os.Exit(realMain(os.Args[1:], os.Stdout))
+}
+
+// realMain parses the global flags and dispatches to a subcommand
+func realMain(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("hlld-cli", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() { usage(out) }
+	addr := flags.String("addr", "", "address of the hlld server")
+	configPath := flags.String("config", "", "path to a JSON configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	// Load the configuration, the address flag takes precedence
+	m := &meta{
+		config: &hlldconfig.Config{},
+		in:     os.Stdin,
+		out:    out,
+	}
+	if *configPath != "" {
+		conf, err := hlldconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(out, "Failed to load config: %v\n", err)
+			return 1
+		}
+		m.config = conf
+	}
+	if *addr != "" {
+		m.config.Addr = *addr
+	}
+
+	if flags.NArg() == 0 {
+		usage(out)
+		return 1
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(out, "Unknown command: %s\n", flags.Arg(0))
+		usage(out)
+		return 1
+	}
+	return cmd.run(m, flags.Args()[1:])
+}
+
+// usage prints the available commands
+func usage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: hlld-cli [-addr host:port] [-config path] <command> [args]\n\n")
+	fmt.Fprintf(out, "Available commands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "    %-12s %s\n", name, commands[name].synopsis)
+	}
+}
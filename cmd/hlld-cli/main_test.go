@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRealMain_Usage(t *testing.T) {
+	var out bytes.Buffer
+	if code := realMain(nil, &out); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	if !strings.Contains(out.String(), "accuracy") {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
+
+func TestRealMain_UnknownCommand(t *testing.T) {
+	var out bytes.Buffer
+	if code := realMain([]string{"nope"}, &out); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	if !strings.Contains(out.String(), "Unknown command: nope") {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
+
+func TestRealMain_BadConfig(t *testing.T) {
+	var out bytes.Buffer
+	code := realMain([]string{"-config", "/does/not/exist", "accuracy"}, &out)
+	if code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	if !strings.Contains(out.String(), "Failed to load config") {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/armon/go-hlld"
+)
+
+// shellCommands are the commands of the protocol completed by the shell,
+// mapped to whether their first argument is a set name
+var shellCommands = map[string]bool{
+	"create": true,
+	"list":   false,
+	"drop":   true,
+	"close":  true,
+	"clear":  true,
+	"set":    true,
+	"s":      true,
+	"bulk":   true,
+	"b":      true,
+	"info":   true,
+	"flush":  true,
+}
+
+// shellBuiltins are the commands handled by the shell itself
+var shellBuiltins = []string{"connect", "exit", "help", "history", "quit"}
+
+// shellHelp describes the builtins of the shell
+const shellHelp = `Commands are sent to the server as typed, such as "list" or "set foo bar".
+End a line with "?" or a tab to show the completions of its last word.
+
+Builtins:
+    connect <addr>  Switch to another server
+    history         Show the command history
+    !<n>, !!        Repeat command n of the history, or the last command
+    help            Show this help
+    exit, quit      Leave the shell
+`
+
+// shell is the state of an interactive session
+type shell struct {
+	m       *meta
+	client  *hlld.Client
+	addr    string
+	history *history
+}
+
+// shellCommand is used to start an interactive session
+func shellCommand(m *meta, args []string) int {
+	out := m.out
+	flags := flag.NewFlagSet("shell", flag.ContinueOnError)
+	flags.SetOutput(out)
+	historyPath := flags.String("history", defaultHistoryPath(), "path of the history file, empty to disable")
+	historySize := flags.Int("history-size", 1000, "number of commands kept in the history file")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	hist, err := loadHistory(*historyPath, *historySize)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to load history: %v\n", err)
+		return 1
+	}
+	s := &shell{m: m, history: hist}
+	s.connect(m.config.Address())
+	defer func() {
+		if s.client != nil {
+			s.client.Close()
+		}
+	}()
+
+	s.run()
+	if err := hist.save(); err != nil {
+		fmt.Fprintf(out, "Failed to save history: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// run reads and executes lines until the input ends or the user exits
+func (s *shell) run() {
+	out := s.m.out
+	scanner := bufio.NewScanner(s.m.in)
+	for {
+		fmt.Fprintf(out, "%s> ", s.addr)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		// Show completions instead of executing, if the line ends
+		// with a "?" or a tab passed through by the terminal
+		text := strings.TrimLeft(scanner.Text(), " ")
+		if trimmed := strings.TrimRight(text, "?\t"); trimmed != text {
+			for _, c := range s.complete(trimmed) {
+				fmt.Fprintln(out, c)
+			}
+			continue
+		}
+		line := strings.TrimSpace(text)
+		if line == "" {
+			continue
+		}
+
+		// Expand history references before recording the line
+		if strings.HasPrefix(line, "!") {
+			expanded, ok := s.history.expand(line)
+			if !ok {
+				fmt.Fprintf(out, "No such command in history: %s\n", line)
+				continue
+			}
+			line = expanded
+			fmt.Fprintln(out, line)
+		}
+		s.history.add(line)
+		if !s.exec(line) {
+			return
+		}
+	}
+}
+
+// exec is used to execute a line, returning false to exit
+func (s *shell) exec(line string) bool {
+	out := s.m.out
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "exit", "quit":
+		return false
+	case "help":
+		fmt.Fprint(out, shellHelp)
+	case "history":
+		for idx, l := range s.history.lines {
+			fmt.Fprintf(out, "%5d  %s\n", idx+1, l)
+		}
+	case "connect":
+		if len(fields) != 2 {
+			fmt.Fprintf(out, "Usage: connect <addr>\n")
+			break
+		}
+		s.connect(fields[1])
+	default:
+		if s.client == nil {
+			fmt.Fprintf(out, "Not connected, use connect <addr>\n")
+			break
+		}
+		resp, err := s.raw(line)
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			break
+		}
+		fmt.Fprint(out, resp)
+	}
+	return true
+}
+
+// connect is used to switch to another server. The current
+// connection is kept if the new server cannot be reached.
+func (s *shell) connect(addr string) {
+	conf := *s.m.config
+	conf.Addr = addr
+	client, err := conf.Dial()
+	if err != nil {
+		fmt.Fprintf(s.m.out, "Failed to connect to %s: %v\n", addr, err)
+		return
+	}
+	if s.client != nil {
+		s.client.Close()
+	}
+	s.client = client
+	s.addr = addr
+}
+
+// raw is used to send a line to the server, returning the response
+func (s *shell) raw(line string) (string, error) {
+	cmd, err := hlld.NewRawCommand(line)
+	if err != nil {
+		return "", err
+	}
+	f, err := s.client.Execute(cmd)
+	if err != nil {
+		return "", err
+	}
+	if err := f.Error(); err != nil {
+		return "", err
+	}
+	return cmd.Result()
+}
+
+// complete returns the completions of the last word of a line. The first
+// word is completed with the commands, and the set name argument of a
+// command with the sets of the server.
+func (s *shell) complete(line string) []string {
+	fields := strings.Fields(line)
+	word := ""
+	if len(fields) > 0 && !strings.HasSuffix(line, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+
+	var candidates []string
+	switch len(fields) {
+	case 0:
+		for name := range shellCommands {
+			candidates = append(candidates, name)
+		}
+		candidates = append(candidates, shellBuiltins...)
+	case 1:
+		if !shellCommands[fields[0]] || s.client == nil {
+			return nil
+		}
+		s.client.ListAll(word, func(entries []*hlld.ListEntry) bool {
+			for _, e := range entries {
+				candidates = append(candidates, e.Name)
+			}
+			return true
+		})
+	}
+
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// history is the command history of the shell, persisted to a file
+type history struct {
+	path  string
+	max   int
+	lines []string
+}
+
+// defaultHistoryPath returns the history file in the home directory
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".hlld_history")
+}
+
+// loadHistory is used to read the history file, which may not exist
+func loadHistory(path string, max int) (*history, error) {
+	h := &history{path: path, max: max}
+	if path == "" {
+		return h, nil
+	}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if line != "" {
+			h.add(line)
+		}
+	}
+	return h, nil
+}
+
+// add is used to record a line, dropping the oldest beyond the max
+func (h *history) add(line string) {
+	h.lines = append(h.lines, line)
+	if h.max > 0 && len(h.lines) > h.max {
+		h.lines = h.lines[len(h.lines)-h.max:]
+	}
+}
+
+// expand resolves a "!!" or "!n" reference to a line of the history
+func (h *history) expand(ref string) (string, bool) {
+	if ref == "!!" {
+		if len(h.lines) == 0 {
+			return "", false
+		}
+		return h.lines[len(h.lines)-1], true
+	}
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(h.lines) {
+		return "", false
+	}
+	return h.lines[n-1], true
+}
+
+// save is used to write the history file
+func (h *history) save() error {
+	if h.path == "" {
+		return nil
+	}
+	var buf strings.Builder
+	for _, line := range h.lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return os.WriteFile(h.path, []byte(buf.String()), 0600)
+}
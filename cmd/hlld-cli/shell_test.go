@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/armon/go-hlld/hlldconfig"
+)
+
+func TestShellCommand(t *testing.T) {
+	addr1, stop1 := testServer(t, map[string]string{
+		"list\n":         "START\nfoo1 0.01 12 100 3280\nfoo2 0.01 12 20 3280\nbar 0.01 12 3 3280\nEND\n",
+		"list foo\n":     "START\nfoo1 0.01 12 100 3280\nfoo2 0.01 12 20 3280\nEND\n",
+		"set foo1 bar\n": "Done\n",
+	})
+	defer stop1()
+	addr2, stop2 := testServer(t, map[string]string{
+		"flush\n": "Done\n",
+	})
+	defer stop2()
+
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("list\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	input := strings.Join([]string{
+		"fl?",
+		"info foo?",
+		"set foo1 bar",
+		"!1",
+		"connect " + addr2,
+		"flush",
+		"exit",
+		"list",
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+	m := &meta{
+		config: &hlldconfig.Config{Addr: addr1},
+		in:     strings.NewReader(input),
+		out:    &out,
+	}
+	if code := shellCommand(m, []string{"-history", path}); code != 0 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+
+	for _, expect := range []string{
+		addr1 + "> flush\n",
+		addr1 + "> foo1\nfoo2\n",
+		addr1 + "> Done\n",
+		addr1 + "> list\nSTART\nfoo1",
+		addr2 + "> Done\n",
+	} {
+		if !strings.Contains(out.String(), expect) {
+			t.Fatalf("missing %q: %s", expect, out.String())
+		}
+	}
+
+	// Completions are not recorded, and the shell exits before the last line
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := "list\nset foo1 bar\nlist\nconnect " + addr2 + "\nflush\nexit\n"
+	if string(raw) != expect {
+		t.Fatalf("bad: %q", raw)
+	}
+}
+
+func TestShell_Complete(t *testing.T) {
+	s := &shell{}
+	out := s.complete("c")
+	if !reflect.DeepEqual(out, []string{"clear", "close", "connect", "create"}) {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// Set names cannot be completed without a connection
+	if out := s.complete("info "); out != nil {
+		t.Fatalf("bad: %v", out)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h, err := loadHistory(filepath.Join(t.TempDir(), "history"), 2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := h.expand("!!"); ok {
+		t.Fatalf("expanded empty history")
+	}
+	h.add("a")
+	h.add("b")
+	h.add("c")
+	if !reflect.DeepEqual(h.lines, []string{"b", "c"}) {
+		t.Fatalf("bad: %v", h.lines)
+	}
+	if line, ok := h.expand("!!"); !ok || line != "c" {
+		t.Fatalf("bad: %v %v", line, ok)
+	}
+	if line, ok := h.expand("!1"); !ok || line != "b" {
+		t.Fatalf("bad: %v %v", line, ok)
+	}
+	for _, ref := range []string{"!0", "!3", "!x"} {
+		if _, ok := h.expand(ref); ok {
+			t.Fatalf("expanded %s", ref)
+		}
+	}
+
+	if err := h.save(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	h2, err := loadHistory(h.path, 2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(h2.lines, h.lines) {
+		t.Fatalf("bad: %v", h2.lines)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+// sparkLevels are the characters of a sparkline, from lowest to highest
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// watchCommand is used to poll the info of a set, rendering its
+// size and storage over time until interrupted
+func watchCommand(m *meta, args []string) int {
+	out := m.out
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flags.SetOutput(out)
+	interval := flags.Duration("interval", 5*time.Second, "time between polls")
+	count := flags.Int("count", 0, "number of polls, zero to poll until interrupted")
+	width := flags.Int("width", 40, "number of polls shown in the sparklines")
+	clearTerm := flags.Bool("clear", true, "clear the terminal before each update")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(out, "Usage: hlld-cli watch [options] <set>\n")
+		return 1
+	}
+	if *interval <= 0 || *width <= 0 {
+		fmt.Fprintf(out, "Interval and width must be positive\n")
+		return 1
+	}
+	name := flags.Arg(0)
+
+	client, err := m.dial()
+	if err != nil {
+		fmt.Fprintf(out, "Failed to connect: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	var sizes, storage []uint64
+	for poll := 0; *count == 0 || poll < *count; poll++ {
+		if poll > 0 {
+			time.Sleep(*interval)
+		}
+
+		// Errors are shown without stopping, since the server
+		// may be restarting while it is watched
+		info, ok, err := watchInfo(client, name)
+		if err == nil && !ok {
+			fmt.Fprintf(out, "Set does not exist: %s\n", name)
+			return 1
+		}
+		if *clearTerm {
+			fmt.Fprint(out, clearScreen)
+		}
+		fmt.Fprintf(out, "Set: %s  (every %v, %s)\n", name, *interval, time.Now().Format("15:04:05"))
+		if err != nil {
+			fmt.Fprintf(out, "Failed to query set: %v\n", err)
+		} else {
+			sizes = appendWindow(sizes, info.Size, *width)
+			storage = appendWindow(storage, info.Storage, *width)
+		}
+		if len(sizes) > 0 {
+			writeWatchTable(out, sizes, storage)
+		}
+	}
+	return 0
+}
+
+// watchInfo is used to query the info of a set
+func watchInfo(client *hlld.Client, name string) (*hlld.SetInfo, bool, error) {
+	cmd, err := hlld.NewInfoCommand(name)
+	if err != nil {
+		return nil, false, err
+	}
+	f, err := client.Execute(cmd)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := f.Error(); err != nil {
+		return nil, false, err
+	}
+	return cmd.Result()
+}
+
+// writeWatchTable renders the latest values, their change since
+// the previous poll and a sparkline of their history
+func writeWatchTable(out io.Writer, sizes, storage []uint64) {
+	fmt.Fprintf(out, "%-8s %14s %10s  %s\n", "", "current", "change", "history")
+	for _, row := range []struct {
+		name   string
+		values []uint64
+	}{{"size", sizes}, {"storage", storage}} {
+		current := row.values[len(row.values)-1]
+		change := int64(0)
+		if len(row.values) > 1 {
+			change = int64(current) - int64(row.values[len(row.values)-2])
+		}
+		fmt.Fprintf(out, "%-8s %14d %+10d  %s\n", row.name, current, change, sparkline(row.values))
+	}
+}
+
+// appendWindow appends a value, keeping at most the last n values
+func appendWindow(values []uint64, v uint64, n int) []uint64 {
+	values = append(values, v)
+	if len(values) > n {
+		values = values[len(values)-n:]
+	}
+	return values
+}
+
+// sparkline renders values scaled between their minimum and maximum
+func sparkline(values []uint64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	out := make([]rune, len(values))
+	for idx, v := range values {
+		level := 0
+		if max > min {
+			level = int(float64(v-min) / float64(max-min) * float64(len(sparkLevels)-1))
+		}
+		out[idx] = sparkLevels[level]
+	}
+	return string(out)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWatchCommand(t *testing.T) {
+	addr, stop := testServer(t, map[string]string{
+		"info foo\n": "START\nin_memory 1\npage_ins 0\npage_outs 0\neps 0.01\nprecision 12\nsets 0\nsize 100\nstorage 3280\nEND\n",
+	})
+	defer stop()
+
+	var out bytes.Buffer
+	code := realMain([]string{"-addr", addr, "watch", "-interval", "1ms", "-count", "2", "-clear=false", "foo"}, &out)
+	if code != 0 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if strings.Count(out.String(), "Set: foo") != 2 {
+		t.Fatalf("bad: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "size                100         +0  ▁▁\n") ||
+		!strings.Contains(out.String(), "storage            3280         +0  ▁▁\n") {
+		t.Fatalf("bad: %s", out.String())
+	}
+	if strings.Contains(out.String(), clearScreen) {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestWatchCommand_Missing(t *testing.T) {
+	addr, stop := testServer(t, map[string]string{
+		"info foo\n": "Set does not exist\n",
+	})
+	defer stop()
+
+	var out bytes.Buffer
+	code := realMain([]string{"-addr", addr, "watch", "-count", "1", "foo"}, &out)
+	if code != 1 {
+		t.Fatalf("bad: %d %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Set does not exist: foo") {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if out := sparkline([]uint64{0, 10, 20, 70}); out != "▁▂▃█" {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := sparkline([]uint64{5, 5}); out != "▁▁" {
+		t.Fatalf("bad: %s", out)
+	}
+	if out := sparkline(nil); out != "" {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestAppendWindow(t *testing.T) {
+	var values []uint64
+	for i := uint64(0); i < 5; i++ {
+		values = appendWindow(values, i, 3)
+	}
+	if len(values) != 3 || values[0] != 2 || values[2] != 4 {
+		t.Fatalf("bad: %v", values)
+	}
+}
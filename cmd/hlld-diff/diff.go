@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/armon/go-hlld"
+)
+
+// change is a field of a set that differs between the inventories
+type change struct {
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+}
+
+// setDiff is the difference of a set between the inventories
+type setDiff struct {
+	Name string `json:"name"`
+
+	// Kind is "removed" if the set is only in a, "added" if
+	// it is only in b, or "changed"
+	Kind    string   `json:"kind"`
+	Changes []change `json:"changes,omitempty"`
+}
+
+// diff is used to compare the sets of two inventories. Precision and
+// error thresholds must match exactly, while sizes may differ within
+// the given number of standard errors of the difference of two
+// estimates, since each server estimates the size independently.
+func diff(a, b *hlld.Manifest, sigmas float64) []setDiff {
+	names := make(map[string]struct{})
+	for name := range a.Sets {
+		names[name] = struct{}{}
+	}
+	for name := range b.Sets {
+		names[name] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var out []setDiff
+	for _, name := range sorted {
+		infoA, inA := a.Sets[name]
+		infoB, inB := b.Sets[name]
+		switch {
+		case !inB:
+			out = append(out, setDiff{Name: name, Kind: "removed"})
+		case !inA:
+			out = append(out, setDiff{Name: name, Kind: "added"})
+		default:
+			if changes := compare(infoA, infoB, sigmas); len(changes) > 0 {
+				out = append(out, setDiff{Name: name, Kind: "changed", Changes: changes})
+			}
+		}
+	}
+	return out
+}
+
+// compare is used to compare the info of a set
+func compare(a, b *hlld.SetInfo, sigmas float64) []change {
+	var changes []change
+	if a.Precision != b.Precision {
+		changes = append(changes, change{"precision",
+			strconv.FormatUint(a.Precision, 10), strconv.FormatUint(b.Precision, 10)})
+	}
+	if a.ErrThreshold != b.ErrThreshold {
+		changes = append(changes, change{"eps",
+			strconv.FormatFloat(a.ErrThreshold, 'g', -1, 64),
+			strconv.FormatFloat(b.ErrThreshold, 'g', -1, 64)})
+	}
+	if a.Size != b.Size {
+		precision := a.Precision
+		if b.Precision < precision {
+			precision = b.Precision
+		}
+		tolerance := sigmas * math.Sqrt2 * hlld.TheoreticalError(precision)
+		larger := math.Max(float64(a.Size), float64(b.Size))
+		if math.Abs(float64(a.Size)-float64(b.Size))/larger > tolerance {
+			changes = append(changes, change{"size",
+				strconv.FormatUint(a.Size, 10), strconv.FormatUint(b.Size, 10)})
+		}
+	}
+	return changes
+}
+
+// writeText is used to print the differences, a line per set
+func writeText(w io.Writer, diffs []setDiff) error {
+	for _, d := range diffs {
+		var err error
+		switch d.Kind {
+		case "removed":
+			_, err = fmt.Fprintf(w, "- %s\n", d.Name)
+		case "added":
+			_, err = fmt.Fprintf(w, "+ %s\n", d.Name)
+		default:
+			parts := make([]string, len(d.Changes))
+			for idx, c := range d.Changes {
+				parts[idx] = fmt.Sprintf("%s %s -> %s", c.Field, c.A, c.B)
+			}
+			_, err = fmt.Fprintf(w, "~ %s: %s\n", d.Name, strings.Join(parts, ", "))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON is used to print the differences as a JSON array
+func writeJSON(w io.Writer, diffs []setDiff) error {
+	if diffs == nil {
+		diffs = []setDiff{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diffs)
+}
+
+// load is used to take the inventory of a source, which is the path
+// of a manifest file if one exists, or otherwise the address of a server
+func load(source, prefix string, dial func(addr string) (*hlld.Client, error)) (*hlld.Manifest, error) {
+	if fi, err := os.Stat(source); err == nil && fi.Mode().IsRegular() {
+		fh, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer fh.Close()
+		m, err := hlld.ReadManifest(fh)
+		if err != nil {
+			return nil, err
+		}
+		for name := range m.Sets {
+			if !strings.HasPrefix(name, prefix) {
+				delete(m.Sets, name)
+			}
+		}
+		return m, nil
+	}
+
+	client, err := dial(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", source, err)
+	}
+	defer client.Close()
+	m, err := hlld.BuildManifest(client, prefix)
+	if err != nil {
+		return nil, err
+	}
+	m.Addr = source
+	return m, nil
+}
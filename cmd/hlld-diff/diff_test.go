@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+func TestDiff(t *testing.T) {
+	a := &hlld.Manifest{Sets: map[string]*hlld.SetInfo{
+		"same":    {Precision: 12, ErrThreshold: 0.01, Size: 10000},
+		"close":   {Precision: 12, ErrThreshold: 0.01, Size: 10000},
+		"far":     {Precision: 12, ErrThreshold: 0.01, Size: 10000},
+		"prec":    {Precision: 12, ErrThreshold: 0.01},
+		"removed": {Precision: 12},
+	}}
+	b := &hlld.Manifest{Sets: map[string]*hlld.SetInfo{
+		"same":  {Precision: 12, ErrThreshold: 0.01, Size: 10000},
+		"close": {Precision: 12, ErrThreshold: 0.01, Size: 10100},
+		"far":   {Precision: 12, ErrThreshold: 0.01, Size: 12000},
+		"prec":  {Precision: 14, ErrThreshold: 0.005},
+		"added": {Precision: 12},
+	}}
+
+	diffs := diff(a, b, 3)
+	expect := []setDiff{
+		{Name: "added", Kind: "added"},
+		{Name: "far", Kind: "changed", Changes: []change{{"size", "10000", "12000"}}},
+		{Name: "prec", Kind: "changed", Changes: []change{
+			{"precision", "12", "14"},
+			{"eps", "0.01", "0.005"},
+		}},
+		{Name: "removed", Kind: "removed"},
+	}
+	if !reflect.DeepEqual(diffs, expect) {
+		t.Fatalf("bad: %#v", diffs)
+	}
+
+	var buf bytes.Buffer
+	if err := writeText(&buf, diffs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expectText := `+ added
+~ far: size 10000 -> 12000
+~ prec: precision 12 -> 14, eps 0.01 -> 0.005
+- removed
+`
+	if buf.String() != expectText {
+		t.Fatalf("bad: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeJSON(&buf, diffs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var out []setDiff
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(out, expect) {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	server := hlldproxy.NewServer(list, func(line string) hlldproxy.Reply {
+		switch line {
+		case "list foo\n":
+			return hlldproxy.Static("START\nfoo1 0.01 12 10 3280\nEND\n")
+		case "info foo1\n":
+			return hlldproxy.Static("START\nprecision 12\nsize 10\nEND\n")
+		}
+		return hlldproxy.Static("Client Error: Command not supported\n")
+	})
+	defer server.Close()
+
+	// Load from a server
+	addr := server.Addr().String()
+	m, err := load(addr, "foo", hlld.Dial)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if m.Addr != addr || len(m.Sets) != 1 || m.Sets["foo1"].Precision != 12 {
+		t.Fatalf("bad: %#v", m)
+	}
+
+	// Load from a manifest, filtering by the prefix
+	dir, err := ioutil.TempDir("", "hlld-diff")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	m.Sets["bar"] = &hlld.SetInfo{Precision: 10}
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	path := filepath.Join(dir, "manifest.json")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := load(path, "foo", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(out.Sets) != 1 || out.Sets["foo1"] == nil {
+		t.Fatalf("bad: %#v", out)
+	}
+}
@@ -0,0 +1,79 @@
+// hlld-diff compares the set inventories of two sources, each of which is
+// either the address of a server or the path of a manifest file, such as
+// one written by hlld-backup. Sets that were added or removed are reported,
+// along with differences in precision, error threshold, and size beyond
+// the expected error of the estimates.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldconfig"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: hlld-diff [flags] <addr|manifest> <addr|manifest>\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to a JSON configuration file for the client settings")
+	prefix := flag.String("prefix", "", "only compare sets with this prefix")
+	sigmas := flag.Float64("sigmas", hlld.DefaultDivergenceSigmas, "standard errors the sizes may differ by")
+	format := flag.String("format", "text", "output format, text or json")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 2 || (*format != "text" && *format != "json") {
+		usage()
+		os.Exit(1)
+	}
+
+	// The configuration provides the client settings, such as TLS
+	conf := &hlldconfig.Config{}
+	if *configPath != "" {
+		var err error
+		conf, err = hlldconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	dial := func(addr string) (*hlld.Client, error) {
+		clientConf, err := conf.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		return hlld.DialConfig(addr, clientConf)
+	}
+
+	var manifests [2]*hlld.Manifest
+	for idx, source := range flag.Args() {
+		m, err := load(source, *prefix, dial)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load %s: %v\n", source, err)
+			os.Exit(1)
+		}
+		manifests[idx] = m
+	}
+
+	diffs := diff(manifests[0], manifests[1], *sigmas)
+	var err error
+	if *format == "json" {
+		err = writeJSON(os.Stdout, diffs)
+	} else {
+		err = writeText(os.Stdout, diffs)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write diff: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Exit with a distinct code so the tool can be used in scripts
+	if len(diffs) > 0 {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+// group is the usage of the sets sharing a prefix
+type group struct {
+	Name    string `json:"name"`
+	Sets    int    `json:"sets"`
+	Storage uint64 `json:"storage"`
+}
+
+// snapshot is the usage at a point in time, which is
+// stored as a line of JSON in the history file
+type snapshot struct {
+	Time   time.Time        `json:"time"`
+	Groups map[string]group `json:"groups"`
+}
+
+// usage is used to report the disk usage of the sets
+type usage struct {
+	client *hlld.Client
+	out    io.Writer
+
+	// prefix filters the sets that are listed
+	prefix string
+
+	// sep and depth determine the group of a set, which is
+	// the first depth components of the name split by sep
+	sep   string
+	depth int
+
+	// historyPath is an optional file of previous snapshots
+	historyPath string
+
+	// maxGrowth is the relative growth since the previous snapshot
+	// beyond which a group is flagged
+	maxGrowth float64
+}
+
+// run is used to gather the usage, print the report and record the
+// snapshot. It returns the number of groups flagged for growth.
+func (u *usage) run() (int, error) {
+	snap, err := u.gather()
+	if err != nil {
+		return 0, err
+	}
+
+	var prev *snapshot
+	if u.historyPath != "" {
+		if prev, err = lastSnapshot(u.historyPath); err != nil {
+			return 0, err
+		}
+	}
+	flagged := u.report(snap, prev)
+
+	if u.historyPath != "" {
+		if err := appendSnapshot(u.historyPath, snap); err != nil {
+			return 0, err
+		}
+	}
+	return flagged, nil
+}
+
+// gather is used to list the sets and group their storage
+func (u *usage) gather() (*snapshot, error) {
+	snap := &snapshot{
+		Time:   time.Now().UTC(),
+		Groups: make(map[string]group),
+	}
+	err := u.client.ListAll(u.prefix, func(entries []*hlld.ListEntry) bool {
+		for _, e := range entries {
+			name := u.groupName(e.Name)
+			g := snap.Groups[name]
+			g.Name = name
+			g.Sets++
+			g.Storage += e.Storage
+			snap.Groups[name] = g
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// groupName returns the group of a set name
+func (u *usage) groupName(name string) string {
+	parts := strings.SplitN(name, u.sep, u.depth+1)
+	if len(parts) <= u.depth {
+		return name
+	}
+	return strings.Join(parts[:u.depth], u.sep)
+}
+
+// report is used to print the groups sorted by storage, with the change
+// since the previous snapshot. It returns the number of flagged groups.
+func (u *usage) report(snap, prev *snapshot) int {
+	groups := make([]group, 0, len(snap.Groups))
+	var total uint64
+	for _, g := range snap.Groups {
+		groups = append(groups, g)
+		total += g.Storage
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Storage != groups[j].Storage {
+			return groups[i].Storage > groups[j].Storage
+		}
+		return groups[i].Name < groups[j].Name
+	})
+
+	flagged := 0
+	tw := tabwriter.NewWriter(u.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "GROUP\tSETS\tSTORAGE\tCHANGE\t\n")
+	for _, g := range groups {
+		change, flag := "", ""
+		if prev != nil {
+			old, ok := prev.Groups[g.Name]
+			switch {
+			case !ok || old.Storage == 0:
+				change = "new"
+			default:
+				growth := (float64(g.Storage) - float64(old.Storage)) / float64(old.Storage)
+				change = fmt.Sprintf("%+.1f%%", growth*100)
+				if u.maxGrowth > 0 && growth > u.maxGrowth {
+					flag = "GROWTH"
+					flagged++
+				}
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", g.Name, g.Sets, formatBytes(g.Storage), change, flag)
+	}
+	fmt.Fprintf(tw, "total\t\t%s\t\t\n", formatBytes(total))
+	tw.Flush()
+	return flagged
+}
+
+// formatBytes is used to format a size in human units
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// lastSnapshot returns the last snapshot in the history file,
+// or nil if the file does not exist or is empty
+func lastSnapshot(path string) (*snapshot, error) {
+	fh, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var last string
+	scan := bufio.NewScanner(fh)
+	scan.Buffer(nil, 64*1024*1024)
+	for scan.Scan() {
+		if line := strings.TrimSpace(scan.Text()); line != "" {
+			last = line
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	if last == "" {
+		return nil, nil
+	}
+
+	snap := &snapshot{}
+	if err := json.Unmarshal([]byte(last), snap); err != nil {
+		return nil, fmt.Errorf("failed to parse history: %w", err)
+	}
+	return snap, nil
+}
+
+// appendSnapshot is used to add a snapshot to the history file
+func appendSnapshot(path string, snap *snapshot) error {
+	fh, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(snap)
+	if err != nil {
+		fh.Close()
+		return err
+	}
+	if _, err := fh.Write(append(buf, '\n')); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+func TestUsage(t *testing.T) {
+	var lock sync.Mutex
+	resp := "START\nweb-users 0.01 12 10 1024\nweb-pages 0.01 12 10 2048\napi-keys 0.01 12 10 512\nEND\n"
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	server := hlldproxy.NewServer(list, func(line string) hlldproxy.Reply {
+		lock.Lock()
+		defer lock.Unlock()
+		return hlldproxy.Static(resp)
+	})
+	defer server.Close()
+
+	client, err := hlld.Dial(server.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	dir, err := ioutil.TempDir("", "hlld-du")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	u := &usage{
+		client:      client,
+		out:         &out,
+		sep:         "-",
+		depth:       1,
+		historyPath: filepath.Join(dir, "history"),
+		maxGrowth:   0.5,
+	}
+
+	// First run has no history
+	flagged, err := u.run()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if flagged != 0 {
+		t.Fatalf("bad: %d", flagged)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if strings.Join(strings.Fields(lines[1]), " ") != "web 2 3.0KB" {
+		t.Fatalf("bad: %s", out.String())
+	}
+	if strings.Join(strings.Fields(lines[2]), " ") != "api 1 512B" {
+		t.Fatalf("bad: %s", out.String())
+	}
+
+	// Grow the web group
+	lock.Lock()
+	resp = "START\nweb-users 0.01 12 10 4096\nweb-pages 0.01 12 10 2048\napi-keys 0.01 12 10 512\nEND\n"
+	lock.Unlock()
+	out.Reset()
+	flagged, err = u.run()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if flagged != 1 {
+		t.Fatalf("bad: %d", flagged)
+	}
+	lines = strings.Split(out.String(), "\n")
+	if strings.Join(strings.Fields(lines[1]), " ") != "web 2 6.0KB +100.0% GROWTH" {
+		t.Fatalf("bad: %s", out.String())
+	}
+	if strings.Join(strings.Fields(lines[2]), " ") != "api 1 512B +0.0%" {
+		t.Fatalf("bad: %s", out.String())
+	}
+
+	// History has both snapshots
+	buf, err := ioutil.ReadFile(u.historyPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n := strings.Count(string(buf), "\n"); n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestUsage_GroupName(t *testing.T) {
+	u := &usage{sep: "-", depth: 2}
+	if g := u.groupName("web-users-1h"); g != "web-users" {
+		t.Fatalf("bad: %s", g)
+	}
+	if g := u.groupName("web"); g != "web" {
+		t.Fatalf("bad: %s", g)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[uint64]string{
+		512:             "512B",
+		1536:            "1.5KB",
+		3 * 1024 * 1024: "3.0MB",
+	}
+	for n, expect := range cases {
+		if out := formatBytes(n); out != expect {
+			t.Fatalf("bad: %d %s", n, out)
+		}
+	}
+}
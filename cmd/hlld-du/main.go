@@ -0,0 +1,69 @@
+// hlld-du reports the disk usage of sets grouped by name prefix, sorted
+// by storage. Snapshots can be recorded in a history file to track the
+// trend, and groups that grew unexpectedly since the last run are flagged.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/armon/go-hlld/hlldconfig"
+)
+
+func main() {
+	addr := flag.String("addr", "", "address of the hlld server")
+	configPath := flag.String("config", "", "path to a JSON configuration file")
+	prefix := flag.String("prefix", "", "only include sets with this prefix")
+	sep := flag.String("sep", "-", "separator of the components of set names")
+	depth := flag.Int("depth", 1, "number of name components used to group sets")
+	historyPath := flag.String("history", "", "path to a file to record snapshots in")
+	maxGrowth := flag.Float64("max-growth", 0.5, "relative growth since the last snapshot that is flagged")
+	flag.Parse()
+
+	if *sep == "" || *depth <= 0 {
+		fmt.Fprintf(os.Stderr, "The -sep flag must be set and -depth must be positive\n")
+		os.Exit(1)
+	}
+
+	// Load the configuration, the address flag takes precedence
+	conf := &hlldconfig.Config{}
+	if *configPath != "" {
+		var err error
+		conf, err = hlldconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *addr != "" {
+		conf.Addr = *addr
+	}
+
+	client, err := conf.Dial()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	u := &usage{
+		client:      client,
+		out:         os.Stdout,
+		prefix:      *prefix,
+		sep:         *sep,
+		depth:       *depth,
+		historyPath: *historyPath,
+		maxGrowth:   *maxGrowth,
+	}
+	flagged, err := u.run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to report usage: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Exit with a distinct code so the tool can be used for alerting
+	if flagged > 0 {
+		os.Exit(2)
+	}
+}
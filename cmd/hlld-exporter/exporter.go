@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/armon/go-hlld"
+)
+
+// labelName matches the valid names of Prometheus labels
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// target is an hlld server that is scraped
+type target struct {
+	// addr is the address of the server, exported as the target label
+	addr string
+
+	// labels are the extra labels of the series of the server
+	labels map[string]string
+
+	lock   sync.Mutex
+	client *hlld.Client
+}
+
+// parseTarget is used to parse a target flag, which is the address
+// optionally followed by labels, such as "host:4553,env=prod,dc=east"
+func parseTarget(s string) (*target, error) {
+	parts := strings.Split(s, ",")
+	t := &target{addr: strings.TrimSpace(parts[0]), labels: make(map[string]string)}
+	if t.addr == "" {
+		return nil, fmt.Errorf("target '%s' has no address", s)
+	}
+	for _, part := range parts[1:] {
+		idx := strings.IndexByte(part, '=')
+		if idx <= 0 {
+			return nil, fmt.Errorf("target label '%s' must be name=value", part)
+		}
+		name, value := part[:idx], part[idx+1:]
+		if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid target label name '%s'", name)
+		}
+		if name == "target" || name == "set" || name == "group" {
+			return nil, fmt.Errorf("target label name '%s' is reserved", name)
+		}
+		t.labels[name] = value
+	}
+	return t, nil
+}
+
+// exporter serves the metrics of the sets of the targets
+// in the Prometheus text format
+type exporter struct {
+	targets []*target
+
+	// dial is used to connect to a target, and
+	// is called again after a failed scrape
+	dial func(addr string) (*hlld.Client, error)
+
+	// include and exclude are optional filters of the set names
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+
+	// maxSets is the number of sets exported across all the
+	// targets, keeping the largest, or zero for no limit
+	maxSets int
+
+	// sep and depth determine the group of a set, which is the first
+	// depth components of the name split by sep. Metrics aggregated by
+	// group are exported if depth is positive.
+	sep   string
+	depth int
+
+	// groupOnly omits the series of each set, exporting only the groups
+	groupOnly bool
+}
+
+// group is the aggregate of the sets sharing a name prefix
+type group struct {
+	sets    uint64
+	size    uint64
+	storage uint64
+}
+
+// scrape is the result of listing the sets of a target
+type scrape struct {
+	target  *target
+	entries []*hlld.ListEntry
+	err     error
+
+	// matched is the number of sets that passed the filters
+	matched int
+
+	// dropped is the number of matching sets not
+	// exported because of the limit of sets
+	dropped int
+
+	// groups are the sets aggregated by group name
+	groups map[string]*group
+}
+
+// collect is used to list the sets of every target concurrently
+func (e *exporter) collect() []*scrape {
+	scrapes := make([]*scrape, len(e.targets))
+	var wg sync.WaitGroup
+	for idx, t := range e.targets {
+		scrapes[idx] = &scrape{target: t}
+		wg.Add(1)
+		go func(s *scrape) {
+			defer wg.Done()
+			s.entries, s.err = e.list(s.target)
+			s.matched = len(s.entries)
+		}(scrapes[idx])
+	}
+	wg.Wait()
+	return scrapes
+}
+
+// list is used to list the sets of a target that pass the filters,
+// reconnecting if the previous scrape failed
+func (e *exporter) list(t *target) ([]*hlld.ListEntry, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.client == nil {
+		client, err := e.dial(t.addr)
+		if err != nil {
+			return nil, err
+		}
+		t.client = client
+	}
+
+	var out []*hlld.ListEntry
+	err := t.client.ListAll("", func(entries []*hlld.ListEntry) bool {
+		for _, entry := range entries {
+			if e.include != nil && !e.include.MatchString(entry.Name) {
+				continue
+			}
+			if e.exclude != nil && e.exclude.MatchString(entry.Name) {
+				continue
+			}
+			out = append(out, entry)
+		}
+		return true
+	})
+	if err != nil {
+		t.client.Close()
+		t.client = nil
+		return nil, err
+	}
+	return out, nil
+}
+
+// limit is used to keep the largest sets across all the
+// targets, counting the sets dropped from each target
+func (e *exporter) limit(scrapes []*scrape) {
+	type ref struct {
+		scrape *scrape
+		entry  *hlld.ListEntry
+	}
+	var refs []ref
+	for _, s := range scrapes {
+		for _, entry := range s.entries {
+			refs = append(refs, ref{s, entry})
+		}
+	}
+	if e.maxSets <= 0 || len(refs) <= e.maxSets {
+		return
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].entry.Size > refs[j].entry.Size
+	})
+	for _, s := range scrapes {
+		s.entries = s.entries[:0]
+	}
+	for idx, r := range refs {
+		if idx < e.maxSets {
+			r.scrape.entries = append(r.scrape.entries, r.entry)
+		} else {
+			r.scrape.dropped++
+		}
+	}
+}
+
+// groupName returns the group of a set name
+func (e *exporter) groupName(name string) string {
+	parts := strings.SplitN(name, e.sep, e.depth+1)
+	if len(parts) <= e.depth {
+		return name
+	}
+	return strings.Join(parts[:e.depth], e.sep)
+}
+
+// aggregate is used to sum the sets of each group, which
+// includes the sets dropped by the limit of sets
+func (e *exporter) aggregate(scrapes []*scrape) {
+	for _, s := range scrapes {
+		s.groups = make(map[string]*group)
+		for _, entry := range s.entries {
+			name := e.groupName(entry.Name)
+			g, ok := s.groups[name]
+			if !ok {
+				g = &group{}
+				s.groups[name] = g
+			}
+			g.sets++
+			g.size += entry.Size
+			g.storage += entry.Storage
+		}
+	}
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scrapes := e.collect()
+	if e.depth > 0 {
+		e.aggregate(scrapes)
+	}
+	if e.groupOnly {
+		for _, s := range scrapes {
+			s.entries = nil
+		}
+	} else {
+		e.limit(scrapes)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, scrapes, e.depth > 0)
+}
+
+// metric describes an exported metric
+type metric struct {
+	name  string
+	help  string
+	value func(s *scrape, entry *hlld.ListEntry) float64
+}
+
+// targetMetrics are exported once per target
+var targetMetrics = []metric{
+	{"hlld_up", "Whether the last scrape of the server succeeded", func(s *scrape, _ *hlld.ListEntry) float64 {
+		if s.err != nil {
+			return 0
+		}
+		return 1
+	}},
+	{"hlld_sets", "Number of sets matching the filters", func(s *scrape, _ *hlld.ListEntry) float64 {
+		return float64(s.matched)
+	}},
+	{"hlld_sets_dropped", "Number of matching sets not exported because of the limit of sets", func(s *scrape, _ *hlld.ListEntry) float64 {
+		return float64(s.dropped)
+	}},
+}
+
+// setMetrics are exported once per set
+var setMetrics = []metric{
+	{"hlld_set_size", "Estimated cardinality of the set", func(_ *scrape, e *hlld.ListEntry) float64 {
+		return float64(e.Size)
+	}},
+	{"hlld_set_storage_bytes", "Disk space required by the set", func(_ *scrape, e *hlld.ListEntry) float64 {
+		return float64(e.Storage)
+	}},
+	{"hlld_set_precision", "Number of precision bits of the set", func(_ *scrape, e *hlld.ListEntry) float64 {
+		return float64(e.Precision)
+	}},
+}
+
+// groupMetric describes a metric exported once per group
+type groupMetric struct {
+	name  string
+	help  string
+	value func(g *group) uint64
+}
+
+// groupMetrics are exported once per group
+var groupMetrics = []groupMetric{
+	{"hlld_group_sets", "Number of sets of the group", func(g *group) uint64 { return g.sets }},
+	{"hlld_group_size", "Sum of the estimated cardinalities of the sets of the group", func(g *group) uint64 { return g.size }},
+	{"hlld_group_storage_bytes", "Disk space required by the sets of the group", func(g *group) uint64 { return g.storage }},
+}
+
+// writeMetrics is used to write the metrics of the scrapes,
+// including the metrics of their groups if aggregated
+func writeMetrics(w io.Writer, scrapes []*scrape, groups bool) {
+	for _, m := range targetMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, s := range scrapes {
+			fmt.Fprintf(w, "%s{%s} %v\n", m.name, s.target.labelString("", ""), m.value(s, nil))
+		}
+	}
+	for _, m := range setMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, s := range scrapes {
+			for _, entry := range s.entries {
+				fmt.Fprintf(w, "%s{%s} %v\n", m.name, s.target.labelString("set", entry.Name), m.value(s, entry))
+			}
+		}
+	}
+	if !groups {
+		return
+	}
+	for _, m := range groupMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, s := range scrapes {
+			names := make([]string, 0, len(s.groups))
+			for name := range s.groups {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(w, "%s{%s} %d\n", m.name, s.target.labelString("group", name), m.value(s.groups[name]))
+			}
+		}
+	}
+}
+
+// labelString formats the labels of a series of the target,
+// with an extra label such as the set if the name is not empty
+func (t *target) labelString(name, value string) string {
+	names := make([]string, 0, len(t.labels))
+	for name := range t.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []string{fmt.Sprintf("target=%s", quoteLabel(t.addr))}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, quoteLabel(t.labels[name])))
+	}
+	if name != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, quoteLabel(value)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// labelEscaper escapes label values in the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel is used to quote a label value
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
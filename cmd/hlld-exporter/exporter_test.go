@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+// testTarget starts a server that lists the given sets
+func testTarget(t *testing.T, resp string) (string, func()) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	server := hlldproxy.NewServer(list, func(line string) hlldproxy.Reply {
+		return hlldproxy.Static(resp)
+	})
+	return server.Addr().String(), func() { server.Close() }
+}
+
+func TestExporter(t *testing.T) {
+	addr1, stop1 := testTarget(t, "START\nweb-users 0.01 12 300 1024\nweb-tmp 0.01 12 5 64\napi-keys 0.01 14 10 512\nEND\n")
+	defer stop1()
+	addr2, stop2 := testTarget(t, "START\nweb-pages 0.01 12 200 2048\nEND\n")
+	defer stop2()
+
+	// A server that is not listening
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	down := list.Addr().String()
+	list.Close()
+
+	e := &exporter{
+		dial:    func(addr string) (*hlld.Client, error) { return hlld.Dial(addr) },
+		include: regexp.MustCompile(`^web-`),
+		exclude: regexp.MustCompile(`-tmp$`),
+		maxSets: 1,
+	}
+	for _, s := range []string{addr1 + ",env=prod", addr2 + ",env=dev", down} {
+		target, err := parseTarget(s)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		e.targets = append(e.targets, target)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	for _, expect := range []string{
+		"# TYPE hlld_up gauge",
+		`hlld_up{target="` + addr1 + `",env="prod"} 1`,
+		`hlld_up{target="` + down + `"} 0`,
+		`hlld_sets{target="` + addr1 + `",env="prod"} 1`,
+		`hlld_sets{target="` + addr2 + `",env="dev"} 1`,
+		`hlld_sets_dropped{target="` + addr2 + `",env="dev"} 1`,
+		`hlld_set_size{target="` + addr1 + `",env="prod",set="web-users"} 300`,
+		`hlld_set_storage_bytes{target="` + addr1 + `",env="prod",set="web-users"} 1024`,
+		`hlld_set_precision{target="` + addr1 + `",env="prod",set="web-users"} 12`,
+	} {
+		if !strings.Contains(out, expect+"\n") {
+			t.Fatalf("missing %s: %s", expect, out)
+		}
+	}
+
+	// Filtered and dropped sets are not exported
+	for _, name := range []string{"web-tmp", "api-keys", "web-pages"} {
+		if strings.Contains(out, name) {
+			t.Fatalf("exported %s: %s", name, out)
+		}
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	target, err := parseTarget("host:4553,env=prod,dc=east")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if target.addr != "host:4553" || len(target.labels) != 2 || target.labels["dc"] != "east" {
+		t.Fatalf("bad: %#v", target)
+	}
+	if out := target.labelString("set", "a\"b"); out != `target="host:4553",dc="east",env="prod",set="a\"b"` {
+		t.Fatalf("bad: %s", out)
+	}
+
+	for _, s := range []string{"", ",env=prod", "host,env", "host,1x=a", "host,set=a", "host,__name=a"} {
+		if _, err := parseTarget(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
+
+func TestExporter_Groups(t *testing.T) {
+	addr, stop := testTarget(t, "START\nweb-users-1 0.01 12 300 1024\nweb-users-2 0.01 12 100 1024\nweb-pages 0.01 12 5 64\napi 0.01 14 10 512\nEND\n")
+	defer stop()
+	tgt, err := parseTarget(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	e := &exporter{
+		targets:   []*target{tgt},
+		dial:      func(addr string) (*hlld.Client, error) { return hlld.Dial(addr) },
+		maxSets:   1,
+		sep:       "-",
+		depth:     2,
+		groupOnly: true,
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	// Groups include every set, regardless of the limit of sets
+	for _, expect := range []string{
+		`hlld_sets{target="` + addr + `"} 4`,
+		`hlld_sets_dropped{target="` + addr + `"} 0`,
+		`hlld_group_sets{target="` + addr + `",group="web-users"} 2`,
+		`hlld_group_size{target="` + addr + `",group="web-users"} 400`,
+		`hlld_group_storage_bytes{target="` + addr + `",group="web-users"} 2048`,
+		`hlld_group_sets{target="` + addr + `",group="web-pages"} 1`,
+		`hlld_group_size{target="` + addr + `",group="api"} 10`,
+	} {
+		if !strings.Contains(out, expect+"\n") {
+			t.Fatalf("missing %s: %s", expect, out)
+		}
+	}
+	if strings.Contains(out, `set="`) {
+		t.Fatalf("exported sets: %s", out)
+	}
+
+	// Sets are exported with the groups unless disabled
+	e.groupOnly = false
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out = rec.Body.String()
+	if !strings.Contains(out, `hlld_set_size{target="`+addr+`",set="web-users-1"} 300`) ||
+		!strings.Contains(out, `hlld_group_size{target="`+addr+`",group="web-users"} 400`) {
+		t.Fatalf("bad: %s", out)
+	}
+}
@@ -0,0 +1,104 @@
+// hlld-exporter serves the size and storage of the sets of one or more
+// hlld servers as Prometheus metrics. Sets can be filtered by name, and
+// the number of exported sets is limited to keep the number of series
+// bounded on servers with many sets.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldconfig"
+)
+
+// targetFlags collects the repeated target flag
+type targetFlags []string
+
+func (t *targetFlags) String() string {
+	return strings.Join(*t, " ")
+}
+
+func (t *targetFlags) Set(v string) error {
+	*t = append(*t, v)
+	return nil
+}
+
+func main() {
+	var targets targetFlags
+	flag.Var(&targets, "target", "address of an hlld server with optional labels, such as host:4553,env=prod. May be repeated.")
+	listen := flag.String("listen", "127.0.0.1:9553", "address to serve metrics on")
+	configPath := flag.String("config", "", "path to a JSON configuration file used for every target")
+	include := flag.String("include", "", "only export sets whose names match this regex")
+	exclude := flag.String("exclude", "", "do not export sets whose names match this regex")
+	maxSets := flag.Int("max-sets", 1000, "number of sets exported across all targets, keeping the largest, or zero for no limit")
+	sep := flag.String("group-sep", "-", "separator of the components of set names")
+	depth := flag.Int("group-depth", 0, "number of name components used to group sets, aggregate metrics are exported if positive")
+	groupOnly := flag.Bool("group-only", false, "only export the aggregate metrics of the groups")
+	flag.Parse()
+
+	if *depth < 0 || (*depth > 0 && *sep == "") {
+		fmt.Fprintf(os.Stderr, "The -group-sep flag must be set and -group-depth must not be negative\n")
+		os.Exit(1)
+	}
+	if *groupOnly && *depth == 0 {
+		fmt.Fprintf(os.Stderr, "The -group-only flag requires -group-depth\n")
+		os.Exit(1)
+	}
+
+	conf := &hlldconfig.Config{}
+	if *configPath != "" {
+		var err error
+		conf, err = hlldconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(targets) == 0 {
+		targets = append(targets, conf.Address())
+	}
+
+	e := &exporter{
+		dial: func(addr string) (*hlld.Client, error) {
+			c := *conf
+			c.Addr = addr
+			return c.Dial()
+		},
+		maxSets:   *maxSets,
+		sep:       *sep,
+		depth:     *depth,
+		groupOnly: *groupOnly,
+	}
+	for _, s := range targets {
+		t, err := parseTarget(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid target: %v\n", err)
+			os.Exit(1)
+		}
+		e.targets = append(e.targets, t)
+	}
+	var err error
+	if *include != "" {
+		if e.include, err = regexp.Compile(*include); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid include regex: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *exclude != "" {
+		if e.exclude, err = regexp.Compile(*exclude); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid exclude regex: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	http.Handle("/metrics", e)
+	if err := http.ListenAndServe(*listen, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to serve: %v\n", err)
+		os.Exit(1)
+	}
+}
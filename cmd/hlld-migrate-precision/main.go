@@ -0,0 +1,72 @@
+// hlld-migrate-precision is used to change the precision of a set by
+// re-ingesting its keys from a file into a new set and dropping the old
+// set, reporting the error characteristics before and after.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/armon/go-hlld/hlldconfig"
+)
+
+func main() {
+	addr := flag.String("addr", "", "address of the hlld server")
+	configPath := flag.String("config", "", "path to a JSON configuration file")
+	set := flag.String("set", "", "name of the set to migrate")
+	target := flag.String("target", "", "name of the new set, defaults to <set>_p<precision>")
+	precision := flag.Int("precision", 0, "precision of the new set")
+	eps := flag.Float64("eps", 0, "error threshold of the new set, if precision is not given")
+	keysPath := flag.String("keys", "", "path to a file with a key per line")
+	keepName := flag.Bool("keep-name", false, "copy the keys back into a set with the original name")
+	flag.Parse()
+
+	if *set == "" || *keysPath == "" {
+		fmt.Fprintf(os.Stderr, "The -set and -keys flags are required\n")
+		os.Exit(1)
+	}
+	if *precision == 0 && *eps == 0 {
+		fmt.Fprintf(os.Stderr, "One of -precision or -eps is required\n")
+		os.Exit(1)
+	}
+	if *target == "" {
+		*target = fmt.Sprintf("%s_p%d", *set, *precision)
+	}
+
+	// Load the configuration, the address flag takes precedence
+	conf := &hlldconfig.Config{}
+	if *configPath != "" {
+		var err error
+		conf, err = hlldconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *addr != "" {
+		conf.Addr = *addr
+	}
+
+	client, err := conf.Dial()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	m := &migration{
+		client:    client,
+		out:       os.Stdout,
+		set:       *set,
+		target:    *target,
+		precision: *precision,
+		eps:       *eps,
+		keysPath:  *keysPath,
+		keepName:  *keepName,
+	}
+	if err := m.run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/armon/go-hlld"
+)
+
+// migration is used to re-ingest a set with a new precision
+type migration struct {
+	client *hlld.Client
+	out    io.Writer
+
+	// set is the name of the set to migrate, and target is the
+	// name of the set that is created with the new precision
+	set    string
+	target string
+
+	// precision and eps are the options of the new set
+	precision int
+	eps       float64
+
+	// keysPath is the path of the file with a key per line
+	keysPath string
+
+	// keepName is set to copy the keys back into a set with the
+	// original name once the migration to the target is done
+	keepName bool
+}
+
+// run is used to perform the migration and report the results
+func (m *migration) run() error {
+	before, err := m.info(m.set)
+	if err != nil {
+		return err
+	}
+	m.report("Before", m.set, before)
+
+	if err := m.copy(m.set, m.target); err != nil {
+		return err
+	}
+	name := m.target
+
+	// Copy back into the original name if requested, since hlld does
+	// not support renaming a set
+	if m.keepName {
+		if err := m.copy(m.target, m.set); err != nil {
+			return err
+		}
+		name = m.set
+	}
+
+	after, err := m.info(name)
+	if err != nil {
+		return err
+	}
+	m.report("After", name, after)
+	return nil
+}
+
+// copy is used to replay the keys file from one set into another
+func (m *migration) copy(from, to string) error {
+	f, err := os.Open(m.keysPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	opts := &hlld.CopyOptions{
+		Precision:    m.precision,
+		ErrThreshold: m.eps,
+		Source:       hlld.LineSource(f, 1000),
+		Progress: func(p hlld.CopyProgress) {
+			fmt.Fprintf(m.out, "[%s -> %s] %s: %d keys\n", from, to, p.Stage, p.Keys)
+		},
+	}
+	return m.client.CopyAndSwap(from, to, opts)
+}
+
+// info is used to query the details of a set
+func (m *migration) info(name string) (*hlld.SetInfo, error) {
+	cmd, err := hlld.NewInfoCommand(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.client.Execute(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+	info, ok, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("set '%s' does not exist", name)
+	}
+	return info, nil
+}
+
+// report is used to print the error characteristics of a set
+func (m *migration) report(label, name string, info *hlld.SetInfo) {
+	fmt.Fprintf(m.out, "%s: set=%s precision=%d eps=%f size=%d storage=%d theoretical_error=%.4f%%\n",
+		label, name, info.Precision, info.ErrThreshold, info.Size, info.Storage,
+		hlld.TheoreticalError(info.Precision)*100)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+func TestMigration(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	server := hlldproxy.NewServer(list, func(line string) hlldproxy.Reply {
+		lock.Lock()
+		received = append(received, line)
+		lock.Unlock()
+		if strings.HasPrefix(line, "info") {
+			return hlldproxy.Static("START\nprecision 12\nsize 2\nEND\n")
+		}
+		return hlldproxy.Static("Done\n")
+	})
+	defer server.Close()
+
+	client, err := hlld.Dial(server.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	f, err := ioutil.TempFile("", "keys")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("a\nb\n")
+	f.Close()
+
+	var out bytes.Buffer
+	m := &migration{
+		client:    client,
+		out:       &out,
+		set:       "foo",
+		target:    "foo_p14",
+		precision: 14,
+		keysPath:  f.Name(),
+		keepName:  true,
+	}
+	if err := m.run(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	expect := []string{
+		"info foo\n",
+		"create foo_p14 precision=14\n",
+		"b foo_p14 a b\n",
+		"flush foo_p14\n",
+		"drop foo\n",
+		"create foo precision=14\n",
+		"b foo a b\n",
+		"flush foo\n",
+		"drop foo_p14\n",
+		"info foo\n",
+	}
+	if !reflect.DeepEqual(received, expect) {
+		t.Fatalf("bad: %q", received)
+	}
+	if !strings.Contains(out.String(), "Before: set=foo precision=12") {
+		t.Fatalf("bad: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "After: set=foo precision=12") {
+		t.Fatalf("bad: %s", out.String())
+	}
+}
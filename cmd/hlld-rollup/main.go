@@ -0,0 +1,72 @@
+// hlld-rollup merges hourly sets exported from hlld, such as the data
+// directory of a backup, into daily or weekly sets, and reports the
+// unique keys of each period. This allows backfills and analytics over
+// long ranges without loading the hourly sets into a server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: hlld-rollup [flags] -data-dir <dir> -prefix <prefix>\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	dataDir := flag.String("data-dir", "", "hlld data directory with the hourly sets")
+	prefix := flag.String("prefix", "", "prefix of the hourly sets, which are named <prefix>-<hour>")
+	layout := flag.String("layout", "unix", "time layout of the hour in the set names, or unix for Unix seconds")
+	period := flag.String("period", "day", "period to roll up to, day or week")
+	tz := flag.String("tz", "UTC", "time zone of the periods")
+	format := flag.String("format", "text", "output format, text or json")
+	outDir := flag.String("out-dir", "", "hlld data directory to write the rolled up sets to")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *dataDir == "" || *prefix == "" || flag.NArg() != 0 ||
+		(*period != "day" && *period != "week") ||
+		(*format != "text" && *format != "json") {
+		usage()
+		os.Exit(1)
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid time zone: %v\n", err)
+		os.Exit(1)
+	}
+
+	sets, err := load(*dataDir, *prefix, *layout, loc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load sets: %v\n", err)
+		os.Exit(1)
+	}
+	if len(sets) == 0 {
+		fmt.Fprintf(os.Stderr, "No hourly sets found with prefix '%s'\n", *prefix)
+		os.Exit(1)
+	}
+	rollups, err := rollUp(sets, *period)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to roll up sets: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *outDir != "" {
+		if err := writeRollups(*outDir, *prefix, rollups); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write sets: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *format == "json" {
+		err = writeJSON(os.Stdout, rollups)
+	} else {
+		err = writeText(os.Stdout, rollups)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hll"
+)
+
+// hourly is an hourly set read from a data directory
+type hourly struct {
+	name   string
+	hour   time.Time
+	sketch *hll.Sketch
+}
+
+// parseHour is used to parse the hour from the name of a set, which is
+// the prefix and a suffix in the layout, or Unix seconds if the layout
+// is "unix" as with the buckets of hlld.SlidingWindow
+func parseHour(name, prefix, layout string, loc *time.Location) (time.Time, bool) {
+	if !strings.HasPrefix(name, prefix+"-") {
+		return time.Time{}, false
+	}
+	suffix := strings.TrimPrefix(name, prefix+"-")
+	if layout == "unix" {
+		secs, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(secs, 0).In(loc), true
+	}
+	hour, err := time.ParseInLocation(layout, suffix, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return hour, true
+}
+
+// load is used to read the hourly sets with the prefix from an hlld
+// data directory. Sets kept in memory by hlld have no registers on
+// disk, so they are skipped.
+func load(dataDir, prefix, layout string, loc *time.Location) ([]*hourly, error) {
+	names, err := hll.SetFolderNames(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	var sets []*hourly
+	for _, name := range names {
+		hour, ok := parseHour(name, prefix, layout, loc)
+		if !ok {
+			continue
+		}
+		set, err := hll.ReadSetFolder(dataDir, name)
+		if err != nil {
+			return nil, err
+		}
+		if set.InMemory {
+			continue
+		}
+		sets = append(sets, &hourly{name: name, hour: hour, sketch: set.Sketch})
+	}
+	return sets, nil
+}
+
+// periodStart returns the start of the day, or the week starting
+// on Monday, that contains the time
+func periodStart(t time.Time, period string) time.Time {
+	y, m, d := t.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	if period == "week" {
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	}
+	return start
+}
+
+// periodEnd returns the start of the next period
+func periodEnd(start time.Time, period string) time.Time {
+	if period == "week" {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// rollup is the union of the hourly sets of a period
+type rollup struct {
+	// Period names the day, such as 2024-05-01, or the
+	// ISO week, such as 2024-W18
+	Period string    `json:"period"`
+	Start  time.Time `json:"start"`
+
+	// Hours is the number of hourly sets, out of the hours
+	// in the period, which may differ from 24 a day with DST
+	Hours         int `json:"hours"`
+	ExpectedHours int `json:"expected_hours"`
+
+	// Estimate is the unique keys in the period, within Margin
+	// with 95% confidence
+	Estimate uint64 `json:"estimate"`
+	Margin   uint64 `json:"margin_95"`
+
+	// HourlySum is the sum of the hourly estimates, which exceeds
+	// the estimate by the keys that recur in multiple hours
+	HourlySum uint64 `json:"hourly_sum"`
+
+	// Returning is the estimated keys also in the previous period,
+	// if there are sets for it
+	Returning *uint64 `json:"returning,omitempty"`
+
+	sketch *hll.Sketch
+}
+
+// rollUp is used to merge the hourly sets of each period, returning
+// the rollups sorted by period
+func rollUp(sets []*hourly, period string) ([]*rollup, error) {
+	byStart := make(map[time.Time]*rollup)
+	hourlySum := make(map[time.Time]float64)
+	for _, set := range sets {
+		start := periodStart(set.hour, period)
+		r, ok := byStart[start]
+		if !ok {
+			end := periodEnd(start, period)
+			r = &rollup{
+				Period:        periodName(start, period),
+				Start:         start,
+				ExpectedHours: int(end.Sub(start) / time.Hour),
+				sketch:        set.sketch.Clone(),
+			}
+			byStart[start] = r
+		} else if err := r.sketch.Merge(set.sketch); err != nil {
+			return nil, fmt.Errorf("failed to merge '%s': %w", set.name, err)
+		}
+		r.Hours++
+		hourlySum[start] += set.sketch.Estimate()
+	}
+
+	out := make([]*rollup, 0, len(byStart))
+	for start, r := range byStart {
+		est := r.sketch.Estimate()
+		r.Estimate = uint64(math.Round(est))
+		r.Margin = uint64(math.Ceil(hlld.Sigmas95 * hll.ErrorForPrecision(r.sketch.Precision()) * est))
+		r.HourlySum = uint64(math.Round(hourlySum[start]))
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Start.Before(out[j].Start)
+	})
+
+	// Estimate the keys returning from the previous period
+	for i, r := range out {
+		if i == 0 || !periodEnd(out[i-1].Start, period).Equal(r.Start) {
+			continue
+		}
+		inter, err := hll.Intersection(out[i-1].sketch, r.sketch)
+		if err != nil {
+			return nil, err
+		}
+		returning := uint64(math.Round(inter.Value))
+		r.Returning = &returning
+	}
+	return out, nil
+}
+
+// periodName returns the name of the period starting at the time
+func periodName(start time.Time, period string) string {
+	if period == "week" {
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return start.Format("2006-01-02")
+}
+
+// writeText is used to print the rollups as a table
+func writeText(w io.Writer, rollups []*rollup) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "PERIOD\tHOURS\tESTIMATE\tMARGIN\tHOURLY SUM\tRETURNING\t\n")
+	for _, r := range rollups {
+		returning := "-"
+		if r.Returning != nil {
+			returning = strconv.FormatUint(*r.Returning, 10)
+		}
+		fmt.Fprintf(tw, "%s\t%d/%d\t%d\t±%d\t%d\t%s\t\n",
+			r.Period, r.Hours, r.ExpectedHours, r.Estimate, r.Margin, r.HourlySum, returning)
+	}
+	return tw.Flush()
+}
+
+// writeJSON is used to print the rollups as a JSON array
+func writeJSON(w io.Writer, rollups []*rollup) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rollups)
+}
+
+// writeRollups is used to write the rollups as sets of an hlld data
+// directory, named after the prefix and the period
+func writeRollups(dataDir, prefix string, rollups []*rollup) error {
+	for _, r := range rollups {
+		set := &hll.SetFolder{
+			Name:   prefix + "-" + r.Period,
+			Eps:    hll.ErrorForPrecision(r.sketch.Precision()),
+			Sketch: r.sketch,
+		}
+		if err := hll.WriteSetFolder(dataDir, set); err != nil {
+			return fmt.Errorf("failed to write '%s': %w", set.Name, err)
+		}
+	}
+	return nil
+}
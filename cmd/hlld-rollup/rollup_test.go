@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armon/go-hlld/hll"
+)
+
+// testDataDir writes hourly sets for two days, where each hour has
+// 1000 keys of which half recur every hour of the day, and the first
+// 500 keys of the first day recur on the second
+func testDataDir(t *testing.T) string {
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for h := 0; h < 48; h++ {
+		day := h / 24
+		s, _ := hll.New(14)
+		for i := 0; i < 500; i++ {
+			s.Add("recurring-" + strconv.Itoa(day) + "-" + strconv.Itoa(i))
+			s.Add("hour-" + strconv.Itoa(h) + "-" + strconv.Itoa(i))
+		}
+		if day == 1 {
+			// Make the recurring keys of the second day match the first
+			s.Reset()
+			for i := 0; i < 500; i++ {
+				s.Add("recurring-0-" + strconv.Itoa(i))
+				s.Add("hour-" + strconv.Itoa(h) + "-" + strconv.Itoa(i))
+			}
+		}
+		hour := start.Add(time.Duration(h) * time.Hour)
+		set := &hll.SetFolder{
+			Name:   "visitors-" + strconv.FormatInt(hour.Unix(), 10),
+			Eps:    hll.ErrorForPrecision(14),
+			Sketch: s,
+		}
+		if err := hll.WriteSetFolder(dir, set); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Other sets are ignored
+	other, _ := hll.New(12)
+	hll.WriteSetFolder(dir, &hll.SetFolder{Name: "visitors-total", Sketch: other})
+	hll.WriteSetFolder(dir, &hll.SetFolder{Name: "clicks-1714521600", Sketch: other})
+	return dir
+}
+
+// near checks an estimate is within 4 standard errors
+func near(t *testing.T, got uint64, expect float64) {
+	t.Helper()
+	if math.Abs(float64(got)-expect) > 4*hll.ErrorForPrecision(14)*expect+1 {
+		t.Fatalf("bad: %d expected %v", got, expect)
+	}
+}
+
+func TestParseHour(t *testing.T) {
+	hour, ok := parseHour("foo-1714521600", "foo", "unix", time.UTC)
+	if !ok || !hour.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("bad: %v %v", hour, ok)
+	}
+	hour, ok = parseHour("foo-2024050113", "foo", "2006010215", time.UTC)
+	if !ok || hour.Hour() != 13 {
+		t.Fatalf("bad: %v %v", hour, ok)
+	}
+	for _, name := range []string{"foo", "foobar-1", "foo-bar", "bar-1714521600"} {
+		if _, ok := parseHour(name, "foo", "unix", time.UTC); ok {
+			t.Fatalf("bad: %s", name)
+		}
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 13, 30, 0, 0, time.UTC)
+	if start := periodStart(ts, "day"); !start.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("bad: %v", start)
+	}
+	// Weeks start on Monday
+	if start := periodStart(ts, "week"); !start.Equal(time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("bad: %v", start)
+	}
+	sunday := time.Date(2024, 5, 5, 23, 0, 0, 0, time.UTC)
+	if start := periodStart(sunday, "week"); !start.Equal(time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("bad: %v", start)
+	}
+	if name := periodName(time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC), "week"); name != "2024-W18" {
+		t.Fatalf("bad: %v", name)
+	}
+}
+
+func TestRollUp(t *testing.T) {
+	dir := testDataDir(t)
+	sets, err := load(dir, "visitors", "unix", time.UTC)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(sets) != 48 {
+		t.Fatalf("bad: %d", len(sets))
+	}
+
+	rollups, err := rollUp(sets, "day")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(rollups) != 2 || rollups[0].Period != "2024-05-01" || rollups[1].Period != "2024-05-02" {
+		t.Fatalf("bad: %v", rollups)
+	}
+	for _, r := range rollups {
+		if r.Hours != 24 || r.ExpectedHours != 24 {
+			t.Fatalf("bad: %v", r)
+		}
+		near(t, r.Estimate, 500+24*500)
+		near(t, r.HourlySum, 24*1000)
+	}
+	if rollups[0].Returning != nil || rollups[1].Returning == nil {
+		t.Fatalf("bad: %v", rollups)
+	}
+	if got := float64(*rollups[1].Returning); math.Abs(got-500) > 4*hll.ErrorForPrecision(14)*25000 {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Both days are in the same week
+	rollups, err = rollUp(sets, "week")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(rollups) != 1 || rollups[0].Hours != 48 || rollups[0].ExpectedHours != 168 {
+		t.Fatalf("bad: %v", rollups)
+	}
+	near(t, rollups[0].Estimate, 1000+48*500)
+}
+
+func TestRollUp_Precision(t *testing.T) {
+	a, _ := hll.New(12)
+	b, _ := hll.New(14)
+	hour := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	sets := []*hourly{
+		{name: "a", hour: hour, sketch: a},
+		{name: "b", hour: hour.Add(time.Hour), sketch: b},
+	}
+	if _, err := rollUp(sets, "day"); err == nil || !strings.Contains(err.Error(), "'b'") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	returning := uint64(480)
+	rollups := []*rollup{
+		{Period: "2024-05-01", Hours: 24, ExpectedHours: 24, Estimate: 12500, Margin: 200, HourlySum: 24000},
+		{Period: "2024-05-02", Hours: 20, ExpectedHours: 24, Estimate: 11000, Margin: 180, HourlySum: 20000, Returning: &returning},
+	}
+	var buf bytes.Buffer
+	if err := writeText(&buf, rollups); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := "PERIOD      HOURS  ESTIMATE  MARGIN  HOURLY SUM  RETURNING  \n" +
+		"2024-05-01  24/24  12500     ±200    24000       -          \n" +
+		"2024-05-02  20/24  11000     ±180    20000       480        \n"
+	if buf.String() != expect {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeJSON(&buf, rollups); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var out []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := out[0]["returning"]; ok || out[1]["returning"] != 480.0 || out[1]["margin_95"] != 180.0 {
+		t.Fatalf("bad: %v", out)
+	}
+}
+
+func TestWriteRollups(t *testing.T) {
+	dir := testDataDir(t)
+	sets, _ := load(dir, "visitors", "unix", time.UTC)
+	rollups, _ := rollUp(sets, "day")
+
+	out := t.TempDir()
+	if err := writeRollups(out, "visitors", rollups); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	set, err := hll.ReadSetFolder(out, "visitors-2024-05-01")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if uint64(math.Round(set.Sketch.Estimate())) != rollups[0].Estimate {
+		t.Fatalf("bad: %v", set.Sketch.Estimate())
+	}
+}
@@ -0,0 +1,75 @@
+// hlld-server runs the embedded server of the hlldserver package as a
+// standalone daemon. It speaks the hlld protocol over TCP and optionally
+// a unix socket, and is intended for development environments where
+// running hlld itself is inconvenient.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/armon/go-hlld/hlldserver"
+)
+
+func main() {
+	config := hlldserver.DefaultConfig()
+	listen := flag.String("listen", "127.0.0.1:4553", "TCP address to listen on, or empty to disable")
+	unixPath := flag.String("unix", "", "path of a unix socket to also listen on")
+	flag.StringVar(&config.DataDir, "data-dir", "", "directory to snapshot the sets to, or empty to keep them in memory")
+	flag.IntVar(&config.DefaultPrecision, "precision", config.DefaultPrecision, "precision of new sets")
+	flag.DurationVar(&config.SnapshotInterval, "snapshot-interval", config.SnapshotInterval, "how often changed sets are snapshotted")
+	flag.DurationVar(&config.IdleTimeout, "idle-timeout", 0, "how long sets may be unused before they are paged out")
+	flag.IntVar(&config.MaxConnections, "max-conns", 0, "maximum number of client connections, or 0 for unlimited")
+	flag.Float64Var(&config.RateLimit, "rate-limit", 0, "commands per second allowed on each connection, or 0 for unlimited")
+	flag.IntVar(&config.Burst, "burst", 0, "commands allowed at once on each connection when rate limited")
+	flag.Parse()
+
+	var lists []net.Listener
+	if *listen != "" {
+		list, err := net.Listen("tcp", *listen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to listen: %v\n", err)
+			os.Exit(1)
+		}
+		lists = append(lists, list)
+	}
+	if *unixPath != "" {
+		// Remove the socket of a previous run
+		if err := os.Remove(*unixPath); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to remove socket: %v\n", err)
+			os.Exit(1)
+		}
+		list, err := net.Listen("unix", *unixPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to listen: %v\n", err)
+			os.Exit(1)
+		}
+		lists = append(lists, list)
+	}
+	if len(lists) == 0 {
+		fmt.Fprintf(os.Stderr, "At least one of -listen or -unix is required\n")
+		os.Exit(1)
+	}
+
+	server, err := hlldserver.NewServer(lists[0], config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
+		os.Exit(1)
+	}
+	for _, list := range lists[1:] {
+		server.Listen(list)
+	}
+
+	// Wait for a shutdown signal, then snapshot the sets
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+	if err := server.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to snapshot sets: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,301 @@
+package hlld
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// CommandCodec is used to serialize commands, so they can be queued by
+// producers, such as in Kafka or SQS, and executed by a separate consumer.
+// Only the arguments of a command are serialized, never its result, and
+// commands are validated by their constructors when unmarshaled.
+type CommandCodec interface {
+	Marshal(cmd Command) ([]byte, error)
+	Unmarshal(buf []byte) (Command, error)
+}
+
+var (
+	// JSONCodec serializes commands as JSON objects, such as
+	// {"type":"bulk","set":"foo","keys":["a","b"]}
+	JSONCodec CommandCodec = jsonCodec{}
+
+	// BinaryCodec serializes commands in a compact binary form, which
+	// is versioned so that it can be extended
+	BinaryCodec CommandCodec = binaryCodec{}
+)
+
+// commandJSON is the JSON representation of a command
+type commandJSON struct {
+	Type          string   `json:"type"`
+	Set           string   `json:"set,omitempty"`
+	Key           string   `json:"key,omitempty"`
+	Keys          []string `json:"keys,omitempty"`
+	Prefix        string   `json:"prefix,omitempty"`
+	Precision     int      `json:"precision,omitempty"`
+	ErrThreshold  float64  `json:"eps,omitempty"`
+	EpsDigits     int      `json:"eps_digits,omitempty"`
+	EpsScientific bool     `json:"eps_scientific,omitempty"`
+	InMemory      bool     `json:"in_memory,omitempty"`
+	Line          string   `json:"line,omitempty"`
+}
+
+// commandFields is used to convert a command to its serialized fields
+func commandFields(cmd Command) (*commandJSON, error) {
+	out := &commandJSON{Type: commandType(cmd)}
+	switch c := cmd.(type) {
+	case *CreateCommand:
+		out.Set = c.SetName
+		out.Precision = c.Precision
+		out.ErrThreshold = c.ErrThreshold
+		out.EpsDigits = c.EpsDigits
+		out.EpsScientific = c.EpsScientific
+		out.InMemory = c.InMemory
+	case *ListCommand:
+		out.Prefix = c.Prefix
+	case *SetCommand:
+		if c.Command != "drop" && c.Command != "close" && c.Command != "clear" {
+			return nil, fmt.Errorf("cannot serialize set command '%s'", c.Command)
+		}
+		out.Set = c.SetName
+	case *SetKeysCommand:
+		out.Set = c.SetName
+		out.Keys = c.Keys
+	case *SetKeyCommand:
+		out.Set = c.SetName
+		out.Key = c.Key
+	case *FlushCommand:
+		out.Set = c.SetName
+	case *InfoCommand:
+		out.Set = c.SetName
+	case *RawCommand:
+		out.Line = c.Line
+	default:
+		return nil, fmt.Errorf("cannot serialize command of type %T", cmd)
+	}
+	return out, nil
+}
+
+// command is used to build the command of the serialized fields,
+// validating the arguments with the constructors
+func (f *commandJSON) command() (Command, error) {
+	switch f.Type {
+	case "create":
+		cmd, err := NewCreateCommand(f.Set)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Precision = f.Precision
+		cmd.ErrThreshold = f.ErrThreshold
+		cmd.EpsDigits = f.EpsDigits
+		cmd.EpsScientific = f.EpsScientific
+		cmd.InMemory = f.InMemory
+		return cmd, nil
+	case "list":
+		return NewListCommand(f.Prefix)
+	case "drop":
+		return NewDropCommand(f.Set)
+	case "close":
+		return NewCloseCommand(f.Set)
+	case "clear":
+		return NewClearCommand(f.Set)
+	case "bulk":
+		return NewSetKeysCommand(f.Set, f.Keys)
+	case "set":
+		return NewSetKeyCommand(f.Set, f.Key)
+	case "flush":
+		return NewFlushCommand(f.Set)
+	case "info":
+		return NewInfoCommand(f.Set)
+	case "raw":
+		return NewRawCommand(f.Line)
+	default:
+		return nil, fmt.Errorf("unknown command type '%s'", f.Type)
+	}
+}
+
+// jsonCodec implements JSONCodec
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(cmd Command) ([]byte, error) {
+	fields, err := commandFields(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+func (jsonCodec) Unmarshal(buf []byte) (Command, error) {
+	var fields commandJSON
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return nil, err
+	}
+	return fields.command()
+}
+
+// binaryVersion is the version of the binary form, which is the
+// first byte of every serialized command
+const binaryVersion = 1
+
+// binaryTypes are the type codes of the binary form, which
+// must never be reordered
+var binaryTypes = []string{"", "create", "list", "drop", "close", "clear", "bulk", "flush", "info", "raw", "set"}
+
+// Flags of a create command in the binary form
+const (
+	binaryInMemory = 1 << iota
+	binaryEpsScientific
+)
+
+// binaryCodec implements BinaryCodec. Commands are encoded as the version
+// and type code, followed by the arguments of the type. Strings are
+// prefixed with their length as a uvarint.
+type binaryCodec struct{}
+
+func (binaryCodec) Marshal(cmd Command) ([]byte, error) {
+	f, err := commandFields(cmd)
+	if err != nil {
+		return nil, err
+	}
+	code := 0
+	for idx, name := range binaryTypes {
+		if name == f.Type {
+			code = idx
+		}
+	}
+
+	b := []byte{binaryVersion, byte(code)}
+	switch f.Type {
+	case "create":
+		b = appendString(b, f.Set)
+		b = binary.AppendUvarint(b, uint64(f.Precision))
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(f.ErrThreshold))
+		b = binary.AppendUvarint(b, uint64(f.EpsDigits))
+		var flags byte
+		if f.InMemory {
+			flags |= binaryInMemory
+		}
+		if f.EpsScientific {
+			flags |= binaryEpsScientific
+		}
+		b = append(b, flags)
+	case "list":
+		b = appendString(b, f.Prefix)
+	case "bulk":
+		b = appendString(b, f.Set)
+		b = binary.AppendUvarint(b, uint64(len(f.Keys)))
+		for _, key := range f.Keys {
+			b = appendString(b, key)
+		}
+	case "raw":
+		b = appendString(b, f.Line)
+	case "set":
+		b = appendString(b, f.Set)
+		b = appendString(b, f.Key)
+	default:
+		b = appendString(b, f.Set)
+	}
+	return b, nil
+}
+
+func (binaryCodec) Unmarshal(buf []byte) (Command, error) {
+	if len(buf) < 2 {
+		return nil, fmt.Errorf("binary command truncated")
+	}
+	if buf[0] != binaryVersion {
+		return nil, fmt.Errorf("unsupported binary command version %d", buf[0])
+	}
+	if int(buf[1]) == 0 || int(buf[1]) >= len(binaryTypes) {
+		return nil, fmt.Errorf("unknown binary command type %d", buf[1])
+	}
+	f := &commandJSON{Type: binaryTypes[buf[1]]}
+	r := &binaryReader{buf: buf[2:]}
+
+	switch f.Type {
+	case "create":
+		f.Set = r.string()
+		f.Precision = int(r.uvarint())
+		f.ErrThreshold = math.Float64frombits(r.uint64())
+		f.EpsDigits = int(r.uvarint())
+		flags := r.byte()
+		f.InMemory = flags&binaryInMemory != 0
+		f.EpsScientific = flags&binaryEpsScientific != 0
+	case "list":
+		f.Prefix = r.string()
+	case "bulk":
+		f.Set = r.string()
+		n := r.uvarint()
+		if n > uint64(len(r.buf)) {
+			r.err = true
+		}
+		for i := uint64(0); i < n && !r.err; i++ {
+			f.Keys = append(f.Keys, r.string())
+		}
+	case "raw":
+		f.Line = r.string()
+	case "set":
+		f.Set = r.string()
+		f.Key = r.string()
+	default:
+		f.Set = r.string()
+	}
+	if r.err || len(r.buf) != 0 {
+		return nil, fmt.Errorf("malformed binary %s command", f.Type)
+	}
+	return f.command()
+}
+
+// appendString is used to append a length prefixed string
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// binaryReader is used to read the binary form, setting
+// err instead of returning errors from each read
+type binaryReader struct {
+	buf []byte
+	err bool
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = true
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) uint64() uint64 {
+	if len(r.buf) < 8 {
+		r.err = true
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v
+}
+
+func (r *binaryReader) byte() byte {
+	if len(r.buf) < 1 {
+		r.err = true
+		return 0
+	}
+	v := r.buf[0]
+	r.buf = r.buf[1:]
+	return v
+}
+
+func (r *binaryReader) string() string {
+	n := r.uvarint()
+	if r.err || n > uint64(len(r.buf)) {
+		r.err = true
+		return ""
+	}
+	s := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return s
+}
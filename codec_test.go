@@ -0,0 +1,157 @@
+package hlld
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// codecCommands returns a command of every serializable type
+func codecCommands(t *testing.T) []Command {
+	create, err := NewCreateCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	create.Precision = 14
+	create.ErrThreshold = 0.0001
+	create.EpsDigits = 3
+	create.EpsScientific = true
+	create.InMemory = true
+
+	var cmds []Command
+	add := func(cmd Command, err error) {
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	add(create, nil)
+	add(NewCreateCommand("bar"))
+	add(NewListCommand(""))
+	add(NewListCommand("foo"))
+	add(NewDropCommand("foo"))
+	add(NewCloseCommand("foo"))
+	add(NewClearCommand("foo"))
+	add(NewSetKeysCommand("foo", []string{"a", "b", "ünïcode"}))
+	add(NewSetKeyCommand("foo", "a"))
+	add(NewFlushCommand(""))
+	add(NewFlushCommand("foo"))
+	add(NewInfoCommand("foo"))
+	add(NewRawCommand("s foo bar"))
+	return cmds
+}
+
+// wireOf returns the wire form of a command
+func wireOf(t *testing.T, cmd Command) string {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := cmd.Encode(w); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+func TestCommandCodec_RoundTrip(t *testing.T) {
+	for _, codec := range []CommandCodec{JSONCodec, BinaryCodec} {
+		for _, cmd := range codecCommands(t) {
+			buf, err := codec.Marshal(cmd)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			out, err := codec.Unmarshal(buf)
+			if err != nil {
+				t.Fatalf("err: %v %q", err, buf)
+			}
+			if !reflect.DeepEqual(out, cmd) {
+				t.Fatalf("bad: %#v %#v", out, cmd)
+			}
+			if wireOf(t, out) != wireOf(t, cmd) {
+				t.Fatalf("bad: %q", wireOf(t, out))
+			}
+		}
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	cmd, _ := NewSetKeysCommand("foo", []string{"a", "b"})
+	buf, err := JSONCodec.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(buf) != `{"type":"bulk","set":"foo","keys":["a","b"]}` {
+		t.Fatalf("bad: %s", buf)
+	}
+
+	// Commands are validated when unmarshaled
+	bad := []string{
+		`{"type":"bulk","set":"foo bar","keys":["a"]}`,
+		`{"type":"bulk","set":"foo"}`,
+		`{"type":"set","set":"foo"}`,
+		`{"type":"compact","set":"foo"}`,
+		`{"type":"raw","line":"s foo\nb bar"}`,
+		`not json`,
+	}
+	for _, in := range bad {
+		if _, err := JSONCodec.Unmarshal([]byte(in)); err == nil {
+			t.Fatalf("expect error: %s", in)
+		}
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	cmd, _ := NewSetKeysCommand("foo", []string{"a", "bc"})
+	buf, err := BinaryCodec.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := []byte{1, 6, 3, 'f', 'o', 'o', 2, 1, 'a', 2, 'b', 'c'}
+	if !bytes.Equal(buf, expect) {
+		t.Fatalf("bad: %v", buf)
+	}
+
+	// Truncated and padded forms are rejected
+	for i := 0; i < len(buf); i++ {
+		if _, err := BinaryCodec.Unmarshal(buf[:i]); err == nil {
+			t.Fatalf("expect error: %v", buf[:i])
+		}
+	}
+	if _, err := BinaryCodec.Unmarshal(append(buf, 0)); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	bad := [][]byte{
+		{2, 6},
+		{1, 0},
+		{1, 200},
+		{1, 6, 3, 'f', 'o', 'o', 0xff, 0xff, 0xff, 0xff, 0x0f},
+		{1, 3, 3, 'f', ' ', 'o'},
+	}
+	for _, in := range bad {
+		if _, err := BinaryCodec.Unmarshal(in); err == nil {
+			t.Fatalf("expect error: %v", in)
+		}
+	}
+}
+
+// foreignCommand is a command type of another package
+type foreignCommand struct {
+	RawCommand
+}
+
+func TestCommandCodec_Unsupported(t *testing.T) {
+	cmds := []Command{
+		&SetCommand{Command: "compact", SetName: "foo"},
+		&foreignCommand{},
+	}
+	for _, codec := range []CommandCodec{JSONCodec, BinaryCodec} {
+		for _, cmd := range cmds {
+			_, err := codec.Marshal(cmd)
+			if err == nil || !strings.Contains(err.Error(), "cannot serialize") {
+				t.Fatalf("bad: %v", err)
+			}
+		}
+	}
+}
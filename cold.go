@@ -0,0 +1,94 @@
+package hlld
+
+import (
+	"sort"
+)
+
+// ColdReport contains the results of checking for cold sets
+type ColdReport struct {
+	// Sampled is the number of sets that were sampled
+	Sampled int
+
+	// Cold are the in-memory sets with no writes since the last check
+	Cold []string
+
+	// Closed are the cold sets that were closed
+	Closed []string
+}
+
+// ColdSetDetector is a maintenance helper that finds sets that are in
+// memory but have not been written to recently, and closes them to free
+// memory. Writes are detected by sampling the sets counter of each set,
+// so a set is only cold if it was unchanged between two checks, which
+// should be spaced by the interval considered recent.
+type ColdSetDetector struct {
+	// DryRun is used to report the cold sets without closing them
+	DryRun bool
+
+	client *Client
+	prefix string
+
+	// last is the sets counter of each set at the previous check
+	last map[string]uint64
+}
+
+// NewColdSetDetector returns a detector for the sets matching a prefix
+func NewColdSetDetector(client *Client, prefix string) *ColdSetDetector {
+	return &ColdSetDetector{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Check is used to sample the sets and close those that are cold, unless
+// this is a dry run. The first check only records a baseline, so no sets
+// are cold until the second check.
+func (d *ColdSetDetector) Check() (*ColdReport, error) {
+	infos, err := d.client.InfoByPrefix(d.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare the counters against the previous check
+	report := &ColdReport{Sampled: len(infos)}
+	current := make(map[string]uint64, len(infos))
+	for name, info := range infos {
+		current[name] = info.Sets
+		prev, ok := d.last[name]
+		if ok && info.InMemory && info.Sets == prev {
+			report.Cold = append(report.Cold, name)
+		}
+	}
+	sort.Strings(report.Cold)
+	d.last = current
+	if d.DryRun || len(report.Cold) == 0 {
+		return report, nil
+	}
+
+	// Close the cold sets
+	cmds := make([]*SetCommand, 0, len(report.Cold))
+	futures := make([]*Future, 0, len(report.Cold))
+	for _, name := range report.Cold {
+		cmd, err := NewCloseCommand(name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := d.client.Execute(cmd)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+		futures = append(futures, f)
+	}
+	for idx, f := range futures {
+		if err := f.Error(); err != nil {
+			return nil, err
+		}
+		if ok, err := cmds[idx].Result(); err != nil {
+			return nil, err
+		} else if ok {
+			report.Closed = append(report.Closed, cmds[idx].SetName)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,77 @@
+package hlld
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestColdSetDetector(t *testing.T) {
+	var lock sync.Mutex
+	fooSets := 100
+	var closed []string
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		defer lock.Unlock()
+		switch line {
+		case "list\n":
+			return "START\nfoo 0.01 12 10 3280\nbar 0.01 12 10 3280\nbaz 0.01 12 10 3280\nEND\n"
+		case "info foo\n":
+			fooSets += 10
+			return fmt.Sprintf("START\nin_memory 1\nsets %d\nEND\n", fooSets)
+		case "info bar\n":
+			return "START\nin_memory 1\nsets 50\nEND\n"
+		case "info baz\n":
+			return "START\nin_memory 0\nsets 50\nEND\n"
+		case "close bar\n":
+			closed = append(closed, "bar")
+			return "Done\n"
+		}
+		t.Errorf("bad: %q", line)
+		return "Client Error: Command not supported\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	d := NewColdSetDetector(client, "")
+	d.DryRun = true
+
+	// First check is the baseline
+	report, err := d.Check()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if report.Sampled != 3 || len(report.Cold) != 0 {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	// Dry run does not close
+	report, err = d.Check()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(report.Cold, []string{"bar"}) || len(report.Closed) != 0 {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	// Closes the cold sets
+	d.DryRun = false
+	report, err = d.Check()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(report.Closed, []string{"bar"}) {
+		t.Fatalf("bad: %#v", report)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if !reflect.DeepEqual(closed, []string{"bar"}) {
+		t.Fatalf("bad: %v", closed)
+	}
+}
@@ -21,6 +21,9 @@ type CreateCommand struct {
 	// SetName is the name of the set to create
 	SetName string
 
+	// prefixes records the prefix hooks applied to the command
+	prefixes prefixMarks
+
 	// Precision is the number of bits used for the bucket, the higher
 	// precision will reduce the errors at the cost of using more memory.A
 	// By default this is unspecified and computed based on the ErrThreshold.
@@ -36,14 +39,52 @@ type CreateCommand struct {
 	// sets from leaving memory.
 	InMemory bool
 
+	// EpsDigits is the number of digits after the decimal point used to
+	// encode the ErrThreshold. By default, the fewest digits needed to
+	// represent the value exactly are used.
+	EpsDigits int
+
+	// EpsScientific can be set to encode the ErrThreshold in scientific
+	// notation, which is more compact for very small values
+	EpsScientific bool
+
 	// result is the result of the decode
 	result string
 }
 
+// ValidationError is returned by the command constructors if an
+// argument is invalid, identifying the argument and offending value
+type ValidationError struct {
+	// Field is the invalid argument, such as "set name" or "key"
+	Field string
+
+	// Value is the offending value, or empty if it is missing
+	Value string
+
+	// Index is the index of the offending key in a batch, or -1
+	Index int
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Index >= 0:
+		return fmt.Sprintf("invalid %s at index %d: '%s'", e.Field, e.Index, e.Value)
+	case e.Value == "":
+		return fmt.Sprintf("missing %s", e.Field)
+	default:
+		return fmt.Sprintf("invalid %s '%s'", e.Field, e.Value)
+	}
+}
+
+// invalidArg is used to build the error for an invalid argument
+func invalidArg(field, value string) error {
+	return &ValidationError{Field: field, Value: value, Index: -1}
+}
+
 // NewCreateCommand is used to prepare a new create command
 func NewCreateCommand(name string) (*CreateCommand, error) {
 	if !validWord.MatchString(name) {
-		return nil, fmt.Errorf("invalid set name")
+		return nil, invalidArg("set name", name)
 	}
 	cmd := &CreateCommand{
 		SetName: name,
@@ -55,7 +96,7 @@ func (c *CreateCommand) Encode(w *bufio.Writer) error {
 	if _, err := w.WriteString("create "); err != nil {
 		return err
 	}
-	if _, err := w.WriteString(c.SetName); err != nil {
+	if _, err := w.WriteString(c.wireName()); err != nil {
 		return err
 	}
 	if c.Precision != 0 {
@@ -64,7 +105,10 @@ func (c *CreateCommand) Encode(w *bufio.Writer) error {
 		}
 	}
 	if c.ErrThreshold != 0 {
-		if _, err := fmt.Fprintf(w, " eps=%f", c.ErrThreshold); err != nil {
+		if _, err := w.WriteString(" eps="); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(c.formatEps()); err != nil {
 			return err
 		}
 	}
@@ -76,6 +120,19 @@ func (c *CreateCommand) Encode(w *bufio.Writer) error {
 	return w.WriteByte('\n')
 }
 
+// formatEps is used to encode the ErrThreshold
+func (c *CreateCommand) formatEps() string {
+	format := byte('f')
+	if c.EpsScientific {
+		format = 'e'
+	}
+	digits := -1
+	if c.EpsDigits > 0 {
+		digits = c.EpsDigits
+	}
+	return strconv.FormatFloat(c.ErrThreshold, format, digits, 64)
+}
+
 func (c *CreateCommand) Decode(r *bufio.Reader) error {
 	resp, err := r.ReadString('\n')
 	if err != nil {
@@ -88,7 +145,7 @@ func (c *CreateCommand) Decode(r *bufio.Reader) error {
 func (c *CreateCommand) Result() (bool, error) {
 	switch c.result {
 	case "":
-		return false, fmt.Errorf("result not decoded yet")
+		return false, ErrNotDecoded
 	case "Done\n":
 		return true, nil
 	case "Exists\n":
@@ -96,8 +153,50 @@ func (c *CreateCommand) Result() (bool, error) {
 	case "Delete in progress\n":
 		return false, nil
 	default:
-		return false, fmt.Errorf("invalid response: %s", c.result)
+		if strings.HasPrefix(c.result, "Client Error") {
+			return false, c.createError()
+		}
+		return false, fmt.Errorf("%w: %s", ErrInvalidResponse, c.result)
+	}
+}
+
+// CreateError is returned if the server rejects the arguments of a
+// create command, so that callers can fall back to the defaults
+type CreateError struct {
+	// Param is the rejected parameter, either "precision" or "eps", or
+	// empty if it cannot be determined
+	Param string
+
+	// Response is the error returned by the server
+	Response string
+}
+
+func (e *CreateError) Error() string {
+	if e.Param == "" {
+		return fmt.Sprintf("create failed: %s", e.Response)
 	}
+	return fmt.Sprintf("create failed, bad %s: %s", e.Param, e.Response)
+}
+
+// createError is used to build the error for a client error response.
+// The server does not always name the rejected parameter, in which case
+// it is inferred if only one of precision and eps was provided.
+func (c *CreateCommand) createError() *CreateError {
+	e := &CreateError{
+		Response: strings.TrimSpace(c.result),
+	}
+	lower := strings.ToLower(e.Response)
+	switch {
+	case strings.Contains(lower, "precision"):
+		e.Param = "precision"
+	case strings.Contains(lower, "eps"), strings.Contains(lower, "error threshold"):
+		e.Param = "eps"
+	case c.Precision != 0 && c.ErrThreshold == 0:
+		e.Param = "precision"
+	case c.Precision == 0 && c.ErrThreshold != 0:
+		e.Param = "eps"
+	}
+	return e
 }
 
 // ListCommand is used to make a new set
@@ -105,9 +204,20 @@ type ListCommand struct {
 	// Prefix is the prefix to filter
 	Prefix string
 
+	// prefixes records the prefix hooks applied to the command
+	prefixes prefixMarks
+
 	// lines is each line of output
 	lines []string
 
+	// pageFn is invoked with each page of entries instead of storing
+	// the lines, if set. It returns false to stop iteration.
+	pageFn   func([]*ListEntry) bool
+	pageSize int
+	page     []*ListEntry
+	pageErr  error
+	stopped  bool
+
 	// Done indicates we've ended decode
 	done bool
 }
@@ -116,7 +226,7 @@ type ListCommand struct {
 // an optional prefix
 func NewListCommand(prefix string) (*ListCommand, error) {
 	if prefix != "" && !validWord.MatchString(prefix) {
-		return nil, fmt.Errorf("invalid prefix")
+		return nil, invalidArg("prefix", prefix)
 	}
 	cmd := &ListCommand{
 		Prefix: prefix,
@@ -128,9 +238,9 @@ func (c *ListCommand) Encode(w *bufio.Writer) error {
 	if _, err := w.WriteString("list"); err != nil {
 		return err
 	}
-	if c.Prefix != "" {
+	if prefix := c.wirePrefix(); prefix != "" {
 		w.WriteByte(' ')
-		if _, err := w.WriteString(c.Prefix); err != nil {
+		if _, err := w.WriteString(prefix); err != nil {
 			return err
 		}
 	}
@@ -148,7 +258,7 @@ func (c *ListCommand) Decode(r *bufio.Reader) error {
 		// Handle the start condition
 		if !started {
 			if resp != "START\n" {
-				return fmt.Errorf("expect list start block")
+				return fmt.Errorf("%w: expect list start block", ErrInvalidResponse)
 			}
 			started = true
 			continue
@@ -156,43 +266,160 @@ func (c *ListCommand) Decode(r *bufio.Reader) error {
 
 		// Check for the end
 		if resp == "END\n" {
+			c.flushPage()
 			c.done = true
 			return nil
 		}
 
-		// Store the line
+		// Store the line, or add it to the page if paging
+		if c.pageFn != nil {
+			c.addPageLine(resp)
+			continue
+		}
 		c.lines = append(c.lines, resp)
 	}
-	return nil
 }
 
-// ListEntry is used to provide the details of a set when listing
+// addPageLine is used to parse a line into the current page,
+// handing off the page once it is full
+func (c *ListCommand) addPageLine(line string) {
+	if c.stopped {
+		return
+	}
+	le, err := parseListEntry(line)
+	if err != nil {
+		c.pageErr = err
+		c.stopped = true
+		return
+	}
+	le.Name = strings.TrimPrefix(le.Name, c.namespace())
+	c.page = append(c.page, le)
+	if len(c.page) >= c.pageSize {
+		c.flushPage()
+	}
+}
+
+// flushPage is used to hand off the current page
+func (c *ListCommand) flushPage() {
+	if c.stopped || len(c.page) == 0 {
+		return
+	}
+	if !c.pageFn(c.page) {
+		c.stopped = true
+	}
+	c.page = nil
+}
+
+// ListEntry is used to provide the details of a set when listing.
+// Columns missing from the line, as with older servers, are left zero.
 type ListEntry struct {
 	Name         string
 	ErrThreshold float64
 	Precision    int
 	Size         uint64
 	Storage      uint64
+
+	// Extra is the remainder of the line after the known columns,
+	// as reported by newer servers
+	Extra string
 }
 
 func (c *ListCommand) Result() ([]*ListEntry, error) {
 	if !c.done {
-		return nil, fmt.Errorf("result not decoded yet")
+		return nil, ErrNotDecoded
+	}
+	if c.pageFn != nil {
+		return nil, c.pageErr
 	}
 
+	namespace := c.namespace()
+	entries := make([]ListEntry, len(c.lines))
 	out := make([]*ListEntry, len(c.lines))
 	for idx, line := range c.lines {
-		le := &ListEntry{}
-		_, err := fmt.Sscanf(line, "%s %f %d %d %d\n", &le.Name,
-			&le.ErrThreshold, &le.Precision, &le.Size, &le.Storage)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse '%s'", line)
+		if err := parseListEntryInto(&entries[idx], line); err != nil {
+			return nil, err
 		}
-		out[idx] = le
+		entries[idx].Name = strings.TrimPrefix(entries[idx].Name, namespace)
+		out[idx] = &entries[idx]
 	}
 	return out, nil
 }
 
+// namespace returns the prefixes added to the list prefix by
+// hooks, which are stripped from the names of the listed sets
+func (c *ListCommand) namespace() string {
+	wire := c.wirePrefix()
+	return wire[:len(wire)-len(c.Prefix)]
+}
+
+// listColumns is the number of list columns known to this client
+const listColumns = 5
+
+// parseListEntry is used to parse a single line of list output
+func parseListEntry(line string) (*ListEntry, error) {
+	le := &ListEntry{}
+	if err := parseListEntryInto(le, line); err != nil {
+		return nil, err
+	}
+	return le, nil
+}
+
+// parseListEntryInto is used to parse a line of list output into an
+// entry without allocating. Only the name is required, so lines with
+// fewer columns are accepted, and the remainder of the line after the
+// known columns is preserved in Extra. The entry is reset first, so
+// columns missing from the line are not left from an earlier entry.
+func parseListEntryInto(le *ListEntry, line string) error {
+	*le = ListEntry{}
+	name, rest := nextField(line)
+	if name == "" {
+		return fmt.Errorf("%w: failed to parse '%s'", ErrInvalidResponse, line)
+	}
+	le.Name = name
+
+	var field string
+	var err error
+	for idx := 1; idx < listColumns && err == nil; idx++ {
+		if field, rest = nextField(rest); field == "" {
+			break
+		}
+		switch idx {
+		case 1:
+			le.ErrThreshold, err = strconv.ParseFloat(field, 64)
+		case 2:
+			le.Precision, err = strconv.Atoi(field)
+		case 3:
+			le.Size, err = strconv.ParseUint(field, 10, 64)
+		case 4:
+			le.Storage, err = strconv.ParseUint(field, 10, 64)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse '%s'", ErrInvalidResponse, line)
+	}
+	le.Extra = strings.TrimSpace(rest)
+	return nil
+}
+
+// nextField is used to split the next whitespace separated field
+// off the line, returning an empty field at the end of the line
+func nextField(line string) (string, string) {
+	start := 0
+	for start < len(line) && isSpace(line[start]) {
+		start++
+	}
+	end := start
+	for end < len(line) && !isSpace(line[end]) {
+		end++
+	}
+	return line[start:end], line[end:]
+}
+
+// isSpace checks if a byte is whitespace in a response line
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
 // SetCommand is used to act on a set
 type SetCommand struct {
 	// Command is invoked on the set
@@ -201,6 +428,9 @@ type SetCommand struct {
 	// SetName is the name of the set to create
 	SetName string
 
+	// prefixes records the prefix hooks applied to the command
+	prefixes prefixMarks
+
 	// result is the result of the decode
 	result string
 }
@@ -208,7 +438,7 @@ type SetCommand struct {
 // NewDropCommand is used to drop a set
 func NewDropCommand(name string) (*SetCommand, error) {
 	if !validWord.MatchString(name) {
-		return nil, fmt.Errorf("invalid set name")
+		return nil, invalidArg("set name", name)
 	}
 	cmd := &SetCommand{
 		Command: "drop",
@@ -220,7 +450,7 @@ func NewDropCommand(name string) (*SetCommand, error) {
 // NewCloseCommand is used to close a set out of memory
 func NewCloseCommand(name string) (*SetCommand, error) {
 	if !validWord.MatchString(name) {
-		return nil, fmt.Errorf("invalid set name")
+		return nil, invalidArg("set name", name)
 	}
 	cmd := &SetCommand{
 		Command: "close",
@@ -232,7 +462,7 @@ func NewCloseCommand(name string) (*SetCommand, error) {
 // NewClearCommand is used to remove a set from management, but leave on disk
 func NewClearCommand(name string) (*SetCommand, error) {
 	if !validWord.MatchString(name) {
-		return nil, fmt.Errorf("invalid set name")
+		return nil, invalidArg("set name", name)
 	}
 	cmd := &SetCommand{
 		Command: "clear",
@@ -246,7 +476,7 @@ func (c *SetCommand) Encode(w *bufio.Writer) error {
 		return err
 	}
 	w.WriteByte(' ')
-	if _, err := w.WriteString(c.SetName); err != nil {
+	if _, err := w.WriteString(c.wireName()); err != nil {
 		return err
 	}
 	return w.WriteByte('\n')
@@ -264,7 +494,7 @@ func (c *SetCommand) Decode(r *bufio.Reader) error {
 func (c *SetCommand) Result() (bool, error) {
 	switch c.result {
 	case "":
-		return false, fmt.Errorf("result not decoded yet")
+		return false, ErrNotDecoded
 	case "Done\n":
 		return true, nil
 	case "Set does not exist\n":
@@ -276,7 +506,7 @@ func (c *SetCommand) Result() (bool, error) {
 	case "Set is not proxied. Close it first.\n":
 		return false, nil
 	default:
-		return false, fmt.Errorf("invalid response: %s", c.result)
+		return false, fmt.Errorf("%w: %s", ErrInvalidResponse, c.result)
 	}
 }
 
@@ -285,6 +515,9 @@ type SetKeysCommand struct {
 	// SetName is the name of the set to create
 	SetName string
 
+	// prefixes records the prefix hooks applied to the command
+	prefixes prefixMarks
+
 	// Keys is the keys to set
 	Keys []string
 
@@ -295,14 +528,14 @@ type SetKeysCommand struct {
 // NewSetKeysCommand is used to set keys in a set
 func NewSetKeysCommand(name string, keys []string) (*SetKeysCommand, error) {
 	if !validWord.MatchString(name) {
-		return nil, fmt.Errorf("invalid set name")
+		return nil, invalidArg("set name", name)
 	}
 	if len(keys) == 0 {
-		return nil, fmt.Errorf("missing keys to set")
+		return nil, invalidArg("keys", "")
 	}
-	for _, key := range keys {
+	for idx, key := range keys {
 		if !validKey.MatchString(key) {
-			return nil, fmt.Errorf("invalid key: %s", key)
+			return nil, &ValidationError{Field: "key", Value: key, Index: idx}
 		}
 	}
 	cmd := &SetKeysCommand{
@@ -312,11 +545,44 @@ func NewSetKeysCommand(name string, keys []string) (*SetKeysCommand, error) {
 	return cmd, nil
 }
 
+// NewSetKeysCommandPartial is used to set keys in a set, skipping any
+// invalid keys instead of rejecting the batch. The skipped keys are
+// returned with their index in the input. An error is returned if the
+// set name is invalid or no valid keys remain.
+func NewSetKeysCommandPartial(name string, keys []string) (*SetKeysCommand, []*ValidationError, error) {
+	if !validWord.MatchString(name) {
+		return nil, nil, invalidArg("set name", name)
+	}
+
+	var skipped []*ValidationError
+	valid := keys
+	for idx, key := range keys {
+		if validKey.MatchString(key) {
+			if skipped != nil {
+				valid = append(valid, key)
+			}
+			continue
+		}
+		if skipped == nil {
+			valid = append([]string(nil), keys[:idx]...)
+		}
+		skipped = append(skipped, &ValidationError{Field: "key", Value: key, Index: idx})
+	}
+	if len(valid) == 0 {
+		return nil, skipped, invalidArg("keys", "")
+	}
+	cmd := &SetKeysCommand{
+		SetName: name,
+		Keys:    valid,
+	}
+	return cmd, skipped, nil
+}
+
 func (c *SetKeysCommand) Encode(w *bufio.Writer) error {
 	if _, err := w.WriteString("b "); err != nil {
 		return err
 	}
-	if _, err := w.WriteString(c.SetName); err != nil {
+	if _, err := w.WriteString(c.wireName()); err != nil {
 		return err
 	}
 	for _, key := range c.Keys {
@@ -340,13 +606,80 @@ func (c *SetKeysCommand) Decode(r *bufio.Reader) error {
 func (c *SetKeysCommand) Result() (bool, error) {
 	switch c.result {
 	case "":
-		return false, fmt.Errorf("result not decoded yet")
+		return false, ErrNotDecoded
+	case "Done\n":
+		return true, nil
+	case "Set does not exist\n":
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %s", ErrInvalidResponse, c.result)
+	}
+}
+
+// SetKeyCommand is used to set a single key in a set, using the "s"
+// command rather than the "b" command of a SetKeysCommand
+type SetKeyCommand struct {
+	// SetName is the name of the set
+	SetName string
+
+	// prefixes records the prefix hooks applied to the command
+	prefixes prefixMarks
+
+	// Key is the key to set
+	Key string
+
+	// result is the result of the decode
+	result string
+}
+
+// NewSetKeyCommand is used to set a single key in a set
+func NewSetKeyCommand(name string, key string) (*SetKeyCommand, error) {
+	if !validWord.MatchString(name) {
+		return nil, invalidArg("set name", name)
+	}
+	if !validKey.MatchString(key) {
+		return nil, invalidArg("key", key)
+	}
+	cmd := &SetKeyCommand{
+		SetName: name,
+		Key:     key,
+	}
+	return cmd, nil
+}
+
+func (c *SetKeyCommand) Encode(w *bufio.Writer) error {
+	if _, err := w.WriteString("s "); err != nil {
+		return err
+	}
+	if _, err := w.WriteString(c.wireName()); err != nil {
+		return err
+	}
+	w.WriteByte(' ')
+	if _, err := w.WriteString(c.Key); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+func (c *SetKeyCommand) Decode(r *bufio.Reader) error {
+	resp, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	c.result = resp
+	return nil
+}
+
+func (c *SetKeyCommand) Result() (bool, error) {
+	switch c.result {
+	case "":
+		return false, ErrNotDecoded
 	case "Done\n":
 		return true, nil
 	case "Set does not exist\n":
 		return false, nil
 	default:
-		return false, fmt.Errorf("invalid response: %s", c.result)
+		return false, fmt.Errorf("%w: %s", ErrInvalidResponse, c.result)
 	}
 }
 
@@ -355,6 +688,9 @@ type FlushCommand struct {
 	// SetName is the optional name of the set to create
 	SetName string
 
+	// prefixes records the prefix hooks applied to the command
+	prefixes prefixMarks
+
 	// result is the result of the decode
 	result string
 }
@@ -363,7 +699,7 @@ type FlushCommand struct {
 // to a specific set
 func NewFlushCommand(name string) (*FlushCommand, error) {
 	if name != "" && !validWord.MatchString(name) {
-		return nil, fmt.Errorf("invalid set name")
+		return nil, invalidArg("set name", name)
 	}
 	cmd := &FlushCommand{
 		SetName: name,
@@ -377,7 +713,7 @@ func (c *FlushCommand) Encode(w *bufio.Writer) error {
 	}
 	if c.SetName != "" {
 		w.WriteByte(' ')
-		if _, err := w.WriteString(c.SetName); err != nil {
+		if _, err := w.WriteString(c.wireName()); err != nil {
 			return err
 		}
 	}
@@ -396,13 +732,13 @@ func (c *FlushCommand) Decode(r *bufio.Reader) error {
 func (c *FlushCommand) Result() (bool, error) {
 	switch c.result {
 	case "":
-		return false, fmt.Errorf("result not decoded yet")
+		return false, ErrNotDecoded
 	case "Done\n":
 		return true, nil
 	case "Set does not exist\n":
 		return false, nil
 	default:
-		return false, fmt.Errorf("invalid response: %s", c.result)
+		return false, fmt.Errorf("%w: %s", ErrInvalidResponse, c.result)
 	}
 }
 
@@ -411,6 +747,9 @@ type InfoCommand struct {
 	// SetName is the name of the set
 	SetName string
 
+	// prefixes records the prefix hooks applied to the command
+	prefixes prefixMarks
+
 	// lines is each line of output
 	lines []string
 
@@ -424,7 +763,7 @@ type InfoCommand struct {
 // NewInfoCommand is used to query a specific set
 func NewInfoCommand(name string) (*InfoCommand, error) {
 	if !validWord.MatchString(name) {
-		return nil, fmt.Errorf("invalid set name")
+		return nil, invalidArg("set name", name)
 	}
 	cmd := &InfoCommand{
 		SetName: name,
@@ -436,7 +775,7 @@ func (c *InfoCommand) Encode(w *bufio.Writer) error {
 	if _, err := w.WriteString("info "); err != nil {
 		return err
 	}
-	if _, err := w.WriteString(c.SetName); err != nil {
+	if _, err := w.WriteString(c.wireName()); err != nil {
 		return err
 	}
 	return w.WriteByte('\n')
@@ -462,7 +801,7 @@ func (c *InfoCommand) Decode(r *bufio.Reader) error {
 				c.notExist = false
 				continue
 			default:
-				return fmt.Errorf("invalid response: %s", resp)
+				return fmt.Errorf("%w: %s", ErrInvalidResponse, resp)
 			}
 		}
 
@@ -475,7 +814,6 @@ func (c *InfoCommand) Decode(r *bufio.Reader) error {
 		// Store the line
 		c.lines = append(c.lines, resp)
 	}
-	return nil
 }
 
 // SetInfo contains the results of a query
@@ -503,11 +841,14 @@ type SetInfo struct {
 
 	// Storage is the disk space requirements of the set
 	Storage uint64
+
+	// Extra contains any fields not known to this client
+	Extra map[string]string
 }
 
 func (c *InfoCommand) Result() (*SetInfo, bool, error) {
 	if !c.done {
-		return nil, false, fmt.Errorf("result not decoded yet")
+		return nil, false, ErrNotDecoded
 	}
 	if c.notExist {
 		return nil, false, nil
@@ -516,63 +857,209 @@ func (c *InfoCommand) Result() (*SetInfo, bool, error) {
 	var err error
 	info := &SetInfo{}
 	for _, line := range c.lines {
-		//eps 0.02
-		switch {
-		case strings.HasPrefix(line, "in_memory"):
-			info.InMemory = line[10] == '1'
-
-		case strings.HasPrefix(line, "page_ins"):
-			num := line[9 : len(line)-1]
-			info.PageIns, err = strconv.ParseUint(num, 10, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse '%s'", line)
-			}
+		// Split on the first space, such as "eps 0.02"
+		field, value := nextField(line)
+		value = strings.TrimSpace(value)
+		if field == "" || value == "" {
+			return nil, false, fmt.Errorf("%w: failed to parse '%s'", ErrInvalidResponse, line)
+		}
 
-		case strings.HasPrefix(line, "page_outs"):
-			num := line[10 : len(line)-1]
-			info.PageOuts, err = strconv.ParseUint(num, 10, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse '%s'", line)
+		switch field {
+		case "in_memory":
+			info.InMemory = value == "1"
+		case "page_ins":
+			info.PageIns, err = strconv.ParseUint(value, 10, 64)
+		case "page_outs":
+			info.PageOuts, err = strconv.ParseUint(value, 10, 64)
+		case "eps":
+			info.ErrThreshold, err = strconv.ParseFloat(value, 64)
+		case "precision":
+			info.Precision, err = strconv.ParseUint(value, 10, 64)
+		case "sets":
+			info.Sets, err = strconv.ParseUint(value, 10, 64)
+		case "size":
+			info.Size, err = strconv.ParseUint(value, 10, 64)
+		case "storage":
+			info.Storage, err = strconv.ParseUint(value, 10, 64)
+		default:
+			if info.Extra == nil {
+				info.Extra = make(map[string]string)
 			}
+			info.Extra[field] = value
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: failed to parse '%s'", ErrInvalidResponse, line)
+		}
+	}
+	return info, true, nil
+}
 
-		case strings.HasPrefix(line, "eps"):
-			num := line[4 : len(line)-1]
-			info.ErrThreshold, err = strconv.ParseFloat(num, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse '%s'", line)
-			}
+// CommandType returns the type of a command, such as "create" or "info",
+// as reported by Completion and PendingCommand
+func CommandType(cmd Command) string {
+	return commandType(cmd)
+}
 
-		case strings.HasPrefix(line, "precision"):
-			num := line[10 : len(line)-1]
-			info.Precision, err = strconv.ParseUint(num, 10, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse '%s'", line)
-			}
+// commandType returns the name of the type of a command
+func commandType(cmd Command) string {
+	switch c := cmd.(type) {
+	case *CreateCommand:
+		return "create"
+	case *ListCommand:
+		return "list"
+	case *SetCommand:
+		return c.Command
+	case *SetKeysCommand:
+		return "bulk"
+	case *SetKeyCommand:
+		return "set"
+	case *FlushCommand:
+		return "flush"
+	case *InfoCommand:
+		return "info"
+	case *RawCommand:
+		return "raw"
+	default:
+		return fmt.Sprintf("%T", cmd)
+	}
+}
 
-		case strings.HasPrefix(line, "sets"):
-			num := line[5 : len(line)-1]
-			info.Sets, err = strconv.ParseUint(num, 10, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse '%s'", line)
-			}
+// commandSetName returns the name of the set a command operates on,
+// including any prefixes, or an empty string if the command is not
+// specific to a set
+func commandSetName(cmd Command) string {
+	switch c := cmd.(type) {
+	case *CreateCommand:
+		return c.wireName()
+	case *SetCommand:
+		return c.wireName()
+	case *SetKeysCommand:
+		return c.wireName()
+	case *SetKeyCommand:
+		return c.wireName()
+	case *FlushCommand:
+		return c.wireName()
+	case *InfoCommand:
+		return c.wireName()
+	default:
+		return ""
+	}
+}
 
-		case strings.HasPrefix(line, "size"):
-			num := line[5 : len(line)-1]
-			info.Size, err = strconv.ParseUint(num, 10, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse '%s'", line)
-			}
+// commandPrefixMarks returns the record of prefix hooks applied to
+// a command and the name set by the caller, or nil if the command
+// does not support prefixes
+func commandPrefixMarks(cmd Command) (*prefixMarks, string) {
+	switch c := cmd.(type) {
+	case *CreateCommand:
+		return &c.prefixes, c.SetName
+	case *ListCommand:
+		return &c.prefixes, c.Prefix
+	case *SetCommand:
+		return &c.prefixes, c.SetName
+	case *SetKeysCommand:
+		return &c.prefixes, c.SetName
+	case *SetKeyCommand:
+		return &c.prefixes, c.SetName
+	case *FlushCommand:
+		return &c.prefixes, c.SetName
+	case *InfoCommand:
+		return &c.prefixes, c.SetName
+	default:
+		return nil, ""
+	}
+}
 
-		case strings.HasPrefix(line, "storage"):
-			num := line[8 : len(line)-1]
-			info.Storage, err = strconv.ParseUint(num, 10, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse '%s'", line)
-			}
+// wireName returns the set name to send, including any prefixes
+func (c *CreateCommand) wireName() string {
+	return c.prefixes.encoded(c.SetName)
+}
 
-		default:
-			return nil, false, fmt.Errorf("failed to parse '%s'", line)
+// wirePrefix returns the list prefix to send, including any prefixes
+func (c *ListCommand) wirePrefix() string {
+	return c.prefixes.encoded(c.Prefix)
+}
+
+// wireName returns the set name to send, including any prefixes
+func (c *SetCommand) wireName() string {
+	return c.prefixes.encoded(c.SetName)
+}
+
+// wireName returns the set name to send, including any prefixes
+func (c *SetKeysCommand) wireName() string {
+	return c.prefixes.encoded(c.SetName)
+}
+
+// wireName returns the set name to send, including any prefixes
+func (c *SetKeyCommand) wireName() string {
+	return c.prefixes.encoded(c.SetName)
+}
+
+// wireName returns the set name to send, including any prefixes
+func (c *FlushCommand) wireName() string {
+	return c.prefixes.encoded(c.SetName)
+}
+
+// wireName returns the set name to send, including any prefixes
+func (c *InfoCommand) wireName() string {
+	return c.prefixes.encoded(c.SetName)
+}
+
+// RawCommand is used to send an arbitrary command line and capture
+// the unparsed response. It is useful for proxies that forward commands
+// without interpreting them.
+type RawCommand struct {
+	// Line is the command line to send, without the trailing newline
+	Line string
+
+	// result is the raw response, including any START/END block
+	result string
+}
+
+// NewRawCommand is used to send a raw command line
+func NewRawCommand(line string) (*RawCommand, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" || strings.ContainsAny(line, "\r\n") {
+		return nil, invalidArg("command line", line)
+	}
+	cmd := &RawCommand{
+		Line: line,
+	}
+	return cmd, nil
+}
+
+func (c *RawCommand) Encode(w *bufio.Writer) error {
+	if _, err := w.WriteString(c.Line); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+func (c *RawCommand) Decode(r *bufio.Reader) error {
+	var out []string
+	for {
+		resp, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		out = append(out, resp)
+
+		// Multi-line responses are wrapped in a START/END block
+		if len(out) == 1 && resp != "START\n" {
+			break
+		}
+		if resp == "END\n" {
+			break
 		}
 	}
-	return info, true, nil
+	c.result = strings.Join(out, "")
+	return nil
+}
+
+// Result returns the raw response, including the trailing newline
+func (c *RawCommand) Result() (string, error) {
+	if c.result == "" {
+		return "", ErrNotDecoded
+	}
+	return c.result, nil
 }
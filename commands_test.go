@@ -3,6 +3,8 @@ package hlld
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -72,7 +74,7 @@ func TestCreateCommand(t *testing.T) {
 	cmd.InMemory = true
 
 	// Verify the encode
-	expect := "create foo precision=12 eps=0.050000 in_memory=true\n"
+	expect := "create foo precision=12 eps=0.05 in_memory=true\n"
 	verifyEncode(t, cmd, expect)
 
 	// Verify the decode
@@ -106,6 +108,61 @@ func TestCreateCommand(t *testing.T) {
 	}
 }
 
+func TestCreateCommand_EpsFormat(t *testing.T) {
+	cmd, err := NewCreateCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	cmd.ErrThreshold = 0.0001625
+	verifyEncode(t, cmd, "create foo eps=0.0001625\n")
+
+	cmd.EpsDigits = 5
+	verifyEncode(t, cmd, "create foo eps=0.00016\n")
+
+	cmd.EpsDigits = 0
+	cmd.EpsScientific = true
+	verifyEncode(t, cmd, "create foo eps=1.625e-04\n")
+
+	cmd.EpsDigits = 1
+	verifyEncode(t, cmd, "create foo eps=1.6e-04\n")
+}
+
+func TestCreateCommand_CreateError(t *testing.T) {
+	cases := []struct {
+		precision int
+		eps       float64
+		resp      string
+		param     string
+	}{
+		{20, 0, "Client Error: Bad arguments\n", "precision"},
+		{0, 0.5, "Client Error: Bad arguments\n", "eps"},
+		{20, 0.5, "Client Error: Bad arguments\n", ""},
+		{20, 0.5, "Client Error: Bad precision\n", "precision"},
+		{20, 0.5, "Client Error: Bad eps\n", "eps"},
+	}
+	for _, tc := range cases {
+		cmd, err := NewCreateCommand("foo")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		cmd.Precision = tc.precision
+		cmd.ErrThreshold = tc.eps
+		verifyDecode(t, cmd, tc.resp)
+
+		ok, err := cmd.Result()
+		if ok {
+			t.Fatalf("bad")
+		}
+		cerr, isCreate := err.(*CreateError)
+		if !isCreate {
+			t.Fatalf("err: %v", err)
+		}
+		if cerr.Param != tc.param || cerr.Response != strings.TrimSpace(tc.resp) {
+			t.Fatalf("bad: %#v", cerr)
+		}
+	}
+}
+
 func TestListCommand(t *testing.T) {
 	// Invalid prefix
 	_, err := NewListCommand("foo 123")
@@ -139,14 +196,102 @@ END
 	}
 
 	expectList := []*ListEntry{
-		{"foo", 0.01, 14, 13108, 0},
-		{"baz", 0.005, 16, 18000, 50},
+		{"foo", 0.01, 14, 13108, 0, ""},
+		{"baz", 0.005, 16, 18000, 50, ""},
 	}
 	if !reflect.DeepEqual(list, expectList) {
 		t.Fatalf("bad: %#v", list)
 	}
 }
 
+func TestListCommand_RelaxedColumns(t *testing.T) {
+	cmd, err := NewListCommand("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	inp := `START
+foo 0.010000 14 13108 0 1 extra
+bar 0.005000 16
+baz
+END
+`
+	verifyDecode(t, cmd, inp)
+	list, err := cmd.Result()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expectList := []*ListEntry{
+		{"foo", 0.01, 14, 13108, 0, "1 extra"},
+		{"bar", 0.005, 16, 0, 0, ""},
+		{"baz", 0, 0, 0, 0, ""},
+	}
+	if !reflect.DeepEqual(list, expectList) {
+		t.Fatalf("bad: %#v", list)
+	}
+
+	// Malformed known columns are still rejected
+	if _, err := parseListEntry("foo abc 14 13108 0"); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestParseListEntryInto_Allocs(t *testing.T) {
+	line := "foo 0.010000 14 13108 3280\n"
+	var le ListEntry
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := parseListEntryInto(&le, line); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("bad: %v", allocs)
+	}
+	expect := ListEntry{"foo", 0.01, 14, 13108, 3280, ""}
+	if le != expect {
+		t.Fatalf("bad: %#v", le)
+	}
+}
+
+func TestParseListEntryInto_Reuse(t *testing.T) {
+	var le ListEntry
+	if err := parseListEntryInto(&le, "foo 0.010000 14 13108 3280 extra\n"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := parseListEntryInto(&le, "bar 0.020000\n"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := ListEntry{Name: "bar", ErrThreshold: 0.02}
+	if le != expect {
+		t.Fatalf("bad: %#v", le)
+	}
+}
+
+func BenchmarkParseListEntry(b *testing.B) {
+	line := "foo 0.010000 14 13108 3280\n"
+	var le ListEntry
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := parseListEntryInto(&le, line); err != nil {
+			b.Fatalf("err: %v", err)
+		}
+	}
+}
+
+func BenchmarkParseListEntry_Sscanf(b *testing.B) {
+	line := "foo 0.010000 14 13108 3280\n"
+	var le ListEntry
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := fmt.Sscanf(line, "%s %f %d %d %d\n", &le.Name,
+			&le.ErrThreshold, &le.Precision, &le.Size, &le.Storage)
+		if err != nil {
+			b.Fatalf("err: %v", err)
+		}
+	}
+}
+
 func TestDropCommand(t *testing.T) {
 	// Invalid set
 	_, err := NewDropCommand("foo 123")
@@ -271,6 +416,74 @@ func TestClearCommand(t *testing.T) {
 	}
 }
 
+func TestValidationError(t *testing.T) {
+	_, err := NewSetKeysCommand("foo", []string{"a", "b", "c d", "e f"})
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("err: %v", err)
+	}
+	expect := &ValidationError{Field: "key", Value: "c d", Index: 2}
+	if !reflect.DeepEqual(verr, expect) {
+		t.Fatalf("bad: %#v", verr)
+	}
+	if err.Error() != "invalid key at index 2: 'c d'" {
+		t.Fatalf("bad: %v", err)
+	}
+
+	_, err = NewSetKeysCommand("foo", nil)
+	if err == nil || err.Error() != "missing keys" {
+		t.Fatalf("bad: %v", err)
+	}
+
+	_, err = NewDropCommand("foo 123")
+	verr, ok = err.(*ValidationError)
+	if !ok || verr.Field != "set name" || verr.Value != "foo 123" || verr.Index != -1 {
+		t.Fatalf("bad: %#v", err)
+	}
+	if err.Error() != "invalid set name 'foo 123'" {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestSetKeysCommandPartial(t *testing.T) {
+	// Invalid set
+	if _, _, err := NewSetKeysCommandPartial("foo 123", []string{"foo"}); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Invalid keys are skipped
+	keys := []string{"a", "b c", "d", "e\tf", "g"}
+	cmd, skipped, err := NewSetKeysCommandPartial("foo", keys)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(cmd.Keys, []string{"a", "d", "g"}) {
+		t.Fatalf("bad: %v", cmd.Keys)
+	}
+	expect := []*ValidationError{
+		{Field: "key", Value: "b c", Index: 1},
+		{Field: "key", Value: "e\tf", Index: 3},
+	}
+	if !reflect.DeepEqual(skipped, expect) {
+		t.Fatalf("bad: %#v", skipped)
+	}
+	if keys[1] != "b c" {
+		t.Fatalf("input modified: %v", keys)
+	}
+
+	// All valid, nothing skipped
+	cmd, skipped, err = NewSetKeysCommandPartial("foo", []string{"a", "b"})
+	if err != nil || skipped != nil || len(cmd.Keys) != 2 {
+		t.Fatalf("bad: %v %v %v", cmd, skipped, err)
+	}
+
+	// No valid keys
+	_, skipped, err = NewSetKeysCommandPartial("foo", []string{"a b"})
+	if err == nil || len(skipped) != 1 {
+		t.Fatalf("bad: %v %v", skipped, err)
+	}
+}
+
 func TestSetKeysCommand(t *testing.T) {
 	// Invalid set
 	_, err := NewSetKeysCommand("foo 123", []string{"foo"})
@@ -315,6 +528,41 @@ func TestSetKeysCommand(t *testing.T) {
 	}
 }
 
+func TestSetKeyCommand(t *testing.T) {
+	// Invalid set and key
+	if _, err := NewSetKeyCommand("foo 123", "foo"); err == nil {
+		t.Fatalf("expect error")
+	}
+	if _, err := NewSetKeyCommand("foo", "foo 123"); err == nil {
+		t.Fatalf("expect error")
+	}
+	if _, err := NewSetKeyCommand("foo", ""); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	cmd, err := NewSetKeyCommand("foo", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, cmd, "s foo bar\n")
+	if CommandType(cmd) != "set" {
+		t.Fatalf("bad: %v", CommandType(cmd))
+	}
+
+	verifyDecode(t, cmd, "Done\n")
+	if ok, err := cmd.Result(); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	verifyDecode(t, cmd, "Set does not exist\n")
+	if ok, err := cmd.Result(); ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	verifyDecode(t, cmd, "Client Error: Bad arguments\n")
+	if _, err := cmd.Result(); !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 func TestFlushCommand_All(t *testing.T) {
 	// All sets
 	cmd, err := NewFlushCommand("")
@@ -438,6 +686,87 @@ END
 	}
 }
 
+func TestInfoCommand_Extra(t *testing.T) {
+	inp := "START\nprecision 12\nsets_total 500\nlast_access 1400000000\nEND\n"
+
+	// Unknown fields are returned, including those sharing a prefix
+	// with a known field
+	cmd, err := NewInfoCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyDecode(t, cmd, inp)
+	info, ok, err := cmd.Result()
+	if err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if info.Precision != 12 || info.Sets != 0 {
+		t.Fatalf("bad: %#v", info)
+	}
+	expect := map[string]string{"sets_total": "500", "last_access": "1400000000"}
+	if !reflect.DeepEqual(info.Extra, expect) {
+		t.Fatalf("bad: %#v", info.Extra)
+	}
+}
+
+func TestInfoCommand_ShortLine(t *testing.T) {
+	for _, line := range []string{"in_memory", "eps\n", "size abc\n"} {
+		cmd, err := NewInfoCommand("foo")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		verifyDecode(t, cmd, "START\n"+line+"\nEND\n")
+		if _, _, err := cmd.Result(); err == nil {
+			t.Fatalf("expect error for %q", line)
+		}
+	}
+}
+
+func TestRawCommand(t *testing.T) {
+	// Invalid line
+	_, err := NewRawCommand("foo\nbar")
+	if err == nil {
+		t.Fatalf("expect error")
+	}
+	_, err = NewRawCommand("\n")
+	if err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Valid line, trailing newline is stripped
+	cmd, err := NewRawCommand("info foo\n")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := cmd.Result(); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Verify the encode
+	verifyEncode(t, cmd, "info foo\n")
+
+	// Verify a single line decode
+	verifyDecode(t, cmd, "Set does not exist\nDone\n")
+	out, err := cmd.Result()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != "Set does not exist\n" {
+		t.Fatalf("bad: %q", out)
+	}
+
+	// Verify a block decode
+	inp := "START\nsize 10\nEND\n"
+	verifyDecode(t, cmd, inp+"Done\n")
+	out, err = cmd.Result()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != inp {
+		t.Fatalf("bad: %q", out)
+	}
+}
+
 func verifyEncode(t *testing.T, cmd Command, expect string) {
 	var buf bytes.Buffer
 	bufW := bufio.NewWriter(&buf)
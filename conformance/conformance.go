@@ -0,0 +1,451 @@
+// Package conformance runs a battery of commands against an hlld server
+// and checks the responses against the semantics of the protocol. It is
+// used to qualify new versions of hlld, and alternative servers such as
+// proxies, before they are put in front of applications.
+//
+// The checks create and drop sets named with a prefix, so they should
+// be run against a server where no other sets share the prefix.
+package conformance
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+const (
+	// DefaultPrefix is the default prefix of the sets used by the checks
+	DefaultPrefix = "hlld-conformance"
+
+	// accuracyKeys is the number of unique keys used to check
+	// the accuracy of the estimates
+	accuracyKeys = 20000
+
+	// accuracySigmas is the number of standard errors the estimate
+	// may differ from the number of keys by
+	accuracySigmas = 4
+)
+
+// Result is the result of a single check
+type Result struct {
+	// Name is the name of the check
+	Name string
+
+	// Err is the reason the check failed, or nil if it passed
+	Err error
+
+	// Duration is how long the check took
+	Duration time.Duration
+}
+
+// Passed checks if the check passed
+func (r *Result) Passed() bool {
+	return r.Err == nil
+}
+
+// check is a named check of the protocol
+type check struct {
+	name string
+	fn   func(s *suite, name string) error
+}
+
+// checks is the battery of checks, in the order they are run
+var checks = []check{
+	{"create", checkCreate},
+	{"create-precision", checkCreatePrecision},
+	{"create-invalid", checkCreateInvalid},
+	{"set", checkSet},
+	{"set-missing", checkSetMissing},
+	{"info", checkInfo},
+	{"list", checkList},
+	{"flush", checkFlush},
+	{"close", checkClose},
+	{"clear", checkClear},
+	{"drop", checkDrop},
+	{"unsupported", checkUnsupported},
+	{"accuracy", checkAccuracy},
+}
+
+// suite is the state shared by the checks
+type suite struct {
+	client *hlld.Client
+	prefix string
+}
+
+// Run is used to run every check against the server, using sets named
+// with the given prefix, or the DefaultPrefix if empty. Every check is
+// run even if earlier checks fail, and the sets are dropped afterwards.
+func Run(client *hlld.Client, prefix string) ([]*Result, error) {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	s := &suite{client: client, prefix: prefix}
+
+	// Start from a clean slate
+	if err := s.cleanup(); err != nil {
+		return nil, err
+	}
+	defer s.cleanup()
+
+	results := make([]*Result, 0, len(checks))
+	for _, c := range checks {
+		start := time.Now()
+		err := c.fn(s, prefix+"-"+c.name)
+		results = append(results, &Result{
+			Name:     c.name,
+			Err:      err,
+			Duration: time.Since(start),
+		})
+	}
+	return results, nil
+}
+
+// cleanup is used to drop the sets with the prefix
+func (s *suite) cleanup() error {
+	names, err := s.list(s.prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := s.raw("drop " + name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// raw is used to send a command line and return the raw response
+func (s *suite) raw(line string) (string, error) {
+	cmd, err := hlld.NewRawCommand(line)
+	if err != nil {
+		return "", err
+	}
+	f, err := s.client.Execute(cmd)
+	if err != nil {
+		return "", err
+	}
+	if err := f.Error(); err != nil {
+		return "", err
+	}
+	return cmd.Result()
+}
+
+// expect is used to send a command line and check the response
+func (s *suite) expect(line, want string) error {
+	got, err := s.raw(line)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("'%s': expected %q, got %q", line, want, got)
+	}
+	return nil
+}
+
+// expectPrefix is used to send a command line and check
+// the response starts with a prefix
+func (s *suite) expectPrefix(line, want string) error {
+	got, err := s.raw(line)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(got, want) {
+		return fmt.Errorf("'%s': expected %q, got %q", line, want+"...", got)
+	}
+	return nil
+}
+
+// info is used to parse the info of a set
+func (s *suite) info(name string) (map[string]string, error) {
+	resp, err := s.raw("info " + name)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(resp, "\n"), "\n")
+	if len(lines) < 2 || lines[0] != "START" || lines[len(lines)-1] != "END" {
+		return nil, fmt.Errorf("'info %s': expected a START/END block, got %q", name, resp)
+	}
+	fields := make(map[string]string)
+	for _, line := range lines[1 : len(lines)-1] {
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("'info %s': malformed line %q", name, line)
+		}
+		fields[parts[0]] = parts[1]
+	}
+	return fields, nil
+}
+
+// size is used to read the size of a set
+func (s *suite) size(name string) (uint64, error) {
+	fields, err := s.info(name)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseUint(fields["size"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("'info %s': invalid size %q", name, fields["size"])
+	}
+	return size, nil
+}
+
+// list is used to list the names of the sets with a prefix. Raw
+// commands are used throughout, so a malformed response fails the
+// check rather than closing the client.
+func (s *suite) list(prefix string) ([]string, error) {
+	resp, err := s.raw("list " + prefix)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(resp, "\n"), "\n")
+	if len(lines) < 2 || lines[0] != "START" || lines[len(lines)-1] != "END" {
+		return nil, fmt.Errorf("'list %s': expected a START/END block, got %q", prefix, resp)
+	}
+	var names []string
+	for _, line := range lines[1 : len(lines)-1] {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names, nil
+}
+
+// listed checks if a set is in the list output for its name
+func (s *suite) listed(name string) (bool, error) {
+	names, err := s.list(name)
+	if err != nil {
+		return false, err
+	}
+	for _, listed := range names {
+		if listed == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// expectSize checks the size of a set is within the
+// given distance of the expected size
+func (s *suite) expectSize(name string, want, within uint64) error {
+	size, err := s.size(name)
+	if err != nil {
+		return err
+	}
+	if size+within < want || size > want+within {
+		return fmt.Errorf("set '%s': expected size %d±%d, got %d", name, want, within, size)
+	}
+	return nil
+}
+
+func checkCreate(s *suite, name string) error {
+	if err := s.expect("create "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("create "+name, "Exists\n"); err != nil {
+		return err
+	}
+	ok, err := s.listed(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("set '%s' not listed after create", name)
+	}
+	return nil
+}
+
+func checkCreatePrecision(s *suite, name string) error {
+	if err := s.expect("create "+name+" precision=14", "Done\n"); err != nil {
+		return err
+	}
+	fields, err := s.info(name)
+	if err != nil {
+		return err
+	}
+	if fields["precision"] != "14" {
+		return fmt.Errorf("set '%s': expected precision 14, got %q", name, fields["precision"])
+	}
+	eps, err := strconv.ParseFloat(fields["eps"], 64)
+	if err != nil {
+		return fmt.Errorf("set '%s': invalid eps %q", name, fields["eps"])
+	}
+	if expect := hlld.TheoreticalError(14); math.Abs(eps-expect) > expect/100 {
+		return fmt.Errorf("set '%s': expected eps %.6f, got %.6f", name, expect, eps)
+	}
+	return nil
+}
+
+func checkCreateInvalid(s *suite, name string) error {
+	if err := s.expectPrefix("create "+name+" precision=100", "Client Error"); err != nil {
+		return err
+	}
+	ok, err := s.listed(name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return fmt.Errorf("set '%s' created with invalid precision", name)
+	}
+	return nil
+}
+
+func checkSet(s *suite, name string) error {
+	if err := s.expect("create "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("s "+name+" a", "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("b "+name+" b c a", "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("bulk "+name+" c d", "Done\n"); err != nil {
+		return err
+	}
+	return s.expectSize(name, 4, 0)
+}
+
+func checkSetMissing(s *suite, name string) error {
+	if err := s.expect("s "+name+" a", "Set does not exist\n"); err != nil {
+		return err
+	}
+	return s.expect("b "+name+" a b", "Set does not exist\n")
+}
+
+func checkInfo(s *suite, name string) error {
+	if err := s.expect("info "+name, "Set does not exist\n"); err != nil {
+		return err
+	}
+	if err := s.expect("create "+name, "Done\n"); err != nil {
+		return err
+	}
+	fields, err := s.info(name)
+	if err != nil {
+		return err
+	}
+	for _, field := range []string{"in_memory", "page_ins", "page_outs", "eps", "precision", "sets", "size", "storage"} {
+		if _, ok := fields[field]; !ok {
+			return fmt.Errorf("'info %s': missing field '%s'", name, field)
+		}
+	}
+	return nil
+}
+
+func checkList(s *suite, name string) error {
+	if err := s.expect("list "+name, "START\nEND\n"); err != nil {
+		return err
+	}
+	if err := s.expect("create "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("s "+name+" a", "Done\n"); err != nil {
+		return err
+	}
+	resp, err := s.raw("list " + name)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(resp, "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "START" || lines[2] != "END" {
+		return fmt.Errorf("'list %s': expected one set, got %q", name, resp)
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) < 5 || fields[0] != name {
+		return fmt.Errorf("'list %s': malformed line %q", name, lines[1])
+	}
+	if fields[3] != "1" {
+		return fmt.Errorf("'list %s': expected size 1, got %q", name, fields[3])
+	}
+	return nil
+}
+
+func checkFlush(s *suite, name string) error {
+	if err := s.expect("create "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("flush "+name, "Done\n"); err != nil {
+		return err
+	}
+	return s.expect("flush", "Done\n")
+}
+
+func checkClose(s *suite, name string) error {
+	if err := s.expect("create "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("b "+name+" a b", "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("close "+name, "Done\n"); err != nil {
+		return err
+	}
+
+	// Closed sets are faulted back in on use
+	if err := s.expectSize(name, 2, 0); err != nil {
+		return err
+	}
+	return s.expect("s "+name+" c", "Done\n")
+}
+
+func checkClear(s *suite, name string) error {
+	if err := s.expect("create "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("clear "+name, "Set is not proxied. Close it first.\n"); err != nil {
+		return err
+	}
+	if err := s.expect("close "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("clear "+name, "Done\n"); err != nil {
+		return err
+	}
+	ok, err := s.listed(name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return fmt.Errorf("set '%s' listed after clear", name)
+	}
+	return nil
+}
+
+func checkDrop(s *suite, name string) error {
+	if err := s.expect("create "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("drop "+name, "Done\n"); err != nil {
+		return err
+	}
+	if err := s.expect("info "+name, "Set does not exist\n"); err != nil {
+		return err
+	}
+	return s.expect("drop "+name, "Set does not exist\n")
+}
+
+func checkUnsupported(s *suite, name string) error {
+	return s.expect("conformance-unsupported "+name, "Client Error: Command not supported\n")
+}
+
+func checkAccuracy(s *suite, name string) error {
+	if err := s.expect("create "+name+" precision=14", "Done\n"); err != nil {
+		return err
+	}
+	keys := make([]string, 0, 1000)
+	for i := 0; i < accuracyKeys; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+		if len(keys) < cap(keys) && i < accuracyKeys-1 {
+			continue
+		}
+		if err := s.expect("b "+name+" "+strings.Join(keys, " "), "Done\n"); err != nil {
+			return err
+		}
+		keys = keys[:0]
+	}
+	within := accuracySigmas * hlld.TheoreticalError(14) * accuracyKeys
+	return s.expectSize(name, accuracyKeys, uint64(within))
+}
@@ -0,0 +1,188 @@
+package conformance
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+// fakeSet is a set of the fake server, which counts keys exactly
+type fakeSet struct {
+	precision int
+	keys      map[string]struct{}
+	open      bool
+}
+
+// fakeServer is an in-memory implementation of the protocol
+type fakeServer struct {
+	sets map[string]*fakeSet
+	lock sync.Mutex
+
+	// broken is a command whose responses are replaced with garbage
+	broken string
+}
+
+func (f *fakeServer) handle(line string) hlldproxy.Reply {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	fields := strings.Fields(line)
+	if len(fields) > 0 && fields[0] == f.broken {
+		return hlldproxy.Static("Broken\n")
+	}
+	return hlldproxy.Static(f.respond(fields))
+}
+
+func (f *fakeServer) respond(fields []string) string {
+	if len(fields) == 0 {
+		return hlldproxy.UnsupportedCommand
+	}
+	var set *fakeSet
+	if len(fields) > 1 {
+		set = f.sets[fields[1]]
+	}
+
+	switch fields[0] {
+	case "create":
+		if set != nil {
+			return "Exists\n"
+		}
+		precision := 12
+		for _, arg := range fields[2:] {
+			if strings.HasPrefix(arg, "precision=") {
+				precision, _ = strconv.Atoi(strings.TrimPrefix(arg, "precision="))
+			}
+		}
+		if precision < 4 || precision > 18 {
+			return "Client Error: Bad arguments\n"
+		}
+		f.sets[fields[1]] = &fakeSet{precision: precision, keys: make(map[string]struct{}), open: true}
+		return "Done\n"
+
+	case "s", "set", "b", "bulk":
+		if set == nil {
+			return "Set does not exist\n"
+		}
+		set.open = true
+		for _, key := range fields[2:] {
+			set.keys[key] = struct{}{}
+		}
+		return "Done\n"
+
+	case "info":
+		if set == nil {
+			return "Set does not exist\n"
+		}
+		set.open = true
+		return fmt.Sprintf("START\nin_memory 1\npage_ins 0\npage_outs 0\neps %f\nprecision %d\nsets %d\nsize %d\nstorage 0\nEND\n",
+			hlld.TheoreticalError(uint64(set.precision)), set.precision, len(set.keys), len(set.keys))
+
+	case "list":
+		prefix := ""
+		if len(fields) > 1 {
+			prefix = fields[1]
+		}
+		var names []string
+		for name := range f.sets {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		out := "START\n"
+		for _, name := range names {
+			s := f.sets[name]
+			out += fmt.Sprintf("%s %f %d %d 0\n", name, hlld.TheoreticalError(uint64(s.precision)), s.precision, len(s.keys))
+		}
+		return out + "END\n"
+
+	case "flush":
+		if len(fields) > 1 && set == nil {
+			return "Set does not exist\n"
+		}
+		return "Done\n"
+
+	case "close", "clear", "drop":
+		if set == nil {
+			return "Set does not exist\n"
+		}
+		switch fields[0] {
+		case "close":
+			set.open = false
+		case "clear":
+			if set.open {
+				return "Set is not proxied. Close it first.\n"
+			}
+			delete(f.sets, fields[1])
+		case "drop":
+			delete(f.sets, fields[1])
+		}
+		return "Done\n"
+	}
+	return hlldproxy.UnsupportedCommand
+}
+
+// testRun runs the checks against a fake server
+func testRun(t *testing.T, broken string) []*Result {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	fake := &fakeServer{sets: make(map[string]*fakeSet), broken: broken}
+	server := hlldproxy.NewServer(list, fake.handle)
+	defer server.Close()
+
+	client, err := hlld.Dial(server.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Leftover sets are dropped before and after the run
+	fake.sets[DefaultPrefix+"-old"] = &fakeSet{keys: make(map[string]struct{})}
+	results, err := Run(client, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(fake.sets) != 0 {
+		t.Fatalf("bad: %v", fake.sets)
+	}
+	return results
+}
+
+func TestRun(t *testing.T) {
+	results := testRun(t, "")
+	if len(results) != len(checks) {
+		t.Fatalf("bad: %v", results)
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			t.Fatalf("check %s failed: %v", r.Name, r.Err)
+		}
+	}
+}
+
+func TestRun_Failures(t *testing.T) {
+	results := testRun(t, "close")
+	failed := make(map[string]string)
+	for _, r := range results {
+		if !r.Passed() {
+			failed[r.Name] = r.Err.Error()
+		}
+	}
+	if len(failed) != 2 {
+		t.Fatalf("bad: %v", failed)
+	}
+	if !strings.Contains(failed["close"], `'close hlld-conformance-close': expected "Done\n", got "Broken\n"`) {
+		t.Fatalf("bad: %v", failed)
+	}
+	if _, ok := failed["clear"]; !ok {
+		t.Fatalf("bad: %v", failed)
+	}
+}
@@ -0,0 +1,159 @@
+// Package hlldlock coordinates destructive operations on hlld sets using
+// advisory locks, so that two operators or tools do not race on the same
+// set. hlld has no locking of its own, so the locks are provided by an
+// external system such as Consul, through the Locker interface.
+package hlldlock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/armon/go-hlld"
+)
+
+const (
+	// DefaultKeyPrefix is prepended to set names to build lock keys
+	DefaultKeyPrefix = "hlld/sets/"
+)
+
+// Locker acquires advisory locks by key. Lock blocks until the lock
+// is held or the context is done, and returns a function to release it.
+// An implementation may be backed by a Consul lock, an etcd lease, or a
+// database row, as long as every tool operating on the sets shares it.
+type Locker interface {
+	Lock(ctx context.Context, key string) (unlock func() error, err error)
+}
+
+// Guard wraps destructive operations on sets in advisory locks
+type Guard struct {
+	// Client is used to execute the operations
+	Client *hlld.Client
+
+	// Locker is used to acquire the locks
+	Locker Locker
+
+	// KeyPrefix is prepended to set names to build lock keys. The
+	// DefaultKeyPrefix is used if unspecified.
+	KeyPrefix string
+}
+
+// Drop is used to drop a set while holding its lock
+func (g *Guard) Drop(ctx context.Context, name string) error {
+	cmd, err := hlld.NewDropCommand(name)
+	if err != nil {
+		return err
+	}
+	return g.setCommand(ctx, cmd)
+}
+
+// Clear is used to clear a set while holding its lock
+func (g *Guard) Clear(ctx context.Context, name string) error {
+	cmd, err := hlld.NewClearCommand(name)
+	if err != nil {
+		return err
+	}
+	return g.setCommand(ctx, cmd)
+}
+
+// Run is used to run a script while holding the lock of every set it
+// operates on, including the sets of its compensations
+func (g *Guard) Run(ctx context.Context, s *hlld.Script) (*hlld.ScriptReport, error) {
+	unlock, err := g.lockAll(ctx, s.SetNames())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.Run(g.Client)
+}
+
+// setCommand is used to execute a command on a set while holding its lock
+func (g *Guard) setCommand(ctx context.Context, cmd *hlld.SetCommand) error {
+	unlock, err := g.lockAll(ctx, []string{cmd.SetName})
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := g.Client.ExecuteContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := f.Error(); err != nil {
+		return err
+	}
+	ok, err := cmd.Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s of set '%s' was not applied", cmd.Command, cmd.SetName)
+	}
+	return nil
+}
+
+// lockAll is used to acquire the locks of the sets in order, returning
+// a function to release them. The names must be sorted so that guards
+// locking overlapping sets cannot deadlock.
+func (g *Guard) lockAll(ctx context.Context, names []string) (func(), error) {
+	prefix := g.KeyPrefix
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+
+	var unlocks []func() error
+	release := func() {
+		for idx := len(unlocks) - 1; idx >= 0; idx-- {
+			unlocks[idx]()
+		}
+	}
+	for _, name := range names {
+		unlock, err := g.Locker.Lock(ctx, prefix+name)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to lock set '%s': %w", name, err)
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return release, nil
+}
+
+// LocalLocker is a Locker for a single process, such as when several
+// goroutines of a tool operate on the same sets, and for testing
+type LocalLocker struct {
+	held     map[string]chan struct{}
+	heldLock sync.Mutex
+}
+
+// NewLocalLocker creates a new local locker
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{held: make(map[string]chan struct{})}
+}
+
+// Lock is used to acquire the lock of a key, waiting until it is
+// released or the context is done
+func (l *LocalLocker) Lock(ctx context.Context, key string) (func() error, error) {
+	for {
+		l.heldLock.Lock()
+		releasedCh, ok := l.held[key]
+		if !ok {
+			releasedCh = make(chan struct{})
+			l.held[key] = releasedCh
+			l.heldLock.Unlock()
+			return func() error {
+				l.heldLock.Lock()
+				delete(l.held, key)
+				l.heldLock.Unlock()
+				close(releasedCh)
+				return nil
+			}, nil
+		}
+		l.heldLock.Unlock()
+
+		select {
+		case <-releasedCh:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
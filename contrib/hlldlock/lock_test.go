@@ -0,0 +1,149 @@
+package hlldlock
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+// testClient returns a client for a server that records each line
+func testClient(t *testing.T) (*hlld.Client, func() []string, func()) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var lock sync.Mutex
+	var lines []string
+	go func() {
+		conn, err := list.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufR := bufio.NewReader(conn)
+		for {
+			line, err := bufR.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			lines = append(lines, line)
+			lock.Unlock()
+			conn.Write([]byte("Done\n"))
+		}
+	}()
+
+	client, err := hlld.Dial(list.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	got := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), lines...)
+	}
+	return client, got, func() {
+		client.Close()
+		list.Close()
+	}
+}
+
+func TestGuard_Drop(t *testing.T) {
+	client, lines, stop := testClient(t)
+	defer stop()
+
+	locker := NewLocalLocker()
+	g := &Guard{Client: client, Locker: locker}
+
+	// Drop waits while another tool holds the lock
+	unlock, err := locker.Lock(context.Background(), "hlld/sets/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- g.Drop(context.Background(), "foo")
+	}()
+	select {
+	case err := <-errCh:
+		t.Fatalf("dropped while locked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(lines()) != 0 {
+		t.Fatalf("bad: %v", lines())
+	}
+
+	unlock()
+	if err := <-errCh; err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got := lines(); len(got) != 1 || got[0] != "drop foo\n" {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// The lock is released afterwards
+	unlock, err = locker.Lock(context.Background(), "hlld/sets/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	unlock()
+}
+
+func TestGuard_Clear_Timeout(t *testing.T) {
+	client, lines, stop := testClient(t)
+	defer stop()
+
+	locker := NewLocalLocker()
+	g := &Guard{Client: client, Locker: locker, KeyPrefix: "test/"}
+	unlock, _ := locker.Lock(context.Background(), "test/foo")
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := g.Clear(ctx, "foo"); err == nil {
+		t.Fatalf("expect error")
+	}
+	if len(lines()) != 0 {
+		t.Fatalf("bad: %v", lines())
+	}
+}
+
+// recordLocker records the keys that are locked
+type recordLocker struct {
+	keys []string
+}
+
+func (r *recordLocker) Lock(ctx context.Context, key string) (func() error, error) {
+	r.keys = append(r.keys, key)
+	return func() error { return nil }, nil
+}
+
+func TestGuard_Run(t *testing.T) {
+	client, lines, stop := testClient(t)
+	defer stop()
+
+	locker := &recordLocker{}
+	g := &Guard{Client: client, Locker: locker}
+
+	create, _ := hlld.NewCreateCommand("foo")
+	drop, _ := hlld.NewDropCommand("foo")
+	bar, _ := hlld.NewDropCommand("bar")
+	s := &hlld.Script{}
+	s.Add(create, drop)
+	s.Add(bar, nil)
+	if _, err := g.Run(context.Background(), s); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(locker.keys) != 2 || locker.keys[0] != "hlld/sets/bar" || locker.keys[1] != "hlld/sets/foo" {
+		t.Fatalf("bad: %v", locker.keys)
+	}
+	if len(lines()) != 2 {
+		t.Fatalf("bad: %v", lines())
+	}
+}
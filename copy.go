@@ -0,0 +1,253 @@
+package hlld
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// copyMaxInflight is the maximum number of batches that
+	// are pipelined before waiting for the results
+	copyMaxInflight = 128
+)
+
+// KeySource provides the keys to replay into a set
+type KeySource interface {
+	// Next returns the next batch of keys, or io.EOF once exhausted
+	Next() ([]string, error)
+}
+
+// sliceSource is a KeySource backed by a slice
+type sliceSource struct {
+	keys  []string
+	batch int
+}
+
+// SliceSource returns a KeySource providing the keys in batches
+func SliceSource(keys []string, batch int) KeySource {
+	return &sliceSource{keys: keys, batch: batch}
+}
+
+func (s *sliceSource) Next() ([]string, error) {
+	if len(s.keys) == 0 {
+		return nil, io.EOF
+	}
+	n := s.batch
+	if n <= 0 || n > len(s.keys) {
+		n = len(s.keys)
+	}
+	out := s.keys[:n]
+	s.keys = s.keys[n:]
+	return out, nil
+}
+
+// lineSource is a KeySource reading a key per line
+type lineSource struct {
+	scan  *bufio.Scanner
+	batch int
+}
+
+// LineSource returns a KeySource that reads a key per line from
+// the reader, such as an exported file of keys. Blank lines are skipped.
+func LineSource(r io.Reader, batch int) KeySource {
+	if batch <= 0 {
+		batch = 1000
+	}
+	return &lineSource{scan: bufio.NewScanner(r), batch: batch}
+}
+
+func (s *lineSource) Next() ([]string, error) {
+	out := make([]string, 0, s.batch)
+	for len(out) < s.batch && s.scan.Scan() {
+		if key := strings.TrimSpace(s.scan.Text()); key != "" {
+			out = append(out, key)
+		}
+	}
+	if err := s.scan.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, io.EOF
+	}
+	return out, nil
+}
+
+// CopyStage is a step of a copy and swap
+type CopyStage int
+
+const (
+	// CopyCreate is when the new set is created
+	CopyCreate CopyStage = iota
+
+	// CopyReplay is when keys are replayed into the new set
+	CopyReplay
+
+	// CopyDrop is when the old set is dropped
+	CopyDrop
+
+	// CopyDone is when the copy is complete
+	CopyDone
+)
+
+func (s CopyStage) String() string {
+	switch s {
+	case CopyCreate:
+		return "create"
+	case CopyReplay:
+		return "replay"
+	case CopyDrop:
+		return "drop"
+	case CopyDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// CopyProgress is reported as a copy and swap proceeds
+type CopyProgress struct {
+	// Stage is the current step
+	Stage CopyStage
+
+	// Keys is the number of keys replayed so far
+	Keys uint64
+}
+
+// CopyOptions are used to parameterize a copy and swap
+type CopyOptions struct {
+	// Precision, ErrThreshold and InMemory are the options used
+	// to create the new set, as with a CreateCommand
+	Precision    int
+	ErrThreshold float64
+	InMemory     bool
+
+	// Source provides the keys to replay into the new set. hlld cannot
+	// export the keys of a set, so they must come from the caller.
+	Source KeySource
+
+	// Progress is an optional function invoked as the copy proceeds
+	Progress func(CopyProgress)
+}
+
+// CopyAndSwap is used to replace a set with a new one, since hlld does
+// not support renaming. The new set is created with the given options,
+// falling back to the DefaultCreateOptions of the client, the keys from the source are replayed into it, and the old set is
+// dropped. This is useful for changing the precision of a set.
+func (c *Client) CopyAndSwap(oldName, newName string, opts *CopyOptions) error {
+	if opts == nil || opts.Source == nil {
+		return fmt.Errorf("missing key source")
+	}
+	if oldName == newName {
+		return fmt.Errorf("old and new set names must differ")
+	}
+	progress := func(stage CopyStage, keys uint64) {
+		if opts.Progress != nil {
+			opts.Progress(CopyProgress{Stage: stage, Keys: keys})
+		}
+	}
+
+	// Create the new set
+	progress(CopyCreate, 0)
+	create, err := NewCreateCommand(newName)
+	if err != nil {
+		return err
+	}
+	create.Precision = opts.Precision
+	create.ErrThreshold = opts.ErrThreshold
+	create.InMemory = opts.InMemory
+	c.config.DefaultCreateOptions.Apply(create)
+	if err := executeWait(c, create); err != nil {
+		return err
+	}
+	if ok, err := create.Result(); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("failed to create set '%s'", newName)
+	}
+
+	// Replay the keys
+	keys, err := c.replay(newName, opts.Source, progress)
+	if err != nil {
+		return err
+	}
+
+	// Flush the new set before dropping the old one
+	flush, err := NewFlushCommand(newName)
+	if err != nil {
+		return err
+	}
+	if err := executeWait(c, flush); err != nil {
+		return err
+	}
+
+	progress(CopyDrop, keys)
+	drop, err := NewDropCommand(oldName)
+	if err != nil {
+		return err
+	}
+	if err := executeWait(c, drop); err != nil {
+		return err
+	}
+	if ok, err := drop.Result(); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("failed to drop set '%s'", oldName)
+	}
+	progress(CopyDone, keys)
+	return nil
+}
+
+// replay is used to pipeline the keys from the source into a set,
+// returning the number of keys written
+func (c *Client) replay(name string, source KeySource, progress func(CopyStage, uint64)) (uint64, error) {
+	var written uint64
+	var cmds []*SetKeysCommand
+	var futures []*Future
+
+	// wait is used to check the results of the inflight batches
+	wait := func() error {
+		for idx, f := range futures {
+			if err := f.Error(); err != nil {
+				return err
+			}
+			if ok, err := cmds[idx].Result(); err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("set '%s' does not exist", name)
+			}
+			written += uint64(len(cmds[idx].Keys))
+		}
+		cmds, futures = cmds[:0], futures[:0]
+		progress(CopyReplay, written)
+		return nil
+	}
+
+	for {
+		keys, err := source.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return written, err
+		}
+
+		cmd, err := NewSetKeysCommand(name, keys)
+		if err != nil {
+			return written, err
+		}
+		f, err := c.Execute(cmd)
+		if err != nil {
+			return written, err
+		}
+		cmds = append(cmds, cmd)
+		futures = append(futures, f)
+
+		if len(futures) >= copyMaxInflight {
+			if err := wait(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, wait()
+}
@@ -0,0 +1,112 @@
+package hlld
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSliceSource(t *testing.T) {
+	src := SliceSource([]string{"a", "b", "c"}, 2)
+	keys, err := src.Next()
+	if err != nil || !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatalf("bad: %v %v", keys, err)
+	}
+	keys, err = src.Next()
+	if err != nil || !reflect.DeepEqual(keys, []string{"c"}) {
+		t.Fatalf("bad: %v %v", keys, err)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestLineSource(t *testing.T) {
+	src := LineSource(strings.NewReader("a\n\nb\nc\n"), 2)
+	keys, err := src.Next()
+	if err != nil || !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatalf("bad: %v %v", keys, err)
+	}
+	keys, err = src.Next()
+	if err != nil || !reflect.DeepEqual(keys, []string{"c"}) {
+		t.Fatalf("bad: %v %v", keys, err)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestClient_CopyAndSwap(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		received = append(received, line)
+		lock.Unlock()
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	var stages []string
+	opts := &CopyOptions{
+		Precision: 14,
+		Source:    SliceSource([]string{"a", "b", "c"}, 2),
+		Progress: func(p CopyProgress) {
+			stages = append(stages, p.Stage.String())
+			if p.Stage == CopyDone && p.Keys != 3 {
+				t.Fatalf("bad: %#v", p)
+			}
+		},
+	}
+	if err := client.CopyAndSwap("old", "new", opts); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	expect := []string{
+		"create new precision=14\n",
+		"b new a b\n",
+		"b new c\n",
+		"flush new\n",
+		"drop old\n",
+	}
+	if !reflect.DeepEqual(received, expect) {
+		t.Fatalf("bad: %q", received)
+	}
+	if strings.Join(stages, ",") != "create,replay,drop,done" {
+		t.Fatalf("bad: %v", stages)
+	}
+}
+
+func TestClient_CopyAndSwap_CreateFailed(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Delete in progress\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	opts := &CopyOptions{Source: SliceSource([]string{"a"}, 1)}
+	if err := client.CopyAndSwap("old", "new", opts); err == nil {
+		t.Fatalf("expect error")
+	}
+	if err := client.CopyAndSwap("old", "old", opts); err == nil {
+		t.Fatalf("expect error")
+	}
+	if err := client.CopyAndSwap("old", "new", nil); err == nil {
+		t.Fatalf("expect error")
+	}
+}
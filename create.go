@@ -0,0 +1,119 @@
+package hlld
+
+import (
+	"fmt"
+)
+
+// CreateOptions are the options used to create a set
+type CreateOptions struct {
+	// Precision is the number of precision bits, as with a CreateCommand
+	Precision int
+
+	// ErrThreshold is the tolerable error, as with a CreateCommand
+	ErrThreshold float64
+
+	// InMemory prevents the set from being paged out
+	InMemory bool
+
+	// Verify is used to check with an info command that the server
+	// honored the precision or error threshold, since it may clamp them
+	// or the set may already exist with other parameters. It is not
+	// applied to create commands.
+	Verify bool
+}
+
+// CreateMismatchError is returned by CreateSet with the Verify option if
+// the set does not have the requested precision or error threshold. The
+// set exists, so callers may treat it as a warning.
+type CreateMismatchError struct {
+	// SetName is the name of the set
+	SetName string
+
+	// Param is the mismatched parameter, either "precision" or "eps"
+	Param string
+
+	// Requested is the requested value, and Actual the value of the set
+	Requested float64
+	Actual    float64
+}
+
+func (e *CreateMismatchError) Error() string {
+	return fmt.Sprintf("set '%s' has %s %v, requested %v", e.SetName, e.Param, e.Actual, e.Requested)
+}
+
+// Apply is used to set the options on a create command for any options
+// it does not specify. The precision and error threshold are only set
+// if the command specifies neither, since they are alternatives.
+func (o *CreateOptions) Apply(cmd *CreateCommand) {
+	if o == nil {
+		return
+	}
+	if cmd.Precision == 0 && cmd.ErrThreshold == 0 {
+		cmd.Precision = o.Precision
+		cmd.ErrThreshold = o.ErrThreshold
+	}
+	if !cmd.InMemory {
+		cmd.InMemory = o.InMemory
+	}
+}
+
+// CreateSet is used to create a set with the given options, which may be
+// nil. Unspecified options are set from the DefaultCreateOptions of the
+// configuration. It returns true if the set was created or already exists,
+// and false if a set with the same name is still being deleted. If the
+// Verify option is set and the set does not have the requested parameters,
+// true is returned with a *CreateMismatchError.
+func (c *Client) CreateSet(name string, opts *CreateOptions) (bool, error) {
+	cmd, err := NewCreateCommand(name)
+	if err != nil {
+		return false, err
+	}
+	opts.Apply(cmd)
+	defaults := c.config.DefaultCreateOptions
+	defaults.Apply(cmd)
+	if err := executeWait(c, cmd); err != nil {
+		return false, err
+	}
+	ok, err := cmd.Result()
+	if !ok || err != nil {
+		return ok, err
+	}
+	if (opts != nil && opts.Verify) || (defaults != nil && defaults.Verify) {
+		return true, c.verifyCreate(cmd)
+	}
+	return true, nil
+}
+
+// verifyCreate is used to check that a set has the
+// precision or error threshold of a create command
+func (c *Client) verifyCreate(cmd *CreateCommand) error {
+	if cmd.Precision == 0 && cmd.ErrThreshold == 0 {
+		return nil
+	}
+	infoCmd, err := NewInfoCommand(cmd.SetName)
+	if err != nil {
+		return err
+	}
+	if err := executeWait(c, infoCmd); err != nil {
+		return err
+	}
+	info, ok, err := infoCmd.Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("set '%s' does not exist after create", cmd.SetName)
+	}
+
+	// The error threshold is honored by any precision with at most that
+	// error, allowing for the rounding of the reported error
+	switch {
+	case cmd.Precision != 0 && info.Precision != uint64(cmd.Precision):
+		return &CreateMismatchError{SetName: cmd.SetName, Param: "precision",
+			Requested: float64(cmd.Precision), Actual: float64(info.Precision)}
+	case cmd.Precision == 0 && info.ErrThreshold > cmd.ErrThreshold*1.001:
+		return &CreateMismatchError{SetName: cmd.SetName, Param: "eps",
+			Requested: cmd.ErrThreshold, Actual: info.ErrThreshold}
+	}
+	return nil
+}
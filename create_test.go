@@ -0,0 +1,114 @@
+package hlld
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCreateOptions_Apply(t *testing.T) {
+	opts := &CreateOptions{Precision: 14, InMemory: true}
+
+	cmd, _ := NewCreateCommand("foo")
+	opts.Apply(cmd)
+	verifyEncode(t, cmd, "create foo precision=14 in_memory=true\n")
+
+	// Explicit options are kept
+	cmd, _ = NewCreateCommand("foo")
+	cmd.ErrThreshold = 0.01
+	opts.Apply(cmd)
+	verifyEncode(t, cmd, "create foo eps=0.01 in_memory=true\n")
+
+	// Nil options are ignored
+	cmd, _ = NewCreateCommand("foo")
+	var none *CreateOptions
+	none.Apply(cmd)
+	verifyEncode(t, cmd, "create foo\n")
+}
+
+func TestClient_CreateSet(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		switch line {
+		case "create foo precision=14\n", "create bar eps=0.02\n":
+			return "Done\n"
+		case "create baz precision=14\n":
+			return "Delete in progress\n"
+		}
+		t.Errorf("bad: %q", line)
+		return "Client Error: Bad arguments\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.DefaultCreateOptions = &CreateOptions{Precision: 14}
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	if ok, err := client.CreateSet("foo", nil); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if ok, err := client.CreateSet("bar", &CreateOptions{ErrThreshold: 0.02}); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if ok, err := client.CreateSet("baz", nil); ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+}
+
+func TestClient_CreateSet_Verify(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "create":
+			return "Done\n"
+		case fields[1] == "missing":
+			return "Set does not exist\n"
+		case fields[1] == "clamped":
+			return "START\neps 0.016250\nprecision 12\nEND\n"
+		}
+		return "START\neps 0.008125\nprecision 14\nEND\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.DefaultCreateOptions = &CreateOptions{Verify: true}
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Honored parameters are not an error
+	for _, opts := range []*CreateOptions{
+		{Precision: 14},
+		{ErrThreshold: 0.01},
+		{ErrThreshold: 0.008125},
+		nil,
+	} {
+		if ok, err := client.CreateSet("foo", opts); !ok || err != nil {
+			t.Fatalf("bad: %v %v", ok, err)
+		}
+	}
+
+	// Mismatches are typed errors, and the set exists
+	ok, err := client.CreateSet("clamped", &CreateOptions{Precision: 14})
+	var mismatch *CreateMismatchError
+	if !ok || !errors.As(err, &mismatch) || mismatch.Param != "precision" || mismatch.Actual != 12 {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if err.Error() != "set 'clamped' has precision 12, requested 14" {
+		t.Fatalf("bad: %v", err)
+	}
+	ok, err = client.CreateSet("clamped", &CreateOptions{ErrThreshold: 0.01})
+	if !ok || !errors.As(err, &mismatch) || mismatch.Param != "eps" || mismatch.Requested != 0.01 {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+
+	// A set deleted after the create is reported
+	if _, err := client.CreateSet("missing", &CreateOptions{Precision: 14}); err == nil {
+		t.Fatalf("expect error")
+	}
+}
@@ -0,0 +1,120 @@
+package hlld
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// maxRecentErrors is the number of command errors
+	// retained for debugging
+	maxRecentErrors = 16
+)
+
+// CommandError describes a command that failed
+type CommandError struct {
+	// Time is when the command failed
+	Time time.Time
+
+	// Type is the type of the command, such as "create" or "info"
+	Type string
+
+	// SetName is the name of the set, if the command targets one
+	SetName string
+
+	// Err is the error of the command
+	Err error
+}
+
+// recordError is used to retain the error of a failed command
+func (c *Client) recordError(f *Future, err error) {
+	c.recentErrorsLock.Lock()
+	defer c.recentErrorsLock.Unlock()
+	c.recentErrors = append(c.recentErrors, CommandError{
+		Time:    time.Now(),
+		Type:    commandType(f.cmd),
+		SetName: commandSetName(f.cmd),
+		Err:     err,
+	})
+	if len(c.recentErrors) > maxRecentErrors {
+		c.recentErrors = c.recentErrors[len(c.recentErrors)-maxRecentErrors:]
+	}
+}
+
+// RecentErrors returns the latest command errors, oldest first
+func (c *Client) RecentErrors() []CommandError {
+	c.recentErrorsLock.Lock()
+	defer c.recentErrorsLock.Unlock()
+	out := make([]CommandError, len(c.recentErrors))
+	copy(out, c.recentErrors)
+	return out
+}
+
+// labeled is used to run a goroutine of the client with pprof labels,
+// so it can be identified in goroutine profiles
+func (c *Client) labeled(role string, fn func()) {
+	addr := ""
+	if remote := c.conn.RemoteAddr(); remote != nil {
+		addr = remote.String()
+	}
+	labels := pprof.Labels("hlld", role, "hlld_addr", addr)
+	pprof.Do(context.Background(), labels, func(context.Context) {
+		fn()
+	})
+}
+
+// Handler returns an HTTP handler that renders the state of a client,
+// including the connection, configuration, pending commands and recent
+// errors. It is intended to be mounted in an existing server, such as
+// under /debug/hlld.
+func Handler(client *Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		client.writeDebug(w)
+	})
+}
+
+// writeDebug is used to render the state of the client
+func (c *Client) writeDebug(w http.ResponseWriter) {
+	c.connLock.Lock()
+	local, remote, gen := c.conn.LocalAddr(), c.conn.RemoteAddr(), c.gen
+	c.connLock.Unlock()
+	stats := c.Stats()
+	now := time.Now()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Connection\n")
+	fmt.Fprintf(tw, "  Local:\t%v\n", local)
+	fmt.Fprintf(tw, "  Remote:\t%v\n", remote)
+	fmt.Fprintf(tw, "  Generation:\t%d\n", gen)
+	fmt.Fprintf(tw, "  Closed:\t%v\n", c.isClosed())
+	fmt.Fprintf(tw, "\nConfig\n")
+	fmt.Fprintf(tw, "  MaxPipeline:\t%d\n", atomic.LoadInt64(&c.maxPipeline))
+	fmt.Fprintf(tw, "  Timeout:\t%v\n", c.timeout())
+	fmt.Fprintf(tw, "  EnqueueTimeout:\t%v\n", c.enqueueTimeout())
+	fmt.Fprintf(tw, "  TLS:\t%v\n", c.config.TLSConfig != nil)
+	fmt.Fprintf(tw, "  Hooks:\t%d\n", len(c.config.Hooks))
+	fmt.Fprintf(tw, "\nStats\n")
+	fmt.Fprintf(tw, "  Commands:\t%d\n", stats.Commands)
+	fmt.Fprintf(tw, "  Errors:\t%d\n", stats.Errors)
+	fmt.Fprintf(tw, "  Reconnects:\t%d\n", stats.Reconnects)
+	fmt.Fprintf(tw, "  Pending:\t%d\n", stats.Pending)
+	tw.Flush()
+
+	fmt.Fprintf(tw, "\nPending commands\n")
+	for _, p := range c.Pending() {
+		fmt.Fprintf(tw, "  %s\t%s\t%v ago\n", p.Type, p.SetName, now.Sub(p.Enqueued))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(tw, "\nRecent errors\n")
+	for _, e := range c.RecentErrors() {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%v\n", e.Time.Format(time.RFC3339), e.Type, e.SetName, e.Err)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,68 @@
+package hlld
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "bad\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.OnReaderError = func(err error) Action { return FailFutureOnly }
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	cmd, err := NewCreateCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := executeWait(client, cmd); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := cmd.Result(); err == nil {
+		t.Fatalf("expect error")
+	}
+	list, err := NewListCommand("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := executeWait(client, list); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	errs := client.RecentErrors()
+	if len(errs) != 1 || errs[0].Type != "list" {
+		t.Fatalf("bad: %#v", errs)
+	}
+
+	resp := httptest.NewRecorder()
+	Handler(client).ServeHTTP(resp, httptest.NewRequest("GET", "/debug/hlld", nil))
+	body := resp.Body.String()
+	for _, expect := range []string{addr, "MaxPipeline:", "Errors:", "expect list start block"} {
+		if !strings.Contains(body, expect) {
+			t.Fatalf("missing %q: %s", expect, body)
+		}
+	}
+}
+
+func TestClient_RecentErrors_Bounded(t *testing.T) {
+	client := &Client{}
+	cmd, err := NewCreateCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < maxRecentErrors*2; i++ {
+		client.recordError(NewFuture(cmd), ErrConnectionLost)
+	}
+	if errs := client.RecentErrors(); len(errs) != maxRecentErrors {
+		t.Fatalf("bad: %d", len(errs))
+	}
+}
@@ -0,0 +1,177 @@
+package hlld
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// lookupHost is used to resolve a host, and can be replaced in tests
+var lookupHost = net.DefaultResolver.LookupHost
+
+// dialAddr is used to connect to an address. If the host resolves to
+// multiple addresses, connections are raced in the style of happy eyeballs:
+// an attempt is started to each address in turn, either once the previous
+// attempt fails or after the DialStagger, and the first connection to
+// succeed is used. IPv6 and IPv4 addresses are interleaved.
+func dialAddr(addr string, config *Config) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the host unless it is an IP
+	ips := []string{host}
+	if net.ParseIP(host) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		ips, err = lookupHost(ctx, host)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	addrs := interleaveFamilies(ips)
+	for idx, ip := range addrs {
+		addrs[idx] = net.JoinHostPort(ip, port)
+	}
+
+	timeout := config.DialTimeout
+	if timeout == 0 {
+		timeout = config.Timeout
+	}
+	conn, err := raceDial(addrs, config.DialStagger, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap the connection with TLS if configured
+	if config.TLSConfig == nil {
+		return conn, nil
+	}
+	tlsConf := config.TLSConfig
+	if tlsConf.ServerName == "" {
+		tlsConf = tlsConf.Clone()
+		tlsConf.ServerName = host
+	}
+	tlsConn := tls.Client(conn, tlsConf)
+	tlsConn.SetDeadline(time.Now().Add(config.Timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// interleaveFamilies is used to order addresses alternating between
+// IPv6 and IPv4, starting with IPv6, preserving the resolver order
+func interleaveFamilies(ips []string) []string {
+	var v6, v4 []string
+	for _, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+			v6 = append(v6, ip)
+		} else {
+			v4 = append(v4, ip)
+		}
+	}
+	out := make([]string, 0, len(ips))
+	for len(v6) > 0 || len(v4) > 0 {
+		if len(v6) > 0 {
+			out = append(out, v6[0])
+			v6 = v6[1:]
+		}
+		if len(v4) > 0 {
+			out = append(out, v4[0])
+			v4 = v4[1:]
+		}
+	}
+	return out
+}
+
+// dialResult is the outcome of a connection attempt
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// DialError is returned if every address of a host fails to connect
+type DialError struct {
+	// Errors are the errors of each attempt, in the order attempted
+	Errors []error
+}
+
+func (e *DialError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	msgs := make([]string, len(e.Errors))
+	for idx, err := range e.Errors {
+		msgs[idx] = err.Error()
+	}
+	return fmt.Sprintf("all %d addresses failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of each attempt, so they
+// can be matched with errors.Is and errors.As
+func (e *DialError) Unwrap() []error {
+	return e.Errors
+}
+
+// raceDial is used to race connections to the addresses, starting the
+// next attempt when one fails or the stagger elapses. Each attempt is
+// limited by the timeout. A DialError is returned if every attempt fails.
+func raceDial(addrs []string, stagger, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan dialResult, len(addrs))
+	next, inflight := 0, 0
+	start := func() {
+		addr := addrs[next]
+		next++
+		inflight++
+		go func() {
+			dialer := &net.Dialer{Timeout: timeout}
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			results <- dialResult{conn, err}
+		}()
+	}
+	start()
+
+	timer := time.NewTimer(stagger)
+	defer timer.Stop()
+
+	var errs []error
+	for inflight > 0 {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				// Close any connections that succeed after the winner
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(inflight)
+				return r.conn, nil
+			}
+			errs = append(errs, r.err)
+			if next < len(addrs) {
+				start()
+				timer.Reset(stagger)
+			}
+
+		case <-timer.C:
+			if next < len(addrs) {
+				start()
+				timer.Reset(stagger)
+			}
+		}
+	}
+	return nil, &DialError{Errors: errs}
+}
@@ -0,0 +1,130 @@
+package hlld
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterleaveFamilies(t *testing.T) {
+	ips := []string{"10.0.0.1", "10.0.0.2", "::1", "10.0.0.3", "fe80::1"}
+	expect := []string{"::1", "10.0.0.1", "fe80::1", "10.0.0.2", "10.0.0.3"}
+	if out := interleaveFamilies(ips); !reflect.DeepEqual(out, expect) {
+		t.Fatalf("bad: %v", out)
+	}
+}
+
+// stubLookup is used to replace the resolver in a test
+func stubLookup(t *testing.T, ips ...string) func() {
+	old := lookupHost
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host != "hlld.test" {
+			t.Errorf("bad: %s", host)
+		}
+		return ips, nil
+	}
+	return func() { lookupHost = old }
+}
+
+func TestDialConfig_MultipleAddrs(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+	_, port, _ := net.SplitHostPort(list.Addr().String())
+
+	// The first address refuses connections
+	defer stubLookup(t, "127.0.0.2", "127.0.0.1")()
+
+	conf := DefaultConfig()
+	conf.DialStagger = time.Minute
+	client, err := DialConfig(net.JoinHostPort("hlld.test", port), conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+	if addr := client.conn.RemoteAddr().String(); addr != list.Addr().String() {
+		t.Fatalf("bad: %s", addr)
+	}
+}
+
+func TestDialConfig_AllFail(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(list.Addr().String())
+	list.Close()
+
+	defer stubLookup(t, "127.0.0.2", "127.0.0.1")()
+	_, err = DialConfig(net.JoinHostPort("hlld.test", port), nil)
+	derr, ok := err.(*DialError)
+	if !ok {
+		t.Fatalf("err: %v", err)
+	}
+	if len(derr.Errors) != 2 || !strings.Contains(err.Error(), "all 2 addresses failed") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestDialConfig_DialTimeout(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+	_, port, _ := net.SplitHostPort(list.Addr().String())
+
+	// The first address never completes, and is abandoned after
+	// the dial timeout rather than the stagger
+	defer stubLookup(t, "192.0.2.1", "127.0.0.1")()
+	conf := DefaultConfig()
+	conf.DialStagger = time.Minute
+	conf.DialTimeout = 50 * time.Millisecond
+	client, err := DialConfig(net.JoinHostPort("hlld.test", port), conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	client.Close()
+}
+
+func TestDialConfig_IPv6(t *testing.T) {
+	list, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 not available: %v", err)
+	}
+	defer list.Close()
+
+	client, err := DialConfig(list.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	client.Close()
+}
+
+func TestRaceDial_Stagger(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+
+	// The first address never completes, so the second is
+	// attempted after the stagger
+	start := time.Now()
+	conn, err := raceDial([]string{"192.0.2.1:4553", list.Addr().String()}, 50*time.Millisecond, 5*time.Second)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != list.Addr().String() {
+		t.Fatalf("bad: %v", conn.RemoteAddr())
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("bad: %v", elapsed)
+	}
+}
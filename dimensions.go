@@ -0,0 +1,197 @@
+package hlld
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDimensionalName is the longest readable set name used by a
+	// DimensionalCounter, beyond which the dimensions are hashed
+	maxDimensionalName = 128
+)
+
+// DimensionalCounter is used to count the unique keys of a metric broken
+// down by dimensions, such as the unique users of a page by country and
+// device. Each combination of dimension values is counted in its own set,
+// named deterministically from the metric and the values in the order of
+// the dimensions, such as "users__us__mobile". Combinations that are too
+// long, or have values that are not valid in a set name, are hashed
+// instead, such as "users___3f2a...".
+//
+// Sets are created as keys are added. If a TTL is given, Expire drops
+// the sets that have not been written by this counter within the TTL,
+// which keeps rarely seen combinations from accumulating. Sets written
+// by other processes are not expired.
+type DimensionalCounter struct {
+	client     *Client
+	dimensions []string
+	ttl        time.Duration
+	opts       *CreateOptions
+
+	// now returns the current time, and can be replaced for testing
+	now func() time.Time
+
+	// written tracks the last write to each set
+	written     map[string]time.Time
+	writtenLock sync.Mutex
+}
+
+// NewDimensionalCounter creates a counter with the given dimension names.
+// A TTL of zero disables expiration. The create options of the sets may
+// be nil.
+func NewDimensionalCounter(client *Client, dimensions []string, ttl time.Duration, opts *CreateOptions) (*DimensionalCounter, error) {
+	if _, err := NewSetName(append([]string{"metric"}, dimensions...)...); err != nil {
+		return nil, err
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("ttl cannot be negative")
+	}
+	d := &DimensionalCounter{
+		client:     client,
+		dimensions: dimensions,
+		ttl:        ttl,
+		opts:       opts,
+		now:        time.Now,
+		written:    make(map[string]time.Time),
+	}
+	return d, nil
+}
+
+// SetName returns the name of the set counting the metric for the given
+// dimension values. A value must be provided for every dimension.
+func (d *DimensionalCounter) SetName(metric string, dims Tags) (string, error) {
+	if err := validTagValue(metric); err != nil {
+		return "", fmt.Errorf("invalid metric '%s': %w", metric, err)
+	}
+	values := make([]string, len(d.dimensions))
+	readable := true
+	for idx, dim := range d.dimensions {
+		value, ok := dims[dim]
+		if !ok {
+			return "", fmt.Errorf("missing value for '%s'", dim)
+		}
+		if validTagValue(value) != nil {
+			readable = false
+		}
+		values[idx] = value
+	}
+	if len(dims) != len(d.dimensions) {
+		return "", fmt.Errorf("unknown dimensions")
+	}
+
+	name := strings.Join(append([]string{metric}, values...), TagSeparator)
+	if readable && len(name) <= maxDimensionalName {
+		return name, nil
+	}
+
+	// Readable values cannot start with an underscore, so the
+	// hashed names never collide with the readable ones
+	h := fnv.New128a()
+	for _, value := range values {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return metric + TagSeparator + "_" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Add is used to add keys to the set for the metric and dimension
+// values, creating it if needed
+func (d *DimensionalCounter) Add(metric string, dims Tags, keys ...string) error {
+	name, err := d.SetName(metric, dims)
+	if err != nil {
+		return err
+	}
+
+	d.writtenLock.Lock()
+	_, created := d.written[name]
+	d.writtenLock.Unlock()
+	if !created {
+		ok, err := d.client.CreateSet(name, d.opts)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("set '%s' is being deleted", name)
+		}
+	}
+
+	cmd, err := NewSetKeysCommand(name, keys)
+	if err != nil {
+		return err
+	}
+	if err := executeWait(d.client, cmd); err != nil {
+		return err
+	}
+	ok, err := cmd.Result()
+	if err != nil {
+		return err
+	}
+
+	d.writtenLock.Lock()
+	defer d.writtenLock.Unlock()
+	if !ok {
+		// The set was dropped, create it again next time
+		delete(d.written, name)
+		return fmt.Errorf("set '%s' does not exist", name)
+	}
+	d.written[name] = d.now()
+	return nil
+}
+
+// Query returns the estimated unique keys of the metric for the given
+// dimension values, which is zero if no keys have been added
+func (d *DimensionalCounter) Query(metric string, dims Tags) (*CardinalityEstimate, error) {
+	name, err := d.SetName(metric, dims)
+	if err != nil {
+		return nil, err
+	}
+	e, ok, err := d.client.Estimate(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &CardinalityEstimate{}, nil
+	}
+	return e, nil
+}
+
+// Expire is used to drop the sets that have not been written within
+// the TTL, returning the number dropped
+func (d *DimensionalCounter) Expire() (int, error) {
+	if d.ttl == 0 {
+		return 0, nil
+	}
+	cutoff := d.now().Add(-d.ttl)
+	var expired []string
+	d.writtenLock.Lock()
+	for name, last := range d.written {
+		if !last.After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	d.writtenLock.Unlock()
+
+	for idx, name := range expired {
+		cmd, err := NewDropCommand(name)
+		if err != nil {
+			return idx, err
+		}
+		if err := executeWait(d.client, cmd); err != nil {
+			return idx, err
+		}
+		if _, err := cmd.Result(); err != nil {
+			return idx, err
+		}
+		d.writtenLock.Lock()
+		if last, ok := d.written[name]; ok && !last.After(cutoff) {
+			delete(d.written, name)
+		}
+		d.writtenLock.Unlock()
+	}
+	return len(expired), nil
+}
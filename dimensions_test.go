@@ -0,0 +1,125 @@
+package hlld
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDimensionalCounter_Invalid(t *testing.T) {
+	if _, err := NewDimensionalCounter(nil, []string{"a", "a"}, 0, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := NewDimensionalCounter(nil, []string{"metric"}, 0, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := NewDimensionalCounter(nil, []string{"a"}, -time.Second, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestDimensionalCounter_SetName(t *testing.T) {
+	d, err := NewDimensionalCounter(nil, []string{"country", "device"}, 0, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	name, err := d.SetName("users", Tags{"device": "mobile", "country": "us"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if name != "users__us__mobile" {
+		t.Fatalf("bad: %v", name)
+	}
+
+	// Invalid values are hashed deterministically
+	hashed, err := d.SetName("users", Tags{"device": "mobile", "country": "São Paulo"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(hashed, "users___") || !validWord.MatchString(hashed) {
+		t.Fatalf("bad: %v", hashed)
+	}
+	again, _ := d.SetName("users", Tags{"device": "mobile", "country": "São Paulo"})
+	if again != hashed {
+		t.Fatalf("bad: %v %v", again, hashed)
+	}
+
+	// Long combinations are hashed
+	long, err := d.SetName("users", Tags{"device": "mobile", "country": strings.Repeat("a", 200)})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(long) > maxDimensionalName || long == hashed {
+		t.Fatalf("bad: %v", long)
+	}
+
+	if _, err := d.SetName("users", Tags{"country": "us"}); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := d.SetName("users", Tags{"country": "us", "device": "pc", "os": "linux"}); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := d.SetName("bad metric", Tags{"country": "us", "device": "pc"}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestDimensionalCounter(t *testing.T) {
+	addr, closer, sets, lock := windowServer(t)
+	defer closer()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	d, err := NewDimensionalCounter(client, []string{"country"}, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	now := time.Unix(36000, 0)
+	d.now = func() time.Time { return now }
+
+	if err := d.Add("users", Tags{"country": "us"}, "a", "b"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := d.Add("users", Tags{"country": "de"}, "a"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	size, err := d.Query("users", Tags{"country": "us"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if size.Size != 2 {
+		t.Fatalf("bad: %v", size)
+	}
+	size, err = d.Query("users", Tags{"country": "fr"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if size.Size != 0 {
+		t.Fatalf("bad: %v", size)
+	}
+
+	// Only the set not written within the TTL expires
+	now = now.Add(45 * time.Minute)
+	if err := d.Add("users", Tags{"country": "de"}, "c"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	now = now.Add(30 * time.Minute)
+	n, err := d.Expire()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("bad: %v", n)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := sets["users__us"]; ok || len(sets["users__de"]) != 2 {
+		t.Fatalf("bad: %v", sets)
+	}
+}
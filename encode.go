@@ -0,0 +1,117 @@
+package hlld
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// listEntryJSON is the JSON representation of a ListEntry,
+// using the field names of hlld
+type listEntryJSON struct {
+	Name         string  `json:"name"`
+	ErrThreshold float64 `json:"eps"`
+	Precision    int     `json:"precision"`
+	Size         uint64  `json:"size"`
+	Storage      uint64  `json:"storage"`
+	Extra        string  `json:"extra,omitempty"`
+}
+
+// MarshalJSON encodes the entry using the field names of hlld
+func (e ListEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(listEntryJSON(e))
+}
+
+// setInfoJSON is the JSON representation of a SetInfo,
+// using the field names of hlld
+type setInfoJSON struct {
+	InMemory     bool              `json:"in_memory"`
+	PageIns      uint64            `json:"page_ins"`
+	PageOuts     uint64            `json:"page_outs"`
+	ErrThreshold float64           `json:"eps"`
+	Precision    uint64            `json:"precision"`
+	Sets         uint64            `json:"sets"`
+	Size         uint64            `json:"size"`
+	Storage      uint64            `json:"storage"`
+	Extra        map[string]string `json:"extra,omitempty"`
+}
+
+// MarshalJSON encodes the info using the field names of hlld
+func (i SetInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(setInfoJSON(i))
+}
+
+// UnmarshalJSON decodes the info from the field names of hlld
+func (i *SetInfo) UnmarshalJSON(buf []byte) error {
+	var out setInfoJSON
+	if err := json.Unmarshal(buf, &out); err != nil {
+		return err
+	}
+	*i = SetInfo(out)
+	return nil
+}
+
+// listCSVHeader is the header row written by WriteListCSV
+var listCSVHeader = []string{"name", "eps", "precision", "size", "storage"}
+
+// WriteListCSV is used to write list entries as CSV, with a header row
+func WriteListCSV(w io.Writer, entries []*ListEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(listCSVHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		row := []string{
+			e.Name,
+			strconv.FormatFloat(e.ErrThreshold, 'g', -1, 64),
+			strconv.Itoa(e.Precision),
+			strconv.FormatUint(e.Size, 10),
+			strconv.FormatUint(e.Storage, 10),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// infoCSVHeader is the header row written by WriteInfoCSV
+var infoCSVHeader = []string{"name", "in_memory", "page_ins", "page_outs",
+	"eps", "precision", "sets", "size", "storage"}
+
+// WriteInfoCSV is used to write set info by set name as CSV, with a
+// header row. Rows are sorted by set name, and extra fields are omitted.
+func WriteInfoCSV(w io.Writer, infos map[string]*SetInfo) error {
+	names := make([]string, 0, len(infos))
+	for name := range infos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(infoCSVHeader); err != nil {
+		return err
+	}
+	for _, name := range names {
+		i := infos[name]
+		row := []string{
+			name,
+			strconv.FormatBool(i.InMemory),
+			strconv.FormatUint(i.PageIns, 10),
+			strconv.FormatUint(i.PageOuts, 10),
+			strconv.FormatFloat(i.ErrThreshold, 'g', -1, 64),
+			strconv.FormatUint(i.Precision, 10),
+			strconv.FormatUint(i.Sets, 10),
+			strconv.FormatUint(i.Size, 10),
+			strconv.FormatUint(i.Storage, 10),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
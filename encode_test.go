@@ -0,0 +1,79 @@
+package hlld
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestListEntry_MarshalJSON(t *testing.T) {
+	entries := []*ListEntry{{Name: "foo", ErrThreshold: 0.01, Precision: 12, Size: 100, Storage: 3280}}
+	out, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := `[{"name":"foo","eps":0.01,"precision":12,"size":100,"storage":3280}]`
+	if string(out) != expect {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestSetInfo_MarshalJSON(t *testing.T) {
+	info := &SetInfo{InMemory: true, Precision: 12, Size: 100, Extra: map[string]string{"foo": "bar"}}
+	out, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := `{"in_memory":true,"page_ins":0,"page_outs":0,"eps":0,"precision":12,"sets":0,"size":100,"storage":0,"extra":{"foo":"bar"}}`
+	if string(out) != expect {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestSetInfo_UnmarshalJSON(t *testing.T) {
+	info := &SetInfo{InMemory: true, ErrThreshold: 0.01, Precision: 12, Size: 100, Extra: map[string]string{"foo": "bar"}}
+	buf, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var out SetInfo
+	if err := json.Unmarshal(buf, &out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(&out, info) {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestWriteListCSV(t *testing.T) {
+	var buf bytes.Buffer
+	entries := []*ListEntry{
+		{Name: "foo", ErrThreshold: 0.01, Precision: 12, Size: 100, Storage: 3280},
+		{Name: "bar", ErrThreshold: 0.02, Precision: 10, Size: 5, Storage: 820},
+	}
+	if err := WriteListCSV(&buf, entries); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := "name,eps,precision,size,storage\nfoo,0.01,12,100,3280\nbar,0.02,10,5,820\n"
+	if buf.String() != expect {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestWriteInfoCSV(t *testing.T) {
+	var buf bytes.Buffer
+	infos := map[string]*SetInfo{
+		"foo": {InMemory: true, Precision: 12, Size: 100},
+		"bar": {Precision: 10, Size: 5},
+	}
+	if err := WriteInfoCSV(&buf, infos); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := "name,in_memory,page_ins,page_outs,eps,precision,sets,size,storage\n" +
+		"bar,false,0,0,0,10,0,5,0\n" +
+		"foo,true,0,0,0,12,0,100,0\n"
+	if buf.String() != expect {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
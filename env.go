@@ -0,0 +1,140 @@
+package hlld
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultAddr is the address used if none is configured
+	DefaultAddr = "127.0.0.1:4553"
+
+	// EnvAddr is the environment variable with the server address
+	EnvAddr = "HLLD_ADDR"
+
+	// EnvTimeout is the environment variable with the read or write
+	// timeout, as a duration such as "5s"
+	EnvTimeout = "HLLD_TIMEOUT"
+
+	// EnvEnqueueTimeout is the environment variable with the maximum
+	// time to wait to queue a command, as a duration such as "1s"
+	EnvEnqueueTimeout = "HLLD_ENQUEUE_TIMEOUT"
+
+	// EnvMaxPipeline is the environment variable with the maximum
+	// number of commands to pipeline
+	EnvMaxPipeline = "HLLD_MAX_PIPELINE"
+
+	// EnvTLS is the environment variable that enables TLS if true
+	EnvTLS = "HLLD_TLS"
+
+	// EnvTLSCACert is the environment variable with the path to a
+	// PEM encoded CA certificate used to verify the server
+	EnvTLSCACert = "HLLD_TLS_CA_CERT"
+
+	// EnvTLSClientCert is the environment variable with the path to
+	// a PEM encoded client certificate
+	EnvTLSClientCert = "HLLD_TLS_CLIENT_CERT"
+
+	// EnvTLSClientKey is the environment variable with the path to
+	// the PEM encoded key of the client certificate
+	EnvTLSClientKey = "HLLD_TLS_CLIENT_KEY"
+
+	// EnvTLSServerName is the environment variable with the server
+	// name used to verify the server certificate
+	EnvTLSServerName = "HLLD_TLS_SERVER_NAME"
+
+	// EnvTLSSkipVerify is the environment variable that disables
+	// verification of the server certificate if true
+	EnvTLSSkipVerify = "HLLD_TLS_SKIP_VERIFY"
+)
+
+// AddrFromEnv returns the server address from the environment,
+// or the default address if it is not set
+func AddrFromEnv() string {
+	if addr := os.Getenv(EnvAddr); addr != "" {
+		return addr
+	}
+	return DefaultAddr
+}
+
+// ConfigFromEnv returns a configuration populated from the environment.
+// Fields without a matching environment variable are left unspecified,
+// and MergeDefaults can be used to populate them.
+func ConfigFromEnv() (*Config, error) {
+	conf := &Config{}
+	if v := os.Getenv(EnvTimeout); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", EnvTimeout, err)
+		}
+		conf.Timeout = timeout
+	}
+	if v := os.Getenv(EnvEnqueueTimeout); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", EnvEnqueueTimeout, err)
+		}
+		conf.EnqueueTimeout = timeout
+	}
+	if v := os.Getenv(EnvMaxPipeline); v != "" {
+		max, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", EnvMaxPipeline, err)
+		}
+		conf.MaxPipeline = max
+	}
+
+	tlsConf, err := tlsConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	conf.TLSConfig = tlsConf
+	return conf, nil
+}
+
+// tlsConfigFromEnv returns the TLS configuration from the
+// environment, or nil if TLS is not enabled
+func tlsConfigFromEnv() (*tls.Config, error) {
+	enabled, err := envBool(EnvTLS)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	skipVerify, err := envBool(EnvTLSSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	opts := &TLSOptions{
+		CACert:     os.Getenv(EnvTLSCACert),
+		ClientCert: os.Getenv(EnvTLSClientCert),
+		ClientKey:  os.Getenv(EnvTLSClientKey),
+		ServerName: os.Getenv(EnvTLSServerName),
+		SkipVerify: skipVerify,
+	}
+	return opts.Config()
+}
+
+// envBool is used to parse a boolean environment variable
+func envBool(name string) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// DialEnv is used to dial the server configured by the environment
+func DialEnv() (*Client, error) {
+	conf, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	conf.MergeDefaults()
+	return DialConfig(AddrFromEnv(), conf)
+}
@@ -0,0 +1,98 @@
+package hlld
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// setEnv sets environment variables for the duration of a test
+func setEnv(t *testing.T, vars map[string]string) func() {
+	for k, v := range vars {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	return func() {
+		for k := range vars {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestAddrFromEnv(t *testing.T) {
+	if addr := AddrFromEnv(); addr != DefaultAddr {
+		t.Fatalf("bad: %s", addr)
+	}
+	defer setEnv(t, map[string]string{EnvAddr: "hlld:1234"})()
+	if addr := AddrFromEnv(); addr != "hlld:1234" {
+		t.Fatalf("bad: %s", addr)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		EnvTimeout:        "1s",
+		EnvEnqueueTimeout: "100ms",
+		EnvMaxPipeline:    "128",
+		EnvTLS:            "true",
+		EnvTLSServerName:  "hlld.local",
+		EnvTLSSkipVerify:  "1",
+	})()
+
+	conf, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf.Timeout != time.Second || conf.MaxPipeline != 128 {
+		t.Fatalf("bad: %#v", conf)
+	}
+	if conf.EnqueueTimeout != 100*time.Millisecond {
+		t.Fatalf("bad: %#v", conf)
+	}
+	if conf.TLSConfig == nil {
+		t.Fatalf("missing TLS config")
+	}
+	if conf.TLSConfig.ServerName != "hlld.local" || !conf.TLSConfig.InsecureSkipVerify {
+		t.Fatalf("bad: %#v", conf.TLSConfig)
+	}
+}
+
+func TestConfigFromEnv_Partial(t *testing.T) {
+	defer setEnv(t, map[string]string{EnvMaxPipeline: "128"})()
+
+	conf, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf.TLSConfig != nil {
+		t.Fatalf("bad: %#v", conf.TLSConfig)
+	}
+
+	conf.MergeDefaults()
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf.MaxPipeline != 128 || conf.Timeout != DefaultConfig().Timeout {
+		t.Fatalf("bad: %#v", conf)
+	}
+}
+
+func TestConfigFromEnv_Invalid(t *testing.T) {
+	cases := []map[string]string{
+		{EnvTimeout: "forever"},
+		{EnvEnqueueTimeout: "forever"},
+		{EnvMaxPipeline: "many"},
+		{EnvTLS: "maybe"},
+		{EnvTLS: "true", EnvTLSCACert: "/does/not/exist"},
+		{EnvTLS: "true", EnvTLSClientCert: "/does/not/exist"},
+	}
+	for _, tc := range cases {
+		reset := setEnv(t, tc)
+		_, err := ConfigFromEnv()
+		reset()
+		if err == nil {
+			t.Fatalf("expect error: %v", tc)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package hlld
+
+import (
+	"fmt"
+)
+
+// The errors returned by the client fall into a few categories, which
+// can be matched with errors.Is and errors.As across versions. Errors
+// from the standard library, such as network errors and context errors,
+// are wrapped rather than replaced.
+//
+// Errors of the client itself are the sentinels ErrClientClosed,
+// ErrShuttingDown, ErrConnectionLost and ErrEnqueueTimeout. Errors of
+// the connection are *DialError, and ErrHandshakeFailed when the
+// configured handshake fails. Errors of the server are ErrInvalidResponse
+// when a response cannot be decoded, and ErrNotDecoded when a result is
+// read before the command completes. Errors of the caller are
+// *ValidationError for invalid arguments, *LimitError for commands
+// beyond the configured limits, *ConfigError for invalid
+// configurations, and ErrStaleFuture for released futures.
+var (
+	// ErrClientClosed is used if the client is closed
+	ErrClientClosed = fmt.Errorf("client closed")
+
+	// ErrConnectionLost is used if a command was written to a connection
+	// that was replaced or lost before any of the response was received
+	ErrConnectionLost = fmt.Errorf("connection lost before response")
+
+	// ErrShuttingDown is used if a command is executed while
+	// the client is shutting down
+	ErrShuttingDown = fmt.Errorf("client shutting down")
+
+	// ErrEnqueueTimeout is used if a command could not be queued for
+	// writing within the EnqueueTimeout, usually because the connection
+	// is stalled
+	ErrEnqueueTimeout = fmt.Errorf("timed out enqueuing command")
+
+	// ErrHandshakeFailed wraps the error of the configured handshake
+	ErrHandshakeFailed = fmt.Errorf("handshake failed")
+
+	// ErrInvalidResponse is used if a response from the
+	// server is unexpected or cannot be parsed
+	ErrInvalidResponse = fmt.Errorf("invalid response")
+
+	// ErrNotDecoded is used if the result of a command is
+	// read before its response is decoded
+	ErrNotDecoded = fmt.Errorf("result not decoded yet")
+
+	// ErrStaleFuture is used if a PooledFuture is used after
+	// it has been released
+	ErrStaleFuture = fmt.Errorf("future used after release")
+)
@@ -0,0 +1,42 @@
+package hlld
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestErrors_Wrapped(t *testing.T) {
+	cmd, _ := NewDropCommand("foo")
+	if _, err := cmd.Result(); !errors.Is(err, ErrNotDecoded) {
+		t.Fatalf("err: %v", err)
+	}
+
+	cmd.result = "Internal Error\n"
+	_, err := cmd.Result()
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("err: %v", err)
+	}
+	if err.Error() != "invalid response: Internal Error\n" {
+		t.Fatalf("bad: %q", err.Error())
+	}
+
+	le := &ListEntry{}
+	if err := parseListEntryInto(le, "foo bar"); !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestDialError_Unwrap(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	var err error = &DialError{Errors: []error{fmt.Errorf("timeout"), refused}}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("err: %v", err)
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr != refused {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package hlld
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// Sigmas95 is the number of standard errors of an
+	// interval with 95% confidence
+	Sigmas95 = 1.96
+)
+
+// CardinalityEstimate is an estimated number of unique keys along with
+// its expected error, which is determined by the precision of the set.
+// It allows the uncertainty of an estimate to be presented honestly,
+// rather than as an exact count.
+type CardinalityEstimate struct {
+	// Size is the point estimate
+	Size uint64
+
+	// Precision is the precision of the set, or zero if unknown
+	Precision uint64
+
+	// StdError is the relative standard error of the estimate
+	StdError float64
+}
+
+// Estimate returns the size of the set with its expected error. The
+// error threshold of the set is used if the precision is unknown.
+func (i *SetInfo) Estimate() *CardinalityEstimate {
+	e := &CardinalityEstimate{
+		Size:      i.Size,
+		Precision: i.Precision,
+		StdError:  i.ErrThreshold,
+	}
+	if i.Precision > 0 {
+		e.StdError = TheoreticalError(i.Precision)
+	}
+	return e
+}
+
+// Margin returns the absolute error of the estimate
+// within the given number of standard errors
+func (e *CardinalityEstimate) Margin(sigmas float64) float64 {
+	return sigmas * e.StdError * float64(e.Size)
+}
+
+// Interval returns the bounds of the estimate within the given number
+// of standard errors, such as Sigmas95. The bounds are rounded outwards,
+// and the lower bound is never negative.
+func (e *CardinalityEstimate) Interval(sigmas float64) (lower, upper uint64) {
+	margin := e.Margin(sigmas)
+	size := float64(e.Size)
+	if margin < size {
+		lower = uint64(math.Floor(size - margin))
+	}
+	upper = uint64(math.Ceil(size + margin))
+	return lower, upper
+}
+
+// String formats the estimate with its 95% margin of error,
+// such as "10000 ±3.2%"
+func (e *CardinalityEstimate) String() string {
+	return fmt.Sprintf("%d ±%.1f%%", e.Size, 100*Sigmas95*e.StdError)
+}
+
+// Estimate is used to read the size of a set with its expected error.
+// It returns false if the set does not exist.
+func (c *Client) Estimate(name string) (*CardinalityEstimate, bool, error) {
+	cmd, err := NewInfoCommand(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := executeWait(c, cmd); err != nil {
+		return nil, false, err
+	}
+	info, ok, err := cmd.Result()
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return info.Estimate(), true, nil
+}
@@ -0,0 +1,63 @@
+package hlld
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetInfo_Estimate(t *testing.T) {
+	info := &SetInfo{Size: 10000, Precision: 12, ErrThreshold: 0.5}
+	e := info.Estimate()
+	if e.Size != 10000 || e.Precision != 12 || e.StdError != TheoreticalError(12) {
+		t.Fatalf("bad: %#v", e)
+	}
+
+	// 1.04 / 64 = 1.625% per standard error
+	lower, upper := e.Interval(1)
+	if lower != 9837 || upper != 10163 {
+		t.Fatalf("bad: %d %d", lower, upper)
+	}
+	if e.String() != "10000 ±3.2%" {
+		t.Fatalf("bad: %s", e.String())
+	}
+
+	// The error threshold is used without a precision
+	info = &SetInfo{Size: 100, ErrThreshold: 0.6}
+	e = info.Estimate()
+	if e.StdError != 0.6 {
+		t.Fatalf("bad: %#v", e)
+	}
+	lower, upper = e.Interval(Sigmas95)
+	if lower != 0 || upper != 218 {
+		t.Fatalf("bad: %d %d", lower, upper)
+	}
+}
+
+func TestClient_Estimate(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line == "info foo\n" {
+			return "START\nprecision 14\nsize 500\nEND\n"
+		}
+		return "Set does not exist\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	e, ok, err := client.Estimate("foo")
+	if err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if e.Size != 500 || e.Precision != 14 || !strings.HasPrefix(e.String(), "500 ±1.6%") {
+		t.Fatalf("bad: %#v", e)
+	}
+
+	e, ok, err = client.Estimate("bar")
+	if err != nil || ok || e != nil {
+		t.Fatalf("bad: %v %v %v", e, ok, err)
+	}
+}
@@ -0,0 +1,83 @@
+package hlld
+
+import (
+	"time"
+)
+
+const (
+	// eventBuffer is the number of events buffered before
+	// new events are discarded
+	eventBuffer = 64
+)
+
+// EventType is the type of a lifecycle event
+type EventType int
+
+const (
+	// EventConnected is emitted when a connection is established
+	EventConnected EventType = iota
+
+	// EventDisconnected is emitted when the connection is closed
+	EventDisconnected
+
+	// EventReconnecting is emitted when a new connection is
+	// being established to replace a failed one
+	EventReconnecting
+
+	// EventPipelineStalled is emitted when a command must wait
+	// because the maximum number of commands are pipelined
+	EventPipelineStalled
+
+	// EventProtocolError is emitted when a response could not be decoded
+	EventProtocolError
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventReconnecting:
+		return "reconnecting"
+	case EventPipelineStalled:
+		return "pipeline-stalled"
+	case EventProtocolError:
+		return "protocol-error"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a lifecycle event of a client
+type Event struct {
+	// Type is the type of the event
+	Type EventType
+
+	// Time is when the event occurred
+	Time time.Time
+
+	// Err is the error that caused the event, if any
+	Err error
+}
+
+// Events returns a channel of lifecycle events, which can be used to
+// integrate connectivity into health checks and alerting. Events are
+// discarded if the channel is not drained. The channel is never closed.
+func (c *Client) Events() <-chan Event {
+	return c.eventCh
+}
+
+// emit is used to publish an event without blocking
+func (c *Client) emit(typ EventType, err error) {
+	e := Event{
+		Type: typ,
+		Time: time.Now(),
+		Err:  err,
+	}
+	select {
+	case c.eventCh <- e:
+	default:
+	}
+	c.logEvent(e)
+}
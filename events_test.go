@@ -0,0 +1,95 @@
+package hlld
+
+import (
+	"testing"
+	"time"
+)
+
+// expectEvent waits for an event of the given type
+func expectEvent(t *testing.T, client *Client, typ EventType) Event {
+	select {
+	case e := <-client.Events():
+		if e.Type != typ {
+			t.Fatalf("bad: %v (expected: %v)", e.Type, typ)
+		}
+		if e.Time.IsZero() {
+			t.Fatalf("missing time")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for %v", typ)
+	}
+	return Event{}
+}
+
+func TestEventType_String(t *testing.T) {
+	if s := EventPipelineStalled.String(); s != "pipeline-stalled" {
+		t.Fatalf("bad: %s", s)
+	}
+	if s := EventType(100).String(); s != "unknown" {
+		t.Fatalf("bad: %s", s)
+	}
+}
+
+func TestClient_Events(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "bad\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+	expectEvent(t, client, EventConnected)
+
+	// A decode failure is a protocol error
+	list, _ := NewListCommand("")
+	f, err := client.Execute(list)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err == nil {
+		t.Fatalf("expect error")
+	}
+	e := expectEvent(t, client, EventProtocolError)
+	if e.Err == nil {
+		t.Fatalf("missing error")
+	}
+	expectEvent(t, client, EventDisconnected)
+}
+
+func TestClient_EventsPipelineStalled(t *testing.T) {
+	releaseCh := make(chan struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		<-releaseCh
+		return "Done\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.MaxPipeline = 1
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+	expectEvent(t, client, EventConnected)
+
+	// The first command is held by the reader, the second fills the
+	// pipeline and the third must wait
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for i := 0; i < 3; i++ {
+			drop, _ := NewDropCommand("foo")
+			if _, err := client.Execute(drop); err != nil {
+				t.Errorf("err: %v", err)
+			}
+		}
+	}()
+	expectEvent(t, client, EventPipelineStalled)
+	close(releaseCh)
+	<-doneCh
+}
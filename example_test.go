@@ -0,0 +1,312 @@
+package hlld_test
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hlldserver"
+)
+
+// The examples are run against embedded servers, so their output is
+// checked by go test. Runnable programs are in the examples directory.
+
+// startServer is used to start an embedded server for an example,
+// returning its address and a function to stop it
+func startServer() (string, func()) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	conf := hlldserver.DefaultConfig()
+	conf.SnapshotInterval = 0
+	server, err := hlldserver.NewServer(list, conf)
+	if err != nil {
+		panic(err)
+	}
+	return server.Addr().String(), func() { server.Close() }
+}
+
+func Example() {
+	addr, stop := startServer()
+	defer stop()
+
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+
+	if _, err := client.CreateSet("visitors", nil); err != nil {
+		panic(err)
+	}
+	set, _ := hlld.NewSetKeysCommand("visitors", []string{"alice", "bob"})
+	f, err := client.Execute(set)
+	if err != nil {
+		panic(err)
+	}
+	if err := f.Error(); err != nil {
+		panic(err)
+	}
+
+	info, _ := hlld.NewInfoCommand("visitors")
+	f, err = client.Execute(info)
+	if err != nil {
+		panic(err)
+	}
+	if err := f.Error(); err != nil {
+		panic(err)
+	}
+	setInfo, _, _ := info.Result()
+	fmt.Println(setInfo.Size)
+	// Output: 2
+}
+
+func ExampleClient_ExecuteNoReply() {
+	addr, stop := startServer()
+	defer stop()
+
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+	if _, err := client.CreateSet("visitors", nil); err != nil {
+		panic(err)
+	}
+
+	// Pipeline writes without waiting for, or allocating, their futures
+	for _, batch := range [][]string{{"a", "b"}, {"c", "d"}} {
+		cmd, _ := hlld.NewSetKeysCommand("visitors", batch)
+		if err := client.ExecuteNoReply(cmd); err != nil {
+			panic(err)
+		}
+	}
+
+	// The commands are ordered, so the writes are applied before the info
+	info, _ := hlld.NewInfoCommand("visitors")
+	f, err := client.Execute(info)
+	if err != nil {
+		panic(err)
+	}
+	if err := f.Error(); err != nil {
+		panic(err)
+	}
+	setInfo, _, _ := info.Result()
+	fmt.Println(setInfo.Size)
+
+	// Wait for the pipeline to drain before exiting
+	if err := client.Shutdown(context.Background()); err != nil {
+		panic(err)
+	}
+	// Output: 4
+}
+
+func ExampleClient_Group() {
+	addr, stop := startServer()
+	defer stop()
+
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+	for _, name := range []string{"daily", "weekly"} {
+		if _, err := client.CreateSet(name, nil); err != nil {
+			panic(err)
+		}
+	}
+
+	// Fan out to several sets, without leaking futures past the request
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	g := client.Group(ctx)
+	var infos []*hlld.InfoCommand
+	for _, name := range []string{"daily", "weekly", "monthly"} {
+		info, _ := hlld.NewInfoCommand(name)
+		if _, err := g.Execute(info); err != nil {
+			break
+		}
+		infos = append(infos, info)
+	}
+	if err := g.Wait(); err != nil {
+		panic(err)
+	}
+	for _, info := range infos {
+		setInfo, ok, err := info.Result()
+		if err == nil && ok {
+			fmt.Println(info.SetName, setInfo.Size)
+		}
+	}
+	// Output:
+	// daily 0
+	// weekly 0
+}
+
+func ExampleSlidingWindow() {
+	addr, stop := startServer()
+	defer stop()
+
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+
+	// Unique visitors over the last hour, to within 15 minutes
+	w, err := hlld.NewSlidingWindow(client, "visitors", time.Hour, 4, nil)
+	if err != nil {
+		panic(err)
+	}
+	if err := w.Add("alice", "bob"); err != nil {
+		panic(err)
+	}
+	size, err := w.Estimate()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(size)
+
+	// Periodically drop the buckets that have left the window
+	if _, err := w.Expire(); err != nil {
+		panic(err)
+	}
+	// Output: 2 ±3.2%
+}
+
+func ExampleDimensionalCounter() {
+	addr, stop := startServer()
+	defer stop()
+
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+
+	// Unique users by country and device, dropping idle sets after a day
+	d, err := hlld.NewDimensionalCounter(client, []string{"country", "device"}, 24*time.Hour, nil)
+	if err != nil {
+		panic(err)
+	}
+	dims := hlld.Tags{"country": "us", "device": "mobile"}
+	if err := d.Add("users", dims, "alice"); err != nil {
+		panic(err)
+	}
+	size, err := d.Query("users", dims)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(size)
+	// Output: 1 ±3.2%
+}
+
+func ExamplePool() {
+	addr, stop := startServer()
+	defer stop()
+
+	pool, err := hlld.DialPool(addr, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	// Commands for the same set are ordered on the same connection
+	create, _ := hlld.NewCreateCommand("visitors")
+	drop, _ := hlld.NewDropCommand("visitors")
+	for _, cmd := range []hlld.Command{create, drop} {
+		f, err := pool.ExecuteOrdered(cmd)
+		if err != nil {
+			panic(err)
+		}
+		if err := f.Error(); err != nil {
+			panic(err)
+		}
+	}
+	fmt.Println(drop.Result())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != nil {
+		panic(err)
+	}
+	// Output: true <nil>
+}
+
+func ExampleBroadcast() {
+	servers := make(map[string]hlld.Executor)
+	for _, name := range []string{"east", "west"} {
+		addr, stop := startServer()
+		defer stop()
+		client, err := hlld.Dial(addr)
+		if err != nil {
+			panic(err)
+		}
+		defer client.Close()
+		servers[name] = client
+	}
+
+	// Create the set on every server of the cluster
+	results := hlld.Broadcast(servers, func() (hlld.Command, error) {
+		return hlld.NewCreateCommand("visitors")
+	})
+	for _, result := range results {
+		fmt.Println(result.Name, result.Err)
+	}
+	// Output:
+	// east <nil>
+	// west <nil>
+}
+
+func ExampleHedgedInfo() {
+	var replicas []hlld.Replica
+	for i := 0; i < 2; i++ {
+		addr, stop := startServer()
+		defer stop()
+		client, err := hlld.Dial(addr)
+		if err != nil {
+			panic(err)
+		}
+		defer client.Close()
+		if _, err := client.CreateSet("visitors", nil); err != nil {
+			panic(err)
+		}
+		replicas = append(replicas, hlld.Replica{Client: client, SetName: "visitors"})
+	}
+
+	// Read from the first replica, falling back to the second if the
+	// first is slow to respond
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	info, ok, err := hlld.HedgedInfo(ctx, replicas, nil)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(ok, info.Size)
+	// Output: true 0
+}
+
+func ExampleClient_PublishExpvar() {
+	addr, stop := startServer()
+	defer stop()
+
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+
+	// Embed the counters of the client in the metrics of the application,
+	// which are served at /debug/vars by net/http
+	name, err := client.PublishExpvar("hlld")
+	if err != nil {
+		panic(err)
+	}
+	if _, err := client.CreateSet("visitors", nil); err != nil {
+		panic(err)
+	}
+	fmt.Println(expvar.Get(name))
+	// Output: {"commands":1,"errors":0,"reconnects":0,"pending":0}
+}
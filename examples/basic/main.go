@@ -0,0 +1,73 @@
+// basic creates a set, adds keys to it, and prints its estimated size.
+//
+//	go run ./examples/basic -addr 127.0.0.1:4553
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/armon/go-hlld"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:4553", "address of the hlld server")
+	flag.Parse()
+	if err := run(*addr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(addr string) error {
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// Create the set, which succeeds if it already exists
+	ok, err := client.CreateSet("example-basic", &hlld.CreateOptions{Precision: 14})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("set is being deleted, try again")
+	}
+
+	// Add some keys, with duplicates
+	set, err := hlld.NewSetKeysCommand("example-basic", []string{"alice", "bob", "alice", "carol"})
+	if err != nil {
+		return err
+	}
+	f, err := client.Execute(set)
+	if err != nil {
+		return err
+	}
+	if err := f.Error(); err != nil {
+		return err
+	}
+	if _, err := set.Result(); err != nil {
+		return err
+	}
+
+	// Read back the estimate
+	info, err := hlld.NewInfoCommand("example-basic")
+	if err != nil {
+		return err
+	}
+	f, err = client.Execute(info)
+	if err != nil {
+		return err
+	}
+	if err := f.Error(); err != nil {
+		return err
+	}
+	setInfo, _, err := info.Result()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("example-basic has about %d unique keys\n", setInfo.Size)
+	return nil
+}
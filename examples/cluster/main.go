@@ -0,0 +1,62 @@
+// cluster creates a set on every server of a cluster, then reads its
+// estimated size from the first replica to respond.
+//
+//	go run ./examples/cluster -addrs hlld-a:4553,hlld-b:4553
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+func main() {
+	addrs := flag.String("addrs", "127.0.0.1:4553", "comma separated addresses of the hlld servers")
+	flag.Parse()
+	if err := run(strings.Split(*addrs, ",")); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(addrs []string) error {
+	servers := make(map[string]hlld.Executor)
+	var replicas []hlld.Replica
+	for _, addr := range addrs {
+		client, err := hlld.Dial(addr)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		servers[addr] = client
+		replicas = append(replicas, hlld.Replica{Client: client, SetName: "example-cluster"})
+	}
+
+	// Create the set on every server, reporting each failure
+	results := hlld.Broadcast(servers, func() (hlld.Command, error) {
+		return hlld.NewCreateCommand("example-cluster")
+	})
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%s: %v\n", result.Name, result.Err)
+		}
+	}
+
+	// Read from the first replica, hedging to the next if it is slow
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	info, ok, err := hlld.HedgedInfo(ctx, replicas, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("set does not exist")
+	}
+	fmt.Printf("example-cluster has about %d unique keys\n", info.Size)
+	return nil
+}
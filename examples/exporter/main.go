@@ -0,0 +1,41 @@
+// exporter embeds the counters of a client in the metrics of an
+// application, served by net/http at /debug/vars.
+//
+//	go run ./examples/exporter -listen 127.0.0.1:8080
+//	curl http://127.0.0.1:8080/debug/vars
+package main
+
+import (
+	_ "expvar"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/armon/go-hlld"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:4553", "address of the hlld server")
+	listen := flag.String("listen", "127.0.0.1:8080", "address to serve the metrics on")
+	flag.Parse()
+	if err := run(*addr, *listen); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(addr, listen string) error {
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	name, err := client.PublishExpvar("hlld")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving the counters of the client as %q\n", name)
+	return http.ListenAndServe(listen, nil)
+}
@@ -0,0 +1,83 @@
+// pipeline ingests keys read from stdin, one per line, pipelining batches
+// of keys to the server without waiting for each response.
+//
+//	seq 1 100000 | go run ./examples/pipeline -addr 127.0.0.1:4553
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/armon/go-hlld"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:4553", "address of the hlld server")
+	name := flag.String("set", "example-pipeline", "name of the set to add keys to")
+	batch := flag.Int("batch", 1024, "number of keys per command")
+	flag.Parse()
+	if err := run(*addr, *name, *batch); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(addr, name string, batch int) error {
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if _, err := client.CreateSet(name, nil); err != nil {
+		return err
+	}
+
+	// The responses are never read, so the futures are recycled
+	keys := make([]string, 0, batch)
+	send := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		cmd, err := hlld.NewSetKeysCommand(name, keys)
+		if err != nil {
+			return err
+		}
+		keys = make([]string, 0, batch)
+		return client.ExecuteNoReply(cmd)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	var total int
+	for scanner.Scan() {
+		keys = append(keys, scanner.Text())
+		total++
+		if len(keys) == batch {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := send(); err != nil {
+		return err
+	}
+
+	// A flush waits for every pipelined command before it
+	flush, err := hlld.NewFlushCommand(name)
+	if err != nil {
+		return err
+	}
+	f, err := client.Execute(flush)
+	if err != nil {
+		return err
+	}
+	if err := f.Error(); err != nil {
+		return err
+	}
+	fmt.Printf("Sent %d keys to %s\n", total, name)
+	return nil
+}
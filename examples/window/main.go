@@ -0,0 +1,71 @@
+// window counts the unique keys read from stdin over a trailing window,
+// printing the estimate every second.
+//
+//	tail -f access.log | awk '{print $1}' | go run ./examples/window -window 5m
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:4553", "address of the hlld server")
+	window := flag.Duration("window", 5*time.Minute, "trailing window to count over")
+	buckets := flag.Int("buckets", 5, "number of overlapping buckets")
+	flag.Parse()
+	if err := run(*addr, *window, *buckets); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(addr string, window time.Duration, buckets int) error {
+	client, err := hlld.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	w, err := hlld.NewSlidingWindow(client, "example-window", window, buckets, nil)
+	if err != nil {
+		return err
+	}
+
+	lines := make(chan string)
+	errCh := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		errCh <- scanner.Err()
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case line := <-lines:
+			if err := w.Add(line); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			size, err := w.Estimate()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%v unique in the last %v\n", size, window)
+			if _, err := w.Expire(); err != nil {
+				return err
+			}
+		case err := <-errCh:
+			return err
+		}
+	}
+}
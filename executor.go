@@ -0,0 +1,14 @@
+package hlld
+
+// Executor is implemented by the Client, the Pool and the SharedClient.
+// Applications can depend on it rather than a concrete type, so that a
+// fake such as the hlldtest.FailingClient can be substituted in tests.
+type Executor interface {
+	Execute(cmd Command) (*Future, error)
+}
+
+var (
+	_ Executor = (*Client)(nil)
+	_ Executor = (*Pool)(nil)
+	_ Executor = (*SharedClient)(nil)
+)
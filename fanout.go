@@ -0,0 +1,60 @@
+package hlld
+
+import (
+	"sort"
+)
+
+// AddToSets is used to add keys to many sets at once, such as when an
+// event fans out to a set per dimension. Every command is validated and
+// pipelined before any result is awaited, so the sets are written in a
+// single round trip. With a Pool, the commands are spread over the
+// connections by set. The result maps each set to whether the keys were
+// added, which is false if the set does not exist. If any command fails,
+// the first error is returned once every command completes.
+func AddToSets(exec Executor, sets map[string][]string) (map[string]bool, error) {
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cmds := make([]*SetKeysCommand, len(names))
+	for idx, name := range names {
+		cmd, err := NewSetKeysCommand(name, sets[name])
+		if err != nil {
+			return nil, err
+		}
+		cmds[idx] = cmd
+	}
+
+	futures := make([]*Future, 0, len(cmds))
+	var firstErr error
+	for _, cmd := range cmds {
+		f, err := exec.Execute(cmd)
+		if err != nil {
+			firstErr = err
+			break
+		}
+		futures = append(futures, f)
+	}
+
+	out := make(map[string]bool, len(futures))
+	for idx, f := range futures {
+		err := f.Error()
+		var ok bool
+		if err == nil {
+			ok, err = cmds[idx].Result()
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		out[cmds[idx].SetName] = ok
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
@@ -0,0 +1,82 @@
+package hlld
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAddToSets(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		lines = append(lines, line)
+		lock.Unlock()
+		if strings.HasPrefix(line, "b missing") {
+			return "Set does not exist\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	pool, err := DialPool(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	out, err := AddToSets(pool, map[string][]string{
+		"foo":     {"a", "b"},
+		"bar":     {"a"},
+		"missing": {"a"},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := map[string]bool{"foo": true, "bar": true, "missing": false}
+	if !reflect.DeepEqual(out, expect) {
+		t.Fatalf("bad: %v", out)
+	}
+
+	lock.Lock()
+	sort.Strings(lines)
+	if strings.Join(lines, "") != "b bar a\nb foo a b\nb missing a\n" {
+		t.Fatalf("bad: %q", lines)
+	}
+	lock.Unlock()
+
+	// Nothing is sent if any set is invalid
+	_, err = AddToSets(pool, map[string][]string{"foo": {"a"}, "bad name": {"a"}})
+	if err == nil {
+		t.Fatalf("expect error")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(lines) != 3 {
+		t.Fatalf("bad: %q", lines)
+	}
+}
+
+func TestAddToSets_Error(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if strings.HasPrefix(line, "b foo") {
+			return "Bad\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	_, err = AddToSets(client, map[string][]string{"foo": {"a"}, "bar": {"a"}})
+	if err == nil || !strings.Contains(err.Error(), "Bad") {
+		t.Fatalf("err: %v", err)
+	}
+}
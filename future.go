@@ -1,10 +1,112 @@
 package hlld
 
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// noReplyFutures is used to recycle the futures of commands
+	// whose results are never read
+	noReplyFutures = sync.Pool{
+		New: func() interface{} {
+			return &Future{noReply: true}
+		},
+	}
+
+	// pooledFutures is used to recycle the futures
+	// released by the holders of a PooledFuture
+	pooledFutures = sync.Pool{
+		New: func() interface{} {
+			return &Future{readyCh: make(chan struct{}, 1)}
+		},
+	}
+)
+
+// futureKind is the kind of future used to execute a command
+type futureKind int
+
+const (
+	// futureDefault is a future allocated for a single command
+	futureDefault futureKind = iota
+
+	// futureNoReply is recycled once the response is decoded
+	futureNoReply
+
+	// futurePooled is recycled once released by its holder
+	futurePooled
+
+	// futureParked is completed with a WaitGroup rather than a channel
+	futureParked
+)
+
+// watchState is the state of a future executed with a context
+const (
+	// unwatched futures are not executed with a context
+	unwatched int32 = iota
+
+	// watching futures fail if their context ends first
+	watching
+
+	// watchDone futures were completed or failed by their context
+	watchDone
+)
+
 // Future is used to wrap a command and return a future
 type Future struct {
 	cmd    Command
 	err    error
 	doneCh chan struct{}
+
+	// deadline is the optional deadline to decode the response by
+	deadline time.Time
+
+	// watch is the watchState of a future executed with a context, and
+	// is updated atomically. stopWatch unregisters the function that
+	// fails the future once the context is done, and cancel releases
+	// the context derived for an earlier deadline, if any.
+	watch     int32
+	stopWatch func() bool
+	cancel    context.CancelFunc
+
+	// labels are the optional labels of the operation
+	labels map[string]string
+
+	// noReply is set if the future is recycled once complete
+	noReply bool
+
+	// readyCh is signaled instead of closing doneCh for pooled
+	// futures, so the channel can be reused. use is the number of
+	// times the future has been released, and waited is set once the
+	// holder has received the signal.
+	readyCh chan struct{}
+	use     uint64
+	waited  bool
+
+	// parked is set if waiters are parked on wg rather than doneCh,
+	// which avoids allocating a channel for every command. A waiter with
+	// a timeout instead creates parkCh, which is closed on completion.
+	// parkCh and parkDone are guarded by parkLock.
+	parked   bool
+	wg       sync.WaitGroup
+	parkCh   chan struct{}
+	parkDone bool
+	parkLock sync.Mutex
+
+	// gen is the generation of the connection the command was sent on
+	gen uint64
+
+	// enqueued is when the command was sent, and elem is the
+	// entry in the pending list of the client
+	enqueued time.Time
+	elem     *list.Element
+
+	// timing is set to record when each stage of a timed command
+	// completes, and is nil otherwise
+	timing *timestamps
 }
 
 // NewFuture returns a new future
@@ -15,6 +117,32 @@ func NewFuture(cmd Command) *Future {
 	}
 }
 
+// NewCompletedFuture returns a future that has already completed with
+// the given error, which is useful for wrappers of an Executor
+func NewCompletedFuture(cmd Command, err error) *Future {
+	f := NewFuture(cmd)
+	f.respond(err)
+	return f
+}
+
+// newFuture returns a future of the given kind
+func newFuture(kind futureKind, cmd Command) *Future {
+	var f *Future
+	switch kind {
+	case futureNoReply:
+		f = noReplyFutures.Get().(*Future)
+	case futurePooled:
+		f = pooledFutures.Get().(*Future)
+	case futureParked:
+		f = &Future{parked: true}
+		f.wg.Add(1)
+	default:
+		return NewFuture(cmd)
+	}
+	f.cmd = cmd
+	return f
+}
+
 // Command returns the underlying command
 func (f *Future) Command() Command {
 	return f.cmd
@@ -22,12 +150,86 @@ func (f *Future) Command() Command {
 
 // Error blocks until the future is complete
 func (f *Future) Error() error {
+	if f.parked {
+		f.wg.Wait()
+		return f.err
+	}
 	<-f.doneCh
 	return f.err
 }
 
+// ErrorTimeout waits up to the given duration for the future to
+// complete. It returns the error and true if the future completed,
+// or false if the timeout was reached first.
+func (f *Future) ErrorTimeout(d time.Duration) (error, bool) {
+	doneCh := f.doneCh
+	if f.parked {
+		// A WaitGroup cannot be selected on, so use a channel
+		f.parkLock.Lock()
+		if f.parkDone {
+			f.parkLock.Unlock()
+			return f.err, true
+		}
+		if f.parkCh == nil {
+			f.parkCh = make(chan struct{})
+		}
+		doneCh = f.parkCh
+		f.parkLock.Unlock()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-doneCh:
+		return f.err, true
+	case <-timer.C:
+		return nil, false
+	}
+}
+
+// unwatch is used to claim a future for completion, returning false if
+// it has already been failed by its context. The context is released.
+func (f *Future) unwatch() bool {
+	if atomic.LoadInt32(&f.watch) == unwatched {
+		return true
+	}
+	if !atomic.CompareAndSwapInt32(&f.watch, watching, watchDone) {
+		return false
+	}
+	f.stopWatch()
+	if f.cancel != nil {
+		f.cancel()
+	}
+	return true
+}
+
+// expired checks if a future was failed by its context
+func (f *Future) expired() bool {
+	return atomic.LoadInt32(&f.watch) == watchDone
+}
+
 // respond stores the error and unblocks the future
 func (f *Future) respond(err error) {
+	if f.noReply {
+		f.cmd = nil
+		f.deadline = time.Time{}
+		f.labels = nil
+		noReplyFutures.Put(f)
+		return
+	}
 	f.err = err
-	close(f.doneCh)
+	switch {
+	case f.parked:
+		f.parkLock.Lock()
+		f.parkDone = true
+		if f.parkCh != nil {
+			close(f.parkCh)
+		}
+		f.parkLock.Unlock()
+		f.wg.Done()
+	case f.readyCh != nil:
+		f.readyCh <- struct{}{}
+	default:
+		close(f.doneCh)
+	}
 }
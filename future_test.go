@@ -2,6 +2,7 @@ package hlld
 
 import (
 	"errors"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -20,12 +21,12 @@ func TestFuture(t *testing.T) {
 		err := f.Error()
 		close(doneCh)
 		if err != expect {
-			t.Fatalf("bad error")
+			t.Errorf("bad error")
 		}
 
 		err = f.Error()
 		if err != expect {
-			t.Fatalf("bad error")
+			t.Errorf("bad error")
 		}
 	}()
 
@@ -47,3 +48,137 @@ func TestFuture(t *testing.T) {
 		t.Fatalf("timeout")
 	}
 }
+
+func TestFuture_ErrorTimeout(t *testing.T) {
+	cmd, _ := NewCreateCommand("foo")
+	f := NewFuture(cmd)
+
+	// Should timeout while pending
+	start := time.Now()
+	err, done := f.ErrorTimeout(10 * time.Millisecond)
+	if done || err != nil {
+		t.Fatalf("bad: %v %v", err, done)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Fatalf("should wait")
+	}
+
+	// Should return the error once complete
+	expect := errors.New("hello!")
+	f.respond(expect)
+	err, done = f.ErrorTimeout(time.Second)
+	if !done || err != expect {
+		t.Fatalf("bad: %v %v", err, done)
+	}
+}
+
+func TestFuture_Parked(t *testing.T) {
+	cmd, _ := NewCreateCommand("foo")
+	f := newFuture(futureParked, cmd)
+	if f.Command() != cmd || f.doneCh != nil {
+		t.Fatalf("bad: %#v", f)
+	}
+
+	// Should timeout while pending, without leaving a goroutine
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		err, done := f.ErrorTimeout(time.Millisecond)
+		if done || err != nil {
+			t.Fatalf("bad: %v %v", err, done)
+		}
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("bad: %d > %d", n, before)
+	}
+
+	// Every waiter is unblocked
+	expect := errors.New("hello!")
+	errCh := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			errCh <- f.Error()
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	f.respond(expect)
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errCh:
+			if err != expect {
+				t.Fatalf("err: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout")
+		}
+	}
+
+	err, done := f.ErrorTimeout(10 * time.Millisecond)
+	if !done || err != expect {
+		t.Fatalf("bad: %v %v", err, done)
+	}
+}
+
+func TestClient_ParkedFutures(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.ParkedFutures = true
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	var futures []*Future
+	for i := 0; i < 100; i++ {
+		cmd, _ := NewDropCommand("foo")
+		f, err := client.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !f.parked {
+			t.Fatalf("expected parked future")
+		}
+		futures = append(futures, f)
+	}
+	for _, f := range futures {
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
+
+func BenchmarkClient_ExecuteParked(b *testing.B) {
+	conf := DefaultConfig()
+	conf.ParkedFutures = true
+	client, stop := benchmarkClient(b, conf)
+	defer stop()
+	cmd, _ := NewDropCommand("foo")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := client.Execute(cmd)
+		if err != nil {
+			b.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			b.Fatalf("err: %v", err)
+		}
+	}
+}
+
+func TestNewCompletedFuture(t *testing.T) {
+	cmd, _ := NewCreateCommand("foo")
+	expect := errors.New("hello!")
+	f := NewCompletedFuture(cmd, expect)
+	if f.Command() != cmd {
+		t.Fatalf("bad")
+	}
+	if err := f.Error(); err != expect {
+		t.Fatalf("err: %v", err)
+	}
+}
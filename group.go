@@ -0,0 +1,64 @@
+package hlld
+
+import (
+	"context"
+	"sync"
+)
+
+// Group is used to track the commands of a scoped operation, such as
+// the handling of a request that fans out several commands. Wait blocks
+// until every command executed through the group has completed, so no
+// futures outlive the operation. A Group is safe for concurrent use.
+type Group struct {
+	client *Client
+	ctx    context.Context
+
+	futures []*Future
+	err     error
+	lock    sync.Mutex
+}
+
+// Group returns a new group of commands executed with the given context,
+// whose deadline and labels apply to every command as with ExecuteContext
+func (c *Client) Group(ctx context.Context) *Group {
+	return &Group{
+		client: c,
+		ctx:    ctx,
+	}
+}
+
+// Execute starts command execution and returns a future,
+// which is tracked by the group
+func (g *Group) Execute(cmd Command) (*Future, error) {
+	f, err := g.client.ExecuteContext(g.ctx, cmd)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if err != nil {
+		if g.err == nil {
+			g.err = err
+		}
+		return nil, err
+	}
+	g.futures = append(g.futures, f)
+	return f, nil
+}
+
+// Wait blocks until every command executed through the group has
+// completed, and returns the first error of execution, if any. The
+// results of the commands must still be checked. The group may be
+// reused afterwards, and Wait only waits for the new commands.
+func (g *Group) Wait() error {
+	g.lock.Lock()
+	futures := g.futures
+	g.futures = nil
+	err := g.err
+	g.err = nil
+	g.lock.Unlock()
+
+	for _, f := range futures {
+		if ferr := f.Error(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package hlld
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	addr, closer := testServer(t, func(conn int, line string) string {
+		if strings.HasPrefix(line, "info") {
+			return "START\nsize 5\nEND\n"
+		}
+		return "Done\n"
+	})
+	defer closer()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	g := client.Group(context.Background())
+	var cmds []*InfoCommand
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd, _ := NewInfoCommand("foo")
+			if _, err := g.Execute(cmd); err != nil {
+				t.Errorf("err: %v", err)
+			}
+			lock.Lock()
+			cmds = append(cmds, cmd)
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	if err := g.Wait(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Every command has a result once Wait returns
+	for _, cmd := range cmds {
+		info, ok, err := cmd.Result()
+		if err != nil || !ok || info.Size != 5 {
+			t.Fatalf("bad: %v %v %v", info, ok, err)
+		}
+	}
+
+	// Waiting again with no commands returns immediately
+	if err := g.Wait(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestGroup_Error(t *testing.T) {
+	addr, closer := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer closer()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := client.Group(ctx)
+	cmd, _ := NewFlushCommand("foo")
+	if _, err := g.Execute(cmd); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Errors of execution are returned by Wait
+	cancel()
+	cmd, _ = NewFlushCommand("foo")
+	if _, err := g.Execute(cmd); err != context.Canceled {
+		t.Fatalf("err: %v", err)
+	}
+	if err := g.Wait(); err != context.Canceled {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Commands fail once the client is closed
+	client.Close()
+	g = client.Group(context.Background())
+	cmd, _ = NewFlushCommand("foo")
+	if _, err := g.Execute(cmd); err != ErrClientClosed {
+		t.Fatalf("err: %v", err)
+	}
+	if err := g.Wait(); err != ErrClientClosed {
+		t.Fatalf("err: %v", err)
+	}
+}
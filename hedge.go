@@ -0,0 +1,173 @@
+package hlld
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultHedgeFraction is the default fraction of the remaining time
+	// before the deadline waited for a replica before hedging to the next
+	DefaultHedgeFraction = 0.5
+)
+
+// HedgeOptions are used to configure hedged commands
+type HedgeOptions struct {
+	// Fraction is the fraction of the time remaining before the deadline
+	// of the context that a replica is given to respond, before the command
+	// is also sent to the next replica. DefaultHedgeFraction is used if zero.
+	Fraction float64
+
+	// Delay is the time a replica is given to respond if the context
+	// has no deadline. Commands are not hedged if it is zero.
+	Delay time.Duration
+}
+
+// delay returns how long to wait before hedging, or zero to not hedge
+func (o *HedgeOptions) delay(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return o.Delay
+	}
+	fraction := o.Fraction
+	if fraction == 0 {
+		fraction = DefaultHedgeFraction
+	}
+	d := time.Duration(fraction * float64(time.Until(deadline)))
+	if d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// hedgeable checks if a command is read-only, so sending
+// it to more than one replica is safe
+func hedgeable(cmd Command) bool {
+	switch cmd.(type) {
+	case *InfoCommand, *ListCommand:
+		return true
+	default:
+		return false
+	}
+}
+
+// hedgeResult is the outcome of a command sent to a replica
+type hedgeResult struct {
+	index int
+	cmd   Command
+	err   error
+}
+
+// Hedge is used to reduce the tail latency of a read-only command by
+// sending it to the first replica, and to each following replica if no
+// response is received within a fraction of the deadline, or when the
+// previous replica fails. The first successful response is used, and
+// the command that received it is returned with the index of its replica.
+// A command is built for each replica by newCmd, since a command can only
+// be executed once. The options may be nil to use the defaults.
+//
+// Responses to the other replicas are discarded once they arrive. If every
+// replica fails, the error of the last is returned.
+func Hedge(ctx context.Context, replicas []Replica, newCmd func(name string) (Command, error), opts *HedgeOptions) (Command, int, error) {
+	if len(replicas) == 0 {
+		return nil, -1, fmt.Errorf("at least 1 replica required")
+	}
+	if opts == nil {
+		opts = &HedgeOptions{}
+	}
+	if opts.Fraction < 0 || opts.Fraction > 1 {
+		return nil, -1, fmt.Errorf("hedge fraction must be in [0, 1], got %v", opts.Fraction)
+	}
+
+	// Build every command up front, so no invalid or
+	// destructive command is sent to any replica
+	cmds := make([]Command, len(replicas))
+	for idx, r := range replicas {
+		cmd, err := newCmd(r.SetName)
+		if err != nil {
+			return nil, -1, err
+		}
+		if !hedgeable(cmd) {
+			return nil, -1, fmt.Errorf("cannot hedge %s command, only read-only commands", commandType(cmd))
+		}
+		cmds[idx] = cmd
+	}
+
+	results := make(chan hedgeResult, len(replicas))
+	sent := 0
+	send := func() {
+		if sent == len(replicas) {
+			return
+		}
+		idx := sent
+		sent++
+		go func() {
+			f, err := replicas[idx].Client.ExecuteContext(ctx, cmds[idx])
+			if err == nil {
+				err = f.Error()
+			}
+			var cmd Command
+			if f != nil {
+				cmd = f.Command()
+			}
+			results <- hedgeResult{index: idx, cmd: cmd, err: err}
+		}()
+	}
+
+	delay := opts.delay(ctx)
+	var timer *time.Timer
+	var timerCh <-chan time.Time
+	if delay > 0 && len(replicas) > 1 {
+		timer = time.NewTimer(delay)
+		defer timer.Stop()
+		timerCh = timer.C
+	}
+
+	send()
+	failed := 0
+	var lastErr error
+	for {
+		select {
+		case res := <-results:
+			if res.err == nil {
+				return res.cmd, res.index, nil
+			}
+			lastErr = res.err
+			failed++
+			if failed == len(replicas) {
+				return nil, -1, lastErr
+			}
+			if failed == sent {
+				send()
+			}
+
+		case <-timerCh:
+			send()
+			if sent < len(replicas) {
+				timer.Reset(opts.delay(ctx))
+			} else {
+				timerCh = nil
+			}
+
+		case <-ctx.Done():
+			return nil, -1, ctx.Err()
+		}
+	}
+}
+
+// HedgedInfo is used to get the info of a set from the first replica
+// to respond, using Hedge. The options may be nil to use the defaults.
+func HedgedInfo(ctx context.Context, replicas []Replica, opts *HedgeOptions) (*SetInfo, bool, error) {
+	cmd, _, err := Hedge(ctx, replicas, func(name string) (Command, error) {
+		return NewInfoCommand(name)
+	}, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	info, ok := cmd.(*InfoCommand)
+	if !ok {
+		return nil, false, fmt.Errorf("info command replaced by a hook")
+	}
+	return info.Result()
+}
@@ -0,0 +1,102 @@
+package hlld
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// hedgeReplica starts a server responding to info with the given
+// size after a delay, returning a replica of the set
+func hedgeReplica(t *testing.T, size int, delay time.Duration) (Replica, func()) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		time.Sleep(delay)
+		return fmt.Sprintf("START\nsize %d\nEND\n", size)
+	})
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return Replica{Client: client, SetName: "foo"}, func() {
+		client.Close()
+		stop()
+	}
+}
+
+func TestHedge(t *testing.T) {
+	slow, stop := hedgeReplica(t, 1, 500*time.Millisecond)
+	defer stop()
+	fast, stop := hedgeReplica(t, 2, 0)
+	defer stop()
+	replicas := []Replica{slow, fast}
+
+	// The fast replica answers once the slow one is hedged
+	start := time.Now()
+	info, ok, err := HedgedInfo(context.Background(), replicas, &HedgeOptions{Delay: 20 * time.Millisecond})
+	if err != nil || !ok {
+		t.Fatalf("err: %v %v", err, ok)
+	}
+	if info.Size != 2 || time.Since(start) > 400*time.Millisecond {
+		t.Fatalf("bad: %v %v", info, time.Since(start))
+	}
+
+	// The delay is a fraction of the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cmd, idx, err := Hedge(ctx, replicas, func(name string) (Command, error) {
+		return NewInfoCommand(name)
+	}, &HedgeOptions{Fraction: 0.01})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if idx != 1 || cmd.(*InfoCommand).SetName != "foo" {
+		t.Fatalf("bad: %v %v", idx, cmd)
+	}
+
+	// Without a deadline or delay, only the first replica is used
+	info, _, err = HedgedInfo(context.Background(), replicas, nil)
+	if err != nil || info.Size != 1 {
+		t.Fatalf("bad: %v %v", info, err)
+	}
+}
+
+func TestHedge_Failover(t *testing.T) {
+	failed, stop := hedgeReplica(t, 1, 0)
+	defer stop()
+	ok, stop := hedgeReplica(t, 2, 0)
+	defer stop()
+
+	// A failed replica is hedged immediately
+	failed.Client.Close()
+	info, _, err := HedgedInfo(context.Background(), []Replica{failed, ok}, nil)
+	if err != nil || info.Size != 2 {
+		t.Fatalf("bad: %v %v", info, err)
+	}
+
+	// The last error is returned if every replica fails
+	_, _, err = HedgedInfo(context.Background(), []Replica{failed, failed}, nil)
+	if err != ErrClientClosed {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestHedge_Invalid(t *testing.T) {
+	replica, stop := hedgeReplica(t, 1, 0)
+	defer stop()
+
+	if _, _, err := HedgedInfo(context.Background(), nil, nil); err == nil {
+		t.Fatalf("expect error")
+	}
+	if _, _, err := HedgedInfo(context.Background(), []Replica{replica}, &HedgeOptions{Fraction: 2}); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Commands that modify sets are never hedged
+	_, _, err := Hedge(context.Background(), []Replica{replica}, func(name string) (Command, error) {
+		return NewDropCommand(name)
+	}, nil)
+	if err == nil || err.Error() != "cannot hedge drop command, only read-only commands" {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+// Package hll implements the HyperLogLog sketches used by hlld, so that
+// cardinalities can be estimated in process, such as by an embedded
+// server or to pre-aggregate keys before sending them to hlld.
+package hll
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+const (
+	// MinPrecision and MaxPrecision bound the precision of a sketch,
+	// matching the limits of hlld
+	MinPrecision = 4
+	MaxPrecision = 18
+
+	// DefaultPrecision is the default precision of hlld
+	DefaultPrecision = 12
+
+	// denseVersion and sparseVersion are the versions of
+	// the binary forms of dense and sparse sketches
+	denseVersion  = 1
+	sparseVersion = 2
+)
+
+// Sketch is a HyperLogLog sketch with 2^precision registers. Sketches
+// start with a sparse representation that only stores the registers
+// that are set, and are promoted to a dense array of registers once
+// that is smaller. Estimates are the same with either representation.
+// Sketches are not safe for concurrent use.
+type Sketch struct {
+	precision int
+
+	// registers is nil while the sketch is sparse
+	registers []uint8
+	sparse    sparseList
+}
+
+// New creates an empty sketch with the given precision
+func New(precision int) (*Sketch, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, fmt.Errorf("precision must be in [%d, %d], got %d", MinPrecision, MaxPrecision, precision)
+	}
+	return &Sketch{precision: precision}, nil
+}
+
+// ErrorForPrecision returns the standard error of the estimates of a
+// sketch with the given precision
+func ErrorForPrecision(precision int) float64 {
+	return 1.04 / math.Sqrt(float64(uint64(1)<<uint(precision)))
+}
+
+// PrecisionForError returns the smallest precision with a standard
+// error no greater than eps
+func PrecisionForError(eps float64) (int, error) {
+	for p := MinPrecision; p <= MaxPrecision; p++ {
+		if ErrorForPrecision(p) <= eps {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("error threshold %v requires a precision above %d", eps, MaxPrecision)
+}
+
+// Storage returns the bytes used by hlld to store the registers of a
+// sketch with the given precision, which packs 5 registers per 32-bit word
+func Storage(precision int) uint64 {
+	m := uint64(1) << uint(precision)
+	return (m + 4) / 5 * 4
+}
+
+// Precision returns the precision of the sketch
+func (s *Sketch) Precision() int {
+	return s.precision
+}
+
+// Sparse checks if the sketch uses the sparse representation
+func (s *Sketch) Sparse() bool {
+	return s.registers == nil
+}
+
+// Add is used to add a key to the sketch
+func (s *Sketch) Add(key string) {
+	s.AddHash(Hash(key))
+}
+
+// AddHash is used to add a hashed key to the sketch. The first precision
+// bits of the hash select the register, which keeps the longest run of
+// leading zeros of the remaining bits.
+func (s *Sketch) AddHash(hash uint64) {
+	p := uint(s.precision)
+	idx := hash >> (64 - p)
+	w := hash<<p | 1<<(p-1)
+	rank := uint8(bits.LeadingZeros64(w) + 1)
+	s.set(uint32(idx), rank)
+}
+
+// set is used to raise a register to at least the given rank,
+// promoting a sparse sketch once it is too large
+func (s *Sketch) set(idx uint32, rank uint8) {
+	if s.registers != nil {
+		if rank > s.registers[idx] {
+			s.registers[idx] = rank
+		}
+		return
+	}
+	s.sparse = s.sparse.set(idx, rank)
+	if len(s.sparse) > s.sparseLimit() {
+		s.promote()
+	}
+}
+
+// sparseLimit is the number of registers set before the sketch is
+// promoted, where the sparse list uses a quarter of the dense memory
+func (s *Sketch) sparseLimit() int {
+	return (1 << uint(s.precision)) / (4 * sparseEntrySize)
+}
+
+// promote is used to switch to the dense representation
+func (s *Sketch) promote() {
+	if s.registers != nil {
+		return
+	}
+	s.registers = make([]uint8, 1<<uint(s.precision))
+	for _, e := range s.sparse {
+		s.registers[e.index()] = e.rank()
+	}
+	s.sparse = nil
+}
+
+// Estimate returns the estimated number of unique keys added to the
+// sketch, using linear counting for small cardinalities
+func (s *Sketch) Estimate() float64 {
+	m := 1 << uint(s.precision)
+	var h histogram
+	if s.registers != nil {
+		h.count(s.registers)
+	} else {
+		h[0] = m - len(s.sparse)
+		for _, e := range s.sparse {
+			h[e.rank()]++
+		}
+	}
+	zeros := h[0]
+	sum := h.harmonicSum()
+
+	fm := float64(m)
+	raw := alpha(m) * fm * fm / sum
+	if raw <= 2.5*fm && zeros > 0 {
+		return fm * math.Log(fm/float64(zeros))
+	}
+	return raw
+}
+
+// alpha is the bias correction constant for m registers
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// Merge is used to add the keys of another sketch with
+// the same precision to this sketch
+func (s *Sketch) Merge(other *Sketch) error {
+	if other.precision != s.precision {
+		return fmt.Errorf("cannot merge sketches with precision %d and %d", s.precision, other.precision)
+	}
+	if other.registers == nil {
+		for _, e := range other.sparse {
+			s.set(e.index(), e.rank())
+		}
+		return nil
+	}
+	s.promote()
+	mergeRegisters(s.registers, other.registers)
+	return nil
+}
+
+// Clone returns a copy of the sketch
+func (s *Sketch) Clone() *Sketch {
+	out := &Sketch{precision: s.precision}
+	if s.registers != nil {
+		out.registers = append([]uint8(nil), s.registers...)
+	} else {
+		out.sparse = append(sparseList(nil), s.sparse...)
+	}
+	return out
+}
+
+// Reset is used to remove every key from the sketch,
+// which returns to the sparse representation
+func (s *Sketch) Reset() {
+	s.registers = nil
+	s.sparse = nil
+}
+
+// MarshalBinary encodes the sketch as a version byte, the precision,
+// and then either a byte per register or, for sparse sketches, the
+// number of registers set and the entry of each as little endian
+// 32-bit fields
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	if s.registers != nil {
+		out := make([]byte, 0, 2+len(s.registers))
+		out = append(out, denseVersion, byte(s.precision))
+		return append(out, s.registers...), nil
+	}
+	out := make([]byte, 0, 6+sparseEntrySize*len(s.sparse))
+	out = append(out, sparseVersion, byte(s.precision))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(s.sparse)))
+	for _, e := range s.sparse {
+		out = binary.LittleEndian.AppendUint32(out, uint32(e))
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary
+func (s *Sketch) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 2 {
+		return fmt.Errorf("sketch truncated")
+	}
+	out, err := New(int(buf[1]))
+	if err != nil {
+		return err
+	}
+	m := 1 << uint(out.precision)
+	limit := uint8(64 - out.precision + 1)
+
+	switch buf[0] {
+	case denseVersion:
+		if len(buf)-2 != m {
+			return fmt.Errorf("sketch with precision %d has %d registers, expected %d",
+				out.precision, len(buf)-2, m)
+		}
+		out.registers = make([]uint8, m)
+		for idx, r := range buf[2:] {
+			if r > limit {
+				return fmt.Errorf("register %d has invalid value %d", idx, r)
+			}
+			out.registers[idx] = r
+		}
+
+	case sparseVersion:
+		if len(buf) < 6 {
+			return fmt.Errorf("sketch truncated")
+		}
+		n := int(binary.LittleEndian.Uint32(buf[2:6]))
+		if n > m || len(buf)-6 != sparseEntrySize*n {
+			return fmt.Errorf("sparse sketch has %d bytes for %d registers", len(buf)-6, n)
+		}
+		out.sparse = make(sparseList, n)
+		for i := range out.sparse {
+			e := sparseEntry(binary.LittleEndian.Uint32(buf[6+sparseEntrySize*i:]))
+			if int(e.index()) >= m || e.rank() == 0 || e.rank() > limit {
+				return fmt.Errorf("sparse entry %d is invalid", i)
+			}
+			if i > 0 && e.index() <= out.sparse[i-1].index() {
+				return fmt.Errorf("sparse entry %d is out of order", i)
+			}
+			out.sparse[i] = e
+		}
+		if n > out.sparseLimit() {
+			out.promote()
+		}
+
+	default:
+		return fmt.Errorf("unsupported sketch version %d", buf[0])
+	}
+	*s = *out
+	return nil
+}
@@ -0,0 +1,281 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(MinPrecision - 1); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := New(MaxPrecision + 1); err == nil {
+		t.Fatalf("expected error")
+	}
+	s, err := New(12)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if s.Precision() != 12 || !s.Sparse() {
+		t.Fatalf("bad: %v", s.Precision())
+	}
+	if s.Estimate() != 0 {
+		t.Fatalf("bad: %v", s.Estimate())
+	}
+}
+
+func TestPrecisionForError(t *testing.T) {
+	p, err := PrecisionForError(0.01625)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p != 12 {
+		t.Fatalf("bad: %v", p)
+	}
+	if ErrorForPrecision(p) > 0.01625 || ErrorForPrecision(p-1) <= 0.01625 {
+		t.Fatalf("bad: %v", ErrorForPrecision(p))
+	}
+	if _, err := PrecisionForError(0.0001); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestStorage(t *testing.T) {
+	if Storage(12) != 3280 {
+		t.Fatalf("bad: %v", Storage(12))
+	}
+	if Storage(4) != 16 {
+		t.Fatalf("bad: %v", Storage(4))
+	}
+}
+
+func TestSketch_Estimate(t *testing.T) {
+	for _, n := range []int{1, 10, 1000, 100000} {
+		s, _ := New(14)
+		for i := 0; i < n; i++ {
+			s.Add("key" + strconv.Itoa(i))
+			s.Add("key" + strconv.Itoa(i))
+		}
+		within := 4 * ErrorForPrecision(14) * float64(n)
+		if est := s.Estimate(); math.Abs(est-float64(n)) > math.Max(within, 0.5) {
+			t.Fatalf("bad: %d %v", n, est)
+		}
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, _ := New(12)
+	b, _ := New(12)
+	for i := 0; i < 1000; i++ {
+		a.Add("a" + strconv.Itoa(i))
+		b.Add("b" + strconv.Itoa(i))
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if est := a.Estimate(); math.Abs(est-2000) > 4*ErrorForPrecision(12)*2000 {
+		t.Fatalf("bad: %v", est)
+	}
+
+	c, _ := New(10)
+	if err := a.Merge(c); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestSketch_CloneReset(t *testing.T) {
+	s, _ := New(8)
+	s.Add("foo")
+	clone := s.Clone()
+	s.Reset()
+	if s.Estimate() != 0 {
+		t.Fatalf("bad: %v", s.Estimate())
+	}
+	if math.Round(clone.Estimate()) != 1 {
+		t.Fatalf("bad: %v", clone.Estimate())
+	}
+}
+
+func TestSketch_Binary(t *testing.T) {
+	s, _ := New(10)
+	for i := 0; i < 500; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	buf, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var out Sketch
+	if err := out.UnmarshalBinary(buf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Precision() != 10 || out.Estimate() != s.Estimate() {
+		t.Fatalf("bad: %v %v", out.Precision(), out.Estimate())
+	}
+
+	if err := out.UnmarshalBinary(buf[:100]); err == nil {
+		t.Fatalf("expected error")
+	}
+	bad := append([]byte(nil), buf...)
+	bad[0] = 9
+	if err := out.UnmarshalBinary(bad); err == nil {
+		t.Fatalf("expected error")
+	}
+	bad[0], bad[2] = denseVersion, 60
+	if err := out.UnmarshalBinary(bad); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestSketch_Promote(t *testing.T) {
+	s, _ := New(12)
+	dense, _ := New(12)
+	dense.promote()
+	for i := 0; s.Sparse(); i++ {
+		key := strconv.Itoa(i)
+		s.Add(key)
+		dense.Add(key)
+
+		// Estimates do not depend on the representation
+		if s.Estimate() != dense.Estimate() {
+			t.Fatalf("bad: %d %v %v", i, s.Estimate(), dense.Estimate())
+		}
+		if s.Sparse() && len(s.sparse) > 256 {
+			t.Fatalf("bad: %d", len(s.sparse))
+		}
+	}
+	if s.Estimate() != dense.Estimate() {
+		t.Fatalf("bad: %v %v", s.Estimate(), dense.Estimate())
+	}
+	for idx, r := range dense.registers {
+		if s.registers[idx] != r {
+			t.Fatalf("bad: %d", idx)
+		}
+	}
+
+	s.Reset()
+	if !s.Sparse() || s.Estimate() != 0 {
+		t.Fatalf("bad: %v", s.Estimate())
+	}
+}
+
+func TestSketch_MergeSparse(t *testing.T) {
+	a, _ := New(12)
+	b, _ := New(12)
+	a.Add("foo")
+	b.Add("bar")
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !a.Sparse() || math.Round(a.Estimate()) != 2 {
+		t.Fatalf("bad: %v", a.Estimate())
+	}
+
+	// Merging a dense sketch promotes
+	for i := 0; i < 1000; i++ {
+		b.Add(strconv.Itoa(i))
+	}
+	if b.Sparse() {
+		t.Fatalf("expected dense")
+	}
+	clone := b.Clone()
+	clone.Merge(a)
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if a.Sparse() || a.Estimate() != clone.Estimate() {
+		t.Fatalf("bad: %v %v", a.Estimate(), clone.Estimate())
+	}
+
+	// Merging a sparse sketch into a dense one
+	c, _ := New(12)
+	c.Add("baz")
+	before := b.Estimate()
+	b.Merge(c)
+	if b.Estimate() <= before {
+		t.Fatalf("bad: %v", b.Estimate())
+	}
+}
+
+func TestSketch_BinarySparse(t *testing.T) {
+	s, _ := New(14)
+	for i := 0; i < 100; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	buf, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if buf[0] != sparseVersion || len(buf) >= 1<<14 {
+		t.Fatalf("bad: %d %d", buf[0], len(buf))
+	}
+
+	var out Sketch
+	if err := out.UnmarshalBinary(buf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !out.Sparse() || out.Estimate() != s.Estimate() {
+		t.Fatalf("bad: %v", out.Estimate())
+	}
+
+	if err := out.UnmarshalBinary(buf[:len(buf)-1]); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Entries must be sorted
+	bad := append([]byte(nil), buf...)
+	copy(bad[6:10], buf[10:14])
+	copy(bad[10:14], buf[6:10])
+	if err := out.UnmarshalBinary(bad); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+// benchSketch returns a dense sketch with the given number of keys
+func benchSketch(precision, keys, seed int) *Sketch {
+	s, _ := New(precision)
+	for i := 0; i < keys; i++ {
+		s.Add(strconv.Itoa(seed) + "-" + strconv.Itoa(i))
+	}
+	s.promote()
+	return s
+}
+
+func BenchmarkSketch_Add(b *testing.B) {
+	s := benchSketch(14, 0, 0)
+	for i := 0; i < b.N; i++ {
+		s.AddHash(uint64(i) * 0x9e3779b97f4a7c15)
+	}
+}
+
+func BenchmarkSketch_Estimate(b *testing.B) {
+	s := benchSketch(14, 100000, 0)
+	b.SetBytes(int64(len(s.registers)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Estimate()
+	}
+}
+
+func BenchmarkSketch_Merge(b *testing.B) {
+	s, other := benchSketch(14, 100000, 0), benchSketch(14, 100000, 1)
+	b.SetBytes(int64(len(s.registers)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Merge(other)
+	}
+}
+
+func BenchmarkUnion_Thousand(b *testing.B) {
+	sketches := make([]*Sketch, 1000)
+	for i := range sketches {
+		sketches[i] = benchSketch(12, 2000, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		u, _ := Union(sketches...)
+		u.Estimate()
+	}
+}
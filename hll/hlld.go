@@ -0,0 +1,215 @@
+package hll
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SetFolderPrefix prefixes the folder of each set in
+	// an hlld data directory
+	SetFolderPrefix = "hlld."
+
+	// setConfigFile and registersFile are the files of a set folder
+	setConfigFile = "config.ini"
+	registersFile = "registers.mmap"
+
+	// registerWidth is the bits per register in the hlld bitmap,
+	// which packs registersPerWord registers in each 32-bit word
+	registerWidth    = 6
+	registersPerWord = 5
+	registerMask     = 1<<registerWidth - 1
+)
+
+// ReadRegisters is used to read the bitmap of registers stored by hlld
+// for a sketch with the given precision. Registers are packed 5 per
+// 32-bit word, from the least significant bits, and the words are
+// little endian as written by hlld on x86 and ARM hosts.
+func ReadRegisters(r io.Reader, precision int) (*Sketch, error) {
+	s, err := New(precision)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, Storage(precision))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("failed to read registers: %w", err)
+	}
+
+	m := 1 << uint(precision)
+	limit := uint8(64 - precision + 1)
+	for base := 0; base < m; base += registersPerWord {
+		// Skip the words with no registers set
+		word := binary.LittleEndian.Uint32(buf[4*(base/registersPerWord):])
+		end := base + registersPerWord
+		if end > m {
+			end = m
+		}
+		for idx := base; word != 0 && idx < end; idx++ {
+			r := uint8(word & registerMask)
+			word >>= registerWidth
+			if r > limit {
+				return nil, fmt.Errorf("register %d has invalid value %d", idx, r)
+			}
+			if r > 0 {
+				s.set(uint32(idx), r)
+			}
+		}
+	}
+	return s, nil
+}
+
+// WriteRegisters is used to write the registers of the sketch
+// in the bitmap format of hlld
+func (s *Sketch) WriteRegisters(w io.Writer) error {
+	buf := make([]byte, Storage(s.precision))
+	put := func(idx uint32, r uint8) {
+		word := buf[4*(idx/registersPerWord):]
+		v := binary.LittleEndian.Uint32(word)
+		v |= uint32(r) << (registerWidth * (idx % registersPerWord))
+		binary.LittleEndian.PutUint32(word, v)
+	}
+	if s.registers != nil {
+		for idx, r := range s.registers {
+			put(uint32(idx), r)
+		}
+	} else {
+		for _, e := range s.sparse {
+			put(e.index(), e.rank())
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// SetFolder is a set stored in an hlld data directory
+type SetFolder struct {
+	// Name is the name of the set
+	Name string
+
+	// Eps is the error threshold in the configuration of the set
+	Eps float64
+
+	// InMemory is set for sets that hlld does not persist, whose
+	// folder only has the configuration
+	InMemory bool
+
+	// Sketch has the registers of the set, with the precision of its
+	// configuration. It is empty for sets that are in memory.
+	Sketch *Sketch
+}
+
+// SetFolderNames returns the names of the sets in an hlld data directory
+func SetFolderNames(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), SetFolderPrefix) {
+			names = append(names, strings.TrimPrefix(entry.Name(), SetFolderPrefix))
+		}
+	}
+	return names, nil
+}
+
+// ReadSetFolder is used to read a set from an hlld data directory. The
+// set should be flushed or closed first, since hlld only syncs the
+// registers to disk periodically.
+func ReadSetFolder(dataDir, name string) (*SetFolder, error) {
+	dir := filepath.Join(dataDir, SetFolderPrefix+name)
+	raw, err := os.ReadFile(filepath.Join(dir, setConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	config, err := parseSetConfig(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config of set '%s': %w", name, err)
+	}
+
+	precision, err := strconv.Atoi(config["default_precision"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid precision of set '%s': %w", name, err)
+	}
+	set := &SetFolder{Name: name}
+	if set.Eps, err = strconv.ParseFloat(config["default_eps"], 64); err != nil {
+		return nil, fmt.Errorf("invalid eps of set '%s': %w", name, err)
+	}
+	set.InMemory = config["in_memory"] == "1"
+	if set.InMemory {
+		set.Sketch, err = New(precision)
+		return set, err
+	}
+
+	f, err := os.Open(filepath.Join(dir, registersFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if set.Sketch, err = ReadRegisters(f, precision); err != nil {
+		return nil, fmt.Errorf("invalid registers of set '%s': %w", name, err)
+	}
+	return set, nil
+}
+
+// WriteSetFolder is used to write a set into an hlld data directory,
+// replacing any existing folder of the same name. hlld discovers the
+// set when it starts, so it should not be running.
+func WriteSetFolder(dataDir string, set *SetFolder) error {
+	dir := filepath.Join(dataDir, SetFolderPrefix+set.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var config bytes.Buffer
+	inMemory := 0
+	if set.InMemory {
+		inMemory = 1
+	}
+	fmt.Fprintf(&config, "[hlld]\ndefault_eps = %s\ndefault_precision = %d\nin_memory = %d\n",
+		strconv.FormatFloat(set.Eps, 'g', -1, 64), set.Sketch.Precision(), inMemory)
+	if err := os.WriteFile(filepath.Join(dir, setConfigFile), config.Bytes(), 0644); err != nil {
+		return err
+	}
+	if set.InMemory {
+		return nil
+	}
+
+	var regs bytes.Buffer
+	if err := set.Sketch.WriteRegisters(&regs); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, registersFile), regs.Bytes(), 0644)
+}
+
+// parseSetConfig is used to parse the keys of the hlld
+// section of the config.ini of a set
+func parseSetConfig(raw []byte) (map[string]string, error) {
+	config := make(map[string]string)
+	section := ""
+	scan := bufio.NewScanner(bytes.NewReader(raw))
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = line[1 : len(line)-1]
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("malformed line '%s'", line)
+			}
+			if section == "hlld" {
+				config[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return config, scan.Err()
+}
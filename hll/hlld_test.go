@@ -0,0 +1,130 @@
+package hll
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestRegisters_Layout(t *testing.T) {
+	s, _ := New(4)
+	s.set(0, 1)
+	s.set(1, 2)
+	s.set(4, 63-2)
+	s.set(5, 3)
+
+	var buf bytes.Buffer
+	if err := s.WriteRegisters(&buf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if buf.Len() != 16 {
+		t.Fatalf("bad: %d", buf.Len())
+	}
+
+	// Five registers per little endian word
+	expect := []byte{0x81, 0x00, 0x00, 0x3d, 0x03, 0, 0, 0}
+	if !bytes.Equal(buf.Bytes()[:8], expect) {
+		t.Fatalf("bad: %x", buf.Bytes())
+	}
+
+	out, err := ReadRegisters(bytes.NewReader(buf.Bytes()), 4)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Estimate() != s.Estimate() {
+		t.Fatalf("bad: %v %v", out.Estimate(), s.Estimate())
+	}
+
+	// Registers beyond the maximum rank are rejected
+	bad := append([]byte(nil), buf.Bytes()...)
+	bad[0] = 0x3f
+	if _, err := ReadRegisters(bytes.NewReader(bad), 4); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := ReadRegisters(bytes.NewReader(buf.Bytes()[:15]), 4); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestRegisters_Dense(t *testing.T) {
+	s, _ := New(12)
+	for i := 0; i < 10000; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	if err := s.WriteRegisters(&buf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if uint64(buf.Len()) != Storage(12) {
+		t.Fatalf("bad: %d", buf.Len())
+	}
+	out, err := ReadRegisters(&buf, 12)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Sparse() || out.Estimate() != s.Estimate() {
+		t.Fatalf("bad: %v %v", out.Estimate(), s.Estimate())
+	}
+}
+
+func TestSetFolder(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := New(14)
+	for i := 0; i < 500; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	sets := []*SetFolder{
+		{Name: "foo", Eps: ErrorForPrecision(14), Sketch: s},
+		{Name: "bar", Eps: 0.0123456789, InMemory: true, Sketch: s},
+	}
+	for _, set := range sets {
+		if err := WriteSetFolder(dir, set); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hlld.bar", registersFile)); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "other"), nil, 0644)
+
+	names, err := SetFolderNames(dir)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "bar" || names[1] != "foo" {
+		t.Fatalf("bad: %v", names)
+	}
+
+	foo, err := ReadSetFolder(dir, "foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if foo.InMemory || foo.Eps != ErrorForPrecision(14) || foo.Sketch.Precision() != 14 || foo.Sketch.Estimate() != s.Estimate() {
+		t.Fatalf("bad: %v", foo)
+	}
+	bar, err := ReadSetFolder(dir, "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bar.InMemory || bar.Eps != 0.0123456789 || bar.Sketch.Estimate() != 0 {
+		t.Fatalf("bad: %v", bar)
+	}
+}
+
+func TestParseSetConfig(t *testing.T) {
+	raw := "; written by hlld\n[hlld]\ndefault_eps = 0.016250\ndefault_precision=12\n\n[other]\nin_memory = 1\n"
+	config, err := parseSetConfig([]byte(raw))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(config) != 2 || config["default_eps"] != "0.016250" || config["default_precision"] != "12" {
+		t.Fatalf("bad: %v", config)
+	}
+	if _, err := parseSetConfig([]byte("[hlld]\nbad\n")); err == nil {
+		t.Fatalf("expected error")
+	}
+}
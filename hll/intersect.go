@@ -0,0 +1,124 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+)
+
+// MaxIntersection is the most sketches that can be intersected, as
+// inclusion–exclusion estimates the union of every subset of them
+const MaxIntersection = 10
+
+// Cardinality is an estimated cardinality with its standard error
+type Cardinality struct {
+	// Value is the point estimate
+	Value float64
+
+	// StdError is the absolute standard error of the estimate
+	StdError float64
+}
+
+// Interval returns the bounds of the estimate within the given
+// number of standard errors. The lower bound is never negative.
+func (c Cardinality) Interval(sigmas float64) (lower, upper float64) {
+	margin := sigmas * c.StdError
+	return math.Max(c.Value-margin, 0), c.Value + margin
+}
+
+// Union returns a sketch of the union of sketches with the same precision
+func Union(sketches ...*Sketch) (*Sketch, error) {
+	if len(sketches) == 0 {
+		return nil, fmt.Errorf("no sketches to union")
+	}
+	out := sketches[0].Clone()
+	for _, s := range sketches[1:] {
+		if err := out.Merge(s); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Intersection estimates the number of keys in all of the sketches using
+// inclusion–exclusion over the unions of every subset of them. The error
+// is propagated from the standard error of each union, assuming they are
+// independent, and is relative to the unions rather than the intersection.
+// Small intersections of large sets are therefore imprecise, and should
+// be compared with the returned error before being relied on.
+func Intersection(sketches ...*Sketch) (Cardinality, error) {
+	if err := checkIntersection(sketches); err != nil {
+		return Cardinality{}, err
+	}
+	rel := ErrorForPrecision(sketches[0].precision)
+
+	var value, variance float64
+	var walk func(start, size int, acc *Sketch)
+	walk = func(start, size int, acc *Sketch) {
+		for i := start; i < len(sketches); i++ {
+			union := sketches[i].Clone()
+			if acc != nil {
+				union.Merge(acc)
+			}
+			est := union.Estimate()
+			if size%2 == 0 {
+				value += est
+			} else {
+				value -= est
+			}
+			variance += (rel * est) * (rel * est)
+			walk(i+1, size+1, union)
+		}
+	}
+	walk(0, 0, nil)
+
+	// The intersection is no larger than the smallest sketch
+	smallest := math.Inf(1)
+	for _, s := range sketches {
+		smallest = math.Min(smallest, s.Estimate())
+	}
+	value = math.Min(math.Max(value, 0), smallest)
+	return Cardinality{Value: value, StdError: math.Sqrt(variance)}, nil
+}
+
+// Jaccard estimates the Jaccard similarity of the sketches, which is the
+// size of their intersection relative to their union. The error combines
+// the relative errors of the intersection and the union.
+func Jaccard(sketches ...*Sketch) (Cardinality, error) {
+	inter, err := Intersection(sketches...)
+	if err != nil {
+		return Cardinality{}, err
+	}
+	union, _ := Union(sketches...)
+	u := union.Estimate()
+	if u == 0 {
+		return Cardinality{}, nil
+	}
+	uErr := ErrorForPrecision(union.precision)
+
+	j := inter.Value / u
+	var stdErr float64
+	if inter.Value > 0 {
+		rel := inter.StdError / inter.Value
+		stdErr = j * math.Sqrt(rel*rel+uErr*uErr)
+	} else {
+		stdErr = inter.StdError / u
+	}
+	return Cardinality{Value: math.Min(j, 1), StdError: stdErr}, nil
+}
+
+// checkIntersection is used to check sketches can be intersected
+func checkIntersection(sketches []*Sketch) error {
+	if len(sketches) == 0 {
+		return fmt.Errorf("no sketches to intersect")
+	}
+	if len(sketches) > MaxIntersection {
+		return fmt.Errorf("cannot intersect %d sketches, the maximum is %d", len(sketches), MaxIntersection)
+	}
+	for _, s := range sketches[1:] {
+		if s.precision != sketches[0].precision {
+			return fmt.Errorf("cannot intersect sketches with precision %d and %d",
+				sketches[0].precision, s.precision)
+		}
+	}
+	return nil
+}
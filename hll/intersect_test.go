@@ -0,0 +1,116 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// testRange returns a sketch of the keys in [start, end)
+func testRange(start, end int) *Sketch {
+	s, _ := New(14)
+	for i := start; i < end; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	return s
+}
+
+// within checks an estimate is within 4 standard errors of the expected value
+func within(t *testing.T, c Cardinality, expect float64) {
+	t.Helper()
+	if c.StdError <= 0 || math.Abs(c.Value-expect) > 4*c.StdError {
+		t.Fatalf("bad: %v expected %v", c, expect)
+	}
+}
+
+func TestCardinality_Interval(t *testing.T) {
+	c := Cardinality{Value: 100, StdError: 10}
+	lower, upper := c.Interval(2)
+	if lower != 80 || upper != 120 {
+		t.Fatalf("bad: %v %v", lower, upper)
+	}
+	lower, _ = Cardinality{Value: 5, StdError: 10}.Interval(2)
+	if lower != 0 {
+		t.Fatalf("bad: %v", lower)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	a, b := testRange(0, 1000), testRange(500, 1500)
+	u, err := Union(a, b)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if math.Abs(u.Estimate()-1500) > 4*ErrorForPrecision(14)*1500 {
+		t.Fatalf("bad: %v", u.Estimate())
+	}
+	if math.Abs(a.Estimate()-1000) > 4*ErrorForPrecision(14)*1000 {
+		t.Fatalf("inputs modified: %v", a.Estimate())
+	}
+	if _, err := Union(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestIntersection(t *testing.T) {
+	a, b, c := testRange(0, 20000), testRange(10000, 30000), testRange(15000, 40000)
+	inter, err := Intersection(a, b)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	within(t, inter, 10000)
+
+	inter, err = Intersection(a, b, c)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	within(t, inter, 5000)
+
+	// A single sketch is its own intersection
+	inter, _ = Intersection(a)
+	if inter.Value != a.Estimate() {
+		t.Fatalf("bad: %v", inter)
+	}
+
+	// Disjoint sketches are clamped to zero
+	inter, _ = Intersection(testRange(0, 100), testRange(100, 200))
+	if inter.Value < 0 || inter.Value > 4*inter.StdError {
+		t.Fatalf("bad: %v", inter)
+	}
+}
+
+func TestIntersection_Invalid(t *testing.T) {
+	if _, err := Intersection(); err == nil {
+		t.Fatalf("expected error")
+	}
+	other, _ := New(10)
+	if _, err := Intersection(testRange(0, 1), other); err == nil {
+		t.Fatalf("expected error")
+	}
+	many := make([]*Sketch, MaxIntersection+1)
+	for i := range many {
+		many[i], _ = New(4)
+	}
+	if _, err := Intersection(many...); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	j, err := Jaccard(testRange(0, 20000), testRange(10000, 30000))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	within(t, j, 1.0/3)
+
+	j, _ = Jaccard(testRange(0, 5000), testRange(0, 5000))
+	if j.Value != 1 {
+		t.Fatalf("bad: %v", j)
+	}
+
+	empty, _ := New(14)
+	j, err = Jaccard(empty, empty)
+	if err != nil || j.Value != 0 {
+		t.Fatalf("bad: %v %v", j, err)
+	}
+}
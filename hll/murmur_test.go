@@ -0,0 +1,25 @@
+package hll
+
+import (
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	cases := []struct {
+		key    string
+		h1, h2 uint64
+	}{
+		{"", 0, 0},
+		{"foo", 0xe271865701f54561, 0x7eaf87e42bba7d87},
+		{"The quick brown fox jumps over the lazy dog", 0xe34bbc7bbc071b6c, 0x7a433ca9c49a9347},
+	}
+	for _, tc := range cases {
+		h1, h2 := murmur3(tc.key)
+		if h1 != tc.h1 || h2 != tc.h2 {
+			t.Fatalf("bad: %q %x %x", tc.key, h1, h2)
+		}
+	}
+	if Hash("foo") != 0x7eaf87e42bba7d87 {
+		t.Fatalf("bad: %x", Hash("foo"))
+	}
+}
@@ -0,0 +1,74 @@
+package hll
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// numRanks is the size of the rank histogram, as ranks are at most 64-p+1
+const numRanks = 64
+
+// highBits has the high bit of each byte of a word set
+const highBits = 0x8080808080808080
+
+// histogram counts the registers of each rank
+type histogram [numRanks]int
+
+// count is used to add registers to the histogram. Registers are read
+// a word at a time, so that runs of empty registers are counted at once,
+// and the ranks are masked so the counts need no bounds checks.
+func (h *histogram) count(regs []uint8) {
+	for len(regs) >= 8 {
+		w := binary.LittleEndian.Uint64(regs)
+		regs = regs[8:]
+		if w == 0 {
+			h[0] += 8
+			continue
+		}
+		h[w&(numRanks-1)]++
+		h[w>>8&(numRanks-1)]++
+		h[w>>16&(numRanks-1)]++
+		h[w>>24&(numRanks-1)]++
+		h[w>>32&(numRanks-1)]++
+		h[w>>40&(numRanks-1)]++
+		h[w>>48&(numRanks-1)]++
+		h[w>>56&(numRanks-1)]++
+	}
+	for _, r := range regs {
+		h[r&(numRanks-1)]++
+	}
+}
+
+// harmonicSum returns the sum of 2^-r over the registers, adding the
+// smallest terms first. Each term is exact, so the sum does not depend
+// on the order of the registers.
+func (h *histogram) harmonicSum() float64 {
+	var sum float64
+	for r := numRanks - 1; r >= 0; r-- {
+		if h[r] > 0 {
+			sum += math.Ldexp(float64(h[r]), -r)
+		}
+	}
+	return sum
+}
+
+// mergeRegisters is used to set each register of dst to the maximum of
+// it and the register of src, 8 registers at a time. Registers are below
+// 128, so setting the high bit of each byte of dst before subtracting src
+// leaves the high bit set exactly where dst is at least src, without
+// borrowing from the next byte.
+func mergeRegisters(dst, src []uint8) {
+	for len(dst) >= 8 && len(src) >= 8 {
+		a := binary.LittleEndian.Uint64(dst)
+		b := binary.LittleEndian.Uint64(src)
+		ge := ((a | highBits) - b) & highBits
+		mask := (ge >> 7) * 0xff
+		binary.LittleEndian.PutUint64(dst, a&mask|b&^mask)
+		dst, src = dst[8:], src[8:]
+	}
+	for idx, r := range src {
+		if idx < len(dst) && r > dst[idx] {
+			dst[idx] = r
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package hll
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomRegisters returns registers with random ranks, a third empty
+func randomRegisters(rng *rand.Rand, n int) []uint8 {
+	regs := make([]uint8, n)
+	for i := range regs {
+		if rng.Intn(3) > 0 {
+			regs[i] = uint8(rng.Intn(62))
+		}
+	}
+	return regs
+}
+
+func TestHistogram(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 5, 16, 67} {
+		regs := randomRegisters(rng, n)
+		regs = append(regs, make([]uint8, 16)...)
+
+		var h histogram
+		h.count(regs)
+		var sum float64
+		zeros := 0
+		for _, r := range regs {
+			sum += 1 / math.Pow(2, float64(r))
+			if r == 0 {
+				zeros++
+			}
+		}
+		if h[0] != zeros || math.Abs(h.harmonicSum()-sum) > 1e-9 {
+			t.Fatalf("bad: %d %v %v", n, h.harmonicSum(), sum)
+		}
+	}
+}
+
+func TestMergeRegisters(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{3, 16, 67} {
+		dst, src := randomRegisters(rng, n), randomRegisters(rng, n)
+		expect := make([]uint8, n)
+		for i := range expect {
+			expect[i] = dst[i]
+			if src[i] > dst[i] {
+				expect[i] = src[i]
+			}
+		}
+		mergeRegisters(dst, src)
+		for i := range expect {
+			if dst[i] != expect[i] {
+				t.Fatalf("bad: %d %d %d", n, i, dst[i])
+			}
+		}
+	}
+}
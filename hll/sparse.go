@@ -0,0 +1,45 @@
+package hll
+
+import (
+	"sort"
+)
+
+// sparseEntrySize is the size of a sparse entry in bytes
+const sparseEntrySize = 4
+
+// sparseEntry is a register that is set, with the index
+// in the upper 24 bits and the rank in the lower 8 bits
+type sparseEntry uint32
+
+func newSparseEntry(idx uint32, rank uint8) sparseEntry {
+	return sparseEntry(idx<<8 | uint32(rank))
+}
+
+func (e sparseEntry) index() uint32 {
+	return uint32(e) >> 8
+}
+
+func (e sparseEntry) rank() uint8 {
+	return uint8(e)
+}
+
+// sparseList is the registers that are set, sorted by index
+type sparseList []sparseEntry
+
+// set is used to raise a register to at least the given rank,
+// returning the updated list
+func (l sparseList) set(idx uint32, rank uint8) sparseList {
+	i := sort.Search(len(l), func(i int) bool {
+		return l[i].index() >= idx
+	})
+	if i < len(l) && l[i].index() == idx {
+		if rank > l[i].rank() {
+			l[i] = newSparseEntry(idx, rank)
+		}
+		return l
+	}
+	l = append(l, 0)
+	copy(l[i+1:], l[i:])
+	l[i] = newSparseEntry(idx, rank)
+	return l
+}
@@ -0,0 +1,26 @@
+package hll
+
+import (
+	"testing"
+)
+
+func TestSparseList_Set(t *testing.T) {
+	var l sparseList
+	l = l.set(5, 2)
+	l = l.set(1, 3)
+	l = l.set(9, 1)
+	l = l.set(5, 1)
+	l = l.set(5, 4)
+	if len(l) != 3 {
+		t.Fatalf("bad: %v", l)
+	}
+	expect := []struct {
+		idx  uint32
+		rank uint8
+	}{{1, 3}, {5, 4}, {9, 1}}
+	for i, e := range expect {
+		if l[i].index() != e.idx || l[i].rank() != e.rank {
+			t.Fatalf("bad: %d %v", i, l[i])
+		}
+	}
+}
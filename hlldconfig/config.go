@@ -0,0 +1,198 @@
+// Package hlldconfig loads the settings shared by the tools in this
+// repository from a JSON configuration file.
+package hlldconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+// Duration is a time.Duration encoded as a string such as "5s"
+type Duration time.Duration
+
+// UnmarshalJSON is used to parse a duration string
+func (d *Duration) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+// MarshalJSON is used to encode the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config is the contents of a configuration file. Unspecified
+// fields use the client defaults.
+type Config struct {
+	// Addr is the address of the hlld server
+	Addr string `json:"addr"`
+
+	// Timeout is the read or write timeout
+	Timeout Duration `json:"timeout"`
+
+	// EnqueueTimeout is the maximum time to wait to queue a command
+	EnqueueTimeout Duration `json:"enqueue_timeout"`
+
+	// MaxPipeline is the maximum number of commands to pipeline
+	MaxPipeline int `json:"max_pipeline"`
+
+	// MaxKeysPerCommand and MaxCommandBytes limit the size of commands,
+	// matching the limits of the server
+	MaxKeysPerCommand int `json:"max_keys_per_command"`
+	MaxCommandBytes   int `json:"max_command_bytes"`
+
+	// TLS enables TLS if provided
+	TLS *hlld.TLSOptions `json:"tls"`
+
+	// Pool configures tools that use a pool of connections
+	Pool *PoolConfig `json:"pool"`
+
+	// Create is the default options of new sets
+	Create *CreateConfig `json:"create"`
+}
+
+// PoolConfig is the pool section of the configuration
+type PoolConfig struct {
+	// Size is the number of connections to maintain
+	Size int `json:"size"`
+
+	// Affinity routes commands for the same set to the same connection
+	Affinity *bool `json:"affinity"`
+}
+
+// CreateConfig is the default options of new sets
+type CreateConfig struct {
+	Precision    int     `json:"precision"`
+	ErrThreshold float64 `json:"eps"`
+	InMemory     bool    `json:"in_memory"`
+}
+
+// Load is used to read a configuration file
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	conf, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	return conf, nil
+}
+
+// Parse is used to decode a configuration
+func Parse(r io.Reader) (*Config, error) {
+	conf := &Config{}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// Address returns the configured address or the default address
+func (c *Config) Address() string {
+	if c.Addr != "" {
+		return c.Addr
+	}
+	return hlld.DefaultAddr
+}
+
+// ClientConfig returns the client configuration
+func (c *Config) ClientConfig() (*hlld.Config, error) {
+	conf := &hlld.Config{
+		Timeout:        time.Duration(c.Timeout),
+		EnqueueTimeout: time.Duration(c.EnqueueTimeout),
+		MaxPipeline:    c.MaxPipeline,
+
+		MaxKeysPerCommand: c.MaxKeysPerCommand,
+		MaxCommandBytes:   c.MaxCommandBytes,
+	}
+	conf.MergeDefaults()
+	conf.DefaultCreateOptions = c.createOptions()
+	if c.TLS != nil {
+		tlsConf, err := c.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+		conf.TLSConfig = tlsConf
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// PoolConfig returns the pool configuration
+func (c *Config) PoolConfig() (*hlld.PoolConfig, error) {
+	client, err := c.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	conf := hlld.DefaultPoolConfig()
+	conf.Client = client
+	if c.Pool != nil {
+		if c.Pool.Size != 0 {
+			conf.Size = c.Pool.Size
+		}
+		if c.Pool.Affinity != nil {
+			conf.Affinity = *c.Pool.Affinity
+		}
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// ApplyCreate is used to set the default options on a create
+// command for any options it does not specify
+func (c *Config) ApplyCreate(cmd *hlld.CreateCommand) {
+	c.createOptions().Apply(cmd)
+}
+
+// createOptions returns the default create options, if any
+func (c *Config) createOptions() *hlld.CreateOptions {
+	if c.Create == nil {
+		return nil
+	}
+	return &hlld.CreateOptions{
+		Precision:    c.Create.Precision,
+		ErrThreshold: c.Create.ErrThreshold,
+		InMemory:     c.Create.InMemory,
+	}
+}
+
+// Dial is used to connect to the configured server
+func (c *Config) Dial() (*hlld.Client, error) {
+	conf, err := c.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return hlld.DialConfig(c.Address(), conf)
+}
+
+// Lazy returns a client for the configured server that dials on first
+// use, and redials if the connection is lost
+func (c *Config) Lazy() (*hlld.LazyClient, error) {
+	conf, err := c.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return hlld.NewLazyClient(c.Address(), conf)
+}
@@ -0,0 +1,157 @@
+package hlldconfig
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+func TestParse(t *testing.T) {
+	inp := `{
+	"addr": "hlld:4553",
+	"timeout": "2s",
+	"enqueue_timeout": "100ms",
+	"max_pipeline": 64,
+	"max_keys_per_command": 1000,
+	"max_command_bytes": 65536,
+	"tls": {"server_name": "hlld.local"},
+	"pool": {"size": 8, "affinity": false},
+	"create": {"precision": 14, "in_memory": true}
+}`
+	conf, err := Parse(strings.NewReader(inp))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf.Address() != "hlld:4553" {
+		t.Fatalf("bad: %#v", conf)
+	}
+
+	client, err := conf.ClientConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if client.Timeout != 2*time.Second || client.MaxPipeline != 64 {
+		t.Fatalf("bad: %#v", client)
+	}
+	if client.EnqueueTimeout != 100*time.Millisecond {
+		t.Fatalf("bad: %#v", client)
+	}
+	if client.MaxKeysPerCommand != 1000 || client.MaxCommandBytes != 65536 {
+		t.Fatalf("bad: %#v", client)
+	}
+	if client.TLSConfig == nil || client.TLSConfig.ServerName != "hlld.local" {
+		t.Fatalf("bad: %#v", client.TLSConfig)
+	}
+	if opts := client.DefaultCreateOptions; opts == nil || opts.Precision != 14 || !opts.InMemory {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	pool, err := conf.PoolConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if pool.Size != 8 || pool.Affinity || pool.Client.MaxPipeline != 64 {
+		t.Fatalf("bad: %#v", pool)
+	}
+
+	create, _ := hlld.NewCreateCommand("foo")
+	conf.ApplyCreate(create)
+	if create.Precision != 14 || !create.InMemory {
+		t.Fatalf("bad: %#v", create)
+	}
+
+	// Explicit options are not overridden
+	create, _ = hlld.NewCreateCommand("foo")
+	create.ErrThreshold = 0.01
+	conf.ApplyCreate(create)
+	if create.Precision != 0 || create.ErrThreshold != 0.01 {
+		t.Fatalf("bad: %#v", create)
+	}
+}
+
+func TestParse_Defaults(t *testing.T) {
+	conf, err := Parse(strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf.Address() != hlld.DefaultAddr {
+		t.Fatalf("bad: %s", conf.Address())
+	}
+
+	client, err := conf.ClientConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defaults := hlld.DefaultConfig()
+	if client.Timeout != defaults.Timeout || client.MaxPipeline != defaults.MaxPipeline {
+		t.Fatalf("bad: %#v", client)
+	}
+
+	pool, err := conf.PoolConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if pool.Size != hlld.DefaultPoolConfig().Size || !pool.Affinity {
+		t.Fatalf("bad: %#v", pool)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	cases := []string{
+		`{"timeout": 5}`,
+		`{"timeout": "forever"}`,
+		`{"unknown": true}`,
+		`not json`,
+	}
+	for _, inp := range cases {
+		if _, err := Parse(strings.NewReader(inp)); err == nil {
+			t.Fatalf("expect error: %s", inp)
+		}
+	}
+
+	// Valid syntax, but invalid values
+	conf, err := Parse(strings.NewReader(`{"max_pipeline": -1}`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := conf.ClientConfig(); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	f, err := ioutil.TempFile("", "hlldconfig")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"addr": "hlld:4553"}`)
+	f.Close()
+
+	conf, err := Load(f.Name())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf.Addr != "hlld:4553" {
+		t.Fatalf("bad: %#v", conf)
+	}
+
+	if _, err := Load("/does/not/exist"); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestDuration_MarshalJSON(t *testing.T) {
+	out, err := json.Marshal(Duration(5 * time.Second))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(out) != `"5s"` {
+		t.Fatalf("bad: %s", out)
+	}
+}
@@ -0,0 +1,141 @@
+package hlldproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditOptions are used to configure audit logging
+type AuditOptions struct {
+	// Output is where records are written, as a JSON object per line
+	Output io.Writer
+
+	// SampleRate is the fraction of successful commands that are
+	// logged, which defaults to logging all of them. Failed commands
+	// are always logged.
+	SampleRate float64
+
+	// Tenants is used to identify the tenant of each connection,
+	// if the proxy enforces tenants
+	Tenants *Tenants
+}
+
+// AuditRecord is a command logged by the audit layer
+type AuditRecord struct {
+	// Time is when the command was received
+	Time time.Time `json:"time"`
+
+	// Tenant is the name of the authenticated tenant, if any
+	Tenant string `json:"tenant,omitempty"`
+
+	// Command is the command name, such as bulk. Arguments
+	// are not logged, so keys and API keys are never recorded.
+	Command string `json:"command"`
+
+	// Set is the set name of the command, if any
+	Set string `json:"set,omitempty"`
+
+	// Keys is the number of keys of a set command
+	Keys int `json:"keys,omitempty"`
+
+	// Latency is the time until the response was ready, in milliseconds
+	Latency float64 `json:"latency_ms"`
+
+	// Outcome is ok, or error if the response was an error
+	Outcome string `json:"outcome"`
+
+	// Error is the error response, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Audit is used to log the commands handled by a proxy
+type Audit struct {
+	opts   AuditOptions
+	lock   sync.Mutex
+	enc    *json.Encoder
+	random func() float64
+}
+
+// NewAudit creates the audit layer
+func NewAudit(opts *AuditOptions) (*Audit, error) {
+	if opts.Output == nil {
+		return nil, fmt.Errorf("audit output must be set")
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return nil, fmt.Errorf("audit sample rate must be in [0, 1], got %v", opts.SampleRate)
+	}
+	a := &Audit{
+		opts:   *opts,
+		enc:    json.NewEncoder(opts.Output),
+		random: rand.Float64,
+	}
+	if a.opts.SampleRate == 0 {
+		a.opts.SampleRate = 1
+	}
+	return a, nil
+}
+
+// Wrap returns a function that creates a handler for each connection,
+// which logs each command after the next handler responds. It should
+// wrap the tenant layer, so that rejected commands are also logged.
+func (a *Audit) Wrap(newHandler func() Handler) func() Handler {
+	return func() Handler {
+		next := newHandler()
+		var tenant string
+		return func(line string) Reply {
+			start := time.Now()
+			fields := strings.Fields(line)
+			reply := next(line)
+			return func() string {
+				resp := reply()
+				record := &AuditRecord{
+					Time:    start,
+					Tenant:  tenant,
+					Latency: float64(time.Since(start)) / float64(time.Millisecond),
+					Outcome: "ok",
+				}
+				if len(fields) > 0 {
+					record.Command = fields[0]
+				}
+
+				// The API key of an auth command identifies the tenant
+				// of the connection, but is never logged
+				switch record.Command {
+				case "auth":
+					if resp == "Done\n" && len(fields) == 2 && a.opts.Tenants != nil {
+						tenant = a.opts.Tenants.name(fields[1])
+						record.Tenant = tenant
+					}
+				case "set", "s", "bulk", "b":
+					if len(fields) > 2 {
+						record.Keys = len(fields) - 2
+					}
+				}
+				if record.Command != "auth" && len(fields) > 1 {
+					record.Set = fields[1]
+				}
+				if strings.HasPrefix(resp, "Client Error") || strings.HasPrefix(resp, "Internal Error") {
+					record.Outcome = "error"
+					record.Error = strings.TrimSuffix(resp, "\n")
+				}
+				a.log(record)
+				return resp
+			}
+		}
+	}
+}
+
+// log is used to write a record, sampling successful commands
+func (a *Audit) log(record *AuditRecord) {
+	if record.Outcome == "ok" && a.opts.SampleRate < 1 && a.random() >= a.opts.SampleRate {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.enc.Encode(record)
+}
@@ -0,0 +1,122 @@
+package hlldproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// auditRecords is used to decode the records written to a buffer
+func auditRecords(t *testing.T, buf *bytes.Buffer) []*AuditRecord {
+	var out []*AuditRecord
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record AuditRecord
+		if err := dec.Decode(&record); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		out = append(out, &record)
+	}
+	return out
+}
+
+func TestAudit(t *testing.T) {
+	tenants, err := NewTenants(nil, []*Tenant{
+		{Name: "web", APIKey: "secret", Prefixes: []string{"web-"}},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var buf bytes.Buffer
+	audit, err := NewAudit(&AuditOptions{Output: &buf, Tenants: tenants})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	handler := audit.Wrap(tenants.Wrap(func(line string) Reply {
+		return Static("Done\n")
+	}))()
+
+	for _, line := range []string{
+		"auth secret\n",
+		"b web-users a b c\n",
+		"s web-users a\n",
+		"drop api-keys\n",
+		"list web-\n",
+	} {
+		handler(line)()
+	}
+
+	records := auditRecords(t, &buf)
+	if len(records) != 5 {
+		t.Fatalf("bad: %v", records)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("logged API key")
+	}
+	expect := []AuditRecord{
+		{Tenant: "web", Command: "auth", Outcome: "ok"},
+		{Tenant: "web", Command: "b", Set: "web-users", Keys: 3, Outcome: "ok"},
+		{Tenant: "web", Command: "s", Set: "web-users", Keys: 1, Outcome: "ok"},
+		{Tenant: "web", Command: "drop", Set: "api-keys", Outcome: "error", Error: "Client Error: Forbidden"},
+		{Tenant: "web", Command: "list", Set: "web-", Outcome: "ok"},
+	}
+	for idx, r := range records {
+		if r.Time.IsZero() || r.Latency < 0 {
+			t.Fatalf("bad: %#v", r)
+		}
+		r.Time, r.Latency = expect[idx].Time, 0
+		if *r != expect[idx] {
+			t.Fatalf("bad: %#v (expected %#v)", r, expect[idx])
+		}
+	}
+}
+
+func TestAudit_Sampling(t *testing.T) {
+	var buf bytes.Buffer
+	audit, err := NewAudit(&AuditOptions{Output: &buf, SampleRate: 0.5})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	samples := []float64{0.2, 0.7}
+	audit.random = func() float64 {
+		v := samples[0]
+		samples = samples[1:]
+		return v
+	}
+	handler := audit.Wrap(func() Handler {
+		return func(line string) Reply {
+			if strings.HasPrefix(line, "drop") {
+				return Static(InternalError)
+			}
+			return Static("Done\n")
+		}
+	})()
+
+	// The second success is not sampled, but errors are always logged
+	handler("set a x\n")()
+	handler("set b x\n")()
+	handler("drop c\n")()
+
+	records := auditRecords(t, &buf)
+	if len(records) != 2 || records[0].Set != "a" || records[1].Set != "c" {
+		t.Fatalf("bad: %s", buf.String())
+	}
+	if records[1].Outcome != "error" || records[1].Error != "Internal Error" || records[1].Tenant != "" {
+		t.Fatalf("bad: %#v", records[1])
+	}
+}
+
+func TestNewAudit_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	cases := []*AuditOptions{
+		{},
+		{Output: &buf, SampleRate: -1},
+		{Output: &buf, SampleRate: 1.5},
+	}
+	for _, tc := range cases {
+		if _, err := NewAudit(tc); err == nil {
+			t.Fatalf("expect error: %v", tc)
+		}
+	}
+}
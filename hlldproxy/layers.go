@@ -0,0 +1,97 @@
+package hlldproxy
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/armon/go-hlld"
+)
+
+// Layers configures the optional naming policy, tenant and audit layers
+// shared by the proxies. Each layer is enabled by the path to its file.
+type Layers struct {
+	// NamingPath is the path to a JSON file of a naming policy
+	// to enforce on new sets
+	NamingPath string
+
+	// TenantsPath is the path to a JSON file of tenants to enforce
+	TenantsPath string
+
+	// AuditPath is the path to a file to append audit records to, and
+	// AuditSample is the fraction of successful commands recorded
+	AuditPath   string
+	AuditSample float64
+
+	// audit is the open audit log, if any
+	audit *os.File
+}
+
+// RegisterFlags is used to register a flag for each setting
+func (l *Layers) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&l.TenantsPath, "tenants", "", "path to a JSON file of tenants to enforce")
+	fs.StringVar(&l.NamingPath, "naming", "", "path to a JSON file of a naming policy to enforce on new sets")
+	fs.StringVar(&l.AuditPath, "audit", "", "path to a file to append audit records to")
+	fs.Float64Var(&l.AuditSample, "audit-sample", 1, "fraction of successful commands recorded in the audit log")
+}
+
+// Wrap is used to load the configured layers and apply them in front of
+// a handler, returning a function that creates the handler of each
+// connection. The naming policy is checked first, then the tenants,
+// which use the client to count their sets. The audit layer is outermost,
+// so the commands rejected by the other layers are also recorded. Close
+// must be called once the handlers are no longer used.
+func (l *Layers) Wrap(client hlld.Executor, handler Handler) (func() Handler, error) {
+	if l.NamingPath != "" {
+		policy, err := LoadNamingPolicy(l.NamingPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load naming policy: %w", err)
+		}
+		naming, err := NewNaming(policy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid naming policy: %w", err)
+		}
+		handler = naming.Wrap(handler)
+	}
+
+	newHandler := func() Handler { return handler }
+	var layer *Tenants
+	if l.TenantsPath != "" {
+		tenants, err := LoadTenants(l.TenantsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tenants: %w", err)
+		}
+		layer, err = NewTenants(client, tenants)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tenants: %w", err)
+		}
+		newHandler = layer.Wrap(handler)
+	}
+
+	if l.AuditPath != "" {
+		f, err := os.OpenFile(l.AuditPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		audit, err := NewAudit(&AuditOptions{
+			Output:     f,
+			SampleRate: l.AuditSample,
+			Tenants:    layer,
+		})
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid audit options: %w", err)
+		}
+		l.audit = f
+		newHandler = audit.Wrap(newHandler)
+	}
+	return newHandler, nil
+}
+
+// Close is used to close the audit log, if any
+func (l *Layers) Close() error {
+	if l.audit == nil {
+		return nil
+	}
+	return l.audit.Close()
+}
@@ -0,0 +1,91 @@
+package hlldproxy
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayers_RegisterFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	layers := &Layers{}
+	layers.RegisterFlags(fs)
+	err := fs.Parse([]string{"-tenants", "t.json", "-naming", "n.json", "-audit", "audit.log", "-audit-sample", "0.5"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if layers.TenantsPath != "t.json" || layers.NamingPath != "n.json" ||
+		layers.AuditPath != "audit.log" || layers.AuditSample != 0.5 {
+		t.Fatalf("bad: %#v", layers)
+	}
+}
+
+func TestLayers_Wrap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layers")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	layers := &Layers{
+		NamingPath:  filepath.Join(dir, "naming.json"),
+		TenantsPath: filepath.Join(dir, "tenants.json"),
+		AuditPath:   filepath.Join(dir, "audit.log"),
+		AuditSample: 1,
+	}
+	ioutil.WriteFile(layers.NamingPath, []byte(`{"reserved": ["web-admin"]}`), 0600)
+	ioutil.WriteFile(layers.TenantsPath, []byte(`[{"name": "web", "api_key": "secret", "prefixes": ["web-"]}]`), 0600)
+
+	newHandler, err := layers.Wrap(nil, func(line string) Reply {
+		return Static("Done\n")
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	handler := newHandler()
+
+	cases := []struct {
+		line   string
+		expect string
+	}{
+		{"create web-users\n", Unauthorized},
+		{"auth secret\n", "Done\n"},
+		{"create web-users\n", "Done\n"},
+		{"create api-users\n", Forbidden},
+	}
+	for _, tc := range cases {
+		if resp := handler(tc.line)(); resp != tc.expect {
+			t.Fatalf("bad: %q %q (expected %q)", tc.line, resp, tc.expect)
+		}
+	}
+
+	// Names reserved by the naming policy are rejected
+	if resp := handler("create web-admin\n")(); !strings.HasPrefix(resp, "Client Error") {
+		t.Fatalf("bad: %q", resp)
+	}
+
+	// Every command is audited, including the rejected ones
+	if err := layers.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	buf, err := ioutil.ReadFile(layers.AuditPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n := strings.Count(string(buf), "\n"); n != 5 {
+		t.Fatalf("bad: %s", buf)
+	}
+	if !strings.Contains(string(buf), `"tenant":"web"`) {
+		t.Fatalf("bad: %s", buf)
+	}
+}
+
+func TestLayers_Wrap_Invalid(t *testing.T) {
+	layers := &Layers{TenantsPath: "/does/not/exist"}
+	if _, err := layers.Wrap(nil, nil); err == nil {
+		t.Fatalf("expect error")
+	}
+}
@@ -0,0 +1,143 @@
+package hlldproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// NamingPolicy is a convention enforced on the names of new sets, which
+// protects a shared server from sets created outside of any namespace
+type NamingPolicy struct {
+	// Pattern is an optional regex that set names must match
+	Pattern string `json:"pattern"`
+
+	// Prefixes are the prefixes set names must start with, or
+	// empty to allow any prefix
+	Prefixes []string `json:"prefixes"`
+
+	// Reserved are names that may not be used for new sets
+	Reserved []string `json:"reserved"`
+}
+
+// LoadNamingPolicy is used to read a JSON file with a naming policy
+func LoadNamingPolicy(path string) (*NamingPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var policy NamingPolicy
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	return &policy, nil
+}
+
+// NamingError is returned when a set name violates the naming policy
+type NamingError struct {
+	// SetName is the rejected name
+	SetName string
+
+	// Rule is the violated rule, one of pattern, prefix or reserved
+	Rule string
+
+	// Reason describes the violation
+	Reason string
+}
+
+func (e *NamingError) Error() string {
+	return fmt.Sprintf("set name '%s' violates the %s rule: %s", e.SetName, e.Rule, e.Reason)
+}
+
+// Response returns the protocol response to the violation, which
+// starts with "Client Error: Naming policy violation" so that
+// clients can detect it, followed by the rule and reason
+func (e *NamingError) Response() string {
+	return fmt.Sprintf("Client Error: Naming policy violation (%s): %s\n", e.Rule, e.Reason)
+}
+
+// Naming is used to enforce a naming policy on created sets
+type Naming struct {
+	policy   *NamingPolicy
+	pattern  *regexp.Regexp
+	reserved map[string]struct{}
+}
+
+// NewNaming creates the naming layer, validating the policy
+func NewNaming(policy *NamingPolicy) (*Naming, error) {
+	n := &Naming{
+		policy:   policy,
+		reserved: make(map[string]struct{}),
+	}
+	if policy.Pattern != "" {
+		pattern, err := regexp.Compile(policy.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid naming pattern: %w", err)
+		}
+		n.pattern = pattern
+	}
+	for _, prefix := range policy.Prefixes {
+		if prefix == "" {
+			return nil, fmt.Errorf("naming prefixes must not be empty")
+		}
+	}
+	for _, name := range policy.Reserved {
+		n.reserved[name] = struct{}{}
+	}
+	return n, nil
+}
+
+// Check is used to validate a set name against the policy,
+// returning a *NamingError if it is not allowed
+func (n *Naming) Check(name string) error {
+	if err := n.check(name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// check returns the violation of the policy by a set name, if any
+func (n *Naming) check(name string) *NamingError {
+	if _, ok := n.reserved[name]; ok {
+		return &NamingError{SetName: name, Rule: "reserved", Reason: fmt.Sprintf("'%s' is reserved", name)}
+	}
+	if len(n.policy.Prefixes) > 0 {
+		allowed := false
+		for _, prefix := range n.policy.Prefixes {
+			if strings.HasPrefix(name, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &NamingError{SetName: name, Rule: "prefix",
+				Reason: fmt.Sprintf("must start with one of %s", strings.Join(n.policy.Prefixes, ", "))}
+		}
+	}
+	if n.pattern != nil && !n.pattern.MatchString(name) {
+		return &NamingError{SetName: name, Rule: "pattern",
+			Reason: fmt.Sprintf("must match %s", n.policy.Pattern)}
+	}
+	return nil
+}
+
+// Wrap returns a handler that enforces the policy on create commands
+// before invoking the next handler. Commands on existing sets are not
+// checked, so sets created before the policy remain usable.
+func (n *Naming) Wrap(next Handler) Handler {
+	return func(line string) Reply {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "create" {
+			if err := n.check(fields[1]); err != nil {
+				return Static(err.Response())
+			}
+		}
+		return next(line)
+	}
+}
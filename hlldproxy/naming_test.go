@@ -0,0 +1,91 @@
+package hlldproxy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestNaming(t *testing.T) {
+	naming, err := NewNaming(&NamingPolicy{
+		Pattern:  `^[a-z0-9-]+$`,
+		Prefixes: []string{"web-", "api-"},
+		Reserved: []string{"web-all"},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	handler := naming.Wrap(func(line string) Reply {
+		return Static("Done\n")
+	})
+
+	cases := []struct {
+		line   string
+		expect string
+	}{
+		{"create web-users precision=14\n", "Done\n"},
+		{"create team-users\n", "Client Error: Naming policy violation (prefix): must start with one of web-, api-\n"},
+		{"create web-Users\n", "Client Error: Naming policy violation (pattern): must match ^[a-z0-9-]+$\n"},
+		{"create web-all\n", "Client Error: Naming policy violation (reserved): 'web-all' is reserved\n"},
+
+		// Existing sets are not checked
+		{"set team-users foo\n", "Done\n"},
+		{"drop web-all\n", "Done\n"},
+		{"list\n", "Done\n"},
+	}
+	for _, tc := range cases {
+		if resp := handler(tc.line)(); resp != tc.expect {
+			t.Fatalf("bad: %q %q (expected %q)", tc.line, resp, tc.expect)
+		}
+	}
+
+	err = naming.Check("team-users")
+	var ne *NamingError
+	if !errors.As(err, &ne) || ne.SetName != "team-users" || ne.Rule != "prefix" {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestNewNaming_Invalid(t *testing.T) {
+	cases := []*NamingPolicy{
+		{Pattern: "("},
+		{Prefixes: []string{"a-", ""}},
+	}
+	for _, tc := range cases {
+		if _, err := NewNaming(tc); err == nil {
+			t.Fatalf("expect error: %v", tc)
+		}
+	}
+
+	// An empty policy allows any name
+	naming, err := NewNaming(&NamingPolicy{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := naming.Check("anything"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestLoadNamingPolicy(t *testing.T) {
+	f, err := ioutil.TempFile("", "naming")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"pattern": "^[a-z-]+$", "prefixes": ["a-"], "reserved": ["a-all"]}`)
+	f.Close()
+
+	policy, err := LoadNamingPolicy(f.Name())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if policy.Pattern != "^[a-z-]+$" || len(policy.Prefixes) != 1 || policy.Reserved[0] != "a-all" {
+		t.Fatalf("bad: %#v", policy)
+	}
+
+	if _, err := LoadNamingPolicy("/does/not/exist"); err == nil {
+		t.Fatalf("expect error")
+	}
+}
@@ -0,0 +1,62 @@
+package hlldproxy
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket used for rate limiting
+type bucket struct {
+	// rate is the number of tokens added per second, with up
+	// to burst tokens at once. Zero means unlimited.
+	rate  float64
+	burst int
+
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+// allow is used to take a token from the bucket
+func (b *bucket) allow(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	burst := float64(b.burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// ConnRateLimit returns a function that creates a handler for each
+// connection, which limits the connection to rate commands per second
+// with up to burst commands at once before invoking the next handler.
+// Commands over the limit are rejected with RateLimited.
+func ConnRateLimit(rate float64, burst int, next Handler) func() Handler {
+	return func() Handler {
+		b := &bucket{rate: rate, burst: burst}
+		return func(line string) Reply {
+			if !b.allow(time.Now()) {
+				return Static(RateLimited)
+			}
+			return next(line)
+		}
+	}
+}
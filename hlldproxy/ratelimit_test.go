@@ -0,0 +1,51 @@
+package hlldproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket_Allow(t *testing.T) {
+	b := &bucket{rate: 10}
+	now := time.Now()
+	if !b.allow(now) {
+		t.Fatalf("should allow")
+	}
+	if b.allow(now) {
+		t.Fatalf("should not allow")
+	}
+
+	// Tokens are replenished over time
+	if !b.allow(now.Add(100 * time.Millisecond)) {
+		t.Fatalf("should allow")
+	}
+}
+
+func TestConnRateLimit(t *testing.T) {
+	newHandler := ConnRateLimit(0.001, 2, func(line string) Reply {
+		return Static("Done\n")
+	})
+
+	// Each connection has its own limit
+	for conn := 0; conn < 2; conn++ {
+		handler := newHandler()
+		for i := 0; i < 2; i++ {
+			if resp := handler("s foo a\n")(); resp != "Done\n" {
+				t.Fatalf("bad: %q", resp)
+			}
+		}
+		if resp := handler("s foo a\n")(); resp != RateLimited {
+			t.Fatalf("bad: %q", resp)
+		}
+	}
+
+	// Zero is unlimited
+	handler := ConnRateLimit(0, 0, func(line string) Reply {
+		return Static("Done\n")
+	})()
+	for i := 0; i < 100; i++ {
+		if resp := handler("s foo a\n")(); resp != "Done\n" {
+			t.Fatalf("bad: %q", resp)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package hlldproxy provides the building blocks for proxies that
+// speak the hlld protocol to their clients.
+package hlldproxy
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	"github.com/armon/go-hlld"
+)
+
+const (
+	// InternalError is the response used when a command could not
+	// be forwarded to the upstream server
+	InternalError = "Internal Error\n"
+
+	// UnsupportedCommand is the response used for unknown commands
+	UnsupportedCommand = "Client Error: Command not supported\n"
+
+	// maxPendingReplies is the number of replies that can be
+	// pending on a single connection before reads are paused
+	maxPendingReplies = 1024
+)
+
+// Reply is a pending response to a command line. Replies are invoked
+// in the order the commands were received, and must return the complete
+// response including the trailing newline.
+type Reply func() string
+
+// Handler is invoked for each command line received from a client. It
+// should not block waiting for a response, but instead return a Reply
+// so that commands from a client can be pipelined.
+type Handler func(line string) Reply
+
+// Static returns a reply with a fixed response
+func Static(resp string) Reply {
+	return func() string {
+		return resp
+	}
+}
+
+// Forward is used to send a command line to the upstream server,
+// returning a reply that waits for the raw response. The executor is
+// typically a LazyClient, so that a lost upstream connection is redialed.
+func Forward(exec hlld.Executor, line string) Reply {
+	cmd, err := hlld.NewRawCommand(line)
+	if err != nil {
+		return Static(UnsupportedCommand)
+	}
+	f, err := exec.Execute(cmd)
+	if err != nil {
+		return Static(InternalError)
+	}
+	return func() string {
+		if err := f.Error(); err != nil {
+			return InternalError
+		}
+		resp, err := cmd.Result()
+		if err != nil {
+			return InternalError
+		}
+		return resp
+	}
+}
+
+// Server accepts connections speaking the hlld protocol and
+// dispatches each command line to a handler
+type Server struct {
+	newHandler func() Handler
+	list       net.Listener
+
+	// conns is guarded by connsLock, along with closed, which is set
+	// so that connections accepted during Close are not leaked
+	conns     map[net.Conn]struct{}
+	closed    bool
+	connsLock sync.Mutex
+	wg        sync.WaitGroup
+}
+
+// NewServer starts serving connections from the listener
+func NewServer(list net.Listener, handler Handler) *Server {
+	return NewConnServer(list, func() Handler { return handler })
+}
+
+// NewConnServer starts serving connections from the listener, invoking
+// newHandler for each connection. This is used by handlers that keep
+// state for each connection, such as the authenticated tenant.
+func NewConnServer(list net.Listener, newHandler func() Handler) *Server {
+	s := &Server{
+		newHandler: newHandler,
+		list:       list,
+		conns:      make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.listen()
+	return s
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.list.Addr()
+}
+
+// Close stops the listener and closes all client connections
+func (s *Server) Close() error {
+	err := s.list.Close()
+	s.connsLock.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsLock.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// listen accepts new client connections
+func (s *Server) listen() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.list.Accept()
+		if err != nil {
+			return
+		}
+		if !s.track(conn) {
+			return
+		}
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// track is used to register a connection for cleanup on Close. If the
+// server is already closed, the connection is closed and false returned.
+func (s *Server) track(conn net.Conn) bool {
+	s.connsLock.Lock()
+	defer s.connsLock.Unlock()
+	if s.closed {
+		conn.Close()
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// handle reads command lines from a client and dispatches them
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.connsLock.Lock()
+		delete(s.conns, conn)
+		s.connsLock.Unlock()
+		conn.Close()
+	}()
+
+	replyCh := make(chan Reply, maxPendingReplies)
+	doneCh := make(chan struct{})
+	go s.write(conn, replyCh, doneCh)
+
+	handler := s.newHandler()
+	bufR := bufio.NewReader(conn)
+	for {
+		line, err := bufR.ReadString('\n')
+		if err != nil {
+			break
+		}
+		replyCh <- handler(line)
+	}
+	close(replyCh)
+	<-doneCh
+}
+
+// write invokes the pending replies in order and writes the responses
+func (s *Server) write(conn net.Conn, replyCh chan Reply, doneCh chan struct{}) {
+	defer close(doneCh)
+	bufW := bufio.NewWriter(conn)
+	failed := false
+	for reply := range replyCh {
+		// Drain the remaining replies after a failure
+		resp := reply()
+		if failed {
+			continue
+		}
+		if _, err := bufW.WriteString(resp); err != nil {
+			failed = true
+			continue
+		}
+
+		// Flush once there are no more replies ready
+		if len(replyCh) == 0 {
+			if err := bufW.Flush(); err != nil {
+				failed = true
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package hlldproxy
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/armon/go-hlld"
+)
+
+// testListener returns a listener on a random local port
+func testListener(t *testing.T) net.Listener {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return list
+}
+
+func TestServer(t *testing.T) {
+	server := NewServer(testListener(t), func(line string) Reply {
+		if strings.HasPrefix(line, "drop") {
+			return Static("Done\n")
+		}
+		return Static(UnsupportedCommand)
+	})
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	// Pipeline two commands
+	if _, err := conn.Write([]byte("drop foo\nfoo bar\n")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	bufR := bufio.NewReader(conn)
+	for _, expect := range []string{"Done\n", UnsupportedCommand} {
+		resp, err := bufR.ReadString('\n')
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if resp != expect {
+			t.Fatalf("bad: %q", resp)
+		}
+	}
+}
+
+func TestServer_TrackAfterClose(t *testing.T) {
+	server := NewServer(testListener(t), func(line string) Reply {
+		return Static(UnsupportedCommand)
+	})
+	server.Close()
+
+	// Connections accepted while closing are closed rather than leaked
+	conn, other := net.Pipe()
+	defer other.Close()
+	if server.track(conn) {
+		t.Fatalf("should not track")
+	}
+	if _, err := other.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected closed connection")
+	}
+}
+
+func TestForward(t *testing.T) {
+	// Upstream answers every info with a block
+	upstream := NewServer(testListener(t), func(line string) Reply {
+		if line == "info foo\n" {
+			return Static("START\nsize 10\nEND\n")
+		}
+		return Static("Done\n")
+	})
+	defer upstream.Close()
+
+	client, err := hlld.Dial(upstream.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	if resp := Forward(client, "info foo\n")(); resp != "START\nsize 10\nEND\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+	if resp := Forward(client, "drop foo\n")(); resp != "Done\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+	if resp := Forward(client, "\n")(); resp != UnsupportedCommand {
+		t.Fatalf("bad: %q", resp)
+	}
+
+	// Closed clients result in an internal error
+	client.Close()
+	if resp := Forward(client, "drop foo\n")(); resp != InternalError {
+		t.Fatalf("bad: %q", resp)
+	}
+}
@@ -0,0 +1,314 @@
+package hlldproxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+const (
+	// Unauthorized is the response to commands from unauthenticated clients
+	Unauthorized = "Client Error: Unauthorized\n"
+
+	// Forbidden is the response to commands on sets outside the
+	// namespace of the tenant
+	Forbidden = "Client Error: Forbidden\n"
+
+	// RateLimited is the response when a tenant exceeds its rate limit
+	RateLimited = "Client Error: Rate limit exceeded\n"
+
+	// SetLimited is the response when a tenant exceeds its set limit
+	SetLimited = "Client Error: Set limit exceeded\n"
+
+	// Reauthenticate is the response to an auth command on
+	// a connection that is already authenticated
+	Reauthenticate = "Client Error: Already authenticated\n"
+)
+
+// Tenant is a client of a shared hlld server, which is identified by
+// an API key and restricted to a namespace of sets
+type Tenant struct {
+	// Name is used to identify the tenant
+	Name string `json:"name"`
+
+	// APIKey is sent by clients with an "auth <key>" command,
+	// which must be the first command on a connection
+	APIKey string `json:"api_key"`
+
+	// Prefixes are the set name prefixes the tenant may use
+	Prefixes []string `json:"prefixes"`
+
+	// RateLimit is the number of commands per second the tenant
+	// may issue across all connections, with up to Burst commands
+	// at once. Zero means unlimited.
+	RateLimit float64 `json:"rate_limit"`
+	Burst     int     `json:"burst"`
+
+	// MaxSets is the number of sets the tenant may have. Zero
+	// means unlimited. The existing sets are counted when the tenants
+	// are loaded, and the count is then tracked from the responses to
+	// the create and drop commands of the tenant.
+	MaxSets int `json:"max_sets"`
+}
+
+// allowed checks if a set name is within the namespace of the tenant
+func (t *Tenant) allowed(name string) bool {
+	for _, prefix := range t.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadTenants is used to read a JSON file with a list of tenants
+func LoadTenants(path string) ([]*Tenant, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tenants []*Tenant
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tenants); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	return tenants, nil
+}
+
+// tenantState is the shared state of a tenant across connections
+type tenantState struct {
+	*Tenant
+
+	// limit is used to rate limit the tenant
+	limit bucket
+
+	// sets is the number of sets of the tenant, and creates is the
+	// number of creates awaiting a response, which count towards the
+	// set limit until they complete
+	sets    int
+	creates int
+	lock    sync.Mutex
+}
+
+// reserve is used to reserve a set for a create command,
+// returning false if the tenant is at its set limit
+func (t *tenantState) reserve() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.sets+t.creates >= t.MaxSets {
+		return false
+	}
+	t.creates++
+	return true
+}
+
+// created is used to release the reservation of a create
+// command, counting the set if it was created
+func (t *tenantState) created(resp string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.creates--
+	if resp == "Done\n" {
+		t.sets++
+	}
+}
+
+// dropped is used to stop counting a set once it is dropped
+func (t *tenantState) dropped(resp string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if resp == "Done\n" && t.sets > 0 {
+		t.sets--
+	}
+}
+
+// Tenants is used to authenticate clients and enforce the namespace,
+// rate limit and set limit of each tenant before forwarding commands
+type Tenants struct {
+	tenants []*tenantState
+}
+
+// NewTenants creates the tenant layer. The client is used to count the
+// existing sets of the tenants with a set limit, and may be nil if
+// no tenant has one.
+func NewTenants(client hlld.Executor, tenants []*Tenant) (*Tenants, error) {
+	t := &Tenants{}
+	keys := make(map[string]struct{})
+	for _, tenant := range tenants {
+		if tenant.APIKey == "" {
+			return nil, fmt.Errorf("tenant '%s' is missing an API key", tenant.Name)
+		}
+		if len(tenant.Prefixes) == 0 {
+			return nil, fmt.Errorf("tenant '%s' has no prefixes", tenant.Name)
+		}
+		if _, ok := keys[tenant.APIKey]; ok {
+			return nil, fmt.Errorf("tenant '%s' has a duplicate API key", tenant.Name)
+		}
+		keys[tenant.APIKey] = struct{}{}
+
+		state := &tenantState{
+			Tenant: tenant,
+			limit:  bucket{rate: tenant.RateLimit, burst: tenant.Burst},
+		}
+		if tenant.MaxSets > 0 {
+			if client == nil {
+				return nil, fmt.Errorf("tenant '%s' has a set limit but there is no client to count sets", tenant.Name)
+			}
+			count, err := countSets(client, tenant)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count the sets of tenant '%s': %w", tenant.Name, err)
+			}
+			state.sets = count
+		}
+		t.tenants = append(t.tenants, state)
+	}
+	return t, nil
+}
+
+// lookup returns the tenant with an API key, or nil. Every key is
+// compared in constant time, so the time taken does not reveal how
+// much of a key matched.
+func (t *Tenants) lookup(apiKey string) *tenantState {
+	var found *tenantState
+	for _, state := range t.tenants {
+		if subtle.ConstantTimeCompare([]byte(state.APIKey), []byte(apiKey)) == 1 {
+			found = state
+		}
+	}
+	return found
+}
+
+// Wrap returns a function that creates a handler for each connection,
+// which authenticates the tenant and then enforces its restrictions
+// before invoking the next handler
+func (t *Tenants) Wrap(next Handler) func() Handler {
+	return func() Handler {
+		var tenant *tenantState
+		return func(line string) Reply {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				return Static(UnsupportedCommand)
+			}
+
+			// The first command must authenticate. An auth command is
+			// never forwarded, since that would leak the API key.
+			if tenant != nil && fields[0] == "auth" {
+				return Static(Reauthenticate)
+			}
+			if tenant == nil {
+				if fields[0] != "auth" || len(fields) != 2 {
+					return Static(Unauthorized)
+				}
+				state := t.lookup(fields[1])
+				if state == nil {
+					return Static(Unauthorized)
+				}
+				tenant = state
+				return Static("Done\n")
+			}
+
+			if !tenant.limit.allow(time.Now()) {
+				return Static(RateLimited)
+			}
+			if resp := t.check(tenant, fields); resp != "" {
+				return Static(resp)
+			}
+			if tenant.MaxSets == 0 {
+				return next(line)
+			}
+
+			// Track the set count from the responses
+			switch fields[0] {
+			case "create":
+				reply := next(line)
+				return func() string {
+					resp := reply()
+					tenant.created(resp)
+					return resp
+				}
+			case "drop":
+				reply := next(line)
+				return func() string {
+					resp := reply()
+					tenant.dropped(resp)
+					return resp
+				}
+			}
+			return next(line)
+		}
+	}
+}
+
+// name returns the name of the tenant with an API key, if any
+func (t *Tenants) name(apiKey string) string {
+	if state := t.lookup(apiKey); state != nil {
+		return state.Name
+	}
+	return ""
+}
+
+// check is used to enforce the namespace and set limit of a tenant,
+// returning an error response if the command is not allowed. A create
+// within the limit reserves a set, which the caller must release.
+func (t *Tenants) check(tenant *tenantState, fields []string) string {
+	switch fields[0] {
+	case "list":
+		// Only listing within the namespace is allowed
+		if len(fields) < 2 || !tenant.allowed(fields[1]) {
+			return Forbidden
+		}
+		return ""
+
+	case "create":
+		if len(fields) < 2 || !tenant.allowed(fields[1]) {
+			return Forbidden
+		}
+		if tenant.MaxSets > 0 && !tenant.reserve() {
+			return SetLimited
+		}
+		return ""
+
+	default:
+		// All other commands, including a global flush, need
+		// a set within the namespace
+		if len(fields) < 2 || !tenant.allowed(fields[1]) {
+			return Forbidden
+		}
+		return ""
+	}
+}
+
+// countSets is used to count the sets in the namespace of a tenant
+func countSets(client hlld.Executor, tenant *Tenant) (int, error) {
+	seen := make(map[string]struct{})
+	for _, prefix := range tenant.Prefixes {
+		cmd, err := hlld.NewListCommand(prefix)
+		if err != nil {
+			return 0, err
+		}
+		f, err := client.Execute(cmd)
+		if err != nil {
+			return 0, err
+		}
+		if err := f.Error(); err != nil {
+			return 0, err
+		}
+		entries, err := cmd.Result()
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range entries {
+			seen[entry.Name] = struct{}{}
+		}
+	}
+	return len(seen), nil
+}
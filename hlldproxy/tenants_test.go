@@ -0,0 +1,207 @@
+package hlldproxy
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/armon/go-hlld"
+)
+
+func TestTenants(t *testing.T) {
+	// Upstream has two sets for the tenant
+	upstream := NewServer(testListener(t), func(line string) Reply {
+		if line == "list team-a-\n" {
+			return Static("START\nteam-a-foo 0.01 12 10 0\nteam-a-bar 0.01 12 10 0\nEND\n")
+		}
+		return Static("Done\n")
+	})
+	defer upstream.Close()
+
+	client, err := hlld.Dial(upstream.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	tenants, err := NewTenants(client, []*Tenant{
+		{Name: "a", APIKey: "secret", Prefixes: []string{"team-a-"}, MaxSets: 2},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	handler := tenants.Wrap(func(line string) Reply {
+		return Forward(client, line)
+	})()
+
+	cases := []struct {
+		line   string
+		expect string
+	}{
+		{"drop team-a-foo\n", Unauthorized},
+		{"auth wrong\n", Unauthorized},
+		{"auth secret\n", "Done\n"},
+		{"create team-a-baz\n", SetLimited},
+		{"drop team-a-foo\n", "Done\n"},
+		{"drop team-b-foo\n", Forbidden},
+		{"flush\n", Forbidden},
+		{"list\n", Forbidden},
+		{"list team-a-\n", "START\nteam-a-foo 0.01 12 10 0\nteam-a-bar 0.01 12 10 0\nEND\n"},
+		{"create team-a-baz\n", "Done\n"},
+		{"create team-a-qux\n", SetLimited},
+		{"create team-b-baz\n", Forbidden},
+	}
+	for _, tc := range cases {
+		if resp := handler(tc.line)(); resp != tc.expect {
+			t.Fatalf("bad: %q %q (expected %q)", tc.line, resp, tc.expect)
+		}
+	}
+
+	// Each connection must authenticate
+	other := tenants.Wrap(func(line string) Reply {
+		return Static("Done\n")
+	})()
+	if resp := other("drop team-a-foo\n")(); resp != Unauthorized {
+		t.Fatalf("bad: %q", resp)
+	}
+}
+
+func TestTenants_SetLimitPending(t *testing.T) {
+	upstream := NewServer(testListener(t), func(line string) Reply {
+		if line == "list a-\n" {
+			return Static("START\nEND\n")
+		}
+		return Static("Done\n")
+	})
+	defer upstream.Close()
+
+	client, err := hlld.Dial(upstream.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	tenants, err := NewTenants(client, []*Tenant{
+		{Name: "a", APIKey: "secret", Prefixes: []string{"a-"}, MaxSets: 1},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	handler := tenants.Wrap(func(line string) Reply {
+		if line == "create a-exists\n" {
+			return Static("Exists\n")
+		}
+		return Static("Done\n")
+	})()
+	handler("auth secret\n")()
+
+	// A create awaiting its response counts towards the limit
+	first := handler("create a-foo\n")
+	if resp := handler("create a-bar\n")(); resp != SetLimited {
+		t.Fatalf("bad: %q", resp)
+	}
+	first()
+	if resp := handler("drop a-foo\n")(); resp != "Done\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+
+	// Creating an existing set does not count
+	if resp := handler("create a-exists\n")(); resp != "Exists\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+	if resp := handler("create a-bar\n")(); resp != "Done\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+}
+
+func TestTenants_RateLimit(t *testing.T) {
+	tenants, err := NewTenants(nil, []*Tenant{
+		{Name: "a", APIKey: "secret", Prefixes: []string{"a-"}, RateLimit: 1, Burst: 2},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	handler := tenants.Wrap(func(line string) Reply {
+		return Static("Done\n")
+	})()
+	handler("auth secret\n")()
+
+	for i := 0; i < 2; i++ {
+		if resp := handler("drop a-foo\n")(); resp != "Done\n" {
+			t.Fatalf("bad: %q", resp)
+		}
+	}
+	if resp := handler("drop a-foo\n")(); resp != RateLimited {
+		t.Fatalf("bad: %q", resp)
+	}
+}
+
+func TestTenants_Reauthenticate(t *testing.T) {
+	tenants, err := NewTenants(nil, []*Tenant{
+		{Name: "a", APIKey: "secret", Prefixes: []string{"a-"}},
+		{Name: "b", APIKey: "a-other", Prefixes: []string{"b-"}},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var forwarded []string
+	handler := tenants.Wrap(func(line string) Reply {
+		forwarded = append(forwarded, line)
+		return Static("Done\n")
+	})()
+	handler("auth secret\n")()
+
+	// A second auth is rejected rather than forwarded with the key
+	for _, line := range []string{"auth a-other\n", "auth secret\n", "auth\n"} {
+		if resp := handler(line)(); resp != Reauthenticate {
+			t.Fatalf("bad: %q %q", line, resp)
+		}
+	}
+	if len(forwarded) != 0 {
+		t.Fatalf("bad: %v", forwarded)
+	}
+
+	// The connection remains authenticated as the first tenant
+	if resp := handler("drop b-foo\n")(); resp != Forbidden {
+		t.Fatalf("bad: %q", resp)
+	}
+}
+
+func TestNewTenants_Invalid(t *testing.T) {
+	cases := [][]*Tenant{
+		{{Name: "a", Prefixes: []string{"a-"}}},
+		{{Name: "a", APIKey: "secret"}},
+		{
+			{Name: "a", APIKey: "secret", Prefixes: []string{"a-"}},
+			{Name: "b", APIKey: "secret", Prefixes: []string{"b-"}},
+		},
+	}
+	cases = append(cases, []*Tenant{{Name: "a", APIKey: "secret", Prefixes: []string{"a-"}, MaxSets: 1}})
+	for _, tc := range cases {
+		if _, err := NewTenants(nil, tc); err == nil {
+			t.Fatalf("expect error: %v", tc)
+		}
+	}
+}
+
+func TestLoadTenants(t *testing.T) {
+	f, err := ioutil.TempFile("", "tenants")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`[{"name": "a", "api_key": "secret", "prefixes": ["a-"], "rate_limit": 100}]`)
+	f.Close()
+
+	tenants, err := LoadTenants(f.Name())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tenants) != 1 || tenants[0].APIKey != "secret" || tenants[0].RateLimit != 100 {
+		t.Fatalf("bad: %#v", tenants)
+	}
+
+	if _, err := LoadTenants("/does/not/exist"); err == nil {
+		t.Fatalf("expect error")
+	}
+}
@@ -0,0 +1,69 @@
+package hlldserver
+
+import (
+	"net"
+	"sync"
+)
+
+// connLimit is the number of connections shared by the listeners
+// of a server, which are limited to max connections
+type connLimit struct {
+	max    int
+	active int
+	lock   sync.Mutex
+}
+
+// acquire is used to reserve a connection, if any are available
+func (c *connLimit) acquire() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.max > 0 && c.active >= c.max {
+		return false
+	}
+	c.active++
+	return true
+}
+
+// release is used to free a connection
+func (c *connLimit) release() {
+	c.lock.Lock()
+	c.active--
+	c.lock.Unlock()
+}
+
+// limitListener closes the connections accepted beyond the limit,
+// so that clients fail quickly instead of waiting in the backlog
+type limitListener struct {
+	net.Listener
+	limit  *connLimit
+	reject func()
+}
+
+// Accept waits for a connection within the limit
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.limit.acquire() {
+			return &limitConn{Conn: conn, limit: l.limit}, nil
+		}
+		conn.Close()
+		l.reject()
+	}
+}
+
+// limitConn releases its connection from the limit once closed
+type limitConn struct {
+	net.Conn
+	limit *connLimit
+	once  sync.Once
+}
+
+// Close closes the connection and releases it from the limit
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.limit.release)
+	return err
+}
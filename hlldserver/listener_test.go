@@ -0,0 +1,60 @@
+package hlldserver
+
+import (
+	"net"
+	"testing"
+)
+
+func TestLimitListener(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	rejected := 0
+	limited := &limitListener{
+		Listener: list,
+		limit:    &connLimit{max: 1},
+		reject:   func() { rejected++ },
+	}
+	defer limited.Close()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", list.Addr().String())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return conn
+	}
+	c1 := dial()
+	defer c1.Close()
+	first, err := limited.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Connections over the limit are closed
+	c2 := dial()
+	defer c2.Close()
+	acceptCh := make(chan net.Conn)
+	go func() {
+		conn, _ := limited.Accept()
+		acceptCh <- conn
+	}()
+	if _, err := c2.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected closed connection")
+	}
+
+	// Closing a connection allows another, even if closed twice
+	first.Close()
+	first.Close()
+	c3 := dial()
+	defer c3.Close()
+	third := <-acceptCh
+	if third == nil {
+		t.Fatalf("expected connection")
+	}
+	defer third.Close()
+	if rejected != 1 || limited.limit.active != 1 {
+		t.Fatalf("bad: %d %d", rejected, limited.limit.active)
+	}
+}
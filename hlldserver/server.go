@@ -0,0 +1,540 @@
+// Package hlldserver is an embedded server that speaks the hlld protocol,
+// backed by the sketches of the hll package. Sets are snapshotted to a
+// data directory and reloaded at startup, so it can be used in place of
+// hlld for small deployments and in tests.
+package hlldserver
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/hll"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+const (
+	// BadArguments is the response to commands with invalid arguments
+	BadArguments = "Client Error: Bad arguments\n"
+
+	// BadSetName is the response to creating a set with an invalid name
+	BadSetName = "Client Error: Bad set name\n"
+
+	// setMissing is the response to commands on unknown sets
+	setMissing = "Set does not exist\n"
+
+	// notProxied is the response to clearing a set that is not closed
+	notProxied = "Set is not proxied. Close it first.\n"
+)
+
+// validName matches the set names accepted by the client, which are
+// also safe to use as the names of snapshot files
+var validName = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// Config is used to configure the server
+type Config struct {
+	// DataDir is the directory the sets are snapshotted to. If empty,
+	// the sets are only kept in memory.
+	DataDir string
+
+	// DefaultPrecision is the precision of sets created without
+	// a precision or error threshold
+	DefaultPrecision int
+
+	// SnapshotInterval is how often changed sets are snapshotted.
+	// Sets are also snapshotted when flushed or closed, and when the
+	// server is closed, so zero disables only the periodic snapshots.
+	SnapshotInterval time.Duration
+
+	// IdleTimeout is how long a set may go unused before it is closed,
+	// as with the cold interval of hlld. Sets are checked for eviction
+	// at this interval, so they are evicted after up to twice as long.
+	// Evicted sets are paged out and faulted back in from their snapshot
+	// when used, counted by page_outs and page_ins of the set info. Sets
+	// that are not snapshotted are never evicted. Zero disables eviction.
+	IdleTimeout time.Duration
+
+	// MaxConnections is the number of client connections allowed across
+	// all the listeners. Connections beyond the limit are closed once
+	// accepted. Zero means unlimited.
+	MaxConnections int
+
+	// RateLimit is the number of commands per second allowed on each
+	// connection, with up to Burst commands at once. Commands over the
+	// limit are rejected with hlldproxy.RateLimited. Zero means unlimited.
+	RateLimit float64
+	Burst     int
+
+	// Logger receives the snapshot errors of the server, with a
+	// component attribute of "hlldserver". The default logger of
+	// log/slog is used if unspecified.
+	Logger *slog.Logger
+}
+
+// DefaultConfig is used as the default server configuration
+func DefaultConfig() *Config {
+	return &Config{
+		DefaultPrecision: hll.DefaultPrecision,
+		SnapshotInterval: time.Minute,
+	}
+}
+
+// Validate is used to sanity check the configuration. A ConfigError
+// listing every invalid field is returned.
+func (c *Config) Validate() error {
+	var errs []string
+	if c.DefaultPrecision < hll.MinPrecision || c.DefaultPrecision > hll.MaxPrecision {
+		errs = append(errs, fmt.Sprintf("default precision must be in [%d, %d], got %d",
+			hll.MinPrecision, hll.MaxPrecision, c.DefaultPrecision))
+	}
+	if c.SnapshotInterval < 0 {
+		errs = append(errs, fmt.Sprintf("snapshot interval must not be negative, got %v", c.SnapshotInterval))
+	}
+	if c.MaxConnections < 0 {
+		errs = append(errs, fmt.Sprintf("max connections must not be negative, got %d", c.MaxConnections))
+	}
+	if c.RateLimit < 0 {
+		errs = append(errs, fmt.Sprintf("rate limit must not be negative, got %v", c.RateLimit))
+	}
+	if c.Burst < 0 {
+		errs = append(errs, fmt.Sprintf("burst must not be negative, got %d", c.Burst))
+	}
+	if c.IdleTimeout < 0 {
+		errs = append(errs, fmt.Sprintf("idle timeout must not be negative, got %v", c.IdleTimeout))
+	}
+	if len(errs) > 0 {
+		return &hlld.ConfigError{Errors: errs}
+	}
+	return nil
+}
+
+// Server serves sets over the hlld protocol
+type Server struct {
+	config *Config
+	logger *slog.Logger
+	limit  *connLimit
+
+	proxies     []*hlldproxy.Server
+	proxiesLock sync.Mutex
+
+	sets map[string]*set
+	lock sync.Mutex
+
+	shutdownCh chan struct{}
+	wg         sync.WaitGroup
+
+	// closeOnce guards Close, which returns closeErr on every call
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewServer loads the snapshots of the data directory and starts
+// serving connections from the listener
+func NewServer(list net.Listener, config *Config) (*Server, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &Server{
+		config:     config,
+		logger:     logger.With("component", "hlldserver"),
+		limit:      &connLimit{max: config.MaxConnections},
+		sets:       make(map[string]*set),
+		shutdownCh: make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.Listen(list)
+	if config.SnapshotInterval > 0 {
+		s.wg.Add(1)
+		go s.snapshotLoop()
+	}
+	if config.IdleTimeout > 0 {
+		s.wg.Add(1)
+		go s.evictLoop()
+	}
+	return s, nil
+}
+
+// load is used to reload the sets snapshotted to the data directory
+func (s *Server) load() error {
+	if s.config.DataDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.config.DataDir, 0755); err != nil {
+		return err
+	}
+	names, err := snapshotNames(s.config.DataDir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range names {
+		path := snapshotPath(s.config.DataDir, name)
+		snap, err := readSnapshot(path)
+		if err != nil {
+			return fmt.Errorf("failed to load set '%s': %w", name, err)
+		}
+		s.sets[name] = &set{
+			name:      name,
+			eps:       snap.eps,
+			precision: snap.sketch.Precision(),
+			path:      path,
+			sketch:    snap.sketch,
+			ops:       snap.ops,
+			accessed:  now,
+		}
+	}
+	return nil
+}
+
+// Listen is used to serve connections from another listener, such as
+// a unix socket in addition to TCP. The listener is closed with the server.
+func (s *Server) Listen(list net.Listener) {
+	limited := &limitListener{
+		Listener: list,
+		limit:    s.limit,
+		reject: func() {
+			s.logger.Warn("connection limit reached", "addr", list.Addr().String())
+		},
+	}
+	proxy := hlldproxy.NewConnServer(limited,
+		hlldproxy.ConnRateLimit(s.config.RateLimit, s.config.Burst, s.Handle))
+
+	s.proxiesLock.Lock()
+	s.proxies = append(s.proxies, proxy)
+	s.proxiesLock.Unlock()
+}
+
+// Addr returns the address of the listener the server was created with
+func (s *Server) Addr() net.Addr {
+	s.proxiesLock.Lock()
+	defer s.proxiesLock.Unlock()
+	return s.proxies[0].Addr()
+}
+
+// Close stops serving connections and snapshots the changed sets.
+// It is safe to call more than once, returning the first result.
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.shutdownCh)
+		s.wg.Wait()
+		s.proxiesLock.Lock()
+		for _, proxy := range s.proxies {
+			proxy.Close()
+		}
+		s.proxiesLock.Unlock()
+		s.closeErr = s.Snapshot()
+	})
+	return s.closeErr
+}
+
+// Snapshot is used to snapshot every set that changed since its last
+// snapshot, returning the first error
+func (s *Server) Snapshot() error {
+	var first error
+	for _, set := range s.list("") {
+		set.lock.Lock()
+		err := set.persist()
+		set.lock.Unlock()
+		if err != nil && first == nil {
+			first = fmt.Errorf("failed to snapshot set '%s': %w", set.name, err)
+		}
+	}
+	return first
+}
+
+// snapshotLoop periodically snapshots the changed sets
+func (s *Server) snapshotLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.config.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				s.logger.Error("snapshot failed", "error", err)
+			}
+		case <-s.shutdownCh:
+			return
+		}
+	}
+}
+
+// evictLoop periodically closes the idle sets
+func (s *Server) evictLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.config.IdleTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.evict(now.Add(-s.config.IdleTimeout))
+		case <-s.shutdownCh:
+			return
+		}
+	}
+}
+
+// evict is used to close the sets not used since the cutoff,
+// returning the number of sets paged out
+func (s *Server) evict(cutoff time.Time) int {
+	evicted := 0
+	for _, set := range s.list("") {
+		set.lock.Lock()
+		if set.pageable() && !set.dropped && set.accessed.Before(cutoff) {
+			if err := set.close(); err != nil {
+				s.logger.Error("eviction failed", "set", set.name, "error", err)
+			} else {
+				evicted++
+			}
+		}
+		set.lock.Unlock()
+	}
+	if evicted > 0 {
+		s.logger.Debug("evicted idle sets", "sets", evicted)
+	}
+	return evicted
+}
+
+// lookup returns the set with a name, or nil
+func (s *Server) lookup(name string) *set {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sets[name]
+}
+
+// list returns the sets with a name prefix, sorted by name
+func (s *Server) list(prefix string) []*set {
+	s.lock.Lock()
+	out := make([]*set, 0, len(s.sets))
+	for name, set := range s.sets {
+		if strings.HasPrefix(name, prefix) {
+			out = append(out, set)
+		}
+	}
+	s.lock.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].name < out[j].name
+	})
+	return out
+}
+
+// remove is used to remove a set from the server
+func (s *Server) remove(set *set) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.sets[set.name] == set {
+		delete(s.sets, set.name)
+	}
+	set.dropped = true
+}
+
+// Handle executes a command line. It is used as the handler of the
+// listener, but can also be wrapped by the layers of hlldproxy, such
+// as Tenants, and served by another hlldproxy.Server.
+func (s *Server) Handle(line string) hlldproxy.Reply {
+	return hlldproxy.Static(s.execute(strings.Fields(line)))
+}
+
+// execute returns the response to a command
+func (s *Server) execute(fields []string) string {
+	if len(fields) == 0 {
+		return hlldproxy.UnsupportedCommand
+	}
+	switch fields[0] {
+	case "create":
+		return s.create(fields[1:])
+	case "list":
+		if len(fields) > 2 {
+			return BadArguments
+		}
+		prefix := ""
+		if len(fields) == 2 {
+			prefix = fields[1]
+		}
+		return s.listSets(prefix)
+	case "flush":
+		if len(fields) == 1 {
+			if err := s.Snapshot(); err != nil {
+				s.logger.Error("flush failed", "error", err)
+				return hlldproxy.InternalError
+			}
+			return "Done\n"
+		}
+	}
+
+	switch fields[0] {
+	case "s", "set", "b", "bulk", "info", "flush", "close", "clear", "drop":
+	default:
+		return hlldproxy.UnsupportedCommand
+	}
+	if len(fields) < 2 {
+		return BadArguments
+	}
+	set := s.lookup(fields[1])
+	if set == nil {
+		return setMissing
+	}
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if set.dropped {
+		return setMissing
+	}
+
+	switch fields[0] {
+	case "s", "set", "b", "bulk":
+		keys := fields[2:]
+		single := fields[0] == "s" || fields[0] == "set"
+		if len(keys) == 0 || (single && len(keys) > 1) {
+			return BadArguments
+		}
+		if err := set.fault(time.Now()); err != nil {
+			return s.internalError(set, err)
+		}
+		for _, key := range keys {
+			set.sketch.Add(key)
+		}
+		set.ops += uint64(len(keys))
+		set.dirty = true
+		return "Done\n"
+
+	case "info":
+		if err := set.fault(time.Now()); err != nil {
+			return s.internalError(set, err)
+		}
+		inMemory := 0
+		if set.inMemory {
+			inMemory = 1
+		}
+		return fmt.Sprintf("START\nin_memory %d\npage_ins %d\npage_outs %d\neps %f\nprecision %d\nsets %d\nsize %d\nstorage %d\nEND\n",
+			inMemory, set.pageIns, set.pageOuts, set.eps, set.precision, set.ops, set.estimate(), hll.Storage(set.precision))
+
+	case "flush":
+		if err := set.persist(); err != nil {
+			return s.internalError(set, err)
+		}
+		return "Done\n"
+
+	case "close":
+		if err := set.close(); err != nil {
+			return s.internalError(set, err)
+		}
+		return "Done\n"
+
+	case "clear":
+		// The snapshot is kept, so the set is reloaded at startup
+		if !set.closed {
+			return notProxied
+		}
+		s.remove(set)
+		return "Done\n"
+
+	default:
+		s.remove(set)
+		if set.path != "" {
+			if err := os.Remove(set.path); err != nil && !os.IsNotExist(err) {
+				return s.internalError(set, err)
+			}
+		}
+		return "Done\n"
+	}
+}
+
+// internalError is used to log an error executing a command on a set
+func (s *Server) internalError(set *set, err error) string {
+	s.logger.Error("command failed", "set", set.name, "error", err)
+	return hlldproxy.InternalError
+}
+
+// create is used to create a set with the given name and options
+func (s *Server) create(args []string) string {
+	if len(args) == 0 {
+		return BadArguments
+	}
+	name := args[0]
+	if !validName.MatchString(name) {
+		return BadSetName
+	}
+	precision := s.config.DefaultPrecision
+	inMemory := false
+	havePrecision := false
+	for _, arg := range args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return BadArguments
+		}
+		var err error
+		switch key {
+		case "precision":
+			precision, err = strconv.Atoi(value)
+			havePrecision = true
+		case "eps":
+			var eps float64
+			if eps, err = strconv.ParseFloat(value, 64); err == nil && !havePrecision {
+				precision, err = hll.PrecisionForError(eps)
+			}
+		case "in_memory":
+			inMemory, err = strconv.ParseBool(value)
+		default:
+			return BadArguments
+		}
+		if err != nil {
+			return BadArguments
+		}
+	}
+	sketch, err := hll.New(precision)
+	if err != nil {
+		return BadArguments
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.sets[name]; ok {
+		return "Exists\n"
+	}
+	set := &set{
+		name:      name,
+		eps:       hll.ErrorForPrecision(precision),
+		precision: precision,
+		inMemory:  inMemory,
+		sketch:    sketch,
+		dirty:     true,
+		accessed:  time.Now(),
+	}
+	if s.config.DataDir != "" && !inMemory {
+		set.path = snapshotPath(s.config.DataDir, name)
+	}
+	s.sets[name] = set
+	return "Done\n"
+}
+
+// listSets returns the list response for the sets with a name prefix
+func (s *Server) listSets(prefix string) string {
+	var b strings.Builder
+	b.WriteString("START\n")
+	for _, set := range s.list(prefix) {
+		set.lock.Lock()
+		if set.dropped {
+			set.lock.Unlock()
+			continue
+		}
+		fmt.Fprintf(&b, "%s %f %d %d %d\n", set.name, set.eps, set.precision, set.estimate(), hll.Storage(set.precision))
+		set.lock.Unlock()
+	}
+	b.WriteString("END\n")
+	return b.String()
+}
@@ -0,0 +1,332 @@
+package hlldserver
+
+import (
+	"bufio"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armon/go-hlld"
+	"github.com/armon/go-hlld/conformance"
+	"github.com/armon/go-hlld/hlldproxy"
+)
+
+// testServer starts a server with the given data directory
+func testServer(t *testing.T, dir string) *Server {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	config := DefaultConfig()
+	config.DataDir = dir
+	config.Logger = slog.New(slog.DiscardHandler)
+	s, err := NewServer(list, config)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return s
+}
+
+// raw executes a command line against the server
+func raw(s *Server, line string) string {
+	return s.Handle(line)()
+}
+
+// paged checks if a set is paged out
+func paged(s *Server, name string) bool {
+	set := s.lookup(name)
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	return set.sketch == nil
+}
+
+func TestConfig_Validate(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	config.DefaultPrecision = 20
+	config.SnapshotInterval = -1
+	config.IdleTimeout = -1
+	config.MaxConnections = -1
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "default precision") ||
+		!strings.Contains(err.Error(), "snapshot interval") || !strings.Contains(err.Error(), "idle timeout") ||
+		!strings.Contains(err.Error(), "max connections") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestServer_Conformance(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		s := testServer(t, dir)
+		client, err := hlld.Dial(s.Addr().String())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		results, err := conformance.Run(client, "")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		for _, r := range results {
+			if !r.Passed() {
+				t.Fatalf("check %s failed: %v", r.Name, r.Err)
+			}
+		}
+		client.Close()
+		if err := s.Close(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
+
+func TestServer_Create(t *testing.T) {
+	s := testServer(t, "")
+	defer s.Close()
+
+	cases := map[string]string{
+		"create":                          BadArguments,
+		"create foo precision=x":          BadArguments,
+		"create foo eps=0.00001":          BadArguments,
+		"create foo in_memory=maybe":      BadArguments,
+		"create foo color=red":            BadArguments,
+		"create ../foo":                   BadSetName,
+		"create foo:bar precision=14":     BadSetName,
+		"create foo eps=0.02":             "Done\n",
+		"create bar eps=0.5 precision=14": "Done\n",
+		"create baz in_memory=1":          "Done\n",
+	}
+	for line, want := range cases {
+		if got := raw(s, line); got != want {
+			t.Fatalf("bad: %s %q", line, got)
+		}
+	}
+
+	resp := raw(s, "list")
+	if resp != "START\nbar 0.008125 14 0 13108\nbaz 0.016250 12 0 3280\nfoo 0.016250 12 0 3280\nEND\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+	if resp := raw(s, "info baz"); !strings.Contains(resp, "in_memory 1\n") {
+		t.Fatalf("bad: %q", resp)
+	}
+	if resp := raw(s, "s foo a b"); resp != BadArguments {
+		t.Fatalf("bad: %q", resp)
+	}
+}
+
+func TestServer_Reload(t *testing.T) {
+	dir := t.TempDir()
+	s := testServer(t, dir)
+	raw(s, "create foo precision=14")
+	raw(s, "create temp in_memory=true")
+	raw(s, "b foo a b c")
+	raw(s, "b temp a")
+	raw(s, "create dropped")
+	raw(s, "flush")
+	raw(s, "drop dropped")
+
+	// Changes after the flush are snapshotted on close
+	raw(s, "s foo d")
+	if err := s.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	// Closing again is a no-op
+	if err := s.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	s = testServer(t, dir)
+	defer s.Close()
+	resp := raw(s, "list")
+	if resp != "START\nfoo 0.008125 14 4 13108\nEND\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+	if resp := raw(s, "info foo"); !strings.Contains(resp, "sets 4\n") {
+		t.Fatalf("bad: %q", resp)
+	}
+}
+
+func TestServer_ClosePagesOut(t *testing.T) {
+	dir := t.TempDir()
+	s := testServer(t, dir)
+	defer s.Close()
+	raw(s, "create foo")
+	raw(s, "b foo a b")
+	if resp := raw(s, "close foo"); resp != "Done\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+	if !paged(s, "foo") {
+		t.Fatalf("expected page out")
+	}
+
+	// Listing does not fault the set in
+	if resp := raw(s, "list foo"); resp != "START\nfoo 0.016250 12 2 3280\nEND\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+	resp := raw(s, "info foo")
+	if !strings.Contains(resp, "page_ins 1\npage_outs 1\n") || !strings.Contains(resp, "size 2\n") {
+		t.Fatalf("bad: %q", resp)
+	}
+
+	// A cleared set keeps its snapshot
+	raw(s, "close foo")
+	if resp := raw(s, "clear foo"); resp != "Done\n" {
+		t.Fatalf("bad: %q", resp)
+	}
+	if _, err := os.Stat(snapshotPath(dir, "foo")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestServer_CorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(snapshotPath(dir, "foo"), []byte("garbage"), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+	config := DefaultConfig()
+	config.DataDir = dir
+	if _, err := NewServer(list, config); err == nil || !strings.Contains(err.Error(), "set 'foo'") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestServer_Evict(t *testing.T) {
+	dir := t.TempDir()
+	s := testServer(t, dir)
+	defer s.Close()
+	raw(s, "create foo")
+	raw(s, "create bar")
+	raw(s, "create temp in_memory=1")
+	raw(s, "b foo a b")
+
+	// Only the idle persisted sets are evicted
+	cutoff := time.Now()
+	time.Sleep(time.Millisecond)
+	raw(s, "s bar a")
+	if n := s.evict(cutoff); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	if !paged(s, "foo") || paged(s, "bar") || paged(s, "temp") {
+		t.Fatalf("bad eviction")
+	}
+	if n := s.evict(cutoff); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Evicted sets are faulted back in on use
+	resp := raw(s, "info foo")
+	if !strings.Contains(resp, "page_ins 1\npage_outs 1\n") || !strings.Contains(resp, "size 2\n") {
+		t.Fatalf("bad: %q", resp)
+	}
+	if resp := raw(s, "clear foo"); resp != notProxied {
+		t.Fatalf("bad: %q", resp)
+	}
+}
+
+func TestServer_EvictLoop(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	config.IdleTimeout = 10 * time.Millisecond
+	s, err := NewServer(list, config)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer s.Close()
+	raw(s, "create foo")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !paged(s, "foo") {
+		if time.Now().After(deadline) {
+			t.Fatalf("set not evicted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServer_Limits(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	config := DefaultConfig()
+	config.MaxConnections = 1
+	config.RateLimit = 0.001
+	config.Burst = 2
+	s, err := NewServer(list, config)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer s.Close()
+
+	// Also serve a unix socket, sharing the connection limit
+	sock := filepath.Join(t.TempDir(), "hlld.sock")
+	unixList, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.Listen(unixList)
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	bufR := bufio.NewReader(conn)
+	for _, want := range []string{"START\n", "START\n", hlldproxy.RateLimited} {
+		if _, err := conn.Write([]byte("list\n")); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		line, err := bufR.ReadString('\n')
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if line != want {
+			t.Fatalf("bad: %q", line)
+		}
+		if line == "START\n" {
+			bufR.ReadString('\n')
+		}
+	}
+
+	// The TCP connection is over the limit until the first is closed
+	tcp, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := tcp.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected closed connection")
+	}
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client, err := hlld.Dial(s.Addr().String())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		cmd, _ := hlld.NewListCommand("")
+		f, err := client.Execute(cmd)
+		if err == nil {
+			err = f.Error()
+		}
+		client.Close()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("err: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,106 @@
+package hlldserver
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/armon/go-hlld/hll"
+)
+
+// set is a named sketch of the server. Sets that are persisted are
+// paged out when closed, and faulted back in from their snapshot
+// when next used.
+type set struct {
+	name      string
+	eps       float64
+	precision int
+	inMemory  bool
+
+	// path is the snapshot of the set, or empty if not persisted
+	path string
+
+	lock sync.Mutex
+
+	// sketch is nil while the set is paged out, in which
+	// case size is its estimate at the time
+	sketch *hll.Sketch
+	size   uint64
+
+	// ops is the number of keys added to the set
+	ops uint64
+
+	// accessed is when the set was last used, which
+	// determines when it is evicted
+	accessed time.Time
+
+	// closed is set by a close command until the set is used again,
+	// dirty if there are changes since the last snapshot, and dropped
+	// once the set is removed from the server
+	closed  bool
+	dirty   bool
+	dropped bool
+
+	pageIns  uint64
+	pageOuts uint64
+}
+
+// fault is used to load the sketch of a set that was paged out and
+// mark it accessed, and must be called with the lock held
+func (s *set) fault(now time.Time) error {
+	s.closed = false
+	s.accessed = now
+	if s.sketch != nil {
+		return nil
+	}
+	snap, err := readSnapshot(s.path)
+	if err != nil {
+		return err
+	}
+	s.sketch = snap.sketch
+	s.pageIns++
+	return nil
+}
+
+// persist is used to snapshot the set if it changed,
+// and must be called with the lock held
+func (s *set) persist() error {
+	if s.path == "" || !s.dirty || s.dropped || s.sketch == nil {
+		return nil
+	}
+	snap := &snapshot{eps: s.eps, ops: s.ops, sketch: s.sketch}
+	if err := writeSnapshot(s.path, snap); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// close is used to snapshot the set and page it out,
+// and must be called with the lock held
+func (s *set) close() error {
+	if err := s.persist(); err != nil {
+		return err
+	}
+	s.closed = true
+	if s.pageable() {
+		s.size = s.estimate()
+		s.sketch = nil
+		s.pageOuts++
+	}
+	return nil
+}
+
+// pageable checks if the set can be paged out
+func (s *set) pageable() bool {
+	return s.path != "" && s.sketch != nil
+}
+
+// estimate returns the estimated size of the set,
+// and must be called with the lock held
+func (s *set) estimate() uint64 {
+	if s.sketch == nil {
+		return s.size
+	}
+	return uint64(math.Round(s.sketch.Estimate()))
+}
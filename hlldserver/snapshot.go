@@ -0,0 +1,114 @@
+package hlldserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/armon/go-hlld/hll"
+)
+
+const (
+	// snapshotExt is the extension of snapshot files
+	snapshotExt = ".hll"
+
+	// snapshotVersion is the version of the snapshot format
+	snapshotVersion = 1
+)
+
+// snapshotMagic identifies snapshot files
+var snapshotMagic = []byte("HLLS")
+
+// snapshot is the persisted state of a set. The file is the magic, the
+// version, the error threshold and number of set operations as little
+// endian 64-bit fields, and then the binary form of the sketch.
+type snapshot struct {
+	eps    float64
+	ops    uint64
+	sketch *hll.Sketch
+}
+
+// snapshotPath returns the path of the snapshot of a set, escaping
+// the name so that it is a valid file name
+func snapshotPath(dir, name string) string {
+	return filepath.Join(dir, url.PathEscape(name)+snapshotExt)
+}
+
+// snapshotNames returns the names of the sets with snapshots in a directory
+func snapshotNames(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+snapshotExt))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		name, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), snapshotExt))
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot name '%s': %w", path, err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// writeSnapshot is used to atomically replace the snapshot at a path
+func writeSnapshot(path string, snap *snapshot) error {
+	regs, err := snap.sketch.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Write(snapshotMagic)
+	buf.WriteByte(snapshotVersion)
+	binary.Write(&buf, binary.LittleEndian, math.Float64bits(snap.eps))
+	binary.Write(&buf, binary.LittleEndian, snap.ops)
+	buf.Write(regs)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readSnapshot is used to read the snapshot at a path
+func readSnapshot(path string) (*snapshot, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	header := len(snapshotMagic) + 1 + 16
+	if len(raw) < header || !bytes.Equal(raw[:len(snapshotMagic)], snapshotMagic) {
+		return nil, fmt.Errorf("'%s' is not a snapshot", path)
+	}
+	if v := raw[len(snapshotMagic)]; v != snapshotVersion {
+		return nil, fmt.Errorf("'%s' has unsupported version %d", path, v)
+	}
+	fields := raw[len(snapshotMagic)+1:]
+	snap := &snapshot{
+		eps:    math.Float64frombits(binary.LittleEndian.Uint64(fields[:8])),
+		ops:    binary.LittleEndian.Uint64(fields[8:16]),
+		sketch: new(hll.Sketch),
+	}
+	if err := snap.sketch.UnmarshalBinary(raw[header:]); err != nil {
+		return nil, fmt.Errorf("'%s' is corrupt: %w", path, err)
+	}
+	return snap, nil
+}
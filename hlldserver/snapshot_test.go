@@ -0,0 +1,60 @@
+package hlldserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/armon/go-hlld/hll"
+)
+
+func TestSnapshot_ReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	sketch, _ := hll.New(10)
+	sketch.Add("foo")
+	path := snapshotPath(dir, "web/users 1")
+	if filepath.Dir(path) != dir {
+		t.Fatalf("bad: %v", path)
+	}
+	if err := writeSnapshot(path, &snapshot{eps: 0.05, ops: 7, sketch: sketch}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	snap, err := readSnapshot(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if snap.eps != 0.05 || snap.ops != 7 || snap.sketch.Estimate() != sketch.Estimate() {
+		t.Fatalf("bad: %v", snap)
+	}
+
+	names, err := snapshotNames(dir)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(names) != 1 || names[0] != "web/users 1" {
+		t.Fatalf("bad: %v", names)
+	}
+}
+
+func TestSnapshot_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "foo.hll")
+	sketch, _ := hll.New(4)
+	if err := writeSnapshot(path, &snapshot{sketch: sketch}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+
+	bad := append([]byte(nil), raw...)
+	bad[4] = 2
+	os.WriteFile(path, bad, 0644)
+	if _, err := readSnapshot(path); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	os.WriteFile(path, raw[:len(raw)-1], 0644)
+	if _, err := readSnapshot(path); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,205 @@
+// Package hlldtest provides utilities for testing applications that
+// use the hlld client.
+package hlldtest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// FaultType is the kind of fault injected by the ChaosProxy
+type FaultType int
+
+const (
+	// FaultNone passes the response line through unmodified
+	FaultNone FaultType = iota
+
+	// FaultLatency delays the response line by the fault Delay
+	FaultLatency
+
+	// FaultPartialWrite writes the first half of the response line,
+	// waits for the fault Delay, and then writes the remainder
+	FaultPartialWrite
+
+	// FaultDrop closes the connection instead of writing the response line
+	FaultDrop
+
+	// FaultCorrupt replaces the response line with garbage
+	FaultCorrupt
+)
+
+// corruptLine is written in place of a response line by FaultCorrupt
+const corruptLine = "\x00\x7fcorrupt\x00\n"
+
+// Fault describes the fault to inject for a response line
+type Fault struct {
+	Type  FaultType
+	Delay time.Duration
+}
+
+// Schedule determines the fault to inject for a response line. It is
+// invoked with the index of the connection, in the order connections are
+// accepted, and the index of the response line on that connection.
+type Schedule func(conn, line int) Fault
+
+// EveryNth returns a schedule that injects the fault on every nth
+// response line of each connection, starting with the nth line
+func EveryNth(n int, f Fault) Schedule {
+	return func(conn, line int) Fault {
+		if (line+1)%n == 0 {
+			return f
+		}
+		return Fault{}
+	}
+}
+
+// AtLines returns a schedule that injects faults on specific response
+// lines of each connection
+func AtLines(faults map[int]Fault) Schedule {
+	return func(conn, line int) Fault {
+		return faults[line]
+	}
+}
+
+// ChaosProxy sits between a client and an hlld server and injects
+// faults into the responses according to a deterministic schedule.
+// Commands from the client are forwarded unmodified.
+type ChaosProxy struct {
+	upstream string
+	schedule Schedule
+	list     net.Listener
+
+	// conns is guarded by connsLock, along with closed, which is set
+	// so that connections accepted during Close are not leaked
+	conns     map[net.Conn]struct{}
+	closed    bool
+	connsLock sync.Mutex
+	wg        sync.WaitGroup
+}
+
+// NewChaosProxy creates a proxy listening on a random local port that
+// forwards connections to the upstream address
+func NewChaosProxy(upstream string, schedule Schedule) (*ChaosProxy, error) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &ChaosProxy{
+		upstream: upstream,
+		schedule: schedule,
+		list:     list,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	p.wg.Add(1)
+	go p.listen()
+	return p, nil
+}
+
+// Addr returns the address clients should connect to
+func (p *ChaosProxy) Addr() string {
+	return p.list.Addr().String()
+}
+
+// Close stops the proxy and closes all connections
+func (p *ChaosProxy) Close() error {
+	err := p.list.Close()
+	p.connsLock.Lock()
+	p.closed = true
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.connsLock.Unlock()
+	p.wg.Wait()
+	return err
+}
+
+// listen accepts new client connections
+func (p *ChaosProxy) listen() {
+	defer p.wg.Done()
+	for idx := 0; ; idx++ {
+		conn, err := p.list.Accept()
+		if err != nil {
+			return
+		}
+		p.wg.Add(1)
+		go p.handle(idx, conn)
+	}
+}
+
+// track is used to register a connection for cleanup on Close. If the
+// proxy is already closed, the connection is closed and false returned.
+func (p *ChaosProxy) track(conn net.Conn) bool {
+	p.connsLock.Lock()
+	defer p.connsLock.Unlock()
+	if p.closed {
+		conn.Close()
+		return false
+	}
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack is used to close and remove a connection
+func (p *ChaosProxy) untrack(conn net.Conn) {
+	p.connsLock.Lock()
+	delete(p.conns, conn)
+	p.connsLock.Unlock()
+	conn.Close()
+}
+
+// handle proxies a single client connection
+func (p *ChaosProxy) handle(idx int, client net.Conn) {
+	defer p.wg.Done()
+	if !p.track(client) {
+		return
+	}
+	defer p.untrack(client)
+
+	server, err := net.Dial("tcp", p.upstream)
+	if err != nil {
+		return
+	}
+	if !p.track(server) {
+		return
+	}
+	defer p.untrack(server)
+
+	// Forward commands unmodified
+	go func() {
+		io.Copy(server, client)
+		server.Close()
+	}()
+
+	// Forward responses, injecting faults
+	bufR := bufio.NewReader(server)
+	for line := 0; ; line++ {
+		resp, err := bufR.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fault := p.schedule(idx, line)
+		switch fault.Type {
+		case FaultLatency:
+			time.Sleep(fault.Delay)
+		case FaultPartialWrite:
+			half := len(resp) / 2
+			if _, err := client.Write([]byte(resp[:half])); err != nil {
+				return
+			}
+			time.Sleep(fault.Delay)
+			resp = resp[half:]
+		case FaultDrop:
+			return
+		case FaultCorrupt:
+			resp = corruptLine
+		}
+
+		if _, err := client.Write([]byte(resp)); err != nil {
+			return
+		}
+	}
+}
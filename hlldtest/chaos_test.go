@@ -0,0 +1,193 @@
+package hlldtest
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/armon/go-hlld"
+)
+
+// testUpstream starts a server that responds Done to every command
+func testUpstream(t *testing.T) (string, func()) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := list.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				bufR := bufio.NewReader(conn)
+				for {
+					if _, err := bufR.ReadString('\n'); err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte("Done\n")); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return list.Addr().String(), func() { list.Close() }
+}
+
+// dropSet executes a drop command through the client
+func dropSet(t *testing.T, client *hlld.Client) (*hlld.SetCommand, error) {
+	cmd, err := hlld.NewDropCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f, err := client.Execute(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, f.Error()
+}
+
+func TestChaosProxy_Latency(t *testing.T) {
+	upstream, stop := testUpstream(t)
+	defer stop()
+
+	delay := 50 * time.Millisecond
+	proxy, err := NewChaosProxy(upstream, AtLines(map[int]Fault{
+		0: {Type: FaultLatency, Delay: delay},
+	}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer proxy.Close()
+
+	client, err := hlld.Dial(proxy.Addr())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	start := time.Now()
+	cmd, err := dropSet(t, client)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if time.Since(start) < delay {
+		t.Fatalf("expected delay")
+	}
+	if ok, err := cmd.Result(); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+}
+
+func TestChaosProxy_PartialWrite(t *testing.T) {
+	upstream, stop := testUpstream(t)
+	defer stop()
+
+	proxy, err := NewChaosProxy(upstream, EveryNth(1, Fault{
+		Type:  FaultPartialWrite,
+		Delay: 10 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer proxy.Close()
+
+	client, err := hlld.Dial(proxy.Addr())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	cmd, err := dropSet(t, client)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ok, err := cmd.Result(); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+}
+
+func TestChaosProxy_Drop(t *testing.T) {
+	upstream, stop := testUpstream(t)
+	defer stop()
+
+	proxy, err := NewChaosProxy(upstream, EveryNth(2, Fault{Type: FaultDrop}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer proxy.Close()
+
+	client, err := hlld.Dial(proxy.Addr())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// First command succeeds, second is dropped
+	if _, err := dropSet(t, client); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := dropSet(t, client); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestChaosProxy_Corrupt(t *testing.T) {
+	upstream, stop := testUpstream(t)
+	defer stop()
+
+	proxy, err := NewChaosProxy(upstream, AtLines(map[int]Fault{
+		0: {Type: FaultCorrupt},
+	}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer proxy.Close()
+
+	client, err := hlld.Dial(proxy.Addr())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	cmd, err := dropSet(t, client)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := cmd.Result(); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// The following line is not corrupted
+	cmd, err = dropSet(t, client)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ok, err := cmd.Result(); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+}
+
+func TestChaosProxy_TrackAfterClose(t *testing.T) {
+	upstream, stop := testUpstream(t)
+	defer stop()
+	proxy, err := NewChaosProxy(upstream, EveryNth(1, Fault{}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	proxy.Close()
+
+	// Connections accepted while closing are closed rather than leaked
+	conn, other := net.Pipe()
+	defer other.Close()
+	if proxy.track(conn) {
+		t.Fatalf("should not track")
+	}
+	if _, err := other.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected closed connection")
+	}
+}
@@ -0,0 +1,85 @@
+package hlldtest
+
+import (
+	"sync"
+
+	"github.com/armon/go-hlld"
+)
+
+// FailRule describes the commands to fail and how
+type FailRule struct {
+	// Type is the type of command to fail, such as "info" or "bulk",
+	// as returned by hlld.CommandType. All types match if empty.
+	Type string
+
+	// Every fails every nth matching command, starting with the nth.
+	// Every matching command is failed if zero or one.
+	Every int
+
+	// Err is the error to fail with
+	Err error
+
+	// OnExecute fails the call to Execute, rather than returning a
+	// future that completes with the error
+	OnExecute bool
+}
+
+// FailingClient is an hlld.Executor that fails commands according to a
+// set of rules, which allows the error handling of applications to be
+// tested without a flaky real connection. Commands that are not failed
+// are passed to the wrapped Executor, or completed successfully without
+// a response if there is none, in which case their results are not
+// decoded.
+type FailingClient struct {
+	exec  hlld.Executor
+	rules []FailRule
+
+	// matched counts the commands matching each rule
+	matched []int
+	lock    sync.Mutex
+}
+
+// NewFailingClient returns a client failing commands by the rules, which
+// are checked in order. The wrapped Executor may be nil.
+func NewFailingClient(exec hlld.Executor, rules ...FailRule) *FailingClient {
+	return &FailingClient{
+		exec:    exec,
+		rules:   rules,
+		matched: make([]int, len(rules)),
+	}
+}
+
+// Execute is used to fail the command if it matches a rule,
+// or otherwise pass it to the wrapped Executor
+func (c *FailingClient) Execute(cmd hlld.Command) (*hlld.Future, error) {
+	if rule := c.match(cmd); rule != nil {
+		if rule.OnExecute {
+			return nil, rule.Err
+		}
+		return hlld.NewCompletedFuture(cmd, rule.Err), nil
+	}
+	if c.exec == nil {
+		return hlld.NewCompletedFuture(cmd, nil), nil
+	}
+	return c.exec.Execute(cmd)
+}
+
+// match returns the first rule failing the command, if any. Every rule
+// matching the type counts the command, even if an earlier rule fails it.
+func (c *FailingClient) match(cmd hlld.Command) *FailRule {
+	typ := hlld.CommandType(cmd)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var failed *FailRule
+	for idx := range c.rules {
+		rule := &c.rules[idx]
+		if rule.Type != "" && rule.Type != typ {
+			continue
+		}
+		c.matched[idx]++
+		if failed == nil && (rule.Every <= 1 || c.matched[idx]%rule.Every == 0) {
+			failed = rule
+		}
+	}
+	return failed
+}
@@ -0,0 +1,84 @@
+package hlldtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/armon/go-hlld"
+)
+
+func TestFailingClient(t *testing.T) {
+	errInfo := errors.New("info failed")
+	errBulk := errors.New("bulk failed")
+	client := NewFailingClient(nil,
+		FailRule{Type: "info", Err: errInfo, OnExecute: true},
+		FailRule{Type: "bulk", Every: 3, Err: errBulk},
+	)
+	var _ hlld.Executor = client
+
+	info, _ := hlld.NewInfoCommand("foo")
+	if _, err := client.Execute(info); err != errInfo {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Every third bulk command fails through the future
+	for i := 1; i <= 6; i++ {
+		cmd, _ := hlld.NewSetKeysCommand("foo", []string{"bar"})
+		f, err := client.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		err = f.Error()
+		if i%3 == 0 && err != errBulk {
+			t.Fatalf("%d err: %v", i, err)
+		}
+		if i%3 != 0 && err != nil {
+			t.Fatalf("%d err: %v", i, err)
+		}
+	}
+
+	// Other commands succeed
+	drop, _ := hlld.NewDropCommand("foo")
+	f, err := client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestFailingClient_Wrapped(t *testing.T) {
+	addr, stop := testUpstream(t)
+	defer stop()
+	upstream, err := hlld.Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer upstream.Close()
+
+	errAll := errors.New("failed")
+	client := NewFailingClient(upstream, FailRule{Every: 2, Err: errAll})
+	for i := 1; i <= 4; i++ {
+		cmd, _ := hlld.NewDropCommand("foo")
+		f, err := client.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		err = f.Error()
+		if i%2 == 0 {
+			if err != errAll {
+				t.Fatalf("%d err: %v", i, err)
+			}
+			continue
+		}
+
+		// Passed commands have the response of the server
+		if err != nil {
+			t.Fatalf("%d err: %v", i, err)
+		}
+		if ok, err := cmd.Result(); err != nil || !ok {
+			t.Fatalf("bad: %v %v", ok, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package hlldtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Direction is the direction of recorded bytes
+type Direction string
+
+const (
+	// DirSend is used for bytes written by the client
+	DirSend Direction = "send"
+
+	// DirRecv is used for bytes read by the client
+	DirRecv Direction = "recv"
+)
+
+// Record is a chunk of bytes sent or received on a tapped connection
+type Record struct {
+	Time time.Time `json:"time"`
+	Dir  Direction `json:"dir"`
+	Data []byte    `json:"data"`
+}
+
+// TapConn wraps a connection and records every byte written and read,
+// along with the time it was observed. Records are written to the
+// output as JSON lines, so a session with a real hlld server can be
+// captured and later served by a Replayer. Use it by wrapping the
+// connection given to hlld.NewClient.
+type TapConn struct {
+	net.Conn
+
+	out     io.Writer
+	enc     *json.Encoder
+	err     error
+	outLock sync.Mutex
+}
+
+// NewTapConn wraps the connection, recording to the output
+func NewTapConn(conn net.Conn, out io.Writer) *TapConn {
+	return &TapConn{
+		Conn: conn,
+		out:  out,
+		enc:  json.NewEncoder(out),
+	}
+}
+
+func (t *TapConn) Read(b []byte) (int, error) {
+	n, err := t.Conn.Read(b)
+	if n > 0 {
+		t.record(DirRecv, b[:n])
+	}
+	return n, err
+}
+
+func (t *TapConn) Write(b []byte) (int, error) {
+	n, err := t.Conn.Write(b)
+	if n > 0 {
+		t.record(DirSend, b[:n])
+	}
+	return n, err
+}
+
+// Err returns the first error writing the recording, if any
+func (t *TapConn) Err() error {
+	t.outLock.Lock()
+	defer t.outLock.Unlock()
+	return t.err
+}
+
+// record is used to write a record to the output
+func (t *TapConn) record(dir Direction, data []byte) {
+	rec := Record{
+		Time: time.Now(),
+		Dir:  dir,
+		Data: append([]byte(nil), data...),
+	}
+	t.outLock.Lock()
+	defer t.outLock.Unlock()
+	if t.err != nil {
+		return
+	}
+	t.err = t.enc.Encode(&rec)
+}
+
+// ReadRecording is used to read the records written by a TapConn
+func ReadRecording(r io.Reader) ([]Record, error) {
+	var records []Record
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode record %d: %w", len(records), err)
+		}
+		if rec.Dir != DirSend && rec.Dir != DirRecv {
+			return nil, fmt.Errorf("invalid direction '%s' in record %d", rec.Dir, len(records))
+		}
+		records = append(records, rec)
+	}
+}
+
+// Replayer serves a recording to clients in place of an hlld server.
+// Each accepted connection replays the session from the start: the bytes
+// the client sent are expected in the same order, and the bytes it
+// received are written back once every earlier send has been matched.
+// Any divergence from the recording is reported by Err, which makes it
+// simple to check that a new version of the client behaves the same.
+type Replayer struct {
+	// Realtime is used to preserve the recorded delay between
+	// responses. Otherwise responses are written immediately.
+	Realtime bool
+
+	records []Record
+	list    net.Listener
+
+	errs      []error
+	conns     map[net.Conn]struct{}
+	connsLock sync.Mutex
+	wg        sync.WaitGroup
+}
+
+// NewReplayer creates a replayer listening on a random local port
+func NewReplayer(records []Record) (*Replayer, error) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &Replayer{
+		records: records,
+		list:    list,
+		conns:   make(map[net.Conn]struct{}),
+	}
+	r.wg.Add(1)
+	go r.listen()
+	return r, nil
+}
+
+// Addr returns the address clients should connect to
+func (r *Replayer) Addr() string {
+	return r.list.Addr().String()
+}
+
+// Err returns the first divergence from the recording, if any
+func (r *Replayer) Err() error {
+	r.connsLock.Lock()
+	defer r.connsLock.Unlock()
+	if len(r.errs) == 0 {
+		return nil
+	}
+	return r.errs[0]
+}
+
+// Close stops the replayer and closes all connections
+func (r *Replayer) Close() error {
+	err := r.list.Close()
+	r.connsLock.Lock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.connsLock.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+// listen accepts new client connections
+func (r *Replayer) listen() {
+	defer r.wg.Done()
+	for idx := 0; ; idx++ {
+		conn, err := r.list.Accept()
+		if err != nil {
+			return
+		}
+		r.connsLock.Lock()
+		r.conns[conn] = struct{}{}
+		r.connsLock.Unlock()
+		r.wg.Add(1)
+		go r.handle(idx, conn)
+	}
+}
+
+// fail is used to record a divergence
+func (r *Replayer) fail(err error) {
+	r.connsLock.Lock()
+	r.errs = append(r.errs, err)
+	r.connsLock.Unlock()
+}
+
+// handle replays the recording on a single connection
+func (r *Replayer) handle(idx int, conn net.Conn) {
+	defer r.wg.Done()
+	defer func() {
+		r.connsLock.Lock()
+		delete(r.conns, conn)
+		r.connsLock.Unlock()
+		conn.Close()
+	}()
+
+	bufR := bufio.NewReader(conn)
+	var last time.Time
+	for n, rec := range r.records {
+		switch rec.Dir {
+		case DirSend:
+			buf := make([]byte, len(rec.Data))
+			if _, err := io.ReadFull(bufR, buf); err != nil {
+				r.fail(fmt.Errorf("conn %d: record %d: expected %q: %w", idx, n, rec.Data, err))
+				return
+			}
+			if !bytes.Equal(buf, rec.Data) {
+				r.fail(fmt.Errorf("conn %d: record %d: expected %q, got %q", idx, n, rec.Data, buf))
+				return
+			}
+		case DirRecv:
+			if r.Realtime && !last.IsZero() {
+				time.Sleep(rec.Time.Sub(last))
+			}
+			last = rec.Time
+			if _, err := conn.Write(rec.Data); err != nil {
+				return
+			}
+		}
+	}
+}
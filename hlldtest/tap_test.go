@@ -0,0 +1,121 @@
+package hlldtest
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/armon/go-hlld"
+)
+
+// recordSession is used to record dropping a set against an upstream
+func recordSession(t *testing.T) []Record {
+	upstream, stop := testUpstream(t)
+	defer stop()
+
+	conn, err := net.Dial("tcp", upstream)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var buf bytes.Buffer
+	tap := NewTapConn(conn, &buf)
+	client, err := hlld.NewClient(tap, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := dropSet(t, client); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	client.Close()
+	if err := tap.Err(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	records, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return records
+}
+
+func TestTapConn_Record(t *testing.T) {
+	records := recordSession(t)
+	var sent, recv string
+	for _, rec := range records {
+		if rec.Time.IsZero() {
+			t.Fatalf("bad: %v", rec)
+		}
+		switch rec.Dir {
+		case DirSend:
+			sent += string(rec.Data)
+		case DirRecv:
+			recv += string(rec.Data)
+		}
+	}
+	if sent != "drop foo\n" {
+		t.Fatalf("bad: %q", sent)
+	}
+	if recv != "Done\n" {
+		t.Fatalf("bad: %q", recv)
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	r, err := NewReplayer(recordSession(t))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer r.Close()
+
+	client, err := hlld.Dial(r.Addr())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	cmd, err := dropSet(t, client)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ok, err := cmd.Result(); err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestReplayer_Diverged(t *testing.T) {
+	r, err := NewReplayer(recordSession(t))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	client, err := hlld.Dial(r.Addr())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	cmd, err := hlld.NewDropCommand("bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if f, err := client.Execute(cmd); err == nil {
+		f.Error()
+	}
+	r.Close()
+
+	err = r.Err()
+	if err == nil || !strings.Contains(err.Error(), "drop bar") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestReadRecording_Invalid(t *testing.T) {
+	in := `{"time":"2020-01-01T00:00:00Z","dir":"sideways","data":""}`
+	if _, err := ReadRecording(strings.NewReader(in)); err == nil {
+		t.Fatalf("expect error")
+	}
+}
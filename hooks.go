@@ -0,0 +1,196 @@
+package hlld
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Hook is invoked on a command before it is encoded. It may modify the
+// command in place, or return a different command to execute instead.
+// If a hook replaces a command, the result must be read from the command
+// returned by Future.Command. Returning an error aborts the execution.
+type Hook func(cmd Command) (Command, error)
+
+// applyHooks is used to run a command through a chain of hooks
+func applyHooks(hooks []Hook, cmd Command) (Command, error) {
+	for _, hook := range hooks {
+		var err error
+		cmd, err = hook(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if cmd == nil {
+			return nil, fmt.Errorf("hook returned no command")
+		}
+	}
+	return cmd, nil
+}
+
+// prefixMarks records the prefix hooks applied to a command, so that
+// a command executed more than once is only namespaced once. The prefixed
+// name is kept apart from the name set by the caller, which is never
+// modified. The marks are discarded if the caller changes the name after
+// the last hook was applied.
+type prefixMarks struct {
+	base  string
+	name  string
+	hooks []*byte
+}
+
+// current returns the name with the prefixes applied so far,
+// discarding the marks if the caller changed the name
+func (m *prefixMarks) current(base string) string {
+	if m.hooks != nil && base != m.base {
+		m.base = ""
+		m.name = ""
+		m.hooks = nil
+	}
+	return m.encoded(base)
+}
+
+// encoded returns the name to send, which is the prefixed
+// name if the marks are still valid for the caller's name
+func (m *prefixMarks) encoded(base string) string {
+	if m.hooks == nil || base != m.base {
+		return base
+	}
+	return m.name
+}
+
+// applied checks if a hook was applied to the current name
+func (m *prefixMarks) applied(hook *byte) bool {
+	for _, h := range m.hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// mark is used to record that a hook was applied, producing the name
+func (m *prefixMarks) mark(hook *byte, base, name string) {
+	m.base = base
+	m.name = name
+	m.hooks = append(m.hooks, hook)
+}
+
+// PrefixHook returns a hook that prepends a prefix to the set name of
+// every command, which can be used to isolate environments sharing a
+// server. List prefixes are also prefixed, so only the sets in the
+// namespace are listed, and the namespace is stripped from the names of
+// the listed sets. The command provided by the caller keeps its name, so
+// it can be safely executed more than once.
+func PrefixHook(prefix string) Hook {
+	id := new(byte)
+	return func(cmd Command) (Command, error) {
+		marks, base := commandPrefixMarks(cmd)
+		if marks == nil {
+			return cmd, nil
+		}
+		_, list := cmd.(*ListCommand)
+		if !list && base == "" {
+			return cmd, nil
+		}
+		name := marks.current(base)
+		if marks.applied(id) {
+			return cmd, nil
+		}
+		name = prefix + name
+		if !list && !validWord.MatchString(name) {
+			return nil, invalidArg("set name", name)
+		}
+		marks.mark(id, base, name)
+		return cmd, nil
+	}
+}
+
+// DefaultPrecisionHook returns a hook that sets the precision of
+// create commands that specify neither a precision nor an error threshold
+func DefaultPrecisionHook(precision int) Hook {
+	return func(cmd Command) (Command, error) {
+		create, ok := cmd.(*CreateCommand)
+		if ok && create.Precision == 0 && create.ErrThreshold == 0 {
+			create.Precision = precision
+		}
+		return cmd, nil
+	}
+}
+
+// KeyTransform is applied to each key of a command by a KeyHook. It
+// returns the key to set, or an error to abort the execution.
+type KeyTransform func(key string) (string, error)
+
+// KeyHook returns a hook that applies the transforms in order to every
+// key of set commands. The keys of the command are copied before any
+// key is changed, so the slice provided by the caller is not modified.
+func KeyHook(transforms ...KeyTransform) Hook {
+	return func(cmd Command) (Command, error) {
+		if single, ok := cmd.(*SetKeyCommand); ok {
+			out := single.Key
+			for _, transform := range transforms {
+				var err error
+				if out, err = transform(out); err != nil {
+					return nil, err
+				}
+			}
+			if out != single.Key && !validKey.MatchString(out) {
+				return nil, invalidArg("key", out)
+			}
+			single.Key = out
+			return cmd, nil
+		}
+		set, ok := cmd.(*SetKeysCommand)
+		if !ok {
+			return cmd, nil
+		}
+		keys := set.Keys
+		copied := false
+		for idx, key := range set.Keys {
+			out := key
+			for _, transform := range transforms {
+				var err error
+				if out, err = transform(out); err != nil {
+					return nil, err
+				}
+			}
+			if out == key {
+				continue
+			}
+			if !validKey.MatchString(out) {
+				return nil, &ValidationError{Field: "key", Value: out, Index: idx}
+			}
+			if !copied {
+				keys = append([]string(nil), set.Keys...)
+				copied = true
+			}
+			keys[idx] = out
+		}
+		set.Keys = keys
+		return cmd, nil
+	}
+}
+
+// ValidUTF8 is a key transform that rejects keys that are not valid
+// UTF-8, since invalid sequences are likely to be corrupt input
+func ValidUTF8(key string) (string, error) {
+	if !utf8.ValidString(key) {
+		return "", fmt.Errorf("key is not valid UTF-8: %q", key)
+	}
+	return key, nil
+}
+
+// Normalize returns a key transform that applies a unicode normalization
+// form, so that visually identical keys are counted as one element. The
+// standard library has no normalization tables, so the function must be
+// provided, such as norm.NFC.String from golang.org/x/text/unicode/norm.
+// ASCII keys are already normalized and are not passed to the function.
+func Normalize(form func(string) string) KeyTransform {
+	return func(key string) (string, error) {
+		for idx := 0; idx < len(key); idx++ {
+			if key[idx] >= utf8.RuneSelf {
+				return form(key), nil
+			}
+		}
+		return key, nil
+	}
+}
@@ -0,0 +1,217 @@
+package hlld
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrefixHook(t *testing.T) {
+	hook := PrefixHook("prod-")
+
+	create, _ := NewCreateCommand("foo")
+	if _, err := hook(create); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, create, "create prod-foo\n")
+
+	// Should not double prefix, or modify the caller's command
+	if _, err := hook(create); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, create, "create prod-foo\n")
+	if create.SetName != "foo" {
+		t.Fatalf("bad: %s", create.SetName)
+	}
+
+	// Names that already have the prefix are still namespaced
+	create, _ = NewCreateCommand("prod-foo")
+	if _, err := hook(create); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, create, "create prod-prod-foo\n")
+
+	// A renamed command is prefixed again
+	create.SetName = "bar"
+	if _, err := hook(create); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, create, "create prod-bar\n")
+
+	// Chained hooks are each applied once
+	outer := PrefixHook("team-")
+	create, _ = NewCreateCommand("foo")
+	for i := 0; i < 2; i++ {
+		if _, err := applyHooks([]Hook{hook, outer}, create); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	verifyEncode(t, create, "create team-prod-foo\n")
+
+	list, _ := NewListCommand("")
+	if _, err := hook(list); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, list, "list prod-\n")
+	if _, err := hook(list); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, list, "list prod-\n")
+	if list.Prefix != "" {
+		t.Fatalf("bad: %s", list.Prefix)
+	}
+
+	// Global flush is not modified
+	flush, _ := NewFlushCommand("")
+	if _, err := hook(flush); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, flush, "flush\n")
+
+	// Invalid prefix
+	hook = PrefixHook("prod:")
+	drop, _ := NewDropCommand("foo")
+	if _, err := hook(drop); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestDefaultPrecisionHook(t *testing.T) {
+	hook := DefaultPrecisionHook(14)
+
+	create, _ := NewCreateCommand("foo")
+	if _, err := hook(create); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, create, "create foo precision=14\n")
+
+	// Explicit threshold is not modified
+	create, _ = NewCreateCommand("foo")
+	create.ErrThreshold = 0.01
+	if _, err := hook(create); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verifyEncode(t, create, "create foo eps=0.01\n")
+}
+
+func TestClient_Hooks(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		switch line {
+		case "drop prod-foo\n":
+			return "Done\n"
+		case "list prod-f\n":
+			return "START\nprod-foo 0.01 12 3 4096\nEND\n"
+		default:
+			return "Client Error: Command not supported\n"
+		}
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.Hooks = []Hook{PrefixHook("prod-")}
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	drop, _ := NewDropCommand("foo")
+	f, err := client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ok, err := drop.Result(); !ok || err != nil {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+
+	// Running the command again does not double prefix
+	f, err = client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The namespace is stripped from listed sets
+	list, _ := NewListCommand("f")
+	f, err = client.Execute(list)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	entries, err := list.Result()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "foo" {
+		t.Fatalf("bad: %v", entries)
+	}
+
+	// A failing hook aborts the execution
+	conf.Hooks = append(conf.Hooks, func(cmd Command) (Command, error) {
+		return nil, fmt.Errorf("denied")
+	})
+	if _, err := client.Execute(drop); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestKeyHook_Normalize(t *testing.T) {
+	// Stand in for NFC, composing a single sequence
+	var calls int
+	nfc := func(s string) string {
+		calls++
+		return strings.Replace(s, "é", "é", -1)
+	}
+	hook := KeyHook(ValidUTF8, Normalize(nfc))
+
+	keys := []string{"plain", "café", "café"}
+	set, _ := NewSetKeysCommand("foo", keys)
+	if _, err := hook(set); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := []string{"plain", "café", "café"}
+	if !reflect.DeepEqual(set.Keys, expect) {
+		t.Fatalf("bad: %q", set.Keys)
+	}
+	if keys[2] != "café" {
+		t.Fatalf("input modified: %q", keys)
+	}
+	if calls != 2 {
+		t.Fatalf("ascii key normalized: %d", calls)
+	}
+
+	// Single keys are transformed as well
+	single, _ := NewSetKeyCommand("foo", "café")
+	if _, err := hook(single); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if single.Key != "café" {
+		t.Fatalf("bad: %q", single.Key)
+	}
+}
+
+func TestKeyHook_InvalidUTF8(t *testing.T) {
+	hook := KeyHook(ValidUTF8)
+	set, _ := NewSetKeysCommand("foo", []string{"ok", "bad\xff"})
+	if _, err := hook(set); err == nil {
+		t.Fatalf("expect error")
+	}
+	single, _ := NewSetKeyCommand("foo", "bad\xff")
+	if _, err := hook(single); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Other commands are not modified
+	drop, _ := NewDropCommand("foo")
+	if cmd, err := hook(drop); err != nil || cmd != drop {
+		t.Fatalf("bad: %v %v", cmd, err)
+	}
+}
@@ -0,0 +1,73 @@
+package hlld
+
+import (
+	"context"
+	"time"
+)
+
+// labelsKey is the context key for the labels of an operation
+type labelsKey struct{}
+
+// WithLabels returns a context carrying labels that are attached to
+// commands executed with ExecuteContext, and passed to the OnComplete
+// function. This allows latency to be broken down by the calling
+// feature rather than just the command type. Labels already in the
+// context are merged, with the new values taking precedence.
+func WithLabels(ctx context.Context, labels map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range LabelsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, labelsKey{}, merged)
+}
+
+// LabelsFromContext returns the labels carried by a context, if any.
+// The returned map must not be modified.
+func LabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]string)
+	return labels
+}
+
+// Completion describes a completed command, and is passed
+// to the OnComplete function of the configuration
+type Completion struct {
+	// Type is the type of the command, such as "create" or "info"
+	Type string
+
+	// SetName is the name of the set, if the command targets one
+	SetName string
+
+	// Labels are the labels of the context the command was executed
+	// with, if any
+	Labels map[string]string
+
+	// Latency is the time from the command being queued to its
+	// response being decoded
+	Latency time.Duration
+
+	// Bytes is the encoded length of the command, or zero if the
+	// length is unknown
+	Bytes int
+
+	// Err is the error of the command, if any
+	Err error
+}
+
+// observe is used to invoke the OnComplete function for a future
+func (c *Client) observe(f *Future, err error) {
+	if c.config.OnComplete == nil {
+		return
+	}
+	size, _ := EncodedLen(f.cmd)
+	c.config.OnComplete(Completion{
+		Type:    commandType(f.cmd),
+		SetName: commandSetName(f.cmd),
+		Labels:  f.labels,
+		Latency: time.Since(f.enqueued),
+		Bytes:   size,
+		Err:     err,
+	})
+}
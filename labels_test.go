@@ -0,0 +1,72 @@
+package hlld
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithLabels(t *testing.T) {
+	ctx := context.Background()
+	if labels := LabelsFromContext(ctx); labels != nil {
+		t.Fatalf("bad: %v", labels)
+	}
+
+	ctx = WithLabels(ctx, map[string]string{"feature": "signup", "team": "web"})
+	ctx = WithLabels(ctx, map[string]string{"feature": "login"})
+	labels := LabelsFromContext(ctx)
+	if len(labels) != 2 || labels["feature"] != "login" || labels["team"] != "web" {
+		t.Fatalf("bad: %v", labels)
+	}
+}
+
+func TestClient_OnComplete(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	completions := make(chan Completion, 2)
+	conf := DefaultConfig()
+	conf.OnComplete = func(c Completion) {
+		completions <- c
+	}
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Labels from the context are attached
+	ctx := WithLabels(context.Background(), map[string]string{"feature": "signup"})
+	cmd, err := NewCreateCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f, err := client.ExecuteContext(ctx, cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c := <-completions
+	if c.Type != "create" || c.SetName != "foo" || c.Labels["feature"] != "signup" || c.Err != nil {
+		t.Fatalf("bad: %#v", c)
+	}
+	if c.Latency <= 0 || c.Bytes != len("create foo\n") {
+		t.Fatalf("bad: %#v", c)
+	}
+
+	// No labels without a context
+	drop, err := NewDropCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := executeWait(client, drop); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c = <-completions
+	if c.Type != "drop" || c.Labels != nil {
+		t.Fatalf("bad: %#v", c)
+	}
+}
@@ -0,0 +1,138 @@
+package hlld
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// LazyClient is a client that dials the server on first use rather than
+// when it is created, and dials a new connection if the previous one was
+// closed. This avoids ordering the startup of an application after hlld.
+//
+// A connection dropped by the server while idle is only noticed when the
+// next command is sent. Commands that fail with ErrConnectionLost, before
+// any of their response was read, are therefore sent once more on a new
+// connection. Each command is waited on by a goroutine to do so.
+type LazyClient struct {
+	addr   string
+	config *Config
+
+	client     *Client
+	closed     bool
+	clientLock sync.Mutex
+}
+
+// NewLazyClient returns a client for the given address that does not
+// dial until the first command is executed
+func NewLazyClient(addr string, config *Config) (*LazyClient, error) {
+	// Default config if none given, or any unspecified fields
+	if config == nil {
+		config = DefaultConfig()
+	}
+	config.MergeDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	l := &LazyClient{
+		addr:   addr,
+		config: config,
+	}
+	return l, nil
+}
+
+// Execute starts command execution and returns a future,
+// dialing the server if there is no open connection
+func (l *LazyClient) Execute(cmd Command) (*Future, error) {
+	return l.execute(context.Background(), cmd, time.Time{}, nil)
+}
+
+// ExecuteContext starts command execution with a context and returns
+// a future, dialing the server if there is no open connection
+func (l *LazyClient) ExecuteContext(ctx context.Context, cmd Command) (*Future, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	return l.execute(ctx, cmd, deadline, LabelsFromContext(ctx))
+}
+
+// execute is used to send a command, sending it again on a new
+// connection if the connection was lost before the response
+func (l *LazyClient) execute(ctx context.Context, cmd Command, deadline time.Time, labels map[string]string) (*Future, error) {
+	// Apply the hooks once, rather than on every attempt
+	cmd, err := applyHooks(l.config.Hooks, cmd)
+	if err != nil {
+		return nil, err
+	}
+	client, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	sent, err := client.send(ctx, cmd, deadline, labels, futureDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	f := NewFuture(cmd)
+	go func() {
+		err := sent.Error()
+		if errors.Is(err, ErrConnectionLost) {
+			err = l.resend(ctx, cmd, deadline, labels)
+		}
+		f.respond(err)
+	}()
+	return f, nil
+}
+
+// resend is used to send a command again and wait for the result
+func (l *LazyClient) resend(ctx context.Context, cmd Command, deadline time.Time, labels map[string]string) error {
+	client, err := l.get()
+	if err != nil {
+		return err
+	}
+	f, err := client.send(ctx, cmd, deadline, labels, futureDefault)
+	if err != nil {
+		return err
+	}
+	return f.Error()
+}
+
+// Client returns the underlying client, dialing the server
+// if there is no open connection
+func (l *LazyClient) Client() (*Client, error) {
+	return l.get()
+}
+
+// Close is used to shut down the client
+func (l *LazyClient) Close() error {
+	l.clientLock.Lock()
+	defer l.clientLock.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if l.client != nil {
+		return l.client.Close()
+	}
+	return nil
+}
+
+// get is used to return an open client, dialing if necessary
+func (l *LazyClient) get() (*Client, error) {
+	l.clientLock.Lock()
+	defer l.clientLock.Unlock()
+	if l.closed {
+		return nil, ErrClientClosed
+	}
+	if l.client != nil && !l.client.isClosed() {
+		return l.client, nil
+	}
+	client, err := DialConfig(l.addr, l.config)
+	if err != nil {
+		return nil, err
+	}
+	l.client = client
+	return client, nil
+}
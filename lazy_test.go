@@ -0,0 +1,129 @@
+package hlld
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLazyClient(t *testing.T) {
+	// Reserve an address with nothing listening
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	addr := list.Addr().String()
+	list.Close()
+
+	client, err := NewLazyClient(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Should fail to dial
+	cmd, err := NewCreateCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := client.Execute(cmd); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Start the server
+	serverAddr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+	client.addr = serverAddr
+
+	f, err := client.Execute(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	first, err := client.Client()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Should redial once the connection is closed
+	first.Close()
+	f, err = client.Execute(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	second, err := client.Client()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if first == second {
+		t.Fatalf("expect new client")
+	}
+
+	// Should fail after close
+	client.Close()
+	if _, err := client.Execute(cmd); err != ErrClientClosed {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestLazyClient_IdleClose(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+
+	// The server closes each connection after one command
+	var conns int32
+	go func() {
+		for {
+			conn, err := list.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+					return
+				}
+				conn.Write([]byte("Done\n"))
+			}(conn)
+		}
+	}()
+
+	client, err := NewLazyClient(list.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		cmd, _ := NewDropCommand("foo")
+		f, err := client.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if ok, err := cmd.Result(); err != nil || !ok {
+			t.Fatalf("bad: %v %v", ok, err)
+		}
+
+		// Let the connection go idle and be closed by the server
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&conns); n != 3 {
+		t.Fatalf("bad: %d", n)
+	}
+}
@@ -0,0 +1,39 @@
+package hlld
+
+import (
+	"fmt"
+)
+
+// LimitError is returned if a command exceeds the MaxKeysPerCommand
+// or MaxCommandBytes of the client
+type LimitError struct {
+	// Limit is the exceeded limit, either "keys" or "bytes"
+	Limit string
+
+	// Max is the configured limit, and Actual is the size of the command
+	Max    int
+	Actual int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("command has %d %s, limit is %d", e.Actual, e.Limit, e.Max)
+}
+
+// checkLimits is used to check a command against the configured limits
+func (c *Client) checkLimits(cmd Command) error {
+	if max := c.config.MaxKeysPerCommand; max > 0 {
+		if set, ok := cmd.(*SetKeysCommand); ok && len(set.Keys) > max {
+			return &LimitError{Limit: "keys", Max: max, Actual: len(set.Keys)}
+		}
+	}
+	if max := c.config.MaxCommandBytes; max > 0 {
+		size, err := EncodedLen(cmd)
+		if err != nil {
+			return err
+		}
+		if size > max {
+			return &LimitError{Limit: "bytes", Max: max, Actual: size}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package hlld
+
+import (
+	"testing"
+)
+
+func TestClient_Limits(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.MaxKeysPerCommand = 2
+	conf.MaxCommandBytes = 15
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Too many keys
+	set, _ := NewSetKeysCommand("foo", []string{"a", "b", "c"})
+	_, err = client.Execute(set)
+	lerr, ok := err.(*LimitError)
+	if !ok || lerr.Limit != "keys" || lerr.Max != 2 || lerr.Actual != 3 {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Too many bytes, "b foo abcdefgh\n" fits but one more does not
+	set, _ = NewSetKeysCommand("foo", []string{"abcdefghi"})
+	_, err = client.Execute(set)
+	lerr, ok = err.(*LimitError)
+	if !ok || lerr.Limit != "bytes" || lerr.Actual != 16 {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := client.TimeCommand(set); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	set, _ = NewSetKeysCommand("foo", []string{"abcdefgh"})
+	f, err := client.Execute(set)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestConfig_Validate_Limits(t *testing.T) {
+	conf := DefaultConfig()
+	conf.MaxKeysPerCommand = -1
+	conf.MaxCommandBytes = -1
+	err := conf.Validate()
+	cerr, ok := err.(*ConfigError)
+	if !ok || len(cerr.Errors) != 2 {
+		t.Fatalf("err: %v", err)
+	}
+}
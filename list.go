@@ -0,0 +1,79 @@
+package hlld
+
+const (
+	// listPageSize is the number of entries passed to each
+	// invocation of the ListAll callback
+	listPageSize = 1000
+)
+
+// ListAll is used to list the sets, filtering on an optional prefix, and
+// invokes pageFn with each page of entries as they are decoded, so the
+// entire listing is never held in memory. Iteration stops early if pageFn
+// returns false, and the rest of the response is discarded.
+//
+// The callback is invoked on the goroutine decoding responses, so it
+// blocks the responses of other commands and must not execute commands
+// on the same client and wait for them. The Timeout applies to the
+// entire listing, so expensive work should be handed off.
+func (c *Client) ListAll(prefix string, pageFn func(entries []*ListEntry) bool) error {
+	cmd, err := NewListCommand(prefix)
+	if err != nil {
+		return err
+	}
+	cmd.pageFn = pageFn
+	cmd.pageSize = listPageSize
+	if err := executeWait(c, cmd); err != nil {
+		return err
+	}
+	_, err = cmd.Result()
+	return err
+}
+
+// InfoByPrefix is used to list the sets matching a prefix and pipeline
+// an info command for each, returning the results by set name. Sets that
+// are dropped between the list and info commands are omitted.
+func (c *Client) InfoByPrefix(prefix string) (map[string]*SetInfo, error) {
+	// List the names, which cannot be queried from the callback
+	var names []string
+	err := c.ListAll(prefix, func(entries []*ListEntry) bool {
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Pipeline the info commands
+	cmds := make([]*InfoCommand, 0, len(names))
+	futures := make([]*Future, 0, len(names))
+	for _, name := range names {
+		cmd, err := NewInfoCommand(name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := c.Execute(cmd)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+		futures = append(futures, f)
+	}
+
+	// Wait for the results
+	out := make(map[string]*SetInfo, len(cmds))
+	for idx, f := range futures {
+		if err := f.Error(); err != nil {
+			return nil, err
+		}
+		info, ok, err := cmds[idx].Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out[cmds[idx].SetName] = info
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package hlld
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestClient_ListAll(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		switch line {
+		case "list foo\n":
+			var out []string
+			out = append(out, "START")
+			for i := 0; i < 2500; i++ {
+				out = append(out, fmt.Sprintf("foo%d 0.01 12 %d 3280", i, i))
+			}
+			out = append(out, "END")
+			return strings.Join(out, "\n") + "\n"
+		case "list bad\n":
+			return "START\nbad 0.01 12 100 3280\nbad x 12\nEND\n"
+		case "info foo0\n":
+			return "Set does not exist\n"
+		}
+		return "Client Error: Command not supported\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Iterate all the pages
+	var pages []int
+	var total uint64
+	err = client.ListAll("foo", func(entries []*ListEntry) bool {
+		pages = append(pages, len(entries))
+		for _, e := range entries {
+			total += e.Size
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if fmt.Sprintf("%v", pages) != "[1000 1000 500]" {
+		t.Fatalf("bad: %v", pages)
+	}
+	if total != 2500*2499/2 {
+		t.Fatalf("bad: %d", total)
+	}
+
+	// Stop early
+	pages = nil
+	err = client.ListAll("foo", func(entries []*ListEntry) bool {
+		pages = append(pages, len(entries))
+		return false
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("bad: %v", pages)
+	}
+
+	// Should stay in sync
+	info, err := NewInfoCommand("foo0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := executeWait(client, info); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok, err := info.Result(); err != nil || ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+
+	// Parse failure
+	err = client.ListAll("bad", func(entries []*ListEntry) bool {
+		t.Errorf("unexpected page")
+		return true
+	})
+	if err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestClient_InfoByPrefix(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		switch line {
+		case "list foo\n":
+			return "START\nfoo1 0.01 12 10 3280\nfoo2 0.01 12 20 3280\nfoo3 0.01 12 30 3280\nEND\n"
+		case "info foo1\n":
+			return "START\nprecision 12\nsize 10\nEND\n"
+		case "info foo2\n":
+			return "Set does not exist\n"
+		case "info foo3\n":
+			return "START\nprecision 14\nsize 30\nEND\n"
+		}
+		return "Client Error: Command not supported\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	infos, err := client.InfoByPrefix("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("bad: %v", infos)
+	}
+	if infos["foo1"].Size != 10 || infos["foo3"].Precision != 14 {
+		t.Fatalf("bad: %v", infos)
+	}
+}
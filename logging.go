@@ -0,0 +1,139 @@
+package hlld
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// clientLogger returns the logger of a client, which is annotated with
+// the component and remote address. Logging is opt-in, so records are
+// discarded if no logger is configured.
+func clientLogger(logger *slog.Logger, conn net.Conn) *slog.Logger {
+	if logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	attrs := []interface{}{"component", "hlld"}
+	if addr := conn.RemoteAddr(); addr != nil {
+		attrs = append(attrs, "remote", addr.String())
+	}
+	return logger.With(attrs...)
+}
+
+// logEvent is used to log a lifecycle event. Routine events are logged
+// at the debug level, and events that indicate a problem as warnings,
+// unless they are caused by closing the client.
+func (c *Client) logEvent(e Event) {
+	level := slog.LevelDebug
+	switch e.Type {
+	case EventReconnecting, EventProtocolError:
+		if !c.isClosed() {
+			level = slog.LevelWarn
+		}
+	}
+	ctx := context.Background()
+	if !c.logger.Enabled(ctx, level) {
+		return
+	}
+	if e.Err != nil {
+		c.logger.Log(ctx, level, "client "+e.Type.String(), "error", e.Err)
+	} else {
+		c.logger.Log(ctx, level, "client "+e.Type.String())
+	}
+}
+
+// logHandler is a slog.Handler that writes to a log.Logger
+type logHandler struct {
+	logger *log.Logger
+	level  slog.Leveler
+	attrs  string
+	group  string
+}
+
+// NewLogHandler returns a slog.Handler that writes records to a
+// log.Logger at or above the given level, which may be nil for the
+// info level. Records are formatted as "[LEVEL] message key=value",
+// matching the log lines of the tools in this repository.
+func NewLogHandler(logger *log.Logger, level slog.Leveler) slog.Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &logHandler{logger: logger, level: level}
+}
+
+func (h *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString("[")
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("ERR")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("WARN")
+	case r.Level >= slog.LevelInfo:
+		b.WriteString("INFO")
+	default:
+		b.WriteString("DEBUG")
+	}
+	b.WriteString("] ")
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&b, h.group, a)
+		return true
+	})
+	return h.logger.Output(2, b.String())
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		appendAttr(&b, h.group, a)
+	}
+	out := *h
+	out.attrs = b.String()
+	return &out
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	out := *h
+	out.group = h.group + name + "."
+	return &out
+}
+
+// appendAttr is used to format an attribute as " key=value",
+// flattening groups into dotted keys
+func appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(b, prefix, ga)
+		}
+		return
+	}
+	b.WriteString(" ")
+	b.WriteString(prefix)
+	b.WriteString(a.Key)
+	b.WriteString("=")
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	b.WriteString(value)
+}
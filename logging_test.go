@@ -0,0 +1,97 @@
+package hlld
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a buffer safe for concurrent use
+type syncBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(log.New(&buf, "", 0), nil))
+
+	logger.Debug("hidden")
+	logger.With("component", "hlld").WithGroup("cmd").Warn("slow command",
+		"type", "info", "set", "foo bar", slog.Group("latency", "ms", 12))
+	logger.Error("failed", "err", "")
+
+	expect := `[WARN] slow command component=hlld cmd.type=info cmd.set="foo bar" cmd.latency.ms=12
+[ERR] failed err=""
+`
+	if buf.String() != expect {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestClient_Logger(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "bad\n"
+	})
+	defer stop()
+
+	buf := &syncBuffer{}
+	conf := DefaultConfig()
+	conf.Logger = slog.New(NewLogHandler(log.New(buf, "", 0), slog.LevelDebug))
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// A protocol error is logged as a warning
+	list, _ := NewListCommand("")
+	f, err := client.Execute(list)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f.Error()
+
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(buf.String(), "client disconnected") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	out := buf.String()
+	remote := "remote=" + addr
+	if !strings.Contains(out, "[DEBUG] client connected component=hlld "+remote) {
+		t.Fatalf("bad: %s", out)
+	}
+	if !strings.Contains(out, "[WARN] client protocol-error component=hlld "+remote+" error=") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestClientLogger_Default(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Logging is opt-in, so nothing is logged by default
+	logger := clientLogger(nil, client)
+	if logger.Enabled(context.Background(), slog.LevelError) {
+		t.Fatalf("default logger is enabled")
+	}
+}
@@ -0,0 +1,54 @@
+package hlld
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Manifest is an inventory of the sets of a server at a point in time,
+// such as the metadata recorded with a backup
+type Manifest struct {
+	// Created is when the inventory was taken
+	Created time.Time `json:"created"`
+
+	// Addr is the address of the server, if known
+	Addr string `json:"addr,omitempty"`
+
+	// Sets is the info of each set by name
+	Sets map[string]*SetInfo `json:"sets"`
+}
+
+// BuildManifest is used to take an inventory of the sets with
+// the given prefix, or every set if the prefix is empty
+func BuildManifest(client *Client, prefix string) (*Manifest, error) {
+	infos, err := client.InfoByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		Created: time.Now().UTC(),
+		Sets:    infos,
+	}
+	return m, nil
+}
+
+// ReadManifest is used to decode a manifest written by Write
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Sets == nil {
+		m.Sets = make(map[string]*SetInfo)
+	}
+	return m, nil
+}
+
+// Write is used to encode the manifest as indented JSON
+func (m *Manifest) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
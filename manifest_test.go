@@ -0,0 +1,58 @@
+package hlld
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildManifest(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		switch line {
+		case "list \n", "list\n":
+			return "START\nfoo 0.01 12 10 3280\nEND\n"
+		case "info foo\n":
+			return "START\neps 0.01\nprecision 12\nsize 10\nEND\n"
+		}
+		return "Client Error: Command not supported\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	m, err := BuildManifest(client, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if m.Created.IsZero() || len(m.Sets) != 1 || m.Sets["foo"].Precision != 12 {
+		t.Fatalf("bad: %#v", m)
+	}
+
+	// Round trip the manifest
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := ReadManifest(&buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !out.Created.Equal(m.Created) || !reflect.DeepEqual(out.Sets, m.Sets) {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestReadManifest_Invalid(t *testing.T) {
+	if _, err := ReadManifest(strings.NewReader("{")); err == nil {
+		t.Fatalf("expect error")
+	}
+	m, err := ReadManifest(strings.NewReader("{}"))
+	if err != nil || m.Sets == nil {
+		t.Fatalf("bad: %v %v", m, err)
+	}
+}
@@ -0,0 +1,140 @@
+package hlld
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// TagSeparator separates the tag values encoded in a set name
+	TagSeparator = "__"
+)
+
+// Tags maps tag names to values
+type Tags map[string]string
+
+// SetName is used to build and parse set names that encode an ordered
+// list of tags, such as "app__metric__window" for the fields app, metric
+// and window. This provides light-weight labels on top of the flat
+// namespace of hlld, and allows sets to be listed by tag.
+type SetName struct {
+	// Fields are the names of the tags, in the order they are encoded
+	Fields []string
+}
+
+// NewSetName is used to create a set name format with the given fields
+func NewSetName(fields ...string) (*SetName, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("missing fields")
+	}
+	seen := make(map[string]struct{})
+	for _, field := range fields {
+		if field == "" {
+			return nil, fmt.Errorf("invalid field name")
+		}
+		if _, ok := seen[field]; ok {
+			return nil, fmt.Errorf("duplicate field '%s'", field)
+		}
+		seen[field] = struct{}{}
+	}
+	return &SetName{Fields: fields}, nil
+}
+
+// Build is used to encode the tags into a set name. A value must be
+// provided for every field, and values may not contain the separator.
+func (n *SetName) Build(tags Tags) (string, error) {
+	values := make([]string, len(n.Fields))
+	for idx, field := range n.Fields {
+		value, ok := tags[field]
+		if !ok {
+			return "", fmt.Errorf("missing value for '%s'", field)
+		}
+		if err := validTagValue(value); err != nil {
+			return "", fmt.Errorf("invalid value for '%s': %w", field, err)
+		}
+		values[idx] = value
+	}
+	if len(tags) != len(n.Fields) {
+		return "", fmt.Errorf("unknown fields in tags")
+	}
+	return strings.Join(values, TagSeparator), nil
+}
+
+// Parse is used to decode the tags from a set name
+func (n *SetName) Parse(name string) (Tags, error) {
+	values := strings.Split(name, TagSeparator)
+	if len(values) != len(n.Fields) {
+		return nil, fmt.Errorf("expected %d fields in '%s'", len(n.Fields), name)
+	}
+	tags := make(Tags, len(n.Fields))
+	for idx, field := range n.Fields {
+		tags[field] = values[idx]
+	}
+	return tags, nil
+}
+
+// Match checks if a set name has all the tag values in the filter.
+// Names that cannot be parsed do not match.
+func (n *SetName) Match(name string, filter Tags) bool {
+	tags, err := n.Parse(name)
+	if err != nil {
+		return false
+	}
+	for field, value := range filter {
+		if tags[field] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// prefix returns the longest set name prefix fixed by the filter,
+// which can be used to narrow a listing on the server
+func (n *SetName) prefix(filter Tags) string {
+	var values []string
+	for _, field := range n.Fields {
+		value, ok := filter[field]
+		if !ok {
+			break
+		}
+		values = append(values, value)
+	}
+	prefix := strings.Join(values, TagSeparator)
+	if len(values) > 0 && len(values) < len(n.Fields) {
+		prefix += TagSeparator
+	}
+	return prefix
+}
+
+// validTagValue is used to sanity check a tag value
+func validTagValue(value string) error {
+	switch {
+	case !validWord.MatchString(value):
+		return fmt.Errorf("invalid characters")
+	case strings.Contains(value, TagSeparator):
+		return fmt.Errorf("contains separator")
+	case strings.HasPrefix(value, "_") || strings.HasSuffix(value, "_"):
+		return fmt.Errorf("ambiguous with separator")
+	}
+	return nil
+}
+
+// ListTagged is used to list the sets with names in the given format
+// that have all the tag values in the filter. The leading fields of the
+// filter are used as a list prefix, and the remainder are matched by the
+// client. Pages are handed to pageFn as with ListAll, and only contain
+// the matching entries.
+func (c *Client) ListTagged(n *SetName, filter Tags, pageFn func(entries []*ListEntry) bool) error {
+	return c.ListAll(n.prefix(filter), func(entries []*ListEntry) bool {
+		matched := entries[:0]
+		for _, e := range entries {
+			if n.Match(e.Name, filter) {
+				matched = append(matched, e)
+			}
+		}
+		if len(matched) == 0 {
+			return true
+		}
+		return pageFn(matched)
+	})
+}
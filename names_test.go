@@ -0,0 +1,114 @@
+package hlld
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetName(t *testing.T) {
+	if _, err := NewSetName(); err == nil {
+		t.Fatalf("expect error")
+	}
+	if _, err := NewSetName("app", "app"); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	n, err := NewSetName("app", "metric", "window")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tags := Tags{"app": "web", "metric": "users", "window": "1h"}
+	name, err := n.Build(tags)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if name != "web__users__1h" {
+		t.Fatalf("bad: %s", name)
+	}
+
+	out, err := n.Parse(name)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(out, tags) {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// Invalid values
+	for _, bad := range []Tags{
+		{"app": "web", "metric": "users"},
+		{"app": "web", "metric": "users", "window": "1h", "foo": "bar"},
+		{"app": "web__x", "metric": "users", "window": "1h"},
+		{"app": "web_", "metric": "users", "window": "1h"},
+		{"app": "web x", "metric": "users", "window": "1h"},
+	} {
+		if _, err := n.Build(bad); err == nil {
+			t.Fatalf("expect error: %v", bad)
+		}
+	}
+	if _, err := n.Parse("web__users"); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestSetName_Match(t *testing.T) {
+	n, err := NewSetName("app", "metric", "window")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !n.Match("web__users__1h", Tags{"window": "1h"}) {
+		t.Fatalf("expect match")
+	}
+	if n.Match("web__users__1d", Tags{"window": "1h"}) {
+		t.Fatalf("unexpected match")
+	}
+	if n.Match("web_users", nil) {
+		t.Fatalf("unexpected match")
+	}
+
+	if p := n.prefix(Tags{"app": "web", "window": "1h"}); p != "web__" {
+		t.Fatalf("bad: %s", p)
+	}
+	if p := n.prefix(Tags{"app": "web", "metric": "users", "window": "1h"}); p != "web__users__1h" {
+		t.Fatalf("bad: %s", p)
+	}
+	if p := n.prefix(Tags{"window": "1h"}); p != "" {
+		t.Fatalf("bad: %s", p)
+	}
+}
+
+func TestClient_ListTagged(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line != "list web__\n" {
+			t.Errorf("bad: %q", line)
+		}
+		return "START\nweb__users__1h 0.01 12 10 3280\nweb__users__1d 0.01 12 20 3280\nweb__other 0.01 12 30 3280\nweb__pages__1h 0.01 12 40 3280\nEND\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	n, err := NewSetName("app", "metric", "window")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var names []string
+	err = client.ListTagged(n, Tags{"app": "web", "window": "1h"}, func(entries []*ListEntry) bool {
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"web__users__1h", "web__pages__1h"}) {
+		t.Fatalf("bad: %v", names)
+	}
+}
@@ -0,0 +1,420 @@
+package hlld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolConfig is used to parameterize a pool of clients
+type PoolConfig struct {
+	// Size is the number of connections to maintain
+	Size int
+
+	// Affinity is used to route all the commands for the same set
+	// to the same underlying connection. This preserves the ordering
+	// of commands for a given set, which round-robin routing does not.
+	Affinity bool
+
+	// Retries is the number of times a command executed with
+	// ExecuteOrdered is retried if its connection fails. A command must
+	// not be reordered with the commands for the set submitted after it,
+	// so when retries are enabled the commands for each set are sent one
+	// at a time rather than pipelined. Only commands with a single line
+	// response, such as set, create and drop, are retried.
+	Retries int
+
+	// RetryBackoff is the wait before the first retry, which doubles
+	// with each retry up to maxRetryBackoff. A random jitter of up to
+	// the same again is added, so that the commands for many sets do
+	// not all redial at once. Defaults to 10ms.
+	RetryBackoff time.Duration
+
+	// Client is the configuration used for each connection
+	Client *Config
+}
+
+// Validate is used to sanity check the configuration
+func (c *PoolConfig) Validate() error {
+	if c.Size <= 0 {
+		return fmt.Errorf("pool size must be positive")
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("pool retries must not be negative")
+	}
+	if c.RetryBackoff < 0 {
+		return fmt.Errorf("pool retry backoff must not be negative")
+	}
+	if c.Client == nil {
+		return fmt.Errorf("missing client config")
+	}
+	return c.Client.WithDefaults().Validate()
+}
+
+const (
+	// defaultRetryBackoff is used if PoolConfig.RetryBackoff is not set
+	defaultRetryBackoff = 10 * time.Millisecond
+
+	// maxRetryBackoff limits the wait between retries
+	maxRetryBackoff = 5 * time.Second
+)
+
+// DefaultPoolConfig is used as the default pool configuration
+func DefaultPoolConfig() *PoolConfig {
+	return &PoolConfig{
+		Size:     4,
+		Affinity: true,
+		Client:   DefaultConfig(),
+	}
+}
+
+// Pool is used to spread commands over multiple connections
+// to the same hlld server.
+//
+// A single Client executes commands strictly in the order they are
+// submitted. A Pool offers two ordering models. ExecuteOrdered routes
+// every command for a set to the same connection, so commands for that
+// set are executed in submission order, while commands for different
+// sets may be reordered relative to each other. ExecuteUnordered may use
+// any pooled connection, providing maximum throughput with no ordering
+// guarantees. Execute uses the model selected by PoolConfig.Affinity.
+//
+// A pooled connection that fails is redialed when it is next used.
+type Pool struct {
+	addr   string
+	config *PoolConfig
+
+	// next is used for round-robin routing
+	next uint64
+
+	// clients, redials, queues, closed and draining are guarded by
+	// lock. redials holds the dial in progress for each failed slot.
+	// queues holds the ordered commands waiting to be sent for each set
+	// when retries are enabled, and wg tracks the goroutines sending
+	// them. closeCh is closed with the pool to abort retry backoffs.
+	clients  []*Client
+	redials  []*redial
+	queues   map[string]*setQueue
+	closed   bool
+	draining bool
+	closeCh  chan struct{}
+	lock     sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// redial is a dial in progress to replace a failed connection, whose
+// result is shared by all the commands waiting for the slot
+type redial struct {
+	doneCh chan struct{}
+	client *Client
+	err    error
+}
+
+// setQueue is the ordered commands waiting to be sent for a set
+type setQueue struct {
+	futures []*Future
+}
+
+// DialPool is used to dial a pool of connections to a server
+func DialPool(addr string, config *PoolConfig) (*Pool, error) {
+	// Default config if none given
+	if config == nil {
+		config = DefaultPoolConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &Pool{
+		addr:    addr,
+		config:  config,
+		clients: make([]*Client, 0, config.Size),
+		redials: make([]*redial, config.Size),
+		queues:  make(map[string]*setQueue),
+		closeCh: make(chan struct{}),
+	}
+	for i := 0; i < config.Size; i++ {
+		client, err := DialConfig(addr, config.Client)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.clients = append(p.clients, client)
+	}
+	return p, nil
+}
+
+// Close is used to shut down all the connections in the pool. Ordered
+// commands that are waiting to be sent fail with ErrClientClosed.
+func (p *Pool) Close() error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closeCh)
+	for _, client := range p.clients {
+		client.Close()
+	}
+	p.lock.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+// Execute starts command execution on one of the pooled
+// connections and returns a future. The ordering model is
+// determined by the Affinity configuration.
+func (p *Pool) Execute(cmd Command) (*Future, error) {
+	if p.config.Affinity {
+		return p.ExecuteOrdered(cmd)
+	}
+	return p.ExecuteUnordered(cmd)
+}
+
+// ExecuteOrdered starts command execution and returns a future. Commands
+// for the same set are always executed on the same connection in the
+// order they are submitted. Commands that are not specific to a set,
+// such as list or a global flush, are ordered relative to each other.
+//
+// This matters when writes are combined with drop or create, since a set
+// command reordered around a drop would recreate state or be lost. To keep
+// this guarantee, commands are never rerouted to another connection: if
+// the connection for a set fails, the commands already sent on it fail,
+// and it is redialed for the next command. If PoolConfig.Retries is set,
+// the failed commands are instead retried in order on the new connection.
+func (p *Pool) ExecuteOrdered(cmd Command) (*Future, error) {
+	if p.config.Retries > 0 {
+		return p.sequence(cmd)
+	}
+	client, err := p.acquire(p.slot(cmd))
+	if err != nil {
+		return nil, err
+	}
+	return client.Execute(cmd)
+}
+
+// ExecuteUnordered starts command execution and returns a future. The
+// command may use any pooled connection, so there is no guarantee of
+// ordering relative to other commands.
+func (p *Pool) ExecuteUnordered(cmd Command) (*Future, error) {
+	idx := atomic.AddUint64(&p.next, 1) % uint64(p.config.Size)
+	client, err := p.acquire(int(idx))
+	if err != nil {
+		return nil, err
+	}
+	return client.Execute(cmd)
+}
+
+// slot returns the index of the connection used for the ordered
+// commands of a set, or the first connection if the command is
+// not specific to a set
+func (p *Pool) slot(cmd Command) int {
+	name := commandSetName(cmd)
+	if name == "" {
+		return 0
+	}
+	return p.affinityIndex(name)
+}
+
+// accepting returns an error if the pool is not accepting
+// new commands, and must be called with the lock held
+func (p *Pool) accepting() error {
+	if p.closed {
+		return ErrClientClosed
+	}
+	if p.draining {
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// acquire is used to return the connection at an index for a new command
+func (p *Pool) acquire(idx int) (*Client, error) {
+	p.lock.Lock()
+	if err := p.accepting(); err != nil {
+		p.lock.Unlock()
+		return nil, err
+	}
+	return p.memberLocked(idx)
+}
+
+// member is used to return the connection at an index,
+// dialing a new connection if the previous one failed
+func (p *Pool) member(idx int) (*Client, error) {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil, ErrClientClosed
+	}
+	return p.memberLocked(idx)
+}
+
+// memberLocked is used to return the connection at an index. It must be
+// called with the lock held, and releases it. The lock is not held while
+// a failed connection is redialed, so a slow dial only delays the
+// commands for that slot.
+func (p *Pool) memberLocked(idx int) (*Client, error) {
+	client := p.clients[idx]
+	if !client.isClosed() {
+		p.lock.Unlock()
+		return client, nil
+	}
+
+	// Wait for a redial that is already in progress
+	if r := p.redials[idx]; r != nil {
+		p.lock.Unlock()
+		<-r.doneCh
+		return r.client, r.err
+	}
+	r := &redial{doneCh: make(chan struct{})}
+	p.redials[idx] = r
+	p.lock.Unlock()
+
+	r.client, r.err = DialConfig(p.addr, p.config.Client)
+
+	// Only install the client if the pool was not closed while dialing
+	p.lock.Lock()
+	p.redials[idx] = nil
+	if r.err == nil && p.closed {
+		r.client.Close()
+		r.client, r.err = nil, ErrClientClosed
+	} else if r.err == nil {
+		p.clients[idx] = r.client
+	}
+	p.lock.Unlock()
+	close(r.doneCh)
+	return r.client, r.err
+}
+
+// sequence is used to queue an ordered command to be sent once the
+// previous commands for its set have completed, so that a retried
+// command is never reordered with the commands after it
+func (p *Pool) sequence(cmd Command) (*Future, error) {
+	// Apply the hooks once, rather than on every attempt
+	cmd, err := applyHooks(p.config.Client.Hooks, cmd)
+	if err != nil {
+		return nil, err
+	}
+	name := commandSetName(cmd)
+	f := NewFuture(cmd)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err := p.accepting(); err != nil {
+		return nil, err
+	}
+	q, ok := p.queues[name]
+	if !ok {
+		q = &setQueue{}
+		p.queues[name] = q
+		p.wg.Add(1)
+		go p.sendQueue(name, q)
+	}
+	q.futures = append(q.futures, f)
+	return f, nil
+}
+
+// sendQueue is used to send the queued commands for a set one at a
+// time, exiting once the queue is empty
+func (p *Pool) sendQueue(name string, q *setQueue) {
+	defer p.wg.Done()
+	for {
+		p.lock.Lock()
+		if len(q.futures) == 0 {
+			delete(p.queues, name)
+			p.lock.Unlock()
+			return
+		}
+		f := q.futures[0]
+		q.futures[0] = nil
+		q.futures = q.futures[1:]
+		p.lock.Unlock()
+
+		f.respond(p.sendRetry(f.cmd))
+	}
+}
+
+// sendRetry is used to send a command and wait for the result,
+// retrying on a new connection if the connection fails
+func (p *Pool) sendRetry(cmd Command) error {
+	idx := p.slot(cmd)
+	var err error
+	for attempt := 0; attempt <= p.config.Retries; attempt++ {
+		if attempt > 0 {
+			if err := p.backoff(attempt); err != nil {
+				return err
+			}
+		}
+
+		var client *Client
+		client, err = p.member(idx)
+		if err == ErrClientClosed {
+			return err
+		} else if err != nil {
+			continue
+		}
+
+		var f *Future
+		f, err = client.send(context.Background(), cmd, time.Time{}, nil, futureDefault)
+		if err == nil {
+			err = f.Error()
+		}
+		if err == nil || !retryableCommand(cmd) {
+			return err
+		}
+		if !errors.Is(err, ErrConnectionLost) && !client.isClosed() {
+			return err
+		}
+	}
+	return err
+}
+
+// backoff is used to wait before a retry, returning
+// ErrClientClosed if the pool is closed while waiting
+func (p *Pool) backoff(attempt int) error {
+	wait := p.config.RetryBackoff
+	if wait == 0 {
+		wait = defaultRetryBackoff
+	}
+	for i := 1; i < attempt && wait < maxRetryBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryBackoff {
+		wait = maxRetryBackoff
+	}
+	wait += time.Duration(rand.Int63n(int64(wait) + 1))
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-p.closeCh:
+		return ErrClientClosed
+	}
+}
+
+// retryableCommand checks if a command can be sent again after its
+// connection failed. Commands with a multi-line response are not, since
+// a partially decoded response cannot be reset.
+func retryableCommand(cmd Command) bool {
+	switch cmd.(type) {
+	case *CreateCommand, *SetCommand, *SetKeysCommand, *SetKeyCommand, *FlushCommand:
+		return true
+	default:
+		return false
+	}
+}
+
+// affinityIndex is used to map a set name to a stable client index
+func (p *Pool) affinityIndex(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % uint32(p.config.Size))
+}
@@ -0,0 +1,503 @@
+package hlld
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDefaultPoolConfig(t *testing.T) {
+	conf := DefaultPoolConfig()
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	conf.Size = 0
+	if err := conf.Validate(); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestPool_Affinity(t *testing.T) {
+	var lock sync.Mutex
+	seen := make(map[string]map[int]struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		parts := strings.Fields(line)
+		lock.Lock()
+		defer lock.Unlock()
+		if seen[parts[1]] == nil {
+			seen[parts[1]] = make(map[int]struct{})
+		}
+		seen[parts[1]][conn] = struct{}{}
+		return "Done\n"
+	})
+	defer stop()
+
+	pool, err := DialPool(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	var futures []*Future
+	for i := 0; i < 100; i++ {
+		cmd, err := NewSetKeysCommand(fmt.Sprintf("set%d", i%10), []string{"foo"})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		f, err := pool.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		futures = append(futures, f)
+	}
+	for _, f := range futures {
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Each set should only be seen on a single connection
+	lock.Lock()
+	defer lock.Unlock()
+	if len(seen) != 10 {
+		t.Fatalf("bad: %v", seen)
+	}
+	for name, conns := range seen {
+		if len(conns) != 1 {
+			t.Fatalf("set %s used multiple conns: %v", name, conns)
+		}
+	}
+}
+
+func TestPool_RoundRobin(t *testing.T) {
+	var lock sync.Mutex
+	seen := make(map[int]struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		seen[conn] = struct{}{}
+		lock.Unlock()
+		return "Done\n"
+	})
+	defer stop()
+
+	conf := DefaultPoolConfig()
+	conf.Affinity = false
+	pool, err := DialPool(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	for i := 0; i < conf.Size; i++ {
+		cmd, err := NewSetKeysCommand("foo", []string{"bar"})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		f, err := pool.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Every connection should have been used
+	lock.Lock()
+	defer lock.Unlock()
+	if len(seen) != conf.Size {
+		t.Fatalf("bad: %v", seen)
+	}
+}
+
+func TestPool_ExecuteOrdered(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	seen := make(map[string]map[int]struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, line)
+		if seen[line] == nil {
+			seen[line] = make(map[int]struct{})
+		}
+		seen[line][conn] = struct{}{}
+		if line == "list\n" {
+			return "START\nEND\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	// Disable affinity to ensure the explicit ordered mode is used
+	conf := DefaultPoolConfig()
+	conf.Affinity = false
+	pool, err := DialPool(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	for i := 0; i < 20; i++ {
+		var cmd Command
+		if i%2 == 0 {
+			cmd, _ = NewListCommand("")
+		} else {
+			cmd, _ = NewSetKeysCommand("foo", []string{fmt.Sprintf("key%d", i)})
+		}
+		f, err := pool.ExecuteOrdered(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(received) != 20 {
+		t.Fatalf("bad: %v", received)
+	}
+	if len(seen["list\n"]) != 1 {
+		t.Fatalf("list used multiple conns: %v", seen["list\n"])
+	}
+}
+
+func TestPool_ExecuteUnordered(t *testing.T) {
+	var lock sync.Mutex
+	seen := make(map[int]struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		seen[conn] = struct{}{}
+		lock.Unlock()
+		return "Done\n"
+	})
+	defer stop()
+
+	// Affinity is enabled by default, but must be ignored
+	pool, err := DialPool(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	for i := 0; i < pool.config.Size; i++ {
+		cmd, _ := NewSetKeysCommand("foo", []string{"bar"})
+		f, err := pool.ExecuteUnordered(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(seen) != pool.config.Size {
+		t.Fatalf("bad: %v", seen)
+	}
+}
+
+func TestPool_ExecuteOrdered_SubmissionOrder(t *testing.T) {
+	var lock sync.Mutex
+	received := make(map[string][]string)
+	addr, stop := testServer(t, func(conn int, line string) string {
+		parts := strings.Fields(line)
+		lock.Lock()
+		received[parts[1]] = append(received[parts[1]], parts[0])
+		lock.Unlock()
+		return "Done\n"
+	})
+	defer stop()
+
+	pool, err := DialPool(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	// Concurrently submit a create, set and drop sequence per set
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			create, _ := NewCreateCommand(name)
+			set, _ := NewSetKeysCommand(name, []string{"foo"})
+			drop, _ := NewDropCommand(name)
+			var futures []*Future
+			for _, cmd := range []Command{create, set, drop} {
+				f, err := pool.ExecuteOrdered(cmd)
+				if err != nil {
+					t.Errorf("err: %v", err)
+					return
+				}
+				futures = append(futures, f)
+			}
+			for _, f := range futures {
+				if err := f.Error(); err != nil {
+					t.Errorf("err: %v", err)
+				}
+			}
+		}(fmt.Sprintf("set%d", i))
+	}
+	wg.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	for name, cmds := range received {
+		if strings.Join(cmds, ",") != "create,b,drop" {
+			t.Fatalf("bad order for %s: %v", name, cmds)
+		}
+	}
+}
+
+func TestPool_ExecuteOrdered_Redial(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	pool, err := DialPool(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	// Fail the connection used by the set, which is redialed
+	// in the same slot rather than rerouted
+	drop, _ := NewDropCommand("foo")
+	idx := pool.slot(drop)
+	failed := pool.clients[idx]
+	failed.Close()
+
+	f, err := pool.ExecuteOrdered(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if pool.clients[idx] == failed {
+		t.Fatalf("expected new connection")
+	}
+}
+
+func TestPool_ExecuteOrdered_Retries(t *testing.T) {
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+
+	// The connection is dropped the first time the set command is
+	// received, before responding
+	var lock sync.Mutex
+	var received []string
+	dropped := false
+	go func() {
+		for {
+			conn, err := list.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				bufR := bufio.NewReader(conn)
+				for {
+					line, err := bufR.ReadString('\n')
+					if err != nil {
+						return
+					}
+					lock.Lock()
+					received = append(received, strings.TrimSpace(line))
+					drop := line == "b foo a\n" && !dropped
+					dropped = dropped || drop
+					lock.Unlock()
+					if drop {
+						return
+					}
+					conn.Write([]byte("Done\n"))
+				}
+			}(conn)
+		}
+	}()
+
+	conf := DefaultPoolConfig()
+	conf.Retries = 1
+	pool, err := DialPool(list.Addr().String(), conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	create, _ := NewCreateCommand("foo")
+	set, _ := NewSetKeysCommand("foo", []string{"a"})
+	drop, _ := NewDropCommand("foo")
+	var futures []*Future
+	for _, cmd := range []Command{create, set, drop} {
+		f, err := pool.ExecuteOrdered(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		futures = append(futures, f)
+	}
+	for _, f := range futures {
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// The retried command is not reordered with the drop
+	lock.Lock()
+	defer lock.Unlock()
+	if strings.Join(received, ",") != "create foo,b foo a,b foo a,drop foo" {
+		t.Fatalf("bad: %v", received)
+	}
+}
+
+func TestPool_Redial_Unlocked(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	// Connections dialed after the pool is full block in the handshake
+	var dials int32
+	blockCh := make(chan struct{})
+	conf := DefaultPoolConfig()
+	conf.Client.Handshake = func(conn net.Conn, r *bufio.Reader, w *bufio.Writer) error {
+		if atomic.AddInt32(&dials, 1) > int32(conf.Size) {
+			<-blockCh
+		}
+		return nil
+	}
+	pool, err := DialPool(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer pool.Close()
+
+	// Find a set on another connection
+	foo, _ := NewDropCommand("foo")
+	var other Command
+	for i := 0; other == nil; i++ {
+		cmd, _ := NewDropCommand(fmt.Sprintf("bar%d", i))
+		if pool.slot(cmd) != pool.slot(foo) {
+			other = cmd
+		}
+	}
+
+	// Fail the connection for foo, which blocks while redialing
+	pool.clients[pool.slot(foo)].Close()
+	errCh := make(chan error, 1)
+	go func() {
+		f, err := pool.ExecuteOrdered(foo)
+		if err == nil {
+			err = f.Error()
+		}
+		errCh <- err
+	}()
+	for atomic.LoadInt32(&dials) <= int32(conf.Size) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Commands on the other connections are not blocked
+	f, err := pool.ExecuteOrdered(other)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err, ok := f.ErrorTimeout(time.Second); !ok || err != nil {
+		t.Fatalf("bad: %v %v", err, ok)
+	}
+
+	close(blockCh)
+	if err := <-errCh; err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestPool_ExecuteOrdered_CloseBackoff(t *testing.T) {
+	// The connection is always dropped before responding
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return ""
+	})
+	defer stop()
+
+	conf := DefaultPoolConfig()
+	conf.Retries = 1
+	conf.RetryBackoff = time.Hour
+	pool, err := DialPool(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cmd, _ := NewSetKeysCommand("foo", []string{"a"})
+	f, err := pool.ExecuteOrdered(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pool.clients[pool.slot(cmd)].Close()
+
+	// Closing the pool aborts the wait before the retry
+	doneCh := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("close blocked")
+	}
+	if err := f.Error(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPool_Shutdown_Queued(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	conf := DefaultPoolConfig()
+	conf.Retries = 1
+	pool, err := DialPool(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Queued commands are sent before the pool is closed
+	var futures []*Future
+	for i := 0; i < 10; i++ {
+		cmd, _ := NewSetKeysCommand("foo", []string{fmt.Sprintf("k%d", i)})
+		f, err := pool.ExecuteOrdered(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		futures = append(futures, f)
+	}
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, f := range futures {
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	cmd, _ := NewDropCommand("foo")
+	if _, err := pool.ExecuteOrdered(cmd); err != ErrClientClosed {
+		t.Fatalf("bad: %v", err)
+	}
+}
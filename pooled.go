@@ -0,0 +1,72 @@
+package hlld
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// PooledFuture is a handle to a recycled future, returned by
+// ExecutePooled. It avoids allocating a future and channel for every
+// command, which reduces the garbage collection pressure of high rate
+// Execute loops. The handle records the generation of the future, so
+// using it after Release returns ErrStaleFuture rather than the result
+// of another command. Unlike a Future, a PooledFuture must only be
+// waited on by a single goroutine.
+type PooledFuture struct {
+	f   *Future
+	use uint64
+}
+
+// ExecutePooled starts command execution and returns a handle to a
+// pooled future. Release must be called once the result has been read.
+func (c *Client) ExecutePooled(cmd Command) (PooledFuture, error) {
+	f, err := c.execute(context.Background(), cmd, time.Time{}, nil, futurePooled)
+	if err != nil {
+		return PooledFuture{}, err
+	}
+	return PooledFuture{f: f, use: atomic.LoadUint64(&f.use)}, nil
+}
+
+// stale checks if the handle refers to a released future
+func (p PooledFuture) stale() bool {
+	return p.f == nil || atomic.LoadUint64(&p.f.use) != p.use
+}
+
+// Command returns the underlying command, or nil if released
+func (p PooledFuture) Command() Command {
+	if p.stale() {
+		return nil
+	}
+	return p.f.cmd
+}
+
+// Error blocks until the command is complete
+func (p PooledFuture) Error() error {
+	if p.stale() {
+		return ErrStaleFuture
+	}
+	if !p.f.waited {
+		<-p.f.readyCh
+		p.f.waited = true
+	}
+	return p.f.err
+}
+
+// Release is used to return the future to the pool, waiting for the
+// command to complete if needed. The handle and any copies of it must
+// not be used afterwards.
+func (p PooledFuture) Release() {
+	if p.stale() {
+		return
+	}
+	p.Error()
+	f := p.f
+	f.cmd = nil
+	f.err = nil
+	f.deadline = time.Time{}
+	f.labels = nil
+	f.waited = false
+	atomic.AddUint64(&f.use, 1)
+	pooledFutures.Put(f)
+}
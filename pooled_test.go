@@ -0,0 +1,126 @@
+package hlld
+
+import (
+	"testing"
+)
+
+func TestClient_ExecutePooled(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line == "info foo\n" {
+			return "START\nsize 10\nEND\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 100; i++ {
+		info, _ := NewInfoCommand("foo")
+		f, err := client.ExecutePooled(info)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if f.Command() != info {
+			t.Fatalf("bad: %v", f.Command())
+		}
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		// Waiting again returns the same result
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		setInfo, ok, err := info.Result()
+		if err != nil || !ok || setInfo.Size != 10 {
+			t.Fatalf("bad: %v %v %v", setInfo, ok, err)
+		}
+		f.Release()
+
+		// The handle is stale once released
+		if err := f.Error(); err != ErrStaleFuture {
+			t.Fatalf("err: %v", err)
+		}
+		if f.Command() != nil {
+			t.Fatalf("bad: %v", f.Command())
+		}
+		f.Release()
+	}
+
+	// Release waits for the command to complete
+	set, _ := NewSetKeysCommand("foo", []string{"bar"})
+	f, err := client.ExecutePooled(set)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f.Release()
+	if ok, err := set.Result(); err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+
+	// Closed clients return an error
+	client.Close()
+	if _, err := client.ExecutePooled(set); err != ErrClientClosed {
+		t.Fatalf("err: %v", err)
+	}
+	var zero PooledFuture
+	if err := zero.Error(); err != ErrStaleFuture {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func benchmarkClient(b *testing.B, conf *Config) (*Client, func()) {
+	addr, stop := testServer(b, func(conn int, line string) string {
+		return "Done\n"
+	})
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		b.Fatalf("err: %v", err)
+	}
+	return client, func() {
+		client.Close()
+		stop()
+	}
+}
+
+func BenchmarkClient_Execute(b *testing.B) {
+	client, stop := benchmarkClient(b, nil)
+	defer stop()
+	cmd, _ := NewDropCommand("foo")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := client.Execute(cmd)
+		if err != nil {
+			b.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			b.Fatalf("err: %v", err)
+		}
+	}
+}
+
+func BenchmarkClient_ExecutePooled(b *testing.B) {
+	client, stop := benchmarkClient(b, nil)
+	defer stop()
+	cmd, _ := NewDropCommand("foo")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := client.ExecutePooled(cmd)
+		if err != nil {
+			b.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			b.Fatalf("err: %v", err)
+		}
+		f.Release()
+	}
+}
@@ -0,0 +1,257 @@
+package hlld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// QueueMessage is a serialized command received from a QueueSource
+type QueueMessage struct {
+	// Body is the command, serialized by a CommandCodec
+	Body []byte
+
+	// Ack is an optional function invoked once the message is handled,
+	// either because the command succeeded or because it was passed to
+	// OnDeadLetter. Messages that are not acknowledged, such as when the
+	// executor stops while retrying, should be redelivered by the queue.
+	Ack func() error
+}
+
+// QueueSource provides messages to a QueueExecutor, and can be backed
+// by a channel, a Kafka consumer or an SQS queue. Receive blocks until
+// a message is available or the context is done, and returns io.EOF once
+// no more messages will be received. It is called concurrently if the
+// executor has more than one worker.
+type QueueSource interface {
+	Receive(ctx context.Context) (*QueueMessage, error)
+}
+
+// ChannelSource is a QueueSource that receives messages from a channel,
+// which is useful for tests and for queues consumed in the same process
+type ChannelSource <-chan *QueueMessage
+
+// Receive returns the next message of the channel, or io.EOF once it closes
+func (c ChannelSource) Receive(ctx context.Context) (*QueueMessage, error) {
+	select {
+	case msg, ok := <-c:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// QueueOptions are used to configure a QueueExecutor
+type QueueOptions struct {
+	// Codec is used to unmarshal the commands, and defaults to JSONCodec
+	Codec CommandCodec
+
+	// Workers is the number of messages executed concurrently,
+	// and defaults to 1
+	Workers int
+
+	// Retries is the number of times a failed command is retried before
+	// it is passed to OnDeadLetter. Commands are retried if they fail to
+	// execute or are not applied, such as a set that does not exist yet,
+	// but not if they cannot be unmarshaled or the response is an error.
+	Retries int
+
+	// Backoff is the wait before the first retry, which doubles with each
+	// retry up to MaxBackoff. They default to 100ms and 10s.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// OnDeadLetter is an optional function invoked with a message that
+	// could not be executed, which can be used to forward it to a dead
+	// letter queue. The message is acknowledged afterwards, so if it is
+	// not set, failed messages are dropped.
+	OnDeadLetter func(msg *QueueMessage, err error)
+
+	// OnError is an optional function invoked when a message cannot be
+	// acknowledged, which can be used to raise an alert
+	OnError func(err error)
+}
+
+// QueueExecutor executes commands received from a QueueSource, so that
+// producers can queue commands for a separate fleet of consumers
+type QueueExecutor struct {
+	exec   Executor
+	source QueueSource
+	opts   QueueOptions
+}
+
+// NewQueueExecutor creates an executor of the commands of the source.
+// The options may be nil to use the defaults.
+func NewQueueExecutor(exec Executor, source QueueSource, opts *QueueOptions) (*QueueExecutor, error) {
+	if opts == nil {
+		opts = &QueueOptions{}
+	}
+	if opts.Workers < 0 || opts.Retries < 0 {
+		return nil, fmt.Errorf("workers and retries must not be negative")
+	}
+	if opts.Backoff < 0 || opts.MaxBackoff < 0 {
+		return nil, fmt.Errorf("backoff must not be negative")
+	}
+	q := &QueueExecutor{
+		exec:   exec,
+		source: source,
+		opts:   *opts,
+	}
+	if q.opts.Codec == nil {
+		q.opts.Codec = JSONCodec
+	}
+	if q.opts.Workers == 0 {
+		q.opts.Workers = 1
+	}
+	if q.opts.Backoff == 0 {
+		q.opts.Backoff = 100 * time.Millisecond
+	}
+	if q.opts.MaxBackoff == 0 {
+		q.opts.MaxBackoff = 10 * time.Second
+	}
+	return q, nil
+}
+
+// Run is used to execute messages until the context is done or the
+// source is exhausted. It returns nil once the source returns io.EOF,
+// or the first error of the source or context otherwise.
+func (q *QueueExecutor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The first error stops the other workers
+	var wg sync.WaitGroup
+	var once sync.Once
+	var out error
+	for i := 0; i < q.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.work(ctx); err != nil {
+				once.Do(func() {
+					out = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// work is used to execute messages until stopped
+func (q *QueueExecutor) work(ctx context.Context) error {
+	for {
+		msg, err := q.source.Receive(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := q.handle(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle is used to execute a message, retrying until it succeeds or
+// the retries are exhausted. An error is only returned if the context
+// is done, in which case the message is not acknowledged.
+func (q *QueueExecutor) handle(ctx context.Context, msg *QueueMessage) error {
+	err := q.Execute(msg.Body)
+	backoff := q.opts.Backoff
+	for attempt := 0; err != nil && attempt < q.opts.Retries && retryable(err); attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		backoff *= 2
+		if backoff > q.opts.MaxBackoff {
+			backoff = q.opts.MaxBackoff
+		}
+		err = q.Execute(msg.Body)
+	}
+
+	if err != nil && q.opts.OnDeadLetter != nil {
+		q.opts.OnDeadLetter(msg, err)
+	}
+	if msg.Ack != nil {
+		if err := msg.Ack(); err != nil && q.opts.OnError != nil {
+			q.opts.OnError(fmt.Errorf("failed to ack message: %w", err))
+		}
+	}
+	return nil
+}
+
+// QueueError is returned by QueueExecutor.Execute, and passed to
+// OnDeadLetter, if a message cannot be executed
+type QueueError struct {
+	// Command is the type of the command, or empty if
+	// it could not be unmarshaled
+	Command string
+
+	// Err is the cause of the failure
+	Err error
+
+	// Retry is set if the failure may be temporary
+	Retry bool
+}
+
+func (e *QueueError) Error() string {
+	if e.Command == "" {
+		return fmt.Sprintf("failed to unmarshal command: %v", e.Err)
+	}
+	return fmt.Sprintf("%s command failed: %v", e.Command, e.Err)
+}
+
+func (e *QueueError) Unwrap() error {
+	return e.Err
+}
+
+// retryable checks if an error of Execute may be temporary
+func retryable(err error) bool {
+	var qe *QueueError
+	return errors.As(err, &qe) && qe.Retry
+}
+
+// boolResult is implemented by commands with a boolean result
+type boolResult interface {
+	Result() (bool, error)
+}
+
+// Execute is used to unmarshal and execute a single command, without
+// retries, returning a *QueueError if it fails
+func (q *QueueExecutor) Execute(body []byte) error {
+	cmd, err := q.opts.Codec.Unmarshal(body)
+	if err != nil {
+		return &QueueError{Err: err}
+	}
+	typ := commandType(cmd)
+	f, err := q.exec.Execute(cmd)
+	if err == nil {
+		err = f.Error()
+	}
+	if err != nil {
+		return &QueueError{Command: typ, Err: err, Retry: true}
+	}
+	if r, ok := cmd.(boolResult); ok {
+		ok, err := r.Result()
+		if err != nil {
+			return &QueueError{Command: typ, Err: err}
+		}
+		if !ok {
+			return &QueueError{Command: typ, Err: fmt.Errorf("command not applied"), Retry: true}
+		}
+	}
+	return nil
+}
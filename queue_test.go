@@ -0,0 +1,191 @@
+package hlld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// queueMessage returns a message of the command, counting acks
+func queueMessage(t *testing.T, cmd Command, acks *int32) *QueueMessage {
+	buf, err := JSONCodec.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return &QueueMessage{
+		Body: buf,
+		Ack: func() error {
+			atomic.AddInt32(acks, 1)
+			return nil
+		},
+	}
+}
+
+func TestQueueExecutor(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	var missing int32 = 2
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		lines = append(lines, line)
+		lock.Unlock()
+		switch {
+		case strings.HasPrefix(line, "b bar"):
+			// The set exists after a few attempts
+			if atomic.AddInt32(&missing, -1) >= 0 {
+				return "Set does not exist\n"
+			}
+			return "Done\n"
+		case strings.HasPrefix(line, "create"):
+			return "Client Error: Bad arguments\n"
+		default:
+			return "Done\n"
+		}
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	var acks int32
+	var dead []error
+	msgs := make(chan *QueueMessage, 10)
+	keys, _ := NewSetKeysCommand("foo", []string{"a", "b"})
+	retried, _ := NewSetKeysCommand("bar", []string{"c"})
+	create, _ := NewCreateCommand("baz")
+	create.Precision = 30
+	msgs <- queueMessage(t, keys, &acks)
+	msgs <- queueMessage(t, retried, &acks)
+	msgs <- queueMessage(t, create, &acks)
+	msgs <- &QueueMessage{Body: []byte(`{"type":"bulk"}`)}
+	close(msgs)
+
+	q, err := NewQueueExecutor(client, ChannelSource(msgs), &QueueOptions{
+		Retries: 3,
+		Backoff: time.Millisecond,
+		OnDeadLetter: func(msg *QueueMessage, err error) {
+			dead = append(dead, err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := q.Run(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Invalid responses and commands are not retried
+	if acks != 3 {
+		t.Fatalf("bad: %v", acks)
+	}
+	if len(dead) != 2 {
+		t.Fatalf("bad: %v", dead)
+	}
+	var qe *QueueError
+	var ce *CreateError
+	if !errors.As(dead[0], &qe) || qe.Command != "create" || qe.Retry || !errors.As(dead[0], &ce) {
+		t.Fatalf("bad: %v", dead[0])
+	}
+	if !errors.As(dead[1], &qe) || qe.Command != "" || !strings.Contains(qe.Error(), "failed to unmarshal") {
+		t.Fatalf("bad: %v", dead[1])
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	expect := "b foo a b\nb bar c\nb bar c\nb bar c\ncreate baz precision=30\n"
+	if strings.Join(lines, "") != expect {
+		t.Fatalf("bad: %q", lines)
+	}
+}
+
+func TestQueueExecutor_Retries(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Set does not exist\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	var acks int32
+	var dead int32
+	msgs := make(chan *QueueMessage, 10)
+	for i := 0; i < 4; i++ {
+		keys, _ := NewSetKeysCommand(fmt.Sprintf("foo%d", i), []string{"a"})
+		msgs <- queueMessage(t, keys, &acks)
+	}
+	close(msgs)
+
+	q, err := NewQueueExecutor(client, ChannelSource(msgs), &QueueOptions{
+		Workers:    2,
+		Retries:    2,
+		Backoff:    time.Millisecond,
+		MaxBackoff: time.Millisecond,
+		OnDeadLetter: func(msg *QueueMessage, err error) {
+			var qe *QueueError
+			if !errors.As(err, &qe) || !qe.Retry || err.Error() != "bulk command failed: command not applied" {
+				t.Errorf("bad: %v", err)
+			}
+			atomic.AddInt32(&dead, 1)
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := q.Run(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if acks != 4 || dead != 4 {
+		t.Fatalf("bad: %v %v", acks, dead)
+	}
+}
+
+func TestQueueExecutor_Stop(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Set does not exist\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := NewQueueExecutor(client, nil, &QueueOptions{Retries: -1}); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Messages being retried when stopped are not acknowledged
+	var acks int32
+	msgs := make(chan *QueueMessage, 1)
+	keys, _ := NewSetKeysCommand("foo", []string{"a"})
+	msgs <- queueMessage(t, keys, &acks)
+	q, err := NewQueueExecutor(client, ChannelSource(msgs), &QueueOptions{
+		Retries: 100,
+		Backoff: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("err: %v", err)
+	}
+	if acks != 0 {
+		t.Fatalf("bad: %v", acks)
+	}
+}
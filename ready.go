@@ -0,0 +1,84 @@
+package hlld
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// readyMinBackoff and readyMaxBackoff bound the wait
+	// between attempts in WaitReady
+	readyMinBackoff = 50 * time.Millisecond
+	readyMaxBackoff = 5 * time.Second
+
+	// readySetName is the set queried to check readiness. It is not
+	// expected to exist, which keeps the response small.
+	readySetName = "__hlld_ready"
+)
+
+// WaitReady blocks until a round trip with the server succeeds, retrying
+// with backoff until the context is done. A client that has been closed
+// cannot become ready, so ErrClientClosed is returned immediately.
+func (c *Client) WaitReady(ctx context.Context) error {
+	return waitReady(ctx, func() error {
+		if c.isClosed() {
+			return ErrClientClosed
+		}
+		return ping(ctx, c)
+	})
+}
+
+// WaitReady blocks until a round trip with the server succeeds, retrying
+// with backoff until the context is done. The server is dialed on each
+// attempt until it can be reached, so this can be used at startup before
+// hlld is running.
+func (l *LazyClient) WaitReady(ctx context.Context) error {
+	return waitReady(ctx, func() error {
+		client, err := l.get()
+		if err != nil {
+			return err
+		}
+		return ping(ctx, client)
+	})
+}
+
+// waitReady is used to invoke a check with backoff until it succeeds, it
+// returns ErrClientClosed, or the context is done
+func waitReady(ctx context.Context, check func() error) error {
+	backoff := readyMinBackoff
+	for {
+		err := check()
+		if err == nil || err == ErrClientClosed {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+		if backoff > readyMaxBackoff {
+			backoff = readyMaxBackoff
+		}
+	}
+}
+
+// ping is used to perform a single round trip with the server
+func ping(ctx context.Context, client *Client) error {
+	cmd, err := NewInfoCommand(readySetName)
+	if err != nil {
+		return err
+	}
+	f, err := client.ExecuteContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := f.Error(); err != nil {
+		return err
+	}
+	_, _, err = cmd.Result()
+	return err
+}
@@ -0,0 +1,82 @@
+package hlld
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_WaitReady(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line != "info __hlld_ready\n" {
+			t.Errorf("bad: %q", line)
+		}
+		return "Set does not exist\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := client.WaitReady(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	client.Close()
+	if err := client.WaitReady(context.Background()); err != ErrClientClosed {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestLazyClient_WaitReady(t *testing.T) {
+	// Reserve an address with nothing listening
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	addr := list.Addr().String()
+	list.Close()
+
+	client, err := NewLazyClient(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Should give up once the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := client.WaitReady(ctx); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Start the server after a delay
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		list, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		defer list.Close()
+		conn, err := list.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		if _, err := conn.Read(buf); err != nil {
+			return
+		}
+		conn.Write([]byte("Set does not exist\n"))
+		conn.Read(buf)
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.WaitReady(ctx); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
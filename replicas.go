@@ -0,0 +1,136 @@
+package hlld
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// DefaultDivergenceSigmas is the default number of standard errors
+	// the sizes of replicas may differ by before they are diverged
+	DefaultDivergenceSigmas = 3
+)
+
+// Replica identifies a copy of a set, which may be on another server
+type Replica struct {
+	Client  *Client
+	SetName string
+}
+
+// ReplicaReport contains the results of comparing replicas
+type ReplicaReport struct {
+	// Sizes are the estimated sizes of the replicas, in order.
+	// Missing replicas have a size of zero.
+	Sizes []uint64
+
+	// Missing are the indexes of replicas that do not exist
+	Missing []int
+
+	// Precision is the lowest precision of the replicas, which
+	// determines the expected error
+	Precision uint64
+
+	// Divergence is the difference between the largest and smallest
+	// size, relative to the mean size
+	Divergence float64
+
+	// Tolerance is the largest divergence expected from the error of
+	// the HyperLogLog estimates
+	Tolerance float64
+
+	// Diverged is set if a replica is missing, or the divergence
+	// is beyond the tolerance
+	Diverged bool
+}
+
+// ReplicaChecker is used to detect drift between the replicas of a set in
+// dual-write or replicated deployments, by comparing their sizes against
+// the expected error of the HyperLogLog estimates.
+type ReplicaChecker struct {
+	// Replicas are the copies of the set to compare
+	Replicas []Replica
+
+	// Sigmas is the number of standard errors of the difference between
+	// two estimates that are tolerated. DefaultDivergenceSigmas is used
+	// if zero.
+	Sigmas float64
+
+	// OnDiverged is an optional function invoked if the replicas have
+	// diverged, which can be used to trigger re-ingestion
+	OnDiverged func(report *ReplicaReport)
+}
+
+// Check is used to query the size of every replica and compare them
+func (rc *ReplicaChecker) Check() (*ReplicaReport, error) {
+	if len(rc.Replicas) < 2 {
+		return nil, fmt.Errorf("at least 2 replicas required")
+	}
+	sigmas := rc.Sigmas
+	if sigmas == 0 {
+		sigmas = DefaultDivergenceSigmas
+	}
+
+	// Start the info commands on every replica
+	cmds := make([]*InfoCommand, len(rc.Replicas))
+	futures := make([]*Future, len(rc.Replicas))
+	for idx, r := range rc.Replicas {
+		cmd, err := NewInfoCommand(r.SetName)
+		if err != nil {
+			return nil, err
+		}
+		f, err := r.Client.Execute(cmd)
+		if err != nil {
+			return nil, err
+		}
+		cmds[idx] = cmd
+		futures[idx] = f
+	}
+
+	// Gather the sizes
+	report := &ReplicaReport{
+		Sizes: make([]uint64, len(rc.Replicas)),
+	}
+	min, max, sum := uint64(math.MaxUint64), uint64(0), float64(0)
+	for idx, f := range futures {
+		if err := f.Error(); err != nil {
+			return nil, err
+		}
+		info, ok, err := cmds[idx].Result()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			report.Missing = append(report.Missing, idx)
+			continue
+		}
+		report.Sizes[idx] = info.Size
+		if report.Precision == 0 || info.Precision < report.Precision {
+			report.Precision = info.Precision
+		}
+		if info.Size < min {
+			min = info.Size
+		}
+		if info.Size > max {
+			max = info.Size
+		}
+		sum += float64(info.Size)
+	}
+
+	// Compare the sizes of the existing replicas. The difference of two
+	// independent estimates has a standard error of sqrt(2) times that
+	// of a single estimate.
+	if existing := len(rc.Replicas) - len(report.Missing); existing > 0 {
+		if mean := sum / float64(existing); mean > 0 {
+			report.Divergence = float64(max-min) / mean
+		}
+		if report.Precision > 0 {
+			report.Tolerance = sigmas * math.Sqrt2 * TheoreticalError(report.Precision)
+		}
+	}
+	report.Diverged = len(report.Missing) > 0 || report.Divergence > report.Tolerance
+
+	if report.Diverged && rc.OnDiverged != nil {
+		rc.OnDiverged(report)
+	}
+	return report, nil
+}
@@ -0,0 +1,68 @@
+package hlld
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReplicaChecker(t *testing.T) {
+	sizes := map[string]string{
+		"info a\n": "START\nprecision 12\nsize 10000\nEND\n",
+		"info b\n": "START\nprecision 14\nsize 10100\nEND\n",
+		"info c\n": "START\nprecision 12\nsize 12000\nEND\n",
+		"info d\n": "Set does not exist\n",
+	}
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return sizes[line]
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Need at least two replicas
+	rc := &ReplicaChecker{Replicas: []Replica{{client, "a"}}}
+	if _, err := rc.Check(); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	// Within the error
+	var diverged *ReplicaReport
+	rc = &ReplicaChecker{
+		Replicas:   []Replica{{client, "a"}, {client, "b"}},
+		OnDiverged: func(r *ReplicaReport) { diverged = r },
+	}
+	report, err := rc.Check()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if report.Diverged || diverged != nil {
+		t.Fatalf("bad: %#v", report)
+	}
+	if report.Precision != 12 || math.Abs(report.Divergence-100.0/10050) > 1e-9 {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	// Beyond the error
+	rc.Replicas = []Replica{{client, "a"}, {client, "c"}}
+	report, err = rc.Check()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !report.Diverged || diverged != report {
+		t.Fatalf("bad: %#v", report)
+	}
+
+	// Missing replica
+	rc.Replicas = []Replica{{client, "a"}, {client, "d"}}
+	report, err = rc.Check()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !report.Diverged || len(report.Missing) != 1 || report.Missing[0] != 1 {
+		t.Fatalf("bad: %#v", report)
+	}
+}
@@ -0,0 +1,152 @@
+package hlld
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule determines when a recurring task runs
+type Schedule interface {
+	// Next returns the next time after the given time
+	Next(t time.Time) time.Time
+}
+
+// Every returns a schedule that runs at a fixed interval
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+// every is a fixed interval schedule
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronField is the range of a field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// cronSchedule is a schedule parsed from a cron expression. Each field
+// is a set of allowed values, and restricted is used to track if the
+// day fields were specified, since they are combined with a logical or.
+type cronSchedule struct {
+	fields     [5]map[int]bool
+	restricted [5]bool
+}
+
+// ParseCron is used to parse a standard five field cron expression of
+// the minute, hour, day of month, month and day of week. Fields support
+// "*", single values, ranges such as "1-5", steps such as "*/15" or
+// "0-30/10", and comma separated lists of these.
+func ParseCron(expr string) (Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields in cron expression", len(cronFields))
+	}
+	s := &cronSchedule{}
+	for idx, part := range parts {
+		values, err := parseCronField(part, cronFields[idx])
+		if err != nil {
+			return nil, err
+		}
+		s.fields[idx] = values
+		s.restricted[idx] = !strings.HasPrefix(part, "*")
+	}
+	return s, nil
+}
+
+// parseCronField is used to parse a single field of a cron expression
+func parseCronField(part string, field cronField) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, item := range strings.Split(part, ",") {
+		// Split off the step
+		step := 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			n, err := strconv.Atoi(item[idx+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %s field '%s'", field.name, part)
+			}
+			step = n
+			item = item[:idx]
+		}
+
+		// Determine the range
+		lo, hi := field.min, field.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid %s field '%s'", field.name, part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid %s field '%s'", field.name, part)
+				}
+			} else if step != 1 {
+				hi = field.max
+			}
+		}
+		if lo < field.min || hi > field.max || lo > hi {
+			return nil, fmt.Errorf("%s field '%s' out of range %d-%d",
+				field.name, part, field.min, field.max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// cronSearchLimit bounds the search for the next matching time
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	// Start at the next whole minute
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for next.Before(limit) {
+		if !s.fields[3][int(next.Month())] {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if !s.dayMatches(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if !s.fields[1][next.Hour()] {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+			continue
+		}
+		if !s.fields[0][next.Minute()] {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+// dayMatches checks the day fields. As with cron, if both the day of month
+// and day of week are restricted, a day matching either is allowed.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.fields[2][t.Day()]
+	dow := s.fields[4][int(t.Weekday())]
+	if s.restricted[2] && s.restricted[4] {
+		return dom || dow
+	}
+	return dom && dow
+}
@@ -0,0 +1,62 @@
+package hlld
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvery(t *testing.T) {
+	now := time.Now()
+	if next := Every(time.Minute).Next(now); next != now.Add(time.Minute) {
+		t.Fatalf("bad: %v", next)
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("expect error: %s", expr)
+		}
+	}
+}
+
+func TestParseCron_Next(t *testing.T) {
+	// Wednesday
+	start := time.Date(2015, 6, 10, 10, 7, 30, 0, time.UTC)
+	cases := []struct {
+		expr   string
+		expect time.Time
+	}{
+		{"* * * * *", time.Date(2015, 6, 10, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2015, 6, 10, 10, 15, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2015, 6, 10, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2015, 6, 11, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2015, 6, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * 1 *", time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0,30 9-17 * * 1-5", time.Date(2015, 6, 10, 10, 30, 0, 0, time.UTC)},
+
+		// Day of month or day of week
+		{"0 0 20 * 5", time.Date(2015, 6, 12, 0, 0, 0, 0, time.UTC)},
+
+		// Never matches
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tc := range cases {
+		s, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if next := s.Next(start); !next.Equal(tc.expect) {
+			t.Fatalf("bad: %s %v", tc.expr, next)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package hlld
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FlushOptions are used to configure a FlushScheduler
+type FlushOptions struct {
+	// Sets are the sets to flush. If empty, a global flush is issued.
+	Sets []string
+
+	// Jitter is the maximum random delay added to each scheduled time,
+	// which spreads the load of many schedulers with the same schedule
+	Jitter time.Duration
+
+	// OnError is an optional function invoked when a flush fails,
+	// which can be used to raise an alert
+	OnError func(err error)
+}
+
+// FlushScheduler is used to flush sets on a schedule, replacing
+// external cron jobs that send flush commands to the server
+type FlushScheduler struct {
+	client   *Client
+	schedule Schedule
+	opts     FlushOptions
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewFlushScheduler starts flushing on the given schedule. The scheduler
+// must be stopped once it is no longer needed.
+func NewFlushScheduler(client *Client, schedule Schedule, opts *FlushOptions) (*FlushScheduler, error) {
+	if opts == nil {
+		opts = &FlushOptions{}
+	}
+	if opts.Jitter < 0 {
+		return nil, invalidArg("jitter", opts.Jitter.String())
+	}
+	for idx, name := range opts.Sets {
+		if !validWord.MatchString(name) {
+			return nil, &ValidationError{Field: "set name", Value: name, Index: idx}
+		}
+	}
+	f := &FlushScheduler{
+		client:   client,
+		schedule: schedule,
+		opts:     *opts,
+		stopCh:   make(chan struct{}),
+	}
+	go f.run()
+	return f, nil
+}
+
+// Stop is used to stop the scheduler
+func (f *FlushScheduler) Stop() {
+	f.stopOnce.Do(func() {
+		close(f.stopCh)
+	})
+}
+
+// run is used to flush at each scheduled time until stopped
+func (f *FlushScheduler) run() {
+	for {
+		next := f.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		if f.opts.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(f.opts.Jitter))))
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-f.stopCh:
+			timer.Stop()
+			return
+		}
+
+		if err := f.Flush(); err != nil && f.opts.OnError != nil {
+			f.opts.OnError(err)
+		}
+	}
+}
+
+// Flush is used to flush the configured sets immediately
+func (f *FlushScheduler) Flush() error {
+	names := f.opts.Sets
+	if len(names) == 0 {
+		names = []string{""}
+	}
+
+	cmds := make([]*FlushCommand, 0, len(names))
+	futures := make([]*Future, 0, len(names))
+	for _, name := range names {
+		cmd, err := NewFlushCommand(name)
+		if err != nil {
+			return err
+		}
+		fut, err := f.client.Execute(cmd)
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, cmd)
+		futures = append(futures, fut)
+	}
+
+	var failed []string
+	var lastErr error
+	for idx, fut := range futures {
+		err := fut.Error()
+		if err == nil {
+			var ok bool
+			ok, err = cmds[idx].Result()
+			if err == nil && !ok {
+				err = fmt.Errorf("set does not exist")
+			}
+		}
+		if err != nil {
+			failed = append(failed, cmds[idx].SetName)
+			lastErr = err
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to flush %v: %w", failed, lastErr)
+	}
+	return nil
+}
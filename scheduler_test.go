@@ -0,0 +1,87 @@
+package hlld
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlushScheduler(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		lines = append(lines, line)
+		lock.Unlock()
+		if line == "flush bar\n" {
+			return "Set does not exist\n"
+		}
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	_, err = NewFlushScheduler(client, Every(time.Second), &FlushOptions{Sets: []string{"foo", "a b"}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Field != "set name" || verr.Index != 1 {
+		t.Fatalf("bad: %v", err)
+	}
+	_, err = NewFlushScheduler(client, Every(time.Second), &FlushOptions{Jitter: -time.Second})
+	if !errors.As(err, &verr) || verr.Field != "jitter" {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Global flush
+	errCh := make(chan error, 16)
+	sched, err := NewFlushScheduler(client, Every(10*time.Millisecond), &FlushOptions{
+		Jitter:  time.Millisecond,
+		OnError: func(err error) { errCh <- err },
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lock.Lock()
+		n := len(lines)
+		lock.Unlock()
+		if n >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	sched.Stop()
+	lock.Lock()
+	if lines[0] != "flush\n" {
+		t.Fatalf("bad: %v", lines)
+	}
+	lock.Unlock()
+
+	// Per-set flushes report failures
+	sched, err = NewFlushScheduler(client, Every(10*time.Millisecond), &FlushOptions{
+		Sets:    []string{"foo", "bar"},
+		OnError: func(err error) { errCh <- err },
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer sched.Stop()
+	select {
+	case err := <-errCh:
+		if !strings.Contains(err.Error(), "[bar]") {
+			t.Fatalf("bad: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out")
+	}
+}
@@ -0,0 +1,228 @@
+package hlld
+
+import (
+	"fmt"
+	"sort"
+)
+
+// StepStatus is the outcome of a step of a script
+type StepStatus int
+
+const (
+	// StepSkipped is used if the step was not executed because
+	// an earlier step failed
+	StepSkipped StepStatus = iota
+
+	// StepOK is used if the step succeeded
+	StepOK
+
+	// StepFailed is used if the step failed
+	StepFailed
+)
+
+func (s StepStatus) String() string {
+	switch s {
+	case StepSkipped:
+		return "skipped"
+	case StepOK:
+		return "ok"
+	case StepFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("StepStatus(%d)", int(s))
+	}
+}
+
+// scriptStep is a command of a script with an optional compensation
+type scriptStep struct {
+	cmd        Command
+	compensate Command
+}
+
+// Script is used to sequence dependent commands, such as a create followed
+// by sets and a flush. By default every step is sent in a single pipeline,
+// and the results are checked in order once all the steps complete. hlld
+// has no transactions, so steps after a failure may still be applied. If
+// Sequential is set, each step waits for the previous one and the script
+// stops at the first failure, at the cost of a round trip per step.
+//
+// If any step fails, the compensation of every step that succeeded is
+// executed in reverse order, such as a drop to undo a create.
+type Script struct {
+	// Sequential is used to wait for each step before the next
+	Sequential bool
+
+	steps []scriptStep
+}
+
+// Add is used to add a step to the script, with an optional command
+// used to compensate for the step if the script fails
+func (s *Script) Add(cmd Command, compensate Command) {
+	s.steps = append(s.steps, scriptStep{cmd: cmd, compensate: compensate})
+}
+
+// SetNames returns the names of the sets the steps and compensations
+// operate on, sorted and without duplicates. This can be used to lock
+// the sets before running the script.
+func (s *Script) SetNames() []string {
+	seen := make(map[string]struct{})
+	var names []string
+	add := func(cmd Command) {
+		if cmd == nil {
+			return
+		}
+		name := commandSetName(cmd)
+		if _, ok := seen[name]; ok || name == "" {
+			return
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	for _, step := range s.steps {
+		add(step.cmd)
+		add(step.compensate)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StepResult is the result of a step of a script
+type StepResult struct {
+	// Command is the command of the step
+	Command Command
+
+	// Status is the outcome of the step
+	Status StepStatus
+
+	// Err is the reason the step failed
+	Err error
+
+	// Compensated is set if the compensation of the step was executed,
+	// and CompensateErr is set if it failed
+	Compensated   bool
+	CompensateErr error
+}
+
+// ScriptReport is the result of running a script
+type ScriptReport struct {
+	// Steps are the results of the steps, in order
+	Steps []StepResult
+}
+
+// Err returns the error of the first failed step, if any
+func (r *ScriptReport) Err() error {
+	for idx, step := range r.Steps {
+		if step.Status == StepFailed {
+			return fmt.Errorf("step %d (%s) failed: %w", idx, commandType(step.Command), step.Err)
+		}
+	}
+	return nil
+}
+
+// Run is used to execute the script on a client and report each step.
+// The returned error is the error of the first failed step, if any.
+func (s *Script) Run(client *Client) (*ScriptReport, error) {
+	report := &ScriptReport{
+		Steps: make([]StepResult, len(s.steps)),
+	}
+	for idx, step := range s.steps {
+		report.Steps[idx].Command = step.cmd
+	}
+
+	if s.Sequential {
+		for idx, step := range s.steps {
+			s.check(&report.Steps[idx], executeWait(client, step.cmd))
+			if report.Steps[idx].Status == StepFailed {
+				break
+			}
+		}
+	} else {
+		futures := make([]*Future, len(s.steps))
+		for idx, step := range s.steps {
+			f, err := client.Execute(step.cmd)
+			if err != nil {
+				s.check(&report.Steps[idx], err)
+				break
+			}
+			futures[idx] = f
+		}
+		for idx, f := range futures {
+			if f != nil {
+				s.check(&report.Steps[idx], f.Error())
+			}
+		}
+	}
+
+	err := report.Err()
+	if err != nil {
+		s.compensate(client, report)
+	}
+	return report, err
+}
+
+// check is used to set the status of a step given the execution error
+func (s *Script) check(result *StepResult, err error) {
+	if err == nil {
+		err = commandError(result.Command)
+	}
+	if err != nil {
+		result.Status = StepFailed
+		result.Err = err
+		return
+	}
+	result.Status = StepOK
+}
+
+// compensate is used to execute the compensations of the successful
+// steps in reverse order
+func (s *Script) compensate(client *Client, report *ScriptReport) {
+	for idx := len(s.steps) - 1; idx >= 0; idx-- {
+		result := &report.Steps[idx]
+		if result.Status != StepOK || s.steps[idx].compensate == nil {
+			continue
+		}
+		cmd := s.steps[idx].compensate
+		err := executeWait(client, cmd)
+		if err == nil {
+			err = commandError(cmd)
+		}
+		result.Compensated = true
+		result.CompensateErr = err
+	}
+}
+
+// commandError returns an error if the result of a decoded command
+// indicates failure, such as the set not existing
+func commandError(cmd Command) error {
+	var ok bool
+	var err error
+	switch c := cmd.(type) {
+	case *CreateCommand:
+		ok, err = c.Result()
+	case *SetCommand:
+		ok, err = c.Result()
+	case *SetKeysCommand:
+		ok, err = c.Result()
+	case *SetKeyCommand:
+		ok, err = c.Result()
+	case *FlushCommand:
+		ok, err = c.Result()
+	case *InfoCommand:
+		_, ok, err = c.Result()
+	case *ListCommand:
+		_, err = c.Result()
+		ok = true
+	case *RawCommand:
+		_, err = c.Result()
+		ok = true
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("command on set '%s' was not applied", commandSetName(cmd))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package hlld
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		lines = append(lines, line)
+		lock.Unlock()
+		switch line {
+		case "create foo\n", "drop foo\n", "flush foo\n":
+			return "Done\n"
+		}
+		return "Set does not exist\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	newScript := func() *Script {
+		create, _ := NewCreateCommand("foo")
+		drop, _ := NewDropCommand("foo")
+		set, _ := NewSetKeysCommand("bar", []string{"a"})
+		flush, _ := NewFlushCommand("foo")
+		s := &Script{}
+		s.Add(create, drop)
+		s.Add(set, nil)
+		s.Add(flush, nil)
+		return s
+	}
+
+	// Pipelined, every step is executed
+	report, err := newScript().Run(client)
+	if err == nil {
+		t.Fatalf("expect error")
+	}
+	expect := []StepStatus{StepOK, StepFailed, StepOK}
+	for idx, step := range report.Steps {
+		if step.Status != expect[idx] {
+			t.Fatalf("bad: %d %v", idx, step.Status)
+		}
+	}
+	if !report.Steps[0].Compensated || report.Steps[0].CompensateErr != nil {
+		t.Fatalf("bad: %#v", report.Steps[0])
+	}
+	if report.Steps[2].Compensated {
+		t.Fatalf("bad: %#v", report.Steps[2])
+	}
+
+	lock.Lock()
+	got := lines
+	lines = nil
+	lock.Unlock()
+	if len(got) != 4 || got[3] != "drop foo\n" {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Sequential, stops at the failure
+	s := newScript()
+	s.Sequential = true
+	report, err = s.Run(client)
+	if err == nil {
+		t.Fatalf("expect error")
+	}
+	expect = []StepStatus{StepOK, StepFailed, StepSkipped}
+	for idx, step := range report.Steps {
+		if step.Status != expect[idx] {
+			t.Fatalf("bad: %d %v", idx, step.Status)
+		}
+	}
+
+	lock.Lock()
+	got = lines
+	lock.Unlock()
+	if len(got) != 3 || got[2] != "drop foo\n" {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestScript_Success(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	create, _ := NewCreateCommand("foo")
+	drop, _ := NewDropCommand("foo")
+	s := &Script{}
+	s.Add(create, drop)
+	report, err := s.Run(client)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if report.Steps[0].Status != StepOK || report.Steps[0].Compensated {
+		t.Fatalf("bad: %#v", report.Steps[0])
+	}
+}
+
+func TestScript_SetNames(t *testing.T) {
+	create, _ := NewCreateCommand("foo")
+	drop, _ := NewDropCommand("foo")
+	set, _ := NewSetKeysCommand("bar", []string{"a"})
+	flush, _ := NewFlushCommand("")
+	s := &Script{}
+	s.Add(create, drop)
+	s.Add(set, nil)
+	s.Add(flush, nil)
+	names := s.SetNames()
+	if !reflect.DeepEqual(names, []string{"bar", "foo"}) {
+		t.Fatalf("bad: %v", names)
+	}
+}
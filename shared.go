@@ -0,0 +1,133 @@
+package hlld
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	// sharedClients is the registry of shared connections by address
+	sharedClients     = make(map[string]*sharedClient)
+	sharedClientsLock sync.Mutex
+)
+
+// sharedClient is a reference counted connection. dialCh is closed
+// once the connection is dialed, after which client or err is set.
+type sharedClient struct {
+	client *Client
+	err    error
+	dialCh chan struct{}
+	refs   int
+}
+
+// SharedClient is a lightweight handle to a connection that is shared
+// by all the handles in the process dialed to the same address. The
+// underlying connection is closed once every handle is closed. Only
+// command execution is exposed, since methods that change or shut down
+// the connection would affect every handle.
+type SharedClient struct {
+	client    *Client
+	addr      string
+	closeOnce sync.Once
+}
+
+// DialShared returns a handle to a shared connection to the given
+// address, dialing a new connection if there is no open connection.
+// The configuration is only used when a new connection is dialed.
+// Concurrent calls for the same address share a single dial.
+func DialShared(addr string, config *Config) (*SharedClient, error) {
+	sharedClientsLock.Lock()
+
+	// Use the open connection, or wait for a dial in progress
+	shared, ok := sharedClients[addr]
+	if ok {
+		select {
+		case <-shared.dialCh:
+		default:
+			sharedClientsLock.Unlock()
+			<-shared.dialCh
+			if shared.err != nil {
+				return nil, shared.err
+			}
+			sharedClientsLock.Lock()
+		}
+	}
+	if ok && shared.err == nil && !shared.client.isClosed() {
+		shared.refs++
+		sharedClientsLock.Unlock()
+		return &SharedClient{client: shared.client, addr: addr}, nil
+	}
+
+	// Dial a new connection without holding the lock, using
+	// the entry as a placeholder for concurrent callers
+	shared = &sharedClient{dialCh: make(chan struct{})}
+	sharedClients[addr] = shared
+	sharedClientsLock.Unlock()
+	client, err := DialConfig(addr, config)
+
+	sharedClientsLock.Lock()
+	defer sharedClientsLock.Unlock()
+	defer close(shared.dialCh)
+	if err != nil {
+		shared.err = err
+		delete(sharedClients, addr)
+		return nil, err
+	}
+	shared.client = client
+	shared.refs++
+	go unregisterShared(addr, shared)
+	return &SharedClient{client: client, addr: addr}, nil
+}
+
+// unregisterShared is used to remove a connection from the registry
+// once it is closed, such as after an error, so the next DialShared
+// dials a new connection
+func unregisterShared(addr string, shared *sharedClient) {
+	<-shared.client.closedCh
+	sharedClientsLock.Lock()
+	defer sharedClientsLock.Unlock()
+	if sharedClients[addr] == shared {
+		delete(sharedClients, addr)
+	}
+}
+
+// Execute starts command execution on the shared connection
+func (s *SharedClient) Execute(cmd Command) (*Future, error) {
+	return s.client.Execute(cmd)
+}
+
+// ExecuteNoReply starts command execution on the shared connection
+// without returning a future, as with Client.ExecuteNoReply
+func (s *SharedClient) ExecuteNoReply(cmd Command) error {
+	return s.client.ExecuteNoReply(cmd)
+}
+
+// ExecuteContext starts command execution on the shared connection
+// with the deadline and labels of the context, as with
+// Client.ExecuteContext
+func (s *SharedClient) ExecuteContext(ctx context.Context, cmd Command) (*Future, error) {
+	return s.client.ExecuteContext(ctx, cmd)
+}
+
+// Close releases the handle, closing the underlying connection
+// if this is the last open handle to it
+func (s *SharedClient) Close() error {
+	s.closeOnce.Do(func() {
+		sharedClientsLock.Lock()
+		defer sharedClientsLock.Unlock()
+
+		// Check that the connection was not replaced after being closed
+		shared, ok := sharedClients[s.addr]
+		if !ok || shared.client != s.client {
+			s.client.Close()
+			return
+		}
+
+		shared.refs--
+		if shared.refs == 0 {
+			delete(sharedClients, s.addr)
+			shared.client.Close()
+		}
+	})
+	return nil
+}
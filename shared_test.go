@@ -0,0 +1,167 @@
+package hlld
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDialShared(t *testing.T) {
+	var lock sync.Mutex
+	conns := make(map[int]struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		conns[conn] = struct{}{}
+		lock.Unlock()
+		return "Done\n"
+	})
+	defer stop()
+
+	first, err := DialShared(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	second, err := DialShared(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if first.client != second.client {
+		t.Fatalf("expected shared connection")
+	}
+
+	// Closing one handle keeps the connection open
+	first.Close()
+	first.Close()
+	if second.client.isClosed() {
+		t.Fatalf("should not be closed")
+	}
+	drop, _ := NewDropCommand("foo")
+	f, err := second.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Closing the last handle closes the connection
+	second.Close()
+	if !second.client.isClosed() {
+		t.Fatalf("should be closed")
+	}
+
+	// A new handle dials a new connection
+	third, err := DialShared(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer third.Close()
+	if third.client == second.client {
+		t.Fatalf("expected new connection")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(conns) != 1 {
+		t.Fatalf("bad: %v", conns)
+	}
+}
+
+func TestDialShared_Redial(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	first, err := DialShared(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer first.Close()
+
+	// Simulate a connection failure
+	first.client.Close()
+
+	second, err := DialShared(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer second.Close()
+	if first.client == second.client {
+		t.Fatalf("expected new connection")
+	}
+
+	// A closed connection is removed from the registry
+	second.client.Close()
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		sharedClientsLock.Lock()
+		_, ok := sharedClients[addr]
+		sharedClientsLock.Unlock()
+		if !ok {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatalf("expected removal")
+		}
+	}
+}
+
+func TestDialShared_Concurrent(t *testing.T) {
+	slow, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+	other, stopOther := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stopOther()
+
+	// Dialing the slow address blocks in the handshake
+	var dials int32
+	blockCh := make(chan struct{})
+	conf := DefaultConfig()
+	conf.Handshake = func(conn net.Conn, r *bufio.Reader, w *bufio.Writer) error {
+		atomic.AddInt32(&dials, 1)
+		<-blockCh
+		return nil
+	}
+
+	handles := make(chan *SharedClient, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			s, err := DialShared(slow, conf)
+			if err != nil {
+				t.Errorf("err: %v", err)
+			}
+			handles <- s
+		}()
+	}
+	for atomic.LoadInt32(&dials) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Other addresses are not blocked by the dial
+	s, err := DialShared(other, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.Close()
+
+	// Both callers share the single dial
+	close(blockCh)
+	first, second := <-handles, <-handles
+	if first == nil || second == nil {
+		t.FailNow()
+	}
+	defer first.Close()
+	defer second.Close()
+	if first.client != second.client {
+		t.Fatalf("expected shared connection")
+	}
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+}
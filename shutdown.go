@@ -0,0 +1,92 @@
+package hlld
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// accepting returns an error if the client is not
+// accepting new commands
+func (c *Client) accepting() error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+	if atomic.LoadInt32(&c.draining) == 1 {
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// Shutdown is used to gracefully close the client. New commands fail
+// with ErrShuttingDown, while the commands already executed are written
+// and their responses awaited. The client is closed once no commands are
+// pending, or when the context is done, in which case the remaining
+// commands fail and the context error is returned.
+func (c *Client) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&c.draining, 1)
+	defer c.Close()
+	for {
+		c.pendingLock.Lock()
+		pending := c.pending.Len()
+		c.pendingLock.Unlock()
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-c.idleCh:
+		case <-c.closedCh:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Shutdown is used to gracefully close all the connections in the pool
+// in parallel, as with Client.Shutdown. Ordered commands waiting to be
+// sent are sent first. The first error is returned.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.lock.Lock()
+	if p.closed || p.draining {
+		p.lock.Unlock()
+		return nil
+	}
+	p.draining = true
+	p.lock.Unlock()
+
+	// Wait for the queued ordered commands to be sent
+	doneCh := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-ctx.Done():
+	}
+
+	p.lock.Lock()
+	p.closed = true
+	close(p.closeCh)
+	clients := append([]*Client(nil), p.clients...)
+	p.lock.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(clients))
+	for idx, client := range clients {
+		wg.Add(1)
+		go func(idx int, client *Client) {
+			defer wg.Done()
+			errs[idx] = client.Shutdown(ctx)
+		}(idx, client)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package hlld
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClient_Shutdown(t *testing.T) {
+	releaseCh := make(chan struct{})
+	addr, closer := testServer(t, func(conn int, line string) string {
+		<-releaseCh
+		return "Done\n"
+	})
+	defer closer()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	cmd, _ := NewFlushCommand("foo")
+	f, err := client.Execute(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Shutdown(context.Background())
+	}()
+
+	// New commands are rejected while draining
+	deadline := time.Now().Add(time.Second)
+	for {
+		cmd, _ := NewFlushCommand("foo")
+		_, err := client.Execute(cmd)
+		if err == ErrShuttingDown {
+			break
+		}
+		if err != nil || time.Now().After(deadline) {
+			t.Fatalf("err: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-errCh:
+		t.Fatalf("shutdown returned early: %v", err)
+	default:
+	}
+
+	// The pending command completes before the client closes
+	close(releaseCh)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !client.isClosed() {
+		t.Fatalf("expected closed")
+	}
+}
+
+func TestClient_Shutdown_Deadline(t *testing.T) {
+	releaseCh := make(chan struct{})
+	defer close(releaseCh)
+	addr, closer := testServer(t, func(conn int, line string) string {
+		<-releaseCh
+		return "Done\n"
+	})
+	defer closer()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	cmd, _ := NewFlushCommand("foo")
+	f, err := client.Execute(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPool_Shutdown(t *testing.T) {
+	addr, closer := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer closer()
+
+	pool, err := DialPool(addr, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var futures []*Future
+	for i := 0; i < 16; i++ {
+		cmd, _ := NewFlushCommand("foo")
+		f, err := pool.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		futures = append(futures, f)
+	}
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, f := range futures {
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	for _, client := range pool.clients {
+		if !client.isClosed() {
+			t.Fatalf("expected closed")
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package hlld
+
+import (
+	"strconv"
+)
+
+// encodedLener is implemented by commands that can compute
+// the length of their wire form without encoding it
+type encodedLener interface {
+	EncodedLen() int
+}
+
+// EncodedLen returns the length of the wire form of any command,
+// including the trailing newline. This allows batching, limits and
+// metrics to account for the bytes of a command before it is encoded.
+// Commands of this package compute the length directly, and other
+// commands are encoded through AppendWire.
+func EncodedLen(cmd Command) (int, error) {
+	if e, ok := cmd.(encodedLener); ok {
+		return e.EncodedLen(), nil
+	}
+	wire, err := AppendWire(nil, cmd)
+	return len(wire), err
+}
+
+// EncodedLen returns the length of the wire form of the command
+func (c *CreateCommand) EncodedLen() int {
+	n := len("create ") + len(c.wireName()) + 1
+	if c.Precision != 0 {
+		n += len(" precision=") + intLen(c.Precision)
+	}
+	if c.ErrThreshold != 0 {
+		n += len(" eps=") + len(c.formatEps())
+	}
+	if c.InMemory {
+		n += len(" in_memory=true")
+	}
+	return n
+}
+
+// EncodedLen returns the length of the wire form of the command
+func (c *ListCommand) EncodedLen() int {
+	n := len("list") + 1
+	if prefix := c.wirePrefix(); prefix != "" {
+		n += 1 + len(prefix)
+	}
+	return n
+}
+
+// EncodedLen returns the length of the wire form of the command
+func (c *SetCommand) EncodedLen() int {
+	return len(c.Command) + 1 + len(c.wireName()) + 1
+}
+
+// EncodedLen returns the length of the wire form of the command
+func (c *SetKeysCommand) EncodedLen() int {
+	n := len("b ") + len(c.wireName()) + 1
+	for _, key := range c.Keys {
+		n += 1 + len(key)
+	}
+	return n
+}
+
+// EncodedLen returns the length of the wire form of the command
+func (c *SetKeyCommand) EncodedLen() int {
+	return len("s ") + len(c.wireName()) + 1 + len(c.Key) + 1
+}
+
+// EncodedLen returns the length of the wire form of the command
+func (c *FlushCommand) EncodedLen() int {
+	n := len("flush") + 1
+	if c.SetName != "" {
+		n += 1 + len(c.wireName())
+	}
+	return n
+}
+
+// EncodedLen returns the length of the wire form of the command
+func (c *InfoCommand) EncodedLen() int {
+	return len("info ") + len(c.wireName()) + 1
+}
+
+// EncodedLen returns the length of the wire form of the command
+func (c *RawCommand) EncodedLen() int {
+	return len(c.Line) + 1
+}
+
+// intLen returns the number of characters of a formatted integer
+func intLen(v int) int {
+	var buf [20]byte
+	return len(strconv.AppendInt(buf[:0], int64(v), 10))
+}
+
+// SplitSetKeys is used to split keys into set commands of at most
+// maxKeys keys and maxBytes encoded bytes each, such as to match the
+// MaxKeysPerCommand and MaxCommandBytes of a client. Zero disables a
+// limit. An error is returned if a key cannot fit in any command.
+func SplitSetKeys(name string, keys []string, maxKeys, maxBytes int) ([]*SetKeysCommand, error) {
+	if _, err := NewSetKeysCommand(name, keys); err != nil {
+		return nil, err
+	}
+
+	var out []*SetKeysCommand
+	base := len("b ") + len(name) + 1
+	start, size := 0, base
+	for idx, key := range keys {
+		keyLen := 1 + len(key)
+		if maxBytes > 0 && base+keyLen > maxBytes {
+			return nil, &LimitError{Limit: "bytes", Max: maxBytes, Actual: base + keyLen}
+		}
+		full := (maxKeys > 0 && idx-start == maxKeys) || (maxBytes > 0 && size+keyLen > maxBytes)
+		if full {
+			out = append(out, &SetKeysCommand{SetName: name, Keys: keys[start:idx]})
+			start, size = idx, base
+		}
+		size += keyLen
+	}
+	out = append(out, &SetKeysCommand{SetName: name, Keys: keys[start:]})
+	return out, nil
+}
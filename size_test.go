@@ -0,0 +1,76 @@
+package hlld
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodedLen(t *testing.T) {
+	create, _ := NewCreateCommand("foo")
+	create.Precision = 14
+	create.ErrThreshold = 0.000125
+	create.EpsScientific = true
+	single, _ := NewSetKeyCommand("foo", "abc")
+	flush, _ := NewFlushCommand("foo")
+	cmds := append(wireCommands(t), create, single, flush)
+	for _, cmd := range cmds {
+		wire, err := AppendWire(nil, cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		n, err := EncodedLen(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if n != len(wire) {
+			t.Fatalf("bad: %d %q", n, wire)
+		}
+	}
+
+	// Other commands are encoded
+	drop, _ := NewDropCommand("foo")
+	n, err := EncodedLen(struct{ Command }{drop})
+	if err != nil || n != len("drop foo\n") {
+		t.Fatalf("bad: %d %v", n, err)
+	}
+}
+
+func TestSplitSetKeys(t *testing.T) {
+	keys := []string{"a", "bb", "ccc", "d", "e"}
+
+	// No limits use a single command
+	cmds, err := SplitSetKeys("foo", keys, 0, 0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(cmds) != 1 || !reflect.DeepEqual(cmds[0].Keys, keys) {
+		t.Fatalf("bad: %v", cmds)
+	}
+
+	// Each command fits both limits
+	cmds, err = SplitSetKeys("foo", keys, 2, 13)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var out []string
+	for _, cmd := range cmds {
+		out = append(out, cmd.String())
+		if len(cmd.Keys) > 2 || cmd.EncodedLen() > 13 {
+			t.Fatalf("bad: %v", cmd)
+		}
+	}
+	expect := []string{"b foo a bb", "b foo ccc d", "b foo e"}
+	if !reflect.DeepEqual(out, expect) {
+		t.Fatalf("bad: %q", out)
+	}
+
+	// Keys that cannot fit are rejected
+	_, err = SplitSetKeys("foo", keys, 0, 9)
+	lerr, ok := err.(*LimitError)
+	if !ok || lerr.Actual != 10 {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := SplitSetKeys("foo", nil, 0, 0); err == nil {
+		t.Fatalf("expect error")
+	}
+}
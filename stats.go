@@ -0,0 +1,68 @@
+package hlld
+
+import (
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"weak"
+)
+
+// ClientStats contains the counters of a client
+type ClientStats struct {
+	// Commands is the number of commands completed
+	Commands uint64 `json:"commands"`
+
+	// Errors is the number of commands that completed with an error
+	Errors uint64 `json:"errors"`
+
+	// Reconnects is the number of times the connection was replaced
+	Reconnects uint64 `json:"reconnects"`
+
+	// Pending is the number of commands waiting for a response
+	Pending int `json:"pending"`
+}
+
+// Stats returns the current counters of the client
+func (c *Client) Stats() ClientStats {
+	c.pendingLock.Lock()
+	pending := c.pending.Len()
+	c.pendingLock.Unlock()
+	return ClientStats{
+		Commands:   atomic.LoadUint64(&c.commands),
+		Errors:     atomic.LoadUint64(&c.errors),
+		Reconnects: atomic.LoadUint64(&c.reconnects),
+		Pending:    pending,
+	}
+}
+
+// expvarLock serializes PublishExpvar, since checking for a published
+// name and publishing it are separate operations of expvar
+var expvarLock sync.Mutex
+
+// PublishExpvar is used to publish the counters of the client with
+// expvar, so they are served at /debug/vars. Since expvar cannot
+// unpublish a variable, the prefix is used as the name only if it is
+// not yet published, otherwise the first free name of the form
+// "prefix.N" is used. The name is returned. The published variable
+// does not keep the client alive, and is null once it is collected.
+func (c *Client) PublishExpvar(prefix string) (string, error) {
+	if prefix == "" {
+		return "", fmt.Errorf("expvar prefix must not be empty")
+	}
+	expvarLock.Lock()
+	defer expvarLock.Unlock()
+	name := prefix
+	for n := 1; expvar.Get(name) != nil; n++ {
+		name = prefix + "." + strconv.Itoa(n)
+	}
+	ref := weak.Make(c)
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		if c := ref.Value(); c != nil {
+			return c.Stats()
+		}
+		return nil
+	}))
+	return name, nil
+}
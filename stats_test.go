@@ -0,0 +1,71 @@
+package hlld
+
+import (
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+)
+
+func TestClient_Stats(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		if line == "create foo\n" {
+			return "Done\n"
+		}
+		return "bad\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.OnReaderError = func(err error) Action { return FailFutureOnly }
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	create, err := NewCreateCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := executeWait(client, create); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	list, err := NewListCommand("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := executeWait(client, list); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	stats := client.Stats()
+	expect := ClientStats{Commands: 2, Errors: 1}
+	if stats != expect {
+		t.Fatalf("bad: %#v", stats)
+	}
+
+	// Publish with expvar, which uses a new name if the
+	// prefix is taken, such as when the test is repeated
+	name, err := client.PublishExpvar("hlld_test_stats")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	other, err := client.PublishExpvar("hlld_test_stats")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if name == other || !strings.HasPrefix(other, "hlld_test_stats.") {
+		t.Fatalf("bad: %s %s", name, other)
+	}
+	var out ClientStats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != expect {
+		t.Fatalf("bad: %#v", out)
+	}
+	if _, err := client.PublishExpvar(""); err == nil {
+		t.Fatalf("expect error")
+	}
+}
@@ -0,0 +1,84 @@
+package hlld
+
+import (
+	"time"
+)
+
+// timestamps are the times each stage of a timed command completed
+type timestamps struct {
+	dequeued  time.Time
+	written   time.Time
+	firstByte time.Time
+	decoded   time.Time
+}
+
+// CommandTiming is a breakdown of the latency of a command, used to
+// determine if time is spent in the client or in the server
+type CommandTiming struct {
+	// QueueWait is the time spent waiting for the writer, which
+	// grows when the pipeline is busy
+	QueueWait time.Duration
+
+	// Write is the time spent encoding and flushing the command
+	Write time.Duration
+
+	// Server is the time from the write until the first byte of the
+	// response is read. This includes the network round trip, and the
+	// time to read the responses of commands pipelined ahead of it.
+	Server time.Duration
+
+	// Decode is the time from the first byte of the response
+	// until it was decoded
+	Decode time.Duration
+
+	// Total is the time from execution until the response was decoded
+	Total time.Duration
+}
+
+// TimeCommand is used to execute a command and wait for the result,
+// returning a breakdown of where the time was spent. Timed commands
+// are flushed immediately, so this should not be used for every command
+// of a high throughput pipeline. The error is the error of execution;
+// the result of the command is checked as usual.
+func (c *Client) TimeCommand(cmd Command) (*CommandTiming, error) {
+	cmd, err := applyHooks(c.config.Hooks, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkLimits(cmd); err != nil {
+		return nil, err
+	}
+	if err := c.accepting(); err != nil {
+		return nil, err
+	}
+
+	f := NewFuture(cmd)
+	f.timing = &timestamps{}
+	if err := c.enqueue(f); err != nil {
+		return nil, err
+	}
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+
+	ts := f.timing
+	return &CommandTiming{
+		QueueWait: ts.dequeued.Sub(f.enqueued),
+		Write:     ts.written.Sub(ts.dequeued),
+		Server:    ts.firstByte.Sub(ts.written),
+		Decode:    ts.decoded.Sub(ts.firstByte),
+		Total:     ts.decoded.Sub(f.enqueued),
+	}, nil
+}
+
+// decodeTimed is used to decode the response of a timed command,
+// waiting for the first byte before decoding
+func (c *Client) decodeTimed(f *Future) error {
+	if _, err := c.bufR.Peek(1); err != nil {
+		return err
+	}
+	f.timing.firstByte = time.Now()
+	err := f.Command().Decode(c.bufR)
+	f.timing.decoded = time.Now()
+	return err
+}
@@ -0,0 +1,64 @@
+package hlld
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClient_TimeCommand(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		time.Sleep(50 * time.Millisecond)
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	cmd, err := NewDropCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	timing, err := client.TimeCommand(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ok, err := cmd.Result(); err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+
+	if timing.Server < 50*time.Millisecond {
+		t.Fatalf("bad: %#v", timing)
+	}
+	if timing.QueueWait < 0 || timing.Write < 0 || timing.Decode < 0 {
+		t.Fatalf("bad: %#v", timing)
+	}
+	sum := timing.QueueWait + timing.Write + timing.Server + timing.Decode
+	if sum != timing.Total {
+		t.Fatalf("bad: %#v", timing)
+	}
+}
+
+func TestClient_TimeCommand_Closed(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	client.Close()
+
+	cmd, err := NewDropCommand("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := client.TimeCommand(cmd); err != ErrClientClosed {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package hlld
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOptions are used to build a TLS configuration from files
+type TLSOptions struct {
+	// CACert is the path to a PEM encoded CA certificate used to
+	// verify the server. The system roots are used if not provided.
+	CACert string `json:"ca_cert"`
+
+	// ClientCert and ClientKey are the paths to a PEM encoded
+	// certificate and key presented to the server
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+
+	// ServerName is used to verify the server certificate
+	ServerName string `json:"server_name"`
+
+	// SkipVerify disables verification of the server certificate
+	SkipVerify bool `json:"skip_verify"`
+}
+
+// Config is used to build the TLS configuration
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	conf := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.SkipVerify,
+	}
+	if o.CACert != "" {
+		pem, err := ioutil.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA cert: %w", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse CA cert")
+		}
+	}
+	if o.ClientCert != "" || o.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client cert: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
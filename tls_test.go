@@ -0,0 +1,45 @@
+package hlld
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTLSOptions_Config(t *testing.T) {
+	opts := &TLSOptions{
+		ServerName: "hlld.local",
+		SkipVerify: true,
+	}
+	conf, err := opts.Config()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf.ServerName != "hlld.local" || !conf.InsecureSkipVerify {
+		t.Fatalf("bad: %#v", conf)
+	}
+	if conf.RootCAs != nil || len(conf.Certificates) != 0 {
+		t.Fatalf("bad: %#v", conf)
+	}
+}
+
+func TestTLSOptions_ConfigInvalid(t *testing.T) {
+	f, err := ioutil.TempFile("", "hlld")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not a cert")
+	f.Close()
+
+	cases := []*TLSOptions{
+		{CACert: "/does/not/exist"},
+		{CACert: f.Name()},
+		{ClientCert: f.Name(), ClientKey: f.Name()},
+	}
+	for _, opts := range cases {
+		if _, err := opts.Config(); err == nil {
+			t.Fatalf("expect error: %#v", opts)
+		}
+	}
+}
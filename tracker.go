@@ -0,0 +1,190 @@
+package hlld
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sample is a measurement of the size of a set
+type Sample struct {
+	Time time.Time
+	Size uint64
+}
+
+// CardinalityTracker periodically samples the size of a set to measure
+// its rate of growth, which is useful for alerting on anomalous spikes
+// in unique values, such as users. Only a window of recent samples is
+// kept, so the rate reflects recent growth.
+type CardinalityTracker struct {
+	client  *Client
+	name    string
+	window  int
+	samples []Sample
+	lastErr error
+	lock    sync.Mutex
+
+	// detectors observe each sample, see Detect
+	detectors []*AnomalyDetector
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	doneCh   chan struct{}
+}
+
+// NewCardinalityTracker starts tracking the size of a set, sampling at
+// the given interval and keeping up to window samples. The tracker must
+// be stopped once it is no longer needed.
+func NewCardinalityTracker(client *Client, name string, interval time.Duration, window int) (*CardinalityTracker, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+	if window < 2 {
+		return nil, fmt.Errorf("window must be at least 2 samples")
+	}
+	if !validWord.MatchString(name) {
+		return nil, fmt.Errorf("invalid set name")
+	}
+	t := &CardinalityTracker{
+		client: client,
+		name:   name,
+		window: window,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	go t.run(interval)
+	return t, nil
+}
+
+// Stop is used to stop sampling
+func (t *CardinalityTracker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+	})
+}
+
+// Shutdown is used to stop sampling and wait for a sample in progress
+// to complete, or until the context is done. The client is not closed,
+// since it may be shared.
+func (t *CardinalityTracker) Shutdown(ctx context.Context) error {
+	t.Stop()
+	select {
+	case <-t.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run is used to take samples until stopped
+func (t *CardinalityTracker) run(interval time.Duration) {
+	defer close(t.doneCh)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		t.sample()
+		select {
+		case <-ticker.C:
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// sample is used to record the current size of the set
+func (t *CardinalityTracker) sample() {
+	info, err := NewInfoCommand(t.name)
+	if err == nil {
+		err = executeWait(t.client, info)
+	}
+	var setInfo *SetInfo
+	if err == nil {
+		var ok bool
+		setInfo, ok, err = info.Result()
+		if err == nil && !ok {
+			err = fmt.Errorf("set '%s' does not exist", t.name)
+		}
+	}
+
+	t.lock.Lock()
+	t.lastErr = err
+	if err != nil {
+		t.lock.Unlock()
+		return
+	}
+	s := Sample{Time: time.Now(), Size: setInfo.Size}
+	t.add(s)
+	detectors := t.detectors
+	t.lock.Unlock()
+
+	// Detectors are invoked without the lock, so alert hooks may
+	// use the tracker
+	for _, d := range detectors {
+		d.Observe(s)
+	}
+}
+
+// add is used to append a sample, discarding samples outside the window
+func (t *CardinalityTracker) add(s Sample) {
+	t.samples = append(t.samples, s)
+	if len(t.samples) > t.window {
+		t.samples = t.samples[len(t.samples)-t.window:]
+	}
+}
+
+// Samples returns the samples in the window, oldest first
+func (t *CardinalityTracker) Samples() []Sample {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	out := make([]Sample, len(t.samples))
+	copy(out, t.samples)
+	return out
+}
+
+// Err returns the error of the last sample, if it failed
+func (t *CardinalityTracker) Err() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.lastErr
+}
+
+// Rate returns the growth of the set in unique values per minute over
+// the window. It is negative if the set shrank, such as after a clear,
+// and false is returned until there are at least two samples.
+func (t *CardinalityTracker) Rate() (float64, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.rate()
+}
+
+// rate is used to compute the rate with the lock held
+func (t *CardinalityTracker) rate() (float64, bool) {
+	if len(t.samples) < 2 {
+		return 0, false
+	}
+	first, last := t.samples[0], t.samples[len(t.samples)-1]
+	elapsed := last.Time.Sub(first.Time).Minutes()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return (float64(last.Size) - float64(first.Size)) / elapsed, true
+}
+
+// Project returns the expected size of the set after the given duration,
+// assuming it continues to grow at the current rate. False is returned if
+// the rate is not yet known.
+func (t *CardinalityTracker) Project(d time.Duration) (uint64, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	rate, ok := t.rate()
+	if !ok {
+		return 0, false
+	}
+	last := t.samples[len(t.samples)-1]
+	size := float64(last.Size) + rate*d.Minutes()
+	if size < 0 {
+		size = 0
+	}
+	return uint64(size), true
+}
@@ -0,0 +1,127 @@
+package hlld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCardinalityTracker(t *testing.T) {
+	var size uint64
+	addr, stop := testServer(t, func(conn int, line string) string {
+		n := atomic.AddUint64(&size, 100)
+		return fmt.Sprintf("START\nsize %d\nEND\n", n)
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := NewCardinalityTracker(client, "foo", time.Second, 1); err == nil {
+		t.Fatalf("expect error")
+	}
+
+	tracker, err := NewCardinalityTracker(client, "foo", 10*time.Millisecond, 3)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer tracker.Stop()
+
+	// Wait for the window to fill
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tracker.Samples()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tracker.Stop()
+	if err := tracker.Err(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	samples := tracker.Samples()
+	if len(samples) != 3 {
+		t.Fatalf("bad: %v", samples)
+	}
+	if rate, ok := tracker.Rate(); !ok || rate <= 0 {
+		t.Fatalf("bad: %v %v", rate, ok)
+	}
+}
+
+func TestCardinalityTracker_Shutdown(t *testing.T) {
+	startCh := make(chan struct{}, 1)
+	releaseCh := make(chan struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		select {
+		case startCh <- struct{}{}:
+		default:
+		}
+		<-releaseCh
+		return "START\nsize 1\nEND\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	tracker, err := NewCardinalityTracker(client, "foo", time.Hour, 2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	<-startCh
+
+	// The sample in progress holds up the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tracker.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err: %v", err)
+	}
+
+	close(releaseCh)
+	if err := tracker.Shutdown(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if samples := tracker.Samples(); len(samples) != 1 {
+		t.Fatalf("bad: %v", samples)
+	}
+}
+
+func TestCardinalityTracker_Rate(t *testing.T) {
+	tracker := &CardinalityTracker{window: 3}
+	if _, ok := tracker.Rate(); ok {
+		t.Fatalf("expect no rate")
+	}
+
+	start := time.Now()
+	tracker.add(Sample{Time: start, Size: 0})
+	tracker.add(Sample{Time: start.Add(time.Minute), Size: 1000})
+	tracker.add(Sample{Time: start.Add(2 * time.Minute), Size: 1500})
+	tracker.add(Sample{Time: start.Add(3 * time.Minute), Size: 2200})
+
+	// Oldest sample is discarded
+	rate, ok := tracker.Rate()
+	if !ok || rate != 600 {
+		t.Fatalf("bad: %v %v", rate, ok)
+	}
+	size, ok := tracker.Project(10 * time.Minute)
+	if !ok || size != 8200 {
+		t.Fatalf("bad: %v %v", size, ok)
+	}
+
+	// Shrinking sets do not project below zero
+	tracker.add(Sample{Time: start.Add(4 * time.Minute), Size: 0})
+	size, ok = tracker.Project(time.Hour)
+	if !ok || size != 0 {
+		t.Fatalf("bad: %v %v", size, ok)
+	}
+}
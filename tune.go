@@ -0,0 +1,127 @@
+package hlld
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigPatch describes changes to the configuration of a running
+// client. Fields that are nil are left unchanged.
+type ConfigPatch struct {
+	// Timeout is the read or write timeout. Connections that are dialed
+	// on reconnect continue to use the timeout of the original Config.
+	Timeout *time.Duration
+
+	// EnqueueTimeout is the maximum time to wait to queue a command
+	EnqueueTimeout *time.Duration
+
+	// MaxPipeline is the maximum number of pending commands. The
+	// queues are sized when the client is created, so it can be lowered,
+	// or raised back up to the MaxPipeline the client was created with.
+	MaxPipeline *int
+}
+
+// UpdateConfig is used to adjust the timeouts and pipeline depth of a
+// running client, such as when tuning under incident conditions. The
+// patch is validated before any field is applied, and a ConfigError is
+// returned if any field is invalid. Commands already queued or waiting
+// for a response are not affected.
+func (c *Client) UpdateConfig(p ConfigPatch) error {
+	var errs []string
+	if p.Timeout != nil && *p.Timeout <= 0 {
+		errs = append(errs, fmt.Sprintf("timeout must be positive, got %v", *p.Timeout))
+	}
+	if p.EnqueueTimeout != nil && *p.EnqueueTimeout <= 0 {
+		errs = append(errs, fmt.Sprintf("enqueue timeout must be positive, got %v", *p.EnqueueTimeout))
+	}
+	if p.MaxPipeline != nil && (*p.MaxPipeline < 1 || *p.MaxPipeline > cap(c.writeCh)) {
+		errs = append(errs, fmt.Sprintf("max pipeline must be between 1 and %d, got %d",
+			cap(c.writeCh), *p.MaxPipeline))
+	}
+	if len(errs) > 0 {
+		return &ConfigError{Errors: errs}
+	}
+
+	if p.Timeout != nil {
+		atomic.StoreInt64(&c.timeoutNs, int64(*p.Timeout))
+	}
+	if p.EnqueueTimeout != nil {
+		atomic.StoreInt64(&c.enqueueTimeoutNs, int64(*p.EnqueueTimeout))
+	}
+	if p.MaxPipeline != nil {
+		atomic.StoreInt64(&c.maxPipeline, int64(*p.MaxPipeline))
+
+		// Wake a waiter in case the limit was raised
+		select {
+		case c.slotCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// timeout returns the current read or write timeout
+func (c *Client) timeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.timeoutNs))
+}
+
+// enqueueTimeout returns the current enqueue timeout
+func (c *Client) enqueueTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.enqueueTimeoutNs))
+}
+
+// enqueueWait returns the time to wait to queue a future, limited
+// by the deadline of the future if any
+func (c *Client) enqueueWait(f *Future) time.Duration {
+	timeout := c.enqueueTimeout()
+	if !f.deadline.IsZero() {
+		if remain := f.deadline.Sub(time.Now()); remain < timeout {
+			timeout = remain
+		}
+	}
+	return timeout
+}
+
+// pipelineLimited checks if the pipeline depth was lowered below
+// the capacity of the queues
+func (c *Client) pipelineLimited() bool {
+	return atomic.LoadInt64(&c.maxPipeline) < int64(cap(c.writeCh))
+}
+
+// waitSlot is used to wait until fewer commands are pending than the
+// pipeline depth, if it was lowered. The limit is approximate, since
+// concurrent callers may observe the same free slot.
+func (c *Client) waitSlot(f *Future) error {
+	if !c.pipelineLimited() {
+		return nil
+	}
+	var timer *time.Timer
+	for {
+		c.pendingLock.Lock()
+		pending := c.pending.Len()
+		c.pendingLock.Unlock()
+		if int64(pending) < atomic.LoadInt64(&c.maxPipeline) {
+			// Pass the signal on, in case there is room for other waiters
+			if timer != nil {
+				select {
+				case c.slotCh <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(c.enqueueWait(f))
+			defer timer.Stop()
+		}
+		select {
+		case <-c.slotCh:
+		case <-timer.C:
+			return ErrEnqueueTimeout
+		case <-c.closedCh:
+			return ErrClientClosed
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package hlld
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClient_UpdateConfig_Validate(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		return "Done\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.MaxPipeline = 16
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	timeout := time.Duration(-1)
+	depth := 17
+	err = client.UpdateConfig(ConfigPatch{Timeout: &timeout, MaxPipeline: &depth})
+	cerr, ok := err.(*ConfigError)
+	if !ok || len(cerr.Errors) != 2 {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Nothing is applied if any field is invalid
+	if client.timeout() != conf.Timeout {
+		t.Fatalf("bad: %v", client.timeout())
+	}
+}
+
+func TestClient_UpdateConfig_MaxPipeline(t *testing.T) {
+	release := make(chan struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		<-release
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	depth := 1
+	enqueue := 50 * time.Millisecond
+	if err := client.UpdateConfig(ConfigPatch{MaxPipeline: &depth, EnqueueTimeout: &enqueue}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	drop, _ := NewDropCommand("foo")
+	first, err := client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The pipeline is full
+	drop2, _ := NewDropCommand("bar")
+	if _, err := client.Execute(drop2); err != ErrEnqueueTimeout {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A waiting command is queued once the first completes
+	errCh := make(chan error, 1)
+	go func() {
+		enqueue := time.Second
+		client.UpdateConfig(ConfigPatch{EnqueueTimeout: &enqueue})
+		f, err := client.Execute(drop2)
+		if err == nil {
+			err = f.Error()
+		}
+		errCh <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	release <- struct{}{}
+	if err := first.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	release <- struct{}{}
+	if err := <-errCh; err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestClient_UpdateConfig_Timeout(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		time.Sleep(time.Second)
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	timeout := 50 * time.Millisecond
+	if err := client.UpdateConfig(ConfigPatch{Timeout: &timeout}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	drop, _ := NewDropCommand("foo")
+	start := time.Now()
+	f, err := client.Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err == nil {
+		t.Fatalf("expect error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("timeout not applied")
+	}
+}
@@ -0,0 +1,120 @@
+package hlld
+
+import (
+	"strings"
+)
+
+// Capability is a bitmask of optional server features
+type Capability uint32
+
+const (
+	// CapVersion indicates the server supports the version command
+	CapVersion Capability = 1 << iota
+
+	// CapStats indicates the server supports the stats command
+	CapStats
+)
+
+// ServerVersion describes the version and capabilities of a server
+type ServerVersion struct {
+	// Version is the version reported by the server, or empty
+	// if the server does not report a version
+	Version string
+
+	// Capabilities are the optional features detected
+	Capabilities Capability
+}
+
+// Supports checks if the server has all the given capabilities
+func (v *ServerVersion) Supports(cap Capability) bool {
+	return v.Capabilities&cap == cap
+}
+
+// ServerVersion is used to probe the server for its version and
+// capabilities. The version and stats commands are used if supported.
+// Released hlld servers support neither. The result is cached for the
+// lifetime of the client.
+func (c *Client) ServerVersion() (*ServerVersion, error) {
+	c.versionLock.Lock()
+	defer c.versionLock.Unlock()
+	if c.version != nil {
+		return c.version, nil
+	}
+
+	v := &ServerVersion{}
+
+	// Try the version command
+	resp, ok, err := c.probe("version")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		v.Capabilities |= CapVersion
+		v.Version = parseVersion(resp)
+	}
+
+	// Try the stats command, which may also report the version
+	resp, ok, err = c.probe("stats")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		v.Capabilities |= CapStats
+		if v.Version == "" {
+			v.Version = statsVersion(resp)
+		}
+	}
+
+	c.version = v
+	return v, nil
+}
+
+// Supports is used to check if the server has all the given capabilities
+func (c *Client) Supports(cap Capability) (bool, error) {
+	v, err := c.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	return v.Supports(cap), nil
+}
+
+// probe is used to send a raw command, returning false if the
+// server does not support it
+func (c *Client) probe(line string) (string, bool, error) {
+	cmd, err := NewRawCommand(line)
+	if err != nil {
+		return "", false, err
+	}
+	if err := executeWait(c, cmd); err != nil {
+		return "", false, err
+	}
+	resp, err := cmd.Result()
+	if err != nil {
+		return "", false, err
+	}
+	if strings.HasPrefix(resp, "Client Error") {
+		return "", false, nil
+	}
+	return resp, true, nil
+}
+
+// parseVersion is used to extract the version from a version response,
+// such as "hlld 0.5.6" or "0.5.6"
+func parseVersion(resp string) string {
+	fields := strings.Fields(resp)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(fields[len(fields)-1], "v")
+}
+
+// statsVersion is used to extract the version from a stats block
+func statsVersion(resp string) string {
+	for _, line := range strings.Split(resp, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "version" {
+			return strings.TrimPrefix(fields[1], "v")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package hlld
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_ServerVersion_Legacy(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		switch line {
+		case "list\n":
+			return "START\nfoo 0.01 12 100 3280\nEND\n"
+		case "info foo\n":
+			return "START\nin_memory 1\nprecision 12\nsize 100\nEND\n"
+		}
+		return "Client Error: Command not supported\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	v, err := client.ServerVersion()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if v.Version != "" || v.Capabilities != 0 {
+		t.Fatalf("bad: %#v", v)
+	}
+}
+
+func TestClient_ServerVersion(t *testing.T) {
+	var probes, sets int32
+	addr, stop := testServer(t, func(conn int, line string) string {
+		switch line {
+		case "version\n":
+			atomic.AddInt32(&probes, 1)
+			return "hlld v0.6.0\n"
+		case "stats\n":
+			return "START\nversion 0.6.0\nconns 1\nEND\n"
+		case "list\n", "info foo\n":
+			atomic.AddInt32(&sets, 1)
+		}
+		return "Client Error: Command not supported\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	v, err := client.ServerVersion()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if v.Version != "0.6.0" {
+		t.Fatalf("bad: %#v", v)
+	}
+	if !v.Supports(CapVersion | CapStats) {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	// Should be cached
+	ok, err := client.Supports(CapStats)
+	if err != nil || !ok {
+		t.Fatalf("bad: %v %v", ok, err)
+	}
+	if n := atomic.LoadInt32(&probes); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Should not inspect existing sets
+	if n := atomic.LoadInt32(&sets); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
@@ -0,0 +1,121 @@
+package hlld
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Option overrides the behavior of the commands executed by a ClientView
+type Option func(v *ClientView)
+
+// WithTimeout sets the timeout of each command. A command whose response
+// is not received in time fails with context.DeadlineExceeded, as with
+// the deadline of a context passed to Client.ExecuteContext, while the
+// shared connection is unaffected.
+func WithTimeout(d time.Duration) Option {
+	return func(v *ClientView) {
+		v.timeout = d
+	}
+}
+
+// WithRetries sets the number of times a command that could not be
+// queued for writing is retried, waiting for the backoff in between.
+// Only commands that were never sent are retried, so retries are safe
+// for any command.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(v *ClientView) {
+		v.retries = retries
+		v.backoff = backoff
+	}
+}
+
+// WithNamespace prepends a prefix to the set names of every command,
+// using a PrefixHook
+func WithNamespace(prefix string) Option {
+	return WithHooks(PrefixHook(prefix))
+}
+
+// WithHooks adds hooks invoked on every command of the view, before the
+// hooks of the client
+func WithHooks(hooks ...Hook) Option {
+	return func(v *ClientView) {
+		v.hooks = append(v.hooks, hooks...)
+	}
+}
+
+// ClientView is a lightweight view of a Client that shares its connection
+// but overrides the behavior of each command, so subsystems can tune their
+// commands without separate connections. Views are created by Client.With
+// and are closed with the client.
+type ClientView struct {
+	client  *Client
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	hooks   []Hook
+}
+
+var _ Executor = (*ClientView)(nil)
+
+// With returns a view of the client with the given options
+func (c *Client) With(opts ...Option) *ClientView {
+	v := &ClientView{client: c}
+	return v.With(opts...)
+}
+
+// With returns a view deriving the options of this view, overriding
+// its timeout and retries and adding hooks after its hooks
+func (v *ClientView) With(opts ...Option) *ClientView {
+	out := *v
+	out.hooks = append([]Hook(nil), v.hooks...)
+	for _, opt := range opts {
+		opt(&out)
+	}
+	return &out
+}
+
+// Client returns the underlying client
+func (v *ClientView) Client() *Client {
+	return v.client
+}
+
+// Execute starts command execution and returns a future
+func (v *ClientView) Execute(cmd Command) (*Future, error) {
+	return v.ExecuteContext(context.Background(), cmd)
+}
+
+// ExecuteContext starts command execution and returns a future. The
+// deadline of the context is used if it is earlier than the timeout
+// of the view, and labels are attached as with Client.ExecuteContext.
+func (v *ClientView) ExecuteContext(ctx context.Context, cmd Command) (*Future, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cmd, err := applyHooks(v.hooks, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	if v.timeout > 0 {
+		if d := time.Now().Add(v.timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	labels := LabelsFromContext(ctx)
+
+	for attempt := 0; ; attempt++ {
+		f, err := v.client.execute(ctx, cmd, deadline, labels, futureDefault)
+		if !errors.Is(err, ErrEnqueueTimeout) || attempt >= v.retries {
+			return f, err
+		}
+		timer := time.NewTimer(v.backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
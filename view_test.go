@@ -0,0 +1,126 @@
+package hlld
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientView(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	addr, stop := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		lines = append(lines, line)
+		lock.Unlock()
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Namespaces apply to the view and the views derived from it
+	ns := client.With(WithNamespace("a_"))
+	nested := ns.With(WithNamespace("b_"))
+	for _, exec := range []Executor{client, ns, nested} {
+		cmd, _ := NewDropCommand("foo")
+		f, err := exec.Execute(cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := f.Error(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if nested.Client() != client {
+		t.Fatalf("bad client")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if strings.Join(lines, "") != "drop foo\ndrop a_foo\ndrop b_a_foo\n" {
+		t.Fatalf("bad: %q", lines)
+	}
+}
+
+func TestClientView_Timeout(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		time.Sleep(time.Second)
+		return "Done\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// The view times out long before the client
+	view := client.With(WithTimeout(20 * time.Millisecond))
+	cmd, _ := NewDropCommand("foo")
+	start := time.Now()
+	f, err := view.Execute(cmd)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err == nil {
+		t.Fatalf("expect error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("should time out")
+	}
+
+	// Canceled contexts are not executed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := view.ExecuteContext(ctx, cmd); err != context.Canceled {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestClientView_Retries(t *testing.T) {
+	release := make(chan struct{})
+	addr, stop := testServer(t, func(conn int, line string) string {
+		<-release
+		return "Done\n"
+	})
+	defer stop()
+
+	conf := DefaultConfig()
+	conf.MaxPipeline = 1
+	conf.EnqueueTimeout = 10 * time.Millisecond
+	client, err := DialConfig(addr, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	// Fill the pipeline, so commands cannot be queued
+	for i := 0; i < 4; i++ {
+		drop, _ := NewDropCommand("foo")
+		if _, err := client.Execute(drop); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	drop, _ := NewDropCommand("foo")
+	if _, err := client.With(WithRetries(1, time.Millisecond)).Execute(drop); err != ErrEnqueueTimeout {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The command is queued once the pipeline drains
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	f, err := client.With(WithRetries(100, 10*time.Millisecond)).Execute(drop)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := f.Error(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package hlld
+
+// WarmReport contains the results of warming sets
+type WarmReport struct {
+	// Warm are the sets that are in memory
+	Warm []string
+
+	// Cold are the sets that the server did not page in
+	Cold []string
+
+	// Missing are the sets that do not exist
+	Missing []string
+}
+
+// Warm is used to page the given sets into memory before a spike in
+// traffic. hlld has no dedicated command to page in a set, so an info
+// command is pipelined for each set, which pages in the set on servers
+// that load it to answer. Released servers may answer from the cached
+// metadata of a cold set instead, so the report lists the sets that
+// remain cold. The optional progress function is invoked as each set
+// completes with the number completed and the total.
+func (c *Client) Warm(names []string, progress func(done, total int)) (*WarmReport, error) {
+	cmds := make([]*InfoCommand, 0, len(names))
+	futures := make([]*Future, 0, len(names))
+	for _, name := range names {
+		cmd, err := NewInfoCommand(name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := c.Execute(cmd)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+		futures = append(futures, f)
+	}
+
+	report := &WarmReport{}
+	for idx, f := range futures {
+		if err := f.Error(); err != nil {
+			return nil, err
+		}
+		info, ok, err := cmds[idx].Result()
+		if err != nil {
+			return nil, err
+		}
+		name := cmds[idx].SetName
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, name)
+		case info.InMemory:
+			report.Warm = append(report.Warm, name)
+		default:
+			report.Cold = append(report.Cold, name)
+		}
+		if progress != nil {
+			progress(idx+1, len(futures))
+		}
+	}
+	return report, nil
+}
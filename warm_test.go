@@ -0,0 +1,47 @@
+package hlld
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClient_Warm(t *testing.T) {
+	addr, stop := testServer(t, func(conn int, line string) string {
+		switch line {
+		case "info foo\n":
+			return "START\nin_memory 1\nsize 10\nEND\n"
+		case "info bar\n":
+			return "START\nin_memory 0\nsize 20\nEND\n"
+		}
+		return "Set does not exist\n"
+	})
+	defer stop()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	var calls []int
+	report, err := client.Warm([]string{"foo", "bar", "baz"}, func(done, total int) {
+		if total != 3 {
+			t.Fatalf("bad: %d", total)
+		}
+		calls = append(calls, done)
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := &WarmReport{
+		Warm:    []string{"foo"},
+		Cold:    []string{"bar"},
+		Missing: []string{"baz"},
+	}
+	if !reflect.DeepEqual(report, expect) {
+		t.Fatalf("bad: %#v", report)
+	}
+	if !reflect.DeepEqual(calls, []int{1, 2, 3}) {
+		t.Fatalf("bad: %v", calls)
+	}
+}
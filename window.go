@@ -0,0 +1,201 @@
+package hlld
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlidingWindow is used to estimate the unique keys over a trailing
+// window of time. hlld cannot merge sets, so rather than querying the
+// union of disjoint buckets, each key is written to K overlapping bucket
+// sets. A bucket starts every window/K and receives keys for one window,
+// so the oldest active bucket always covers the trailing window to within
+// one step. Buckets are created as needed, and dropped by Expire once
+// their window has passed.
+//
+// Bucket sets are named after the window name and the Unix time the
+// bucket starts, such as "visitors-1400000000", so multiple processes
+// using the same window write to the same buckets.
+type SlidingWindow struct {
+	client  *Client
+	name    string
+	window  time.Duration
+	step    time.Duration
+	buckets int
+	opts    *CreateOptions
+
+	// now returns the current time, and can be replaced for testing
+	now func() time.Time
+
+	created     map[string]struct{}
+	createdLock sync.Mutex
+}
+
+// NewSlidingWindow creates a sliding window over the given duration
+// using the number of buckets, which trades writes for accuracy since
+// the trailing window is approximated to within window/buckets. The
+// create options of the buckets may be nil.
+func NewSlidingWindow(client *Client, name string, window time.Duration, buckets int, opts *CreateOptions) (*SlidingWindow, error) {
+	if !validWord.MatchString(name) {
+		return nil, invalidArg("set name", name)
+	}
+	if buckets < 1 {
+		return nil, fmt.Errorf("at least 1 bucket required")
+	}
+	step := window / time.Duration(buckets)
+	if step < time.Second || step%time.Second != 0 {
+		return nil, fmt.Errorf("window / buckets must be a whole number of seconds, got %v", step)
+	}
+	w := &SlidingWindow{
+		client:  client,
+		name:    name,
+		window:  window,
+		step:    step,
+		buckets: buckets,
+		opts:    opts,
+		now:     time.Now,
+		created: make(map[string]struct{}),
+	}
+	return w, nil
+}
+
+// active returns the names of the buckets receiving keys at the
+// given time, from the oldest to the newest
+func (w *SlidingWindow) active(t time.Time) []string {
+	newest := t.Truncate(w.step)
+	names := make([]string, w.buckets)
+	for idx := 0; idx < w.buckets; idx++ {
+		start := newest.Add(-time.Duration(w.buckets-1-idx) * w.step)
+		names[idx] = w.bucketName(start)
+	}
+	return names
+}
+
+// bucketName returns the name of the bucket starting at the given time
+func (w *SlidingWindow) bucketName(start time.Time) string {
+	return w.name + "-" + strconv.FormatInt(start.Unix(), 10)
+}
+
+// Add is used to add keys to every active bucket, creating
+// any buckets that have not been created yet
+func (w *SlidingWindow) Add(keys ...string) error {
+	names := w.active(w.now())
+	for _, name := range names {
+		if err := w.ensure(name); err != nil {
+			return err
+		}
+	}
+
+	// Pipeline the keys to every bucket
+	cmds := make([]*SetKeysCommand, len(names))
+	futures := make([]*Future, len(names))
+	for idx, name := range names {
+		cmd, err := NewSetKeysCommand(name, keys)
+		if err != nil {
+			return err
+		}
+		f, err := w.client.Execute(cmd)
+		if err != nil {
+			return err
+		}
+		cmds[idx] = cmd
+		futures[idx] = f
+	}
+	for idx, f := range futures {
+		if err := f.Error(); err != nil {
+			return err
+		}
+		ok, err := cmds[idx].Result()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// The bucket was dropped, create it again next time
+			w.createdLock.Lock()
+			delete(w.created, names[idx])
+			w.createdLock.Unlock()
+			return fmt.Errorf("bucket '%s' does not exist", names[idx])
+		}
+	}
+	return nil
+}
+
+// ensure is used to create a bucket if it has not been created
+func (w *SlidingWindow) ensure(name string) error {
+	w.createdLock.Lock()
+	_, ok := w.created[name]
+	w.createdLock.Unlock()
+	if ok {
+		return nil
+	}
+
+	ok, err := w.client.CreateSet(name, w.opts)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("bucket '%s' is being deleted", name)
+	}
+	w.createdLock.Lock()
+	w.created[name] = struct{}{}
+	w.createdLock.Unlock()
+	return nil
+}
+
+// Estimate returns the estimated unique keys over the trailing window,
+// using the oldest active bucket. If that bucket does not exist, no keys
+// were added since it started, and an estimate of zero is returned.
+func (w *SlidingWindow) Estimate() (*CardinalityEstimate, error) {
+	name := w.active(w.now())[0]
+	e, ok, err := w.client.Estimate(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &CardinalityEstimate{}, nil
+	}
+	return e, nil
+}
+
+// Expire is used to drop the buckets whose window has passed,
+// returning the number dropped
+func (w *SlidingWindow) Expire() (int, error) {
+	now := w.now()
+	var expired []string
+	prefix := w.name + "-"
+	err := w.client.ListAll(prefix, func(entries []*ListEntry) bool {
+		for _, e := range entries {
+			unix, err := strconv.ParseInt(strings.TrimPrefix(e.Name, prefix), 10, 64)
+			if err != nil {
+				continue
+			}
+			if !time.Unix(unix, 0).Add(w.window).After(now) {
+				expired = append(expired, e.Name)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, name := range expired {
+		cmd, err := NewDropCommand(name)
+		if err != nil {
+			return 0, err
+		}
+		if err := executeWait(w.client, cmd); err != nil {
+			return 0, err
+		}
+		if _, err := cmd.Result(); err != nil {
+			return 0, err
+		}
+		w.createdLock.Lock()
+		delete(w.created, name)
+		w.createdLock.Unlock()
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,185 @@
+package hlld
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// windowServer is used to fake the sets of a server for a sliding window
+func windowServer(t *testing.T) (string, func(), map[string]map[string]struct{}, *sync.Mutex) {
+	sets := make(map[string]map[string]struct{})
+	var lock sync.Mutex
+	addr, closer := testServer(t, func(conn int, line string) string {
+		lock.Lock()
+		defer lock.Unlock()
+		parts := strings.Fields(line)
+		switch parts[0] {
+		case "create":
+			if _, ok := sets[parts[1]]; !ok {
+				sets[parts[1]] = make(map[string]struct{})
+			}
+			return "Done\n"
+		case "b":
+			set, ok := sets[parts[1]]
+			if !ok {
+				return "Set does not exist\n"
+			}
+			for _, key := range parts[2:] {
+				set[key] = struct{}{}
+			}
+			return "Done\n"
+		case "info":
+			set, ok := sets[parts[1]]
+			if !ok {
+				return "Set does not exist\n"
+			}
+			return fmt.Sprintf("START\nsize %d\nEND\n", len(set))
+		case "list":
+			out := "START\n"
+			for name, set := range sets {
+				if strings.HasPrefix(name, parts[1]) {
+					out += fmt.Sprintf("%s 0.01 12 1 %d\n", name, len(set))
+				}
+			}
+			return out + "END\n"
+		case "drop":
+			delete(sets, parts[1])
+			return "Done\n"
+		}
+		return "Client Error: Command not supported\n"
+	})
+	return addr, closer, sets, &lock
+}
+
+func TestNewSlidingWindow_Invalid(t *testing.T) {
+	if _, err := NewSlidingWindow(nil, "bad name", time.Hour, 4, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := NewSlidingWindow(nil, "foo", time.Hour, 0, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := NewSlidingWindow(nil, "foo", 3*time.Second, 2, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := NewSlidingWindow(nil, "foo", time.Hour, 4, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	addr, closer, sets, lock := windowServer(t)
+	defer closer()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	w, err := NewSlidingWindow(client, "visits", time.Hour, 4, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	now := time.Unix(36000, 0)
+	w.now = func() time.Time { return now }
+
+	// Every active bucket gets the keys
+	if err := w.Add("a", "b"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock.Lock()
+	if len(sets) != 4 || len(sets["visits-36000"]) != 2 || len(sets["visits-33300"]) != 2 {
+		t.Fatalf("bad: %v", sets)
+	}
+	lock.Unlock()
+
+	// Moving a step forward starts a new bucket
+	now = now.Add(15 * time.Minute)
+	if err := w.Add("c"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock.Lock()
+	if len(sets) != 5 || len(sets["visits-36900"]) != 1 {
+		t.Fatalf("bad: %v", sets)
+	}
+	lock.Unlock()
+
+	// The oldest active bucket covers the window
+	size, err := w.Estimate()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if size.Size != 3 {
+		t.Fatalf("bad: %v", size)
+	}
+
+	// The first bucket has expired
+	n, err := w.Expire()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("bad: %v", n)
+	}
+	lock.Lock()
+	if _, ok := sets["visits-33300"]; ok || len(sets) != 4 {
+		t.Fatalf("bad: %v", sets)
+	}
+	lock.Unlock()
+
+	// After a quiet window, nothing remains
+	now = now.Add(2 * time.Hour)
+	size, err = w.Estimate()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if size.Size != 0 {
+		t.Fatalf("bad: %v", size)
+	}
+	n, err = w.Expire()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n != 4 {
+		t.Fatalf("bad: %v", n)
+	}
+}
+
+func TestSlidingWindow_Recreate(t *testing.T) {
+	addr, closer, sets, lock := windowServer(t)
+	defer closer()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	w, err := NewSlidingWindow(client, "visits", time.Minute, 1, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	w.now = func() time.Time { return time.Unix(600, 0) }
+	if err := w.Add("a"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Dropping the bucket behind our back fails once, then recreates
+	lock.Lock()
+	delete(sets, "visits-600")
+	lock.Unlock()
+	if err := w.Add("b"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := w.Add("b"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(sets["visits-600"]) != 1 {
+		t.Fatalf("bad: %v", sets)
+	}
+}
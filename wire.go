@@ -0,0 +1,157 @@
+package hlld
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+)
+
+// wireAppender is implemented by commands that can append their
+// wire form without an intermediate writer
+type wireAppender interface {
+	AppendWire(b []byte) []byte
+}
+
+// AppendWire is used to append the wire form of any command, including
+// the trailing newline. This allows proxies and spoolers to log, hash or
+// forward a command without a connection. Commands of this package are
+// appended directly, and other commands are encoded through a buffer.
+func AppendWire(b []byte, cmd Command) ([]byte, error) {
+	if a, ok := cmd.(wireAppender); ok {
+		return a.AppendWire(b), nil
+	}
+	buf := bytes.NewBuffer(b)
+	bufW := bufio.NewWriter(buf)
+	if err := cmd.Encode(bufW); err != nil {
+		return b, err
+	}
+	if err := bufW.Flush(); err != nil {
+		return b, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AppendWire appends the wire form of the command
+func (c *CreateCommand) AppendWire(b []byte) []byte {
+	b = append(b, "create "...)
+	b = append(b, c.wireName()...)
+	if c.Precision != 0 {
+		b = append(b, " precision="...)
+		b = strconv.AppendInt(b, int64(c.Precision), 10)
+	}
+	if c.ErrThreshold != 0 {
+		b = append(b, " eps="...)
+		b = append(b, c.formatEps()...)
+	}
+	if c.InMemory {
+		b = append(b, " in_memory=true"...)
+	}
+	return append(b, '\n')
+}
+
+// String returns the wire form of the command, without the newline
+func (c *CreateCommand) String() string {
+	return wireString(c.AppendWire(nil))
+}
+
+// AppendWire appends the wire form of the command
+func (c *ListCommand) AppendWire(b []byte) []byte {
+	b = append(b, "list"...)
+	if prefix := c.wirePrefix(); prefix != "" {
+		b = append(b, ' ')
+		b = append(b, prefix...)
+	}
+	return append(b, '\n')
+}
+
+// String returns the wire form of the command, without the newline
+func (c *ListCommand) String() string {
+	return wireString(c.AppendWire(nil))
+}
+
+// AppendWire appends the wire form of the command
+func (c *SetCommand) AppendWire(b []byte) []byte {
+	b = append(b, c.Command...)
+	b = append(b, ' ')
+	b = append(b, c.wireName()...)
+	return append(b, '\n')
+}
+
+// String returns the wire form of the command, without the newline
+func (c *SetCommand) String() string {
+	return wireString(c.AppendWire(nil))
+}
+
+// AppendWire appends the wire form of the command
+func (c *SetKeysCommand) AppendWire(b []byte) []byte {
+	b = append(b, "b "...)
+	b = append(b, c.wireName()...)
+	for _, key := range c.Keys {
+		b = append(b, ' ')
+		b = append(b, key...)
+	}
+	return append(b, '\n')
+}
+
+// String returns the wire form of the command, without the newline
+func (c *SetKeysCommand) String() string {
+	return wireString(c.AppendWire(nil))
+}
+
+// AppendWire appends the wire form of the command
+func (c *SetKeyCommand) AppendWire(b []byte) []byte {
+	b = append(b, "s "...)
+	b = append(b, c.wireName()...)
+	b = append(b, ' ')
+	b = append(b, c.Key...)
+	return append(b, '\n')
+}
+
+// String returns the wire form of the command, without the newline
+func (c *SetKeyCommand) String() string {
+	return wireString(c.AppendWire(nil))
+}
+
+// AppendWire appends the wire form of the command
+func (c *FlushCommand) AppendWire(b []byte) []byte {
+	b = append(b, "flush"...)
+	if c.SetName != "" {
+		b = append(b, ' ')
+		b = append(b, c.wireName()...)
+	}
+	return append(b, '\n')
+}
+
+// String returns the wire form of the command, without the newline
+func (c *FlushCommand) String() string {
+	return wireString(c.AppendWire(nil))
+}
+
+// AppendWire appends the wire form of the command
+func (c *InfoCommand) AppendWire(b []byte) []byte {
+	b = append(b, "info "...)
+	b = append(b, c.wireName()...)
+	return append(b, '\n')
+}
+
+// String returns the wire form of the command, without the newline
+func (c *InfoCommand) String() string {
+	return wireString(c.AppendWire(nil))
+}
+
+// AppendWire appends the wire form of the command
+func (c *RawCommand) AppendWire(b []byte) []byte {
+	b = append(b, c.Line...)
+	return append(b, '\n')
+}
+
+// String returns the wire form of the command, without the newline
+func (c *RawCommand) String() string {
+	return c.Line
+}
+
+// wireString is used to convert a wire form to a string,
+// stripping the trailing newline
+func wireString(b []byte) string {
+	return string(b[:len(b)-1])
+}
@@ -0,0 +1,64 @@
+package hlld
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// wireCommands returns a command of each type
+func wireCommands(t *testing.T) []Command {
+	create, _ := NewCreateCommand("foo")
+	create.Precision = 14
+	create.ErrThreshold = 0.01
+	create.InMemory = true
+	list, _ := NewListCommand("foo")
+	all, _ := NewListCommand("")
+	drop, _ := NewDropCommand("foo")
+	set, _ := NewSetKeysCommand("foo", []string{"a", "b"})
+	single, _ := NewSetKeyCommand("foo", "a")
+	flush, _ := NewFlushCommand("")
+	info, _ := NewInfoCommand("foo")
+	raw, err := NewRawCommand("stats")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return []Command{create, list, all, drop, set, single, flush, info, raw}
+}
+
+func TestAppendWire_MatchesEncode(t *testing.T) {
+	for _, cmd := range wireCommands(t) {
+		var buf bytes.Buffer
+		bufW := bufio.NewWriter(&buf)
+		if err := cmd.Encode(bufW); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		bufW.Flush()
+
+		out, err := AppendWire([]byte("> "), cmd)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if string(out) != "> "+buf.String() {
+			t.Fatalf("bad: %q %q", out, buf.String())
+		}
+
+		str := fmt.Sprint(cmd)
+		if str+"\n" != buf.String() {
+			t.Fatalf("bad: %q", str)
+		}
+	}
+}
+
+func TestAppendWire_Fallback(t *testing.T) {
+	// Embedding the interface hides the AppendWire method
+	drop, _ := NewDropCommand("foo")
+	out, err := AppendWire(nil, struct{ Command }{drop})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(out) != "drop foo\n" {
+		t.Fatalf("bad: %q", out)
+	}
+}